@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,8 +14,13 @@ import (
 
 	"github.com/ncecere/rummage/pkg/api"
 	"github.com/ncecere/rummage/pkg/config"
+	"github.com/ncecere/rummage/pkg/webhook"
 )
 
+// writeTimeout bounds writing a response, except for responses the API holds
+// open, such as a waiting batch scrape, which move their own deadline.
+const writeTimeout = 15 * time.Second
+
 func main() {
 	// Load configuration
 	cfg, err := config.LoadConfig()
@@ -22,21 +28,75 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Log as JSON at the configured level; the standard logger writes
+	// through it too
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	slog.SetDefault(logger)
+
+	// Webhooks may only reach internal addresses when explicitly allowed
+	webhook.AllowPrivateNetworks(cfg.WebhookAllowPrivateNetworks)
+
 	// Initialize the API router
 	router, err := api.NewRouter(api.RouterOptions{
 		BaseURL:  cfg.BaseURL,
 		RedisURL: cfg.RedisURL,
+
+		MaxRequestTimeout: cfg.MaxRequestTimeout,
+		UserAgent:         cfg.UserAgent,
+		ImageHandling:     cfg.ImageHandling,
+		Soft404Patterns:   cfg.Soft404Patterns,
+		RawContentTypes:   cfg.RawContentTypes,
+		PaywallMarkers:    cfg.PaywallMarkers,
+		MaxResponseBytes:  cfg.MaxResponseBytes,
+		GlobalRPS:         cfg.GlobalRPS,
+		BrowserPath:       cfg.BrowserPath,
+
+		MaxScreenshotBytes: cfg.MaxScreenshotBytes,
+		ProxyURL:           cfg.ProxyURL,
+
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		DisableKeepAlives:     cfg.DisableKeepAlives,
+		HostHeaders:           cfg.HostHeaders,
+		MaxSitemapConcurrency: cfg.MaxSitemapConcurrency,
+		MaxConcurrentJobs:     cfg.MaxConcurrentJobs,
+		Parallelism:           cfg.Parallelism,
+		DomainDelay:           cfg.DomainDelay,
+
+		ExportCredentials: cfg.ExportCredentials,
+		WebhookSecret:     cfg.WebhookSecret,
+		AdminToken:        cfg.AdminToken,
+		EnablePprof:       cfg.EnablePprof,
+
+		APIKeys:     cfg.APIKeys,
+		DisableAuth: cfg.DisableAuth,
+
+		RequestsPerMinute:    cfg.RequestsPerMinute,
+		KeyRequestsPerMinute: cfg.KeyRequestsPerMinute,
+		RateLimitBackend:     cfg.RateLimitBackend,
+
+		CORSOrigins: cfg.CORSOrigins,
+		Logger:      logger,
+
+		WriteTimeout:    writeTimeout,
+		ShutdownTimeout: cfg.ShutdownTimeout,
+
+		LLMBaseURL: cfg.LLMBaseURL,
+		LLMAPIKey:  cfg.LLMAPIKey,
+		LLMModel:   cfg.LLMModel,
 	})
 	if err != nil {
 		log.Fatalf("Failed to initialize router: %v", err)
 	}
+	if len(cfg.APIKeys) == 0 || cfg.DisableAuth {
+		log.Printf("API key authentication is off; anyone who can reach the server can use the API")
+	}
 
 	// Configure the server
 	server := &http.Server{
 		Addr:         ":" + cfg.Port,
 		Handler:      router,
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: writeTimeout,
 		IdleTimeout:  60 * time.Second,
 	}
 
@@ -66,9 +126,22 @@ func main() {
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
 
-		// Gracefully shutdown the server
+		// Gracefully shutdown the server, but stop jobs and close Redis
+		// even if it doesn't finish in time
+		failed := false
 		if err := server.Shutdown(ctx); err != nil {
-			log.Fatalf("Could not stop server gracefully: %v", err)
+			log.Printf("Could not stop server gracefully: %v", err)
+			failed = true
+		}
+
+		// Let running jobs store their results before closing Redis; the
+		// router bounds this with its own shutdown timeout
+		if err := router.Close(context.Background()); err != nil {
+			log.Printf("Could not drain jobs before shutdown: %v", err)
+		}
+
+		if failed {
+			os.Exit(1)
 		}
 	}
 
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"net/http"
+)
+
+// handlePrune deletes crawl keys left behind by expired jobs.
+func (r *Router) handlePrune(w http.ResponseWriter, req *http.Request) {
+	resp, err := r.storage.PruneOrphanedKeys()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to prune keys: "+err.Error())
+		return
+	}
+
+	respondSuccess(w, resp)
+}
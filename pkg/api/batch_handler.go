@@ -2,10 +2,23 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+const (
+	// maxWaitBatchURLs caps the URLs a batch may hold the response for.
+	maxWaitBatchURLs = 10
+	// defaultWaitBatchTimeoutMS bounds a waiting batch that doesn't set
+	// waitTimeoutMs.
+	defaultWaitBatchTimeoutMS = 60000
+	// writeDeadlineMargin is left after a held response's wait for writing it.
+	writeDeadlineMargin = 5 * time.Second
 )
 
 // handleBatchScrape handles requests to scrape multiple URLs.
@@ -16,8 +29,30 @@ func (r *Router) handleBatchScrape(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Validate the request, reporting every problem at once
+	var v validator
+	if len(batchReq.URLs) == 0 {
+		v.add("urls", "at least one URL is required")
+	}
+	if batchReq.Wait && len(batchReq.URLs) > maxWaitBatchURLs {
+		v.add("urls", fmt.Sprintf("wait allows at most %d URLs; poll the job for larger batches", maxWaitBatchURLs))
+	}
+	if batchReq.WaitTimeoutMS < 0 {
+		v.add("waitTimeoutMs", "waitTimeoutMs must not be negative")
+	}
+	v.scrapeOptions("", batchReq.ScrapeOptions)
+	v.webhook(batchReq.Webhook)
+	if v.respond(w) {
+		return
+	}
+
+	// Capture the headers to forward to the webhook before the request ends
+	if batchReq.Webhook != nil {
+		batchReq.Webhook.CaptureHeaders(req.Header)
+	}
+
 	// Validate URLs
-	validURLs, invalidURLs, err := r.scraper.BatchScrape(batchReq)
+	validURLs, invalidURLs, duplicateURLs, err := r.scraper.BatchScrape(batchReq)
 	if err != nil && !batchReq.IgnoreInvalidURLs {
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
@@ -31,14 +66,67 @@ func (r *Router) handleBatchScrape(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Start processing in background
-	go r.scraper.ProcessBatchJob(jobID, validURLs, batchReq, r.storage.UpdateBatchJob)
+	done := make(chan struct{})
+	r.goJob(func() {
+		defer close(done)
+		r.scraper.ProcessBatchJob(jobID, validURLs, batchReq, r.storage.UpdateBatchJob)
+	})
+
+	resp := model.BatchScrapeResponse{
+		ID:            jobID,
+		URL:           r.baseURL + "/v1/batch/scrape/" + jobID,
+		InvalidURLs:   invalidURLs,
+		DuplicateURLs: duplicateURLs,
+	}
+
+	// Hold the response for small batches that asked to wait; one that runs
+	// too long keeps going and is polled like any other
+	if batchReq.Wait {
+		timeoutMS, warning := utils.ResolveTimeout(batchReq.WaitTimeoutMS, defaultWaitBatchTimeoutMS, r.scraper.MaxTimeoutMS())
+		resp.Warning = warning
+
+		// Outlast the server's write timeout while waiting
+		timeout, holdWarning := r.holdResponse(w, time.Duration(timeoutMS)*time.Millisecond)
+		if holdWarning != "" {
+			if resp.Warning != "" {
+				resp.Warning += "; "
+			}
+			resp.Warning += holdWarning
+		}
+
+		select {
+		case <-done:
+			job, err := r.storage.GetBatchJob(jobID)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, "Failed to get batch job: "+err.Error())
+				return
+			}
+			resp.Job = job
+		case <-time.After(timeout):
+			if resp.Warning != "" {
+				resp.Warning += "; "
+			}
+			resp.Warning += fmt.Sprintf("batch did not finish within %dms; poll url for its results", timeout.Milliseconds())
+		case <-req.Context().Done():
+			return
+		}
+	}
 
 	// Return job ID and status URL
-	respondSuccess(w, model.BatchScrapeResponse{
-		ID:          jobID,
-		URL:         r.baseURL + "/v1/batch/scrape/" + jobID,
-		InvalidURLs: invalidURLs,
-	})
+	respondSuccess(w, resp)
+}
+
+// holdResponse moves the response's write deadline past the server's write
+// timeout so it can be held for wait. When the deadline can't be moved, the
+// wait is shortened to fit within the write timeout, with a warning.
+func (r *Router) holdResponse(w http.ResponseWriter, wait time.Duration) (time.Duration, string) {
+	err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + writeDeadlineMargin))
+	if err == nil || r.writeTimeout <= 0 || wait <= r.writeTimeout-writeDeadlineMargin {
+		return wait, ""
+	}
+
+	wait = max(r.writeTimeout-writeDeadlineMargin, 0)
+	return wait, fmt.Sprintf("wait shortened to %dms by the server's write timeout", wait.Milliseconds())
 }
 
 // handleGetBatchStatus handles requests to get the status of a batch job.
@@ -61,3 +149,26 @@ func (r *Router) handleGetBatchStatus(w http.ResponseWriter, req *http.Request)
 	// Return status
 	respondSuccess(w, status)
 }
+
+// handleCancelBatch handles requests to cancel a batch job.
+func (r *Router) handleCancelBatch(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+
+	if jobID == "" {
+		respondError(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	// Mark the job cancelled first so no late result marks it completed
+	if err := r.storage.CancelBatchJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, "Job not found: "+err.Error())
+		return
+	}
+
+	// Stop the job if it is still running
+	r.scraper.CancelBatchJob(jobID)
+
+	// Return status
+	respondSuccess(w, map[string]string{"status": "cancelled"})
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ncecere/rummage/pkg/crawler"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/scraper"
+)
+
+// storageBackend names the store used for job state and results.
+const storageBackend = "redis"
+
+// handleCapabilities reports the formats, backends and defaults of this deployment.
+func (r *Router) handleCapabilities(w http.ResponseWriter, req *http.Request) {
+	respondSuccess(w, model.CapabilitiesResponse{
+		Formats:        r.scraper.Formats(),
+		Browser:        r.scraper.HasBrowser(),
+		StorageBackend: storageBackend,
+		Defaults: model.CapabilitiesDefaults{
+			TimeoutMS:     scraper.DefaultTimeoutMS,
+			MaxTimeoutMS:  r.scraper.MaxTimeoutMS(),
+			CrawlLimit:    crawler.DefaultCrawlLimit,
+			CrawlMaxDepth: crawler.DefaultMaxDepth,
+			MapLimit:      crawler.DefaultMapLimit,
+			GlobalRPS:     r.limiter.Stats().Limit,
+			ImageHandling: r.scraper.ImageHandling(),
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/scraper"
+)
+
+func TestHandleCapabilities(t *testing.T) {
+	// A deployment without a browser backend
+	r := &Router{scraper: scraper.NewService()}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/capabilities", nil)
+	rr := httptest.NewRecorder()
+
+	r.handleCapabilities(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	var resp struct {
+		Success bool                       `json:"success"`
+		Data    model.CapabilitiesResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Data.Browser {
+		t.Error("Expected no browser backend to be reported")
+	}
+	for _, format := range resp.Data.Formats {
+		if format == "screenshot" {
+			t.Error("Expected screenshot to be absent without a browser backend")
+		}
+	}
+	if len(resp.Data.Formats) == 0 || resp.Data.Formats[0] != "markdown" {
+		t.Errorf("Expected markdown to be listed first, got %v", resp.Data.Formats)
+	}
+	if resp.Data.StorageBackend != "redis" {
+		t.Errorf("Expected storage backend 'redis', got '%s'", resp.Data.StorageBackend)
+	}
+	if resp.Data.Defaults.TimeoutMS != scraper.DefaultTimeoutMS {
+		t.Errorf("Expected default timeout %d, got %d", scraper.DefaultTimeoutMS, resp.Data.Defaults.TimeoutMS)
+	}
+}
@@ -1,13 +1,27 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/ncecere/rummage/pkg/export"
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
 )
 
+// defaultErrorsPageSize is the number of crawl errors returned when no limit is given.
+const defaultErrorsPageSize = 100
+
+// defaultResultsPageSize is the number of crawl results returned when no limit is given.
+const defaultResultsPageSize = 100
+
+// downloadPageSize is the number of crawl results read from Redis at a time
+// while a download archive is written.
+const downloadPageSize = 100
+
 // handleCrawl handles requests to crawl a website and its subpages.
 func (r *Router) handleCrawl(w http.ResponseWriter, req *http.Request) {
 	var crawlReq model.CrawlRequest
@@ -16,31 +30,87 @@ func (r *Router) handleCrawl(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Validate URL
+	// Validate the request, reporting every problem at once
+	var v validator
 	if crawlReq.URL == "" {
-		respondError(w, http.StatusBadRequest, "URL is required")
+		v.add("url", "URL is required")
+	}
+	v.check("", crawlReq.Validate())
+	v.paths(crawlReq.PathMatching, crawlReq.IncludePaths, crawlReq.ExcludePaths)
+	v.filterExpression("filterExpression", crawlReq.FilterExpression)
+	if crawlReq.Parallelism < 0 {
+		v.add("parallelism", "parallelism must not be negative")
+	}
+	if opts := crawlReq.ScrapeOptions; opts != nil {
+		if opts.Delay < 0 {
+			v.add("scrapeOptions.delay", "delay must not be negative")
+		}
+		if opts.RandomDelay < 0 {
+			v.add("scrapeOptions.randomDelay", "randomDelay must not be negative")
+		}
+		v.scrapeOptions("scrapeOptions.", opts.ScrapeOptions)
+	}
+	v.webhook(crawlReq.Webhook)
+	if v.respond(w) {
 		return
 	}
 
+	// Capture the headers to forward to the webhook before the request ends
+	if crawlReq.Webhook != nil {
+		crawlReq.Webhook.CaptureHeaders(req.Header)
+	}
+
+	// Check the seed before creating a job that would immediately fail
+	if crawlReq.ShouldValidateSeed() {
+		if !utils.IsValidURL(crawlReq.URL) {
+			respondError(w, http.StatusBadRequest, "Invalid URL: "+crawlReq.URL)
+			return
+		}
+		if err := r.crawler.ValidateSeed(crawlReq); err != nil {
+			respondError(w, http.StatusBadGateway, "Seed validation failed: "+err.Error())
+			return
+		}
+	}
+
+	// Check the destination before any pages are scraped
+	if crawlReq.Destination != nil {
+		if err := r.crawler.ValidateDestination(*crawlReq.Destination); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid destination: "+err.Error())
+			return
+		}
+	}
+
+	// Create the crawl job and start it
+	response, err := r.startCrawl(crawlReq)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to start crawl: "+err.Error())
+		return
+	}
+
+	// Return job ID and status URL
+	respondSuccess(w, response)
+}
+
+// startCrawl creates and stores a crawl job, then processes it in the
+// background.
+func (r *Router) startCrawl(crawlReq model.CrawlRequest) (*model.CrawlResponse, error) {
 	// Create crawl job
 	response, jobID, err := r.crawler.Crawl(crawlReq)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create crawl job: "+err.Error())
-		return
+		return nil, fmt.Errorf("failed to create crawl job: %w", err)
 	}
 
 	// Store job in Redis
-	_, err = r.storage.CreateCrawlJob(jobID, crawlReq)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to store crawl job: "+err.Error())
-		return
+	if _, err := r.storage.CreateCrawlJob(jobID, crawlReq); err != nil {
+		return nil, fmt.Errorf("failed to store crawl job: %w", err)
 	}
 
 	// Start processing in background
-	go r.crawler.ProcessCrawlJob(jobID, crawlReq)
+	r.goJob(func() {
+		r.crawler.ProcessCrawlJob(context.Background(), jobID, crawlReq)
+	})
 
-	// Return job ID and status URL
-	respondSuccess(w, response)
+	return response, nil
 }
 
 // handleGetCrawlStatus handles requests to get the status of a crawl job.
@@ -53,6 +123,18 @@ func (r *Router) handleGetCrawlStatus(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	// Parse pagination
+	skip, err := queryInt(req, "skip", 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(req, "limit", defaultResultsPageSize)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Get job status
 	status, err := r.storage.GetCrawlJob(jobID)
 	if err != nil {
@@ -60,10 +142,27 @@ func (r *Router) handleGetCrawlStatus(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	// Get the requested page of results
+	status.Data, err = r.storage.GetCrawlResults(jobID, skip, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get results: "+err.Error())
+		return
+	}
+	status.Next = nextCrawlPage(r.baseURL, jobID, skip, limit, status.Completed)
+
 	// Return status
 	respondSuccess(w, status)
 }
 
+// nextCrawlPage returns the status URL for the page of results after the one
+// at skip, or an empty string when that page holds the last of the results.
+func nextCrawlPage(baseURL, jobID string, skip, limit, completed int) string {
+	if limit <= 0 || skip+limit >= completed {
+		return ""
+	}
+	return fmt.Sprintf("%s/v1/crawl/%s?skip=%d&limit=%d", baseURL, jobID, skip+limit, limit)
+}
+
 // handleCancelCrawl handles requests to cancel a crawl job.
 func (r *Router) handleCancelCrawl(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
@@ -74,12 +173,13 @@ func (r *Router) handleCancelCrawl(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Cancel job
+	// Mark the job cancelled, then stop it if it is still running
 	err := r.storage.CancelCrawlJob(jobID)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to cancel job: "+err.Error())
 		return
 	}
+	_ = r.crawler.CancelCrawl(jobID)
 
 	// Return status
 	respondSuccess(w, map[string]string{"status": "cancelled"})
@@ -95,8 +195,20 @@ func (r *Router) handleGetCrawlErrors(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	// Parse pagination
+	skip, err := queryInt(req, "skip", 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(req, "limit", defaultErrorsPageSize)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Get errors
-	errors, err := r.storage.GetCrawlErrors(jobID)
+	errors, err := r.storage.GetCrawlErrors(jobID, skip, limit)
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to get errors: "+err.Error())
 		return
@@ -105,3 +217,49 @@ func (r *Router) handleGetCrawlErrors(w http.ResponseWriter, req *http.Request)
 	// Return errors
 	respondSuccess(w, errors)
 }
+
+// handleDownloadCrawl streams a crawl's results as a ZIP archive of markdown
+// files.
+func (r *Router) handleDownloadCrawl(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	jobID := vars["id"]
+
+	if jobID == "" {
+		respondError(w, http.StatusBadRequest, "Job ID is required")
+		return
+	}
+
+	// Check the job exists before reading its results
+	if _, err := r.storage.GetCrawlJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, "Job not found: "+err.Error())
+		return
+	}
+
+	// Read the first page of results before committing to a response
+	results, err := r.storage.GetCrawlResults(jobID, 0, downloadPageSize)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get results: "+err.Error())
+		return
+	}
+
+	// Stream the archive a page of results at a time; errors past this point
+	// can't change the status
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="crawl-%s.zip"`, jobID))
+	archive := export.NewMarkdownArchive(w)
+	for skip := 0; ; {
+		if err := archive.Add(results...); err != nil {
+			return
+		}
+		if len(results) < downloadPageSize {
+			break
+		}
+
+		skip += len(results)
+		results, err = r.storage.GetCrawlResults(jobID, skip, downloadPageSize)
+		if err != nil {
+			return
+		}
+	}
+	_ = archive.Close()
+}
@@ -0,0 +1,29 @@
+package api
+
+import "testing"
+
+func TestNextCrawlPage(t *testing.T) {
+	tests := []struct {
+		name      string
+		skip      int
+		limit     int
+		completed int
+		want      string
+	}{
+		{name: "First page", skip: 0, limit: 100, completed: 250, want: "http://localhost:8080/v1/crawl/job-1?skip=100&limit=100"},
+		{name: "Middle page", skip: 100, limit: 100, completed: 250, want: "http://localhost:8080/v1/crawl/job-1?skip=200&limit=100"},
+		{name: "Last partial page", skip: 200, limit: 100, completed: 250, want: ""},
+		{name: "Exactly the last page", skip: 150, limit: 100, completed: 250, want: ""},
+		{name: "No limit", skip: 0, limit: 0, completed: 250, want: ""},
+		{name: "No results", skip: 0, limit: 100, completed: 0, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextCrawlPage("http://localhost:8080", "job-1", tt.skip, tt.limit, tt.completed)
+			if got != tt.want {
+				t.Errorf("Expected next %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
 )
 
 // handleMap handles requests to map a website's URLs.
@@ -15,9 +16,31 @@ func (r *Router) handleMap(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Validate URL
+	// Validate the request, reporting every problem at once
+	var v validator
 	if mapReq.URL == "" {
-		respondError(w, http.StatusBadRequest, "URL is required")
+		v.add("url", "URL is required")
+	} else if !utils.IsValidURL(mapReq.URL) {
+		v.add("url", "URL must be absolute")
+	}
+	if mapReq.Limit < 0 {
+		v.add("limit", "limit must not be negative")
+	}
+	if mapReq.MaxDepth < 0 {
+		v.add("maxDepth", "maxDepth must not be negative")
+	}
+	v.paths(mapReq.PathMatching, mapReq.IncludePaths, mapReq.ExcludePaths)
+	v.filterExpression("filterExpression", mapReq.FilterExpression)
+	if mapReq.Parallelism < 0 {
+		v.add("parallelism", "parallelism must not be negative")
+	}
+	if mapReq.Delay < 0 {
+		v.add("delay", "delay must not be negative")
+	}
+	if mapReq.RandomDelay < 0 {
+		v.add("randomDelay", "randomDelay must not be negative")
+	}
+	if v.respond(w) {
 		return
 	}
 
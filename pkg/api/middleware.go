@@ -0,0 +1,401 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/ratelimit"
+)
+
+// gzipMinSize is the response size in bytes above which responses are compressed.
+const gzipMinSize = 1024
+
+// gzipResponseWriter buffers a response until it is large enough to be worth
+// compressing, then switches to writing through a gzip writer.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz         *gzip.Writer
+	buf        bytes.Buffer
+	statusCode int
+}
+
+// WriteHeader records the status code until the encoding has been decided.
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+// Write buffers small payloads and compresses once the threshold is exceeded.
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+
+	w.buf.Write(p)
+	if w.buf.Len() < gzipMinSize {
+		return len(p), nil
+	}
+
+	if err := w.startGzip(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// startGzip sends the headers and switches to compressed output, writing
+// what has been buffered so far through the gzip writer.
+func (w *gzipResponseWriter) startGzip() error {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.ResponseWriter.WriteHeader(w.status())
+
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	w.buf.Reset()
+	return nil
+}
+
+// Flush sends the output written so far, so streamed responses keep flowing.
+// A response still below the threshold is compressed from this point on.
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil {
+		if err := w.startGzip(); err != nil {
+			return
+		}
+	}
+	_ = w.gz.Flush()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// handlers can still move the write deadline of a compressed response.
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close flushes any pending output, compressed or not.
+func (w *gzipResponseWriter) close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+
+	w.ResponseWriter.WriteHeader(w.status())
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// status returns the recorded status code, defaulting to 200.
+func (w *gzipResponseWriter) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// gzipMiddleware compresses large responses for clients that accept gzip.
+func gzipMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		if !strings.Contains(req.Header.Get("Accept-Encoding"), "gzip") {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer func() {
+			_ = gw.close()
+		}()
+
+		next.ServeHTTP(gw, req)
+	})
+}
+
+// apiKeyAuth only lets through requests bearing one of keys in the
+// Authorization header.
+func apiKeyAuth(keys []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			given := bearerToken(req)
+			if given == "" {
+				respondError(w, http.StatusUnauthorized, "Missing API key; send it as Authorization: Bearer <key>")
+				return
+			}
+
+			// Compare against every key so timing doesn't reveal which matched
+			valid := 0
+			for _, key := range keys {
+				valid |= subtle.ConstantTimeCompare([]byte(given), []byte(key))
+			}
+			if valid != 1 {
+				respondError(w, http.StatusUnauthorized, "Invalid API key")
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// bearerToken returns the token from the request's Authorization header, or
+// "" when it carries none.
+func bearerToken(req *http.Request) string {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return token
+}
+
+// rateLimit answers requests over the global per-minute limit, or over the
+// per-key limit for the request's API key, with a 429 and a Retry-After
+// header. A zero limit is not enforced.
+func rateLimit(take ratelimit.TakeFunc, perMinute, perKeyPerMinute int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// A key over its own limit doesn't use up the global one
+			if key := bearerToken(req); key != "" && perKeyPerMinute > 0 {
+				sum := sha256.Sum256([]byte(key))
+				if !takeToken(w, take, "key:"+hex.EncodeToString(sum[:16]), perKeyPerMinute) {
+					return
+				}
+			}
+			if perMinute > 0 && !takeToken(w, take, "global", perMinute) {
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// takeToken takes a token from the named bucket, answering the request with a
+// 429 when none is left. Requests go ahead when the limiter fails, so its
+// outage doesn't take the API down with it.
+func takeToken(w http.ResponseWriter, take ratelimit.TakeFunc, bucket string, perMinute int) bool {
+	allowed, retryAfter, err := take(bucket, perMinute)
+	if err != nil {
+		log.Printf("rate limiter unavailable, letting request through: %v", err)
+		return true
+	}
+	if allowed {
+		return true
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondError(w, http.StatusTooManyRequests, fmt.Sprintf("Rate limit exceeded; retry in %d seconds", seconds))
+	return false
+}
+
+// corsMethods and corsHeaders are what browsers may use in cross-origin
+// requests to the API.
+const (
+	corsMethods = "GET, POST, DELETE, OPTIONS"
+	corsHeaders = "Authorization, Content-Type"
+)
+
+// corsMiddleware lets browsers on the allowed origins call the API, answering
+// their preflight requests. An origin of * allows any. Requests from other
+// origins get no CORS headers, so browsers refuse them, and their preflights
+// are refused with a 403.
+func corsMiddleware(origins []string) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			origin := req.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+			if !allowed[origin] && !allowed["*"] {
+				if preflight {
+					respondError(w, http.StatusForbidden, "Origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, req)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "Retry-After")
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+				w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+				w.Header().Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+// adminAuth only lets through requests bearing token in the Authorization
+// header. With no token configured, admin endpoints are disabled.
+func adminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if token == "" {
+				respondError(w, http.StatusForbidden, "Admin endpoints are disabled; set admin.token to enable them")
+				return
+			}
+
+			given := bearerToken(req)
+			if given == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+				respondError(w, http.StatusUnauthorized, "Invalid admin token")
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
+
+const (
+	// requestIDHeader carries the ID tying a request to its log entry.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength caps the request IDs accepted from clients.
+	maxRequestIDLength = 128
+)
+
+// requestIDKey is the context key holding the request ID.
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request ctx belongs to, or "" outside a
+// request.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// usableRequestID reports whether a client's request ID can be logged and
+// echoed as is: printable ASCII without spaces, of a reasonable length.
+func usableRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// loggingResponseWriter records the status and size of a response as it is
+// written.
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+}
+
+// WriteHeader records the status code before sending it.
+func (w *loggingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write counts the bytes written.
+func (w *loggingResponseWriter) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes flushes through, so streamed responses keep flowing.
+func (w *loggingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestLogger logs each request once it is answered, with its method, path,
+// status, duration and the bytes written. Every request gets an ID, kept from
+// its X-Request-ID header when usable, which is put in its context and
+// returned in the X-Request-ID response header. Server errors are logged at
+// error level, everything else at info.
+func requestLogger(logger *slog.Logger) func(http.Handler) http.Handler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+
+			id := req.Header.Get(requestIDHeader)
+			if !usableRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(requestIDHeader, id)
+
+			lw := &loggingResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(lw, req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id)))
+
+			status := lw.statusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(req.Context(), level, "request",
+				slog.String("requestId", id),
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", status),
+				slog.Int64("durationMs", time.Since(start).Milliseconds()),
+				slog.Int64("bytes", lw.bytes),
+			)
+		})
+	}
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat("rummage ", 1000)
+
+	tests := []struct {
+		name           string
+		body           string
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{
+			name:           "Large response with gzip accepted",
+			body:           large,
+			acceptEncoding: "gzip, deflate",
+			wantGzip:       true,
+		},
+		{
+			name:           "Small response with gzip accepted",
+			body:           "ok",
+			acceptEncoding: "gzip",
+			wantGzip:       false,
+		},
+		{
+			name:           "Large response without gzip accepted",
+			body:           large,
+			acceptEncoding: "",
+			wantGzip:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := gzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			// Check status code is preserved
+			if rr.Code != http.StatusCreated {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+			}
+
+			// Check Vary header
+			if vary := rr.Header().Get("Vary"); vary != "Accept-Encoding" {
+				t.Errorf("Expected Vary header 'Accept-Encoding', got '%s'", vary)
+			}
+
+			gotGzip := rr.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("Expected gzip %v, got %v", tt.wantGzip, gotGzip)
+			}
+
+			// Check body round-trips
+			body := rr.Body.String()
+			if gotGzip {
+				gz, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatalf("Failed to create gzip reader: %v", err)
+				}
+				data, err := io.ReadAll(gz)
+				if err != nil {
+					t.Fatalf("Failed to decompress body: %v", err)
+				}
+				body = string(data)
+			}
+			if body != tt.body {
+				t.Errorf("Body mismatch: got %d bytes, want %d bytes", len(body), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		wantCode      int
+	}{
+		{
+			name:          "Matching token",
+			token:         "secret",
+			authorization: "Bearer secret",
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "Wrong token",
+			token:         "secret",
+			authorization: "Bearer guess",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:     "Missing token",
+			token:    "secret",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "Token without the Bearer scheme",
+			token:         "secret",
+			authorization: "secret",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "No token configured",
+			token:         "",
+			authorization: "Bearer ",
+			wantCode:      http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := adminAuth(tt.token)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/v1/admin/prune", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name            string
+		perMinute       int
+		perKeyPerMinute int
+		keys            []string
+		wantCodes       []int
+	}{
+		{
+			name:      "Global limit",
+			perMinute: 2,
+			keys:      []string{"", "", ""},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:            "Per-key limit",
+			perKeyPerMinute: 2,
+			keys:            []string{"key-one", "key-one", "key-two", "key-one"},
+			wantCodes:       []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := rateLimit(ratelimit.NewBuckets().Take, tt.perMinute, tt.perKeyPerMinute)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, key := range tt.keys {
+				req := httptest.NewRequest(http.MethodPost, "/v1/scrape", nil)
+				if key != "" {
+					req.Header.Set("Authorization", "Bearer "+key)
+				}
+				rr := httptest.NewRecorder()
+
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != tt.wantCodes[i] {
+					t.Errorf("Request %d returned wrong status code: got %v want %v", i+1, rr.Code, tt.wantCodes[i])
+				}
+				if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "30" {
+					t.Errorf("Expected Retry-After 30, got %q", rr.Header().Get("Retry-After"))
+				}
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		preflight  bool
+		wantCode   int
+		wantOrigin string
+	}{
+		{
+			name:       "Preflight from an allowed origin",
+			method:     http.MethodOptions,
+			origin:     "https://tools.example.com",
+			preflight:  true,
+			wantCode:   http.StatusNoContent,
+			wantOrigin: "https://tools.example.com",
+		},
+		{
+			name:      "Preflight from a disallowed origin",
+			method:    http.MethodOptions,
+			origin:    "https://evil.example.net",
+			preflight: true,
+			wantCode:  http.StatusForbidden,
+		},
+		{
+			name:       "Request from an allowed origin",
+			method:     http.MethodGet,
+			origin:     "https://tools.example.com",
+			wantCode:   http.StatusOK,
+			wantOrigin: "https://tools.example.com",
+		},
+		{
+			name:     "Request from a disallowed origin",
+			method:   http.MethodGet,
+			origin:   "https://evil.example.net",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "Request without an origin",
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+		},
+	}
+
+	// Route through a router, which only answers GET, to check preflights
+	// are answered before routing
+	r := &Router{Router: mux.NewRouter()}
+	r.HandleFunc("/v1/health", r.handleHealth).Methods(http.MethodGet)
+	r.handler = corsMiddleware([]string{"https://tools.example.com/"})(r.Router)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/health", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantCode)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if tt.preflight && tt.wantOrigin != "" {
+				if rr.Header().Get("Access-Control-Allow-Methods") == "" || rr.Header().Get("Access-Control-Allow-Headers") == "" {
+					t.Errorf("Expected allowed methods and headers, got %v", rr.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	var seen string
+	handler := requestLogger(logger)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen = RequestID(req.Context())
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}))
+
+	// A request without an ID is given one
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/scrape", nil))
+
+	id := rr.Header().Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("Expected an X-Request-ID response header")
+	}
+	if seen != id {
+		t.Errorf("Expected the request ID %q in the handler's context, got %q", id, seen)
+	}
+
+	var entry struct {
+		RequestID string `json:"requestId"`
+		Method    string `json:"method"`
+		Path      string `json:"path"`
+		Status    int    `json:"status"`
+		Bytes     int64  `json:"bytes"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a JSON log entry, got %q: %v", logs.String(), err)
+	}
+	if entry.RequestID != id || entry.Method != http.MethodGet || entry.Path != "/v1/scrape" ||
+		entry.Status != http.StatusTeapot || entry.Bytes != int64(len("short and stout")) {
+		t.Errorf("Unexpected log entry %+v", entry)
+	}
+
+	// A client's ID is kept, and an unusable one replaced
+	for given, keep := range map[string]bool{"trace-123": true, "has spaces": false} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/health", nil)
+		req.Header.Set("X-Request-ID", given)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("X-Request-ID"); (got == given) != keep || got == "" {
+			t.Errorf("X-Request-ID %q answered with %q", given, got)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// queryInt reads a non-negative integer query parameter, returning the default
+// when it is absent.
+func queryInt(req *http.Request, key string, defaultValue int) (int, error) {
+	raw := req.URL.Query().Get(key)
+	if raw == "" {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+
+	return value, nil
+}
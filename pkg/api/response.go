@@ -10,6 +10,8 @@ type APIResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	// Fields lists every problem found when a request fails validation.
+	Fields []FieldError `json:"fields,omitempty"`
 }
 
 // respondJSON sends a JSON response with the given status code and data.
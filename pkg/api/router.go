@@ -2,18 +2,124 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/pprof"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/ncecere/rummage/pkg/crawler"
+	"github.com/ncecere/rummage/pkg/export"
+	"github.com/ncecere/rummage/pkg/llm"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+	"github.com/ncecere/rummage/pkg/schedule"
 	"github.com/ncecere/rummage/pkg/scraper"
 	"github.com/ncecere/rummage/pkg/storage"
+	"github.com/ncecere/rummage/pkg/webhook"
 )
 
 // RouterOptions contains configuration options for the API router.
 type RouterOptions struct {
 	BaseURL  string
 	RedisURL string
+
+	// Ceiling applied to every requested timeout
+	MaxRequestTimeout time.Duration
+
+	// User-Agent sent with outbound requests
+	UserAgent string
+
+	// Default markdown image handling mode
+	ImageHandling string
+
+	// Phrases that mark a page as a soft 404
+	Soft404Patterns []string
+
+	// Media types the rawHtml format may return
+	RawContentTypes []string
+
+	// CSS selectors that mark a page as paywalled
+	PaywallMarkers []string
+
+	// Largest response body read per page; requests may only lower it
+	MaxResponseBytes int
+
+	// Outbound requests per second across all jobs; zero means unlimited
+	GlobalRPS int
+
+	// Chrome or Chromium binary for screenshot formats; empty disables them
+	BrowserPath string
+
+	// Largest screenshot kept in a result, in bytes
+	MaxScreenshotBytes int
+
+	// Proxy for requests that don't set their own; empty connects directly
+	ProxyURL string
+
+	// Secret that signs webhook payloads; empty sends them unsigned
+	WebhookSecret string
+
+	// Bearer token for admin endpoints; empty disables them
+	AdminToken string
+
+	// Bearer keys accepted by the /v1 endpoints; none, or DisableAuth,
+	// leaves them open
+	APIKeys     []string
+	DisableAuth bool
+
+	// Requests per minute the /v1 endpoints accept in total and per API key
+	// (zero is unlimited), counted in memory or, across instances, in Redis
+	RequestsPerMinute    int
+	KeyRequestsPerMinute int
+	RateLimitBackend     string
+
+	// Origins browsers may call the API from; none disables CORS
+	CORSOrigins []string
+
+	// Logger records each request; nil uses slog's default logger
+	Logger *slog.Logger
+
+	// The server's write timeout, which held responses such as a waiting
+	// batch scrape must move or fit within
+	WriteTimeout time.Duration
+
+	// How long running jobs may finish when the router is closed before
+	// they are cancelled. Zero waits for as long as Close's context allows
+	ShutdownTimeout time.Duration
+
+	// Serve pprof profiles under /debug/pprof, behind the admin token
+	EnablePprof bool
+
+	// OpenAI-compatible API for the json format; the format is disabled
+	// when neither the base URL nor the API key is set
+	LLMBaseURL string
+	LLMAPIKey  string
+	LLMModel   string
+
+	// Crawler connection tuning defaults
+	MaxIdleConnsPerHost int
+	DisableKeepAlives   bool
+
+	// Extra headers for robots.txt and sitemap fetches, keyed by host
+	HostHeaders map[string]map[string]string
+
+	// Nested sitemaps fetched at once while mapping
+	MaxSitemapConcurrency int
+
+	// Pages each crawl scrapes at once
+	MaxConcurrentJobs int
+
+	// Link discovery requests per domain at once, and the pause between them
+	Parallelism int
+	DomainDelay time.Duration
+
+	// Named credentials for crawl result destinations
+	ExportCredentials map[string]export.Credentials
 }
 
 // Router represents the API router with its dependencies.
@@ -22,25 +128,122 @@ type Router struct {
 	scraper *scraper.Service
 	crawler *crawler.Service
 	storage *storage.RedisStorage
+	limiter *ratelimit.Limiter
 	baseURL string
+
+	scheduler *schedule.Scheduler
+
+	// notifier delivers job webhooks in the background
+	notifier      *webhook.Notifier
+	webhookSecret string
+
+	adminToken  string
+	enablePprof bool
+
+	// apiKeys are the keys the /v1 endpoints accept; empty leaves them open
+	apiKeys []string
+
+	// Per-minute request limits for the /v1 endpoints and the buckets
+	// counting them
+	requestsPerMinute    int
+	keyRequestsPerMinute int
+	takeRateLimit        ratelimit.TakeFunc
+
+	// writeTimeout is the server's write timeout; zero when unknown
+	writeTimeout time.Duration
+
+	// shutdownTimeout bounds how long Close waits for running jobs
+	shutdownTimeout time.Duration
+
+	// handler wraps the routes with what must run for unmatched requests
+	// too, such as request logging and CORS preflights; nil serves the
+	// routes directly
+	handler http.Handler
+
+	// jobs tracks the batch and crawl jobs running in the background
+	jobs sync.WaitGroup
 }
 
 // NewRouter creates and configures a new API router.
-func NewRouter(opts RouterOptions) (*mux.Router, error) {
+func NewRouter(opts RouterOptions) (*Router, error) {
 	// Initialize storage
 	redisStorage, err := storage.NewRedisStorage(opts.RedisURL)
 	if err != nil {
 		return nil, err
 	}
 
+	// Share one outbound rate limit across every service
+	limiter := ratelimit.New(opts.GlobalRPS)
+
+	// Enable LLM extraction when an API is configured
+	var llmClient *llm.Client
+	if opts.LLMBaseURL != "" || opts.LLMAPIKey != "" {
+		llmClient = llm.NewClient(llm.Options{
+			BaseURL: opts.LLMBaseURL,
+			APIKey:  opts.LLMAPIKey,
+			Model:   opts.LLMModel,
+		})
+	}
+
+	// Log every webhook delivery attempt with its job
+	recordWebhook := func(jobID string, delivery model.WebhookDelivery) {
+		_ = redisStorage.RecordWebhookDelivery(jobID, delivery)
+	}
+
+	// Job webhooks go out on per-destination queues drained at shutdown
+	notifier := webhook.NewRecordingNotifier(opts.WebhookSecret, recordWebhook)
+
 	// Initialize scraper service
-	scraperService := scraper.NewService()
+	scraperService := scraper.NewServiceWithOptions(scraper.ServiceOptions{
+		MaxRequestTimeout: opts.MaxRequestTimeout,
+		UserAgent:         opts.UserAgent,
+		ImageHandling:     opts.ImageHandling,
+		Soft404Patterns:   opts.Soft404Patterns,
+		RawContentTypes:   opts.RawContentTypes,
+		PaywallMarkers:    opts.PaywallMarkers,
+		MaxResponseBytes:  opts.MaxResponseBytes,
+		Limiter:           limiter,
+		BrowserPath:       opts.BrowserPath,
+		LLM:               llmClient,
+
+		MaxScreenshotBytes: opts.MaxScreenshotBytes,
+		ProxyURL:           opts.ProxyURL,
+		WebhookFn:          notifier.Notify,
+	})
 
 	// Initialize crawler service
 	crawlerService := crawler.NewService(crawler.ServiceOptions{
 		BaseURL:           opts.BaseURL,
 		UpdateJobFn:       redisStorage.UpdateCrawlJob,
 		UpdateJobStatusFn: redisStorage.UpdateCrawlJobStatus,
+		DiscoveryCappedFn: redisStorage.MarkCrawlDiscoveryCapped,
+		MarkRetriedFn:     redisStorage.MarkCrawlRetried,
+		MarkDegradedFn:    redisStorage.MarkCrawlDegraded,
+
+		StoreErrorFn:         redisStorage.StoreCrawlError,
+		StoreRobotsBlockedFn: redisStorage.StoreRobotsBlocked,
+
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		DisableKeepAlives:     opts.DisableKeepAlives,
+		MaxRequestTimeout:     opts.MaxRequestTimeout,
+		UserAgent:             opts.UserAgent,
+		ImageHandling:         opts.ImageHandling,
+		Soft404Patterns:       opts.Soft404Patterns,
+		RawContentTypes:       opts.RawContentTypes,
+		PaywallMarkers:        opts.PaywallMarkers,
+		MaxResponseBytes:      opts.MaxResponseBytes,
+		BrowserPath:           opts.BrowserPath,
+		MaxScreenshotBytes:    opts.MaxScreenshotBytes,
+		ProxyURL:              opts.ProxyURL,
+		LLM:                   llmClient,
+		HostHeaders:           opts.HostHeaders,
+		MaxSitemapConcurrency: opts.MaxSitemapConcurrency,
+		MaxConcurrentJobs:     opts.MaxConcurrentJobs,
+		Parallelism:           opts.Parallelism,
+		DomainDelay:           opts.DomainDelay,
+		ExportCredentials:     opts.ExportCredentials,
+		Limiter:               limiter,
+		WebhookFn:             notifier.Notify,
 	})
 
 	// Create router instance
@@ -49,34 +252,219 @@ func NewRouter(opts RouterOptions) (*mux.Router, error) {
 		scraper: scraperService,
 		crawler: crawlerService,
 		storage: redisStorage,
+		limiter: limiter,
 		baseURL: opts.BaseURL,
+
+		notifier:      notifier,
+		webhookSecret: opts.WebhookSecret,
+
+		adminToken:  opts.AdminToken,
+		enablePprof: opts.EnablePprof,
+
+		writeTimeout:    opts.WriteTimeout,
+		shutdownTimeout: opts.ShutdownTimeout,
+	}
+	if !opts.DisableAuth {
+		r.apiKeys = opts.APIKeys
+	}
+
+	// Answer browsers before routing, since preflights match no route
+	var handler http.Handler = r.Router
+	if len(opts.CORSOrigins) > 0 {
+		handler = corsMiddleware(opts.CORSOrigins)(handler)
+	}
+
+	// Log every request, routed or not
+	r.handler = requestLogger(opts.Logger)(handler)
+
+	// Limit incoming requests per instance, or across instances through Redis
+	r.requestsPerMinute = opts.RequestsPerMinute
+	r.keyRequestsPerMinute = opts.KeyRequestsPerMinute
+	r.takeRateLimit = ratelimit.NewBuckets().Take
+	if opts.RateLimitBackend == ratelimit.BackendRedis {
+		r.takeRateLimit = redisStorage.TakeRateLimitToken
+	}
+
+	// Resume stored schedules
+	r.scheduler = schedule.New(schedule.Options{
+		SaveFn:      redisStorage.SaveSchedule,
+		LoadFn:      redisStorage.ListSchedules,
+		RecordRunFn: redisStorage.AddScheduleRun,
+		ScrapeFn:    scraperService.ScrapeContext,
+		CrawlFn: func(crawlReq model.CrawlRequest) (string, string, error) {
+			response, err := r.startCrawl(crawlReq)
+			if err != nil {
+				return "", "", err
+			}
+			return response.ID, response.URL, nil
+		},
+	})
+	if err := r.scheduler.Start(); err != nil {
+		return nil, err
 	}
 
 	// Register routes
 	r.registerRoutes()
 
-	return r.Router, nil
+	return r, nil
+}
+
+// ServeHTTP serves the API.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.handler != nil {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+	r.Router.ServeHTTP(w, req)
+}
+
+// goJob runs a job in the background, tracked so Close waits for it.
+func (r *Router) goJob(job func()) {
+	r.jobs.Add(1)
+	go func() {
+		defer r.jobs.Done()
+		job()
+	}()
+}
+
+// shutdownGrace is how long cancelled jobs get to store what they buffered,
+// and queued webhooks get to go out, once the shutdown timeout has passed.
+const shutdownGrace = 5 * time.Second
+
+// Close stops the scheduler and gives background jobs the shutdown timeout to
+// finish so their buffered results reach storage. Jobs still running then are
+// marked cancelled and stopped. Queued webhooks are delivered and the storage
+// connection is closed either way; what went wrong is returned.
+func (r *Router) Close(ctx context.Context) error {
+	if r.scheduler != nil {
+		r.scheduler.Stop()
+	}
+
+	if r.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.shutdownTimeout)
+		defer cancel()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		r.jobs.Wait()
+		close(drained)
+	}()
+
+	var errs []error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("jobs still running at shutdown: %w", ctx.Err()))
+		r.cancelJobs()
+		select {
+		case <-drained:
+		case <-time.After(shutdownGrace):
+		}
+	}
+
+	if r.notifier != nil {
+		notifyCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+		defer cancel()
+		if err := r.notifier.Close(notifyCtx); err != nil {
+			errs = append(errs, fmt.Errorf("webhooks still queued at shutdown: %w", err))
+		}
+	}
+
+	if r.storage != nil {
+		if err := r.storage.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cancelJobs marks the batch and crawl jobs running on this server
+// cancelled, then stops them.
+func (r *Router) cancelJobs() {
+	if r.scraper != nil {
+		for _, jobID := range r.scraper.RunningBatchJobs() {
+			if r.storage != nil {
+				_ = r.storage.CancelBatchJob(jobID)
+			}
+			r.scraper.CancelBatchJob(jobID)
+		}
+	}
+	if r.crawler != nil {
+		for _, jobID := range r.crawler.RunningCrawls() {
+			if r.storage != nil {
+				_ = r.storage.CancelCrawlJob(jobID)
+			}
+			_ = r.crawler.CancelCrawl(jobID)
+		}
+	}
 }
 
 // registerRoutes sets up all API routes.
 func (r *Router) registerRoutes() {
+	// Compress large responses
+	r.Use(gzipMiddleware)
+
+	// Built-in status page
+	r.HandleFunc("/", r.handleUI).Methods(http.MethodGet)
+	r.HandleFunc("/ui", r.handleUI).Methods(http.MethodGet)
+
+	// Health check endpoint, open to load balancers without a key
+	r.HandleFunc("/v1/health", r.handleHealth).Methods(http.MethodGet)
+
+	// Maintenance endpoints, guarded by the admin token instead of API keys
+	admin := r.PathPrefix("/v1/admin").Subrouter()
+	admin.Use(adminAuth(r.adminToken))
+	admin.HandleFunc("/prune", r.handlePrune).Methods(http.MethodPost)
+
 	// API version prefix
 	api := r.PathPrefix("/v1").Subrouter()
+	if len(r.apiKeys) > 0 {
+		api.Use(apiKeyAuth(r.apiKeys))
+	}
+	if r.takeRateLimit != nil && (r.requestsPerMinute > 0 || r.keyRequestsPerMinute > 0) {
+		api.Use(rateLimit(r.takeRateLimit, r.requestsPerMinute, r.keyRequestsPerMinute))
+	}
 
-	// Health check endpoint
-	api.HandleFunc("/health", r.handleHealth).Methods(http.MethodGet)
+	// Server usage statistics and capabilities
+	api.HandleFunc("/stats", r.handleStats).Methods(http.MethodGet)
+	api.HandleFunc("/capabilities", r.handleCapabilities).Methods(http.MethodGet)
 
 	// Scrape endpoints
 	api.HandleFunc("/scrape", r.handleScrape).Methods(http.MethodPost)
+	api.HandleFunc("/scrape/stream", r.handleScrapeStream).Methods(http.MethodPost)
 	api.HandleFunc("/batch/scrape", r.handleBatchScrape).Methods(http.MethodPost)
 	api.HandleFunc("/batch/scrape/{id}", r.handleGetBatchStatus).Methods(http.MethodGet)
+	api.HandleFunc("/batch/scrape/{id}", r.handleCancelBatch).Methods(http.MethodDelete)
+	api.HandleFunc("/batch/scrape/{id}/webhook", r.handleGetBatchWebhook).Methods(http.MethodGet)
 
 	// Crawl endpoints
 	api.HandleFunc("/crawl", r.handleCrawl).Methods(http.MethodPost)
 	api.HandleFunc("/crawl/{id}", r.handleGetCrawlStatus).Methods(http.MethodGet)
 	api.HandleFunc("/crawl/{id}", r.handleCancelCrawl).Methods(http.MethodDelete)
 	api.HandleFunc("/crawl/{id}/errors", r.handleGetCrawlErrors).Methods(http.MethodGet)
+	api.HandleFunc("/crawl/{id}/webhook", r.handleGetCrawlWebhook).Methods(http.MethodGet)
+	api.HandleFunc("/crawl/{id}/download.zip", r.handleDownloadCrawl).Methods(http.MethodGet)
 
 	// Map endpoints
 	api.HandleFunc("/map", r.handleMap).Methods(http.MethodPost)
+
+	// Schedule endpoints
+	api.HandleFunc("/schedule", r.handleSchedule).Methods(http.MethodPost)
+	api.HandleFunc("/schedule/{id}/runs", r.handleGetScheduleRuns).Methods(http.MethodGet)
+
+	// Webhook endpoints
+	api.HandleFunc("/webhook/test", r.handleTestWebhook).Methods(http.MethodPost)
+
+	// Profiling endpoints
+	if r.enablePprof {
+		debug := r.PathPrefix("/debug/pprof").Subrouter()
+		debug.Use(adminAuth(r.adminToken))
+		debug.HandleFunc("/cmdline", pprof.Cmdline)
+		debug.HandleFunc("/profile", pprof.Profile)
+		debug.HandleFunc("/symbol", pprof.Symbol)
+		debug.HandleFunc("/trace", pprof.Trace)
+		debug.PathPrefix("/").HandlerFunc(pprof.Index)
+	}
 }
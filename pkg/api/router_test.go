@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+	"github.com/ncecere/rummage/pkg/scraper"
+)
+
+func TestPprofRoutes(t *testing.T) {
+	tests := []struct {
+		name          string
+		enablePprof   bool
+		authorization string
+		wantCode      int
+	}{
+		{
+			name:          "Disabled",
+			enablePprof:   false,
+			authorization: "Bearer secret",
+			wantCode:      http.StatusNotFound,
+		},
+		{
+			name:          "Enabled with the admin token",
+			enablePprof:   true,
+			authorization: "Bearer secret",
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:        "Enabled without the admin token",
+			enablePprof: true,
+			wantCode:    http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Router{
+				Router:      mux.NewRouter(),
+				adminToken:  "secret",
+				enablePprof: tt.enablePprof,
+			}
+			r.registerRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, "/debug/pprof/heap?debug=1", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRouterCloseWaitsForJobs(t *testing.T) {
+	r := &Router{Router: mux.NewRouter()}
+
+	release := make(chan struct{})
+	finished := false
+	r.goJob(func() {
+		<-release
+		finished = true
+	})
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- r.Close(context.Background())
+	}()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned before the job finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close returned an error: %v", err)
+		}
+		if !finished {
+			t.Error("Expected the job to finish before Close returned")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after the job finished")
+	}
+}
+
+func TestRouterCloseTimeout(t *testing.T) {
+	// The page hangs until its request is aborted
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer page.Close()
+
+	r := &Router{
+		Router:          mux.NewRouter(),
+		scraper:         scraper.NewService(),
+		shutdownTimeout: 20 * time.Millisecond,
+	}
+
+	finished := make(chan struct{})
+	r.goJob(func() {
+		defer close(finished)
+		r.scraper.ProcessBatchJob("job-1", []string{page.URL}, model.BatchScrapeRequest{}, nil)
+	})
+
+	// Wait for the job to register before shutting down
+	deadline := time.Now().Add(time.Second)
+	for len(r.scraper.RunningBatchJobs()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := r.Close(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Error("Expected the running batch job to be cancelled before Close returned")
+	}
+}
+
+func TestAPIKeyRoutes(t *testing.T) {
+	tests := []struct {
+		name          string
+		apiKeys       []string
+		path          string
+		authorization string
+		wantCode      int
+	}{
+		{
+			name:          "First key",
+			apiKeys:       []string{"key-one", "key-two"},
+			path:          "/v1/capabilities",
+			authorization: "Bearer key-one",
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "Second key",
+			apiKeys:       []string{"key-one", "key-two"},
+			path:          "/v1/capabilities",
+			authorization: "Bearer key-two",
+			wantCode:      http.StatusOK,
+		},
+		{
+			name:          "Wrong key",
+			apiKeys:       []string{"key-one", "key-two"},
+			path:          "/v1/capabilities",
+			authorization: "Bearer guess",
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:     "Missing key",
+			apiKeys:  []string{"key-one", "key-two"},
+			path:     "/v1/capabilities",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "Health check without a key",
+			apiKeys:  []string{"key-one", "key-two"},
+			path:     "/v1/health",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "No keys configured",
+			path:     "/v1/capabilities",
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Router{
+				Router:  mux.NewRouter(),
+				scraper: scraper.NewService(),
+				limiter: ratelimit.New(0),
+				apiKeys: tt.apiKeys,
+			}
+			r.registerRoutes()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rr := httptest.NewRecorder()
+
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestAdminRoutesUseAdminToken(t *testing.T) {
+	r := &Router{
+		Router:     mux.NewRouter(),
+		adminToken: "secret",
+		apiKeys:    []string{"key-one"},
+	}
+	r.registerRoutes()
+
+	// The API key is not the admin token
+	req := httptest.NewRequest(http.MethodPost, "/v1/admin/prune", nil)
+	req.Header.Set("Authorization", "Bearer key-one")
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestHeldResponseOutlastsWriteTimeout(t *testing.T) {
+	const writeTimeout = 200 * time.Millisecond
+
+	// Hold a response through the same middleware as the API, the way a
+	// waiting batch scrape does, past the server's write timeout
+	r := &Router{Router: mux.NewRouter(), writeTimeout: writeTimeout}
+	r.Use(gzipMiddleware)
+	r.HandleFunc("/wait", func(w http.ResponseWriter, req *http.Request) {
+		wait, warning := r.holdResponse(w, 2*writeTimeout)
+		time.Sleep(wait)
+		respondSuccess(w, map[string]string{"warning": warning, "padding": strings.Repeat("x", gzipMinSize)})
+	})
+	r.handler = requestLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))(r.Router)
+
+	server := httptest.NewUnstartedServer(r)
+	server.Config.WriteTimeout = writeTimeout
+	server.Start()
+	defer server.Close()
+
+	// Go's client asks for gzip, so the response is compressed
+	resp, err := http.Get(server.URL + "/wait")
+	if err != nil {
+		t.Fatalf("Expected the held response to arrive: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Expected the whole held response: %v", err)
+	}
+	if !resp.Uncompressed {
+		t.Error("Expected the response to be gzipped")
+	}
+	if body.Data["warning"] != "" {
+		t.Errorf("Expected the wait not to be shortened, got %q", body.Data["warning"])
+	}
+}
+
+func TestHoldResponseWithoutDeadlineControl(t *testing.T) {
+	r := &Router{writeTimeout: 15 * time.Second}
+
+	// A recorder can't move its deadline, so the wait must fit the timeout
+	wait, warning := r.holdResponse(httptest.NewRecorder(), time.Minute)
+	if wait != 10*time.Second || warning == "" {
+		t.Errorf("Expected the wait shortened to 10s with a warning, got %v and %q", wait, warning)
+	}
+
+	wait, warning = r.holdResponse(httptest.NewRecorder(), 5*time.Second)
+	if wait != 5*time.Second || warning != "" {
+		t.Errorf("Expected a short wait to be kept, got %v and %q", wait, warning)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/schedule"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// defaultRunsPageSize is the number of schedule runs returned when no limit is given.
+const defaultRunsPageSize = 20
+
+// handleSchedule handles requests to run a scrape or crawl on a cron schedule.
+func (r *Router) handleSchedule(w http.ResponseWriter, req *http.Request) {
+	var scheduleReq model.ScheduleRequest
+	if err := json.NewDecoder(req.Body).Decode(&scheduleReq); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Validate the request, reporting every problem at once
+	var v validator
+	if scheduleReq.Cron == "" {
+		v.add("cron", "cron is required")
+	} else {
+		v.check("cron", schedule.ValidateCron(scheduleReq.Cron))
+	}
+	v.check("", scheduleReq.Validate())
+	if scrapeReq := scheduleReq.Scrape; scrapeReq != nil {
+		if !utils.IsValidURL(scrapeReq.URL) {
+			v.add("scrape.url", "URL must be absolute")
+		}
+		v.scrapeOptions("scrape.", scrapeReq.ScrapeOptions)
+	}
+	if crawlReq := scheduleReq.Crawl; crawlReq != nil {
+		if !utils.IsValidURL(crawlReq.URL) {
+			v.add("crawl.url", "URL must be absolute")
+		}
+		v.check("crawl", crawlReq.Validate())
+		v.filterExpression("crawl.filterExpression", crawlReq.FilterExpression)
+		v.webhook(crawlReq.Webhook)
+	}
+	if v.respond(w) {
+		return
+	}
+
+	// Store and start the schedule
+	created, err := r.scheduler.Add(scheduleReq)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to create schedule: "+err.Error())
+		return
+	}
+
+	respondSuccess(w, model.ScheduleResponse{
+		Success: true,
+		ID:      created.ID,
+		URL:     fmt.Sprintf("%s/v1/schedule/%s/runs", r.baseURL, created.ID),
+	})
+}
+
+// handleGetScheduleRuns handles requests to list a schedule's runs.
+func (r *Router) handleGetScheduleRuns(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	id := vars["id"]
+
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Schedule ID is required")
+		return
+	}
+
+	// Parse pagination
+	skip, err := queryInt(req, "skip", 0)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := queryInt(req, "limit", defaultRunsPageSize)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Get the schedule and its runs
+	stored, err := r.storage.GetSchedule(id)
+	if err != nil {
+		respondError(w, http.StatusNotFound, "Schedule not found: "+err.Error())
+		return
+	}
+	runs, err := r.storage.GetScheduleRuns(id, skip, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get runs: "+err.Error())
+		return
+	}
+
+	respondSuccess(w, model.ScheduleRunsResponse{
+		Schedule: *stored,
+		Runs:     runs,
+	})
+}
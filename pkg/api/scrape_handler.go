@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/scraper"
 )
 
 // ScrapeHandler handles requests to the /scrape endpoint
@@ -29,14 +32,18 @@ func (r *Router) handleScrape(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// Validate URL
-	if scrapeReq.URL == "" {
-		respondError(w, http.StatusBadRequest, "URL is required")
+	// Validate the request, reporting every problem at once
+	v := validateScrape(scrapeReq)
+	if v.respond(w) {
 		return
 	}
 
 	// Perform scrape
 	result, err := r.scraper.Scrape(scrapeReq)
+	if errors.Is(err, scraper.ErrRawContentType) {
+		respondError(w, http.StatusUnsupportedMediaType, "Failed to scrape URL: "+err.Error())
+		return
+	}
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to scrape URL: "+err.Error())
 		return
@@ -45,3 +52,58 @@ func (r *Router) handleScrape(w http.ResponseWriter, req *http.Request) {
 	// Return result
 	respondSuccess(w, result)
 }
+
+// handleScrapeStream handles requests to scrape a single URL, writing its
+// markdown with chunked encoding as each top-level block is converted.
+func (r *Router) handleScrapeStream(w http.ResponseWriter, req *http.Request) {
+	var scrapeReq model.ScrapeRequest
+	if err := json.NewDecoder(req.Body).Decode(&scrapeReq); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Validate the request, reporting every problem at once
+	v := validateScrape(scrapeReq)
+	if v.respond(w) {
+		return
+	}
+
+	// Errors are only reported as JSON until the first block is sent
+	started := false
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	_, err := r.scraper.ScrapeStream(req.Context(), scrapeReq, func(chunk string) error {
+		start()
+		if _, err := io.WriteString(w, chunk); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		respondError(w, http.StatusInternalServerError, "Failed to scrape URL: "+err.Error())
+		return
+	}
+
+	// A page with no content still gets an empty markdown response
+	start()
+}
+
+// validateScrape checks a scrape request, collecting every problem.
+func validateScrape(scrapeReq model.ScrapeRequest) *validator {
+	var v validator
+	if scrapeReq.URL == "" {
+		v.add("url", "URL is required")
+	}
+	v.scrapeOptions("", scrapeReq.ScrapeOptions)
+	return &v
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/scraper"
+)
+
+func TestHandleScrapeStream(t *testing.T) {
+	// A large page of many top-level sections
+	var page strings.Builder
+	page.WriteString("<html><body>")
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&page, "<section><h2>Section %d</h2><p>%s</p></section>", i, strings.Repeat("Lorem ipsum dolor sit amet. ", 20))
+	}
+	page.WriteString("</body></html>")
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, page.String())
+	}))
+	defer site.Close()
+
+	r := &Router{scraper: scraper.NewService()}
+	server := httptest.NewServer(http.HandlerFunc(r.handleScrapeStream))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"url": "`+site.URL+`"}`))
+	if err != nil {
+		t.Fatalf("Failed to request stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", resp.StatusCode, http.StatusOK)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("Expected a chunked response, got transfer encoding %v", resp.TransferEncoding)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Expected markdown, got content type %q", ct)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read stream: %v", err)
+	}
+	markdown := string(body)
+	last := -1
+	for _, i := range []int{0, 1, 250, 499} {
+		heading := fmt.Sprintf("## Section %d\n", i)
+		pos := strings.Index(markdown, heading)
+		if pos < 0 || pos < last {
+			t.Fatalf("Expected %q in order in the stream", heading)
+		}
+		last = pos
+	}
+}
+
+// flushRecorder records how much of the body had been sent at each flush.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []int
+}
+
+func (r *flushRecorder) Flush() {
+	r.flushed = append(r.flushed, r.Body.Len())
+	r.ResponseRecorder.Flush()
+}
+
+func TestHandleScrapeStreamGzip(t *testing.T) {
+	// A page of short sections, each far below the compression threshold
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body><section><h2>First</h2><p>Hello.</p></section><section><h2>Second</h2><p>Goodbye.</p></section></body></html>")
+	}))
+	defer site.Close()
+
+	r := &Router{scraper: scraper.NewService()}
+	req := httptest.NewRequest(http.MethodPost, "/v1/scrape/stream", strings.NewReader(`{"url": "`+site.URL+`"}`))
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	gzipMiddleware(http.HandlerFunc(r.handleScrapeStream)).ServeHTTP(rr, req)
+
+	// The first block is sent when it is flushed, not held for the threshold
+	if len(rr.flushed) == 0 || rr.flushed[0] == 0 {
+		t.Fatalf("Expected output at the first flush, got %v", rr.flushed)
+	}
+	if ce := rr.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Expected a gzip stream, got content encoding %q", ce)
+	}
+
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to read gzip stream: %v", err)
+	}
+	if markdown := string(body); !strings.Contains(markdown, "## First") || !strings.Contains(markdown, "## Second") {
+		t.Errorf("Expected both sections in the stream, got %q", markdown)
+	}
+}
+
+func TestHandleScrapeStreamErrors(t *testing.T) {
+	r := &Router{scraper: scraper.NewService()}
+
+	// Failures before anything is streamed are reported as JSON
+	rr := httptest.NewRecorder()
+	r.handleScrapeStream(rr, httptest.NewRequest(http.MethodPost, "/v1/scrape/stream", strings.NewReader(`{"url": "http://127.0.0.1:1"}`)))
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected a JSON error, got content type %q", ct)
+	}
+}
+
+func TestHandleScrapeRawContentTypes(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/data.json" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"ok": true}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, "\x7fELF")
+	}))
+	defer site.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+	}{
+		{name: "Allowed", path: "/data.json", wantCode: http.StatusOK},
+		{name: "Disallowed", path: "/tool.bin", wantCode: http.StatusUnsupportedMediaType},
+	}
+
+	r := &Router{scraper: scraper.NewService()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"url": "` + site.URL + tt.path + `", "formats": ["raw"]}`
+			rr := httptest.NewRecorder()
+
+			r.handleScrape(rr, httptest.NewRequest(http.MethodPost, "/v1/scrape", strings.NewReader(body)))
+
+			if rr.Code != tt.wantCode {
+				t.Errorf("handler returned wrong status code: got %v want %v (%s)", rr.Code, tt.wantCode, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// handleStats reports server-wide usage, including the global rate limit.
+func (r *Router) handleStats(w http.ResponseWriter, req *http.Request) {
+	respondSuccess(w, model.StatsResponse{
+		GlobalRateLimit: r.limiter.Stats(),
+	})
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed ui/index.html
+var uiFS embed.FS
+
+// handleUI serves the embedded status page.
+func (r *Router) handleUI(w http.ResponseWriter, req *http.Request) {
+	page, err := uiFS.ReadFile("ui/index.html")
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to load UI: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(page)
+}
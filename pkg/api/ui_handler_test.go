@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleUI(t *testing.T) {
+	// Create a router without dependencies; the UI handler doesn't need any
+	r := &Router{}
+
+	// Create a request and response recorder
+	req := httptest.NewRequest(http.MethodGet, "/ui", nil)
+	rr := httptest.NewRecorder()
+
+	// Call the handler
+	r.handleUI(rr, req)
+
+	// Check status code
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+
+	// Check content type
+	contentType := rr.Header().Get("Content-Type")
+	if !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("handler returned wrong content type: got %v want text/html", contentType)
+	}
+
+	// Check body
+	if !strings.Contains(rr.Body.String(), "<title>Rummage</title>") {
+		t.Errorf("handler returned unexpected body")
+	}
+
+	// The page sends an API key with its requests for servers that need one
+	if !strings.Contains(rr.Body.String(), `id="api-key"`) || !strings.Contains(rr.Body.String(), "'Bearer ' + key") {
+		t.Errorf("Expected the page to send an API key as a bearer token")
+	}
+}
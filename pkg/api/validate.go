@@ -0,0 +1,135 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ncecere/rummage/pkg/crawler"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/scraper"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// FieldError describes one problem with a request. Field is the JSON path of
+// the offending field, and is empty for problems spanning several fields.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// validator collects every problem with a request so they can be reported
+// together instead of one per round trip.
+type validator struct {
+	fields []FieldError
+}
+
+// add records a problem with a field.
+func (v *validator) add(field, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Message: message})
+}
+
+// check records err against a field when it is non-nil.
+func (v *validator) check(field string, err error) {
+	if err != nil {
+		v.add(field, err.Error())
+	}
+}
+
+// respond sends a 400 listing every problem found and reports whether it did.
+func (v *validator) respond(w http.ResponseWriter) bool {
+	if len(v.fields) == 0 {
+		return false
+	}
+
+	message := v.fields[0].Message
+	if len(v.fields) > 1 {
+		message = fmt.Sprintf("%s (and %d more problems)", message, len(v.fields)-1)
+	}
+	respondJSON(w, http.StatusBadRequest, APIResponse{
+		Success: false,
+		Error:   message,
+		Fields:  v.fields,
+	})
+	return true
+}
+
+// scrapeOptions validates the scrape settings shared by the scrape, batch and
+// crawl requests, prefixing field names with prefix for requests that nest them.
+func (v *validator) scrapeOptions(prefix string, opts model.ScrapeOptions) {
+	if opts.BaseURLOverride != "" && !utils.IsValidURL(opts.BaseURLOverride) {
+		v.add(prefix+"baseURLOverride", "baseURLOverride must be an absolute URL")
+	}
+	if opts.ImageHandling != "" && !model.IsValidImageHandling(opts.ImageHandling) {
+		v.add(prefix+"imageHandling", "imageHandling must be one of keep, strip or alt")
+	}
+	if opts.UnicodeNormalization != "" && !model.IsValidUnicodeNormalization(opts.UnicodeNormalization) {
+		v.add(prefix+"unicodeNormalization", "unicodeNormalization must be one of none, nfc or nfkc")
+	}
+	for i, selector := range opts.StripElements {
+		if err := scraper.ValidateSelector(selector); err != nil {
+			v.add(fmt.Sprintf("%sstripElements[%d]", prefix, i), "Invalid stripElements selector: "+err.Error())
+		}
+	}
+	if opts.ContentSelector != "" {
+		if err := scraper.ValidateSelector(opts.ContentSelector); err != nil {
+			v.add(prefix+"contentSelector", "Invalid contentSelector: "+err.Error())
+		}
+	}
+	if opts.WaitForSelector != "" {
+		if err := scraper.ValidateSelector(opts.WaitForSelector); err != nil {
+			v.add(prefix+"waitForSelector", "Invalid waitForSelector: "+err.Error())
+		}
+	}
+	if opts.MaxResponseBytes < 0 {
+		v.add(prefix+"maxResponseBytes", "maxResponseBytes must not be negative")
+	}
+	if opts.Proxy != "" {
+		_, err := utils.ParseProxy(opts.Proxy)
+		v.check(prefix+"proxy", err)
+	}
+	v.check(prefix+"jsonOptions", model.ValidateJSONFormat(opts.Formats, opts.JSONOptions))
+	for i, action := range opts.Actions {
+		v.check(fmt.Sprintf("%sactions[%d]", prefix, i), action.Validate())
+	}
+}
+
+// paths validates the matching mode and the regex: patterns of a request's
+// include and exclude paths.
+func (v *validator) paths(mode string, includePaths, excludePaths []string) {
+	if mode != "" && !model.IsValidPathMatching(mode) {
+		v.add("pathMatching", "pathMatching must be one of glob or substring")
+		return
+	}
+	if mode == model.PathMatchingSubstring {
+		return
+	}
+	for i, pattern := range includePaths {
+		if err := crawler.ValidatePathPattern(pattern); err != nil {
+			v.add(fmt.Sprintf("includePaths[%d]", i), "Invalid regex pattern: "+err.Error())
+		}
+	}
+	for i, pattern := range excludePaths {
+		if err := crawler.ValidatePathPattern(pattern); err != nil {
+			v.add(fmt.Sprintf("excludePaths[%d]", i), "Invalid regex pattern: "+err.Error())
+		}
+	}
+}
+
+// filterExpression validates a crawl or map filter expression.
+func (v *validator) filterExpression(field, expression string) {
+	if err := crawler.ValidateFilterExpression(expression); err != nil {
+		v.add(field, err.Error())
+	}
+}
+
+// webhook validates the lifecycle events a job's webhook subscribes to.
+func (v *validator) webhook(cfg *model.WebhookConfig) {
+	if cfg == nil {
+		return
+	}
+	for i, event := range cfg.Events {
+		if !model.IsValidWebhookEvent(event) {
+			v.add(fmt.Sprintf("webhook.events[%d]", i), "webhook events must be started, page, completed or failed")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/scraper"
+)
+
+// decodeFieldErrors decodes a validation failure response.
+func decodeFieldErrors(t *testing.T, rr *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusBadRequest)
+	}
+
+	var resp APIResponse
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Success || resp.Error == "" {
+		t.Errorf("Expected a failed response with an error message, got %+v", resp)
+	}
+
+	fields := make(map[string]string)
+	for _, f := range resp.Fields {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+func TestHandleScrapeValidationErrors(t *testing.T) {
+	r := &Router{scraper: scraper.NewService()}
+
+	body := `{
+		"imageHandling": "blur",
+		"contentSelector": "div[",
+		"stripElements": ["nav", "a[href"],
+		"proxy": "ftp://proxy.example.com",
+		"formats": ["json"],
+		"actions": [{"type": "scroll"}, {"type": "click"}]
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/scrape", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	r.handleScrape(rr, req)
+
+	fields := decodeFieldErrors(t, rr)
+	for _, field := range []string{"url", "imageHandling", "contentSelector", "stripElements[1]", "proxy", "jsonOptions", "actions[1]"} {
+		if fields[field] == "" {
+			t.Errorf("Expected an error for %s, got %v", field, fields)
+		}
+	}
+	if _, ok := fields["actions[0]"]; ok {
+		t.Error("Expected the valid scroll action to pass")
+	}
+	if _, ok := fields["stripElements[0]"]; ok {
+		t.Error("Expected the valid nav selector to pass")
+	}
+}
+
+func TestHandleCrawlValidationErrors(t *testing.T) {
+	r := &Router{scraper: scraper.NewService()}
+
+	body := `{
+		"url": "https://example.com",
+		"ignoreSitemap": true,
+		"sitemapOnly": true,
+		"excludePaths": ["/admin", "regex:("],
+		"filterExpression": "path ==",
+		"scrapeOptions": {"waitForSelector": "[[", "imageHandling": "blur"}
+	}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/crawl", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	r.handleCrawl(rr, req)
+
+	fields := decodeFieldErrors(t, rr)
+	if len(fields) != 5 {
+		t.Errorf("Expected 5 problems, got %v", fields)
+	}
+	for _, field := range []string{"", "excludePaths[1]", "filterExpression", "scrapeOptions.waitForSelector", "scrapeOptions.imageHandling"} {
+		if fields[field] == "" {
+			t.Errorf("Expected an error for %q, got %v", field, fields)
+		}
+	}
+}
+
+func TestHandleBatchScrapeWaitLimit(t *testing.T) {
+	r := &Router{scraper: scraper.NewService()}
+
+	urls := make([]string, maxWaitBatchURLs+1)
+	for i := range urls {
+		urls[i] = fmt.Sprintf(`"https://example.com/%d"`, i)
+	}
+	body := `{"wait": true, "waitTimeoutMs": -1, "urls": [` + strings.Join(urls, ",") + `]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch/scrape", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+
+	r.handleBatchScrape(rr, req)
+
+	fields := decodeFieldErrors(t, rr)
+	for _, field := range []string{"urls", "waitTimeoutMs"} {
+		if fields[field] == "" {
+			t.Errorf("Expected an error for %s, got %v", field, fields)
+		}
+	}
+}
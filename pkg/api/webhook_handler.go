@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/webhook"
+)
+
+// handleTestWebhook sends a sample event to a webhook configuration so it can
+// be checked before a job relies on it.
+func (r *Router) handleTestWebhook(w http.ResponseWriter, req *http.Request) {
+	var cfg model.WebhookConfig
+	if err := json.NewDecoder(req.Body).Decode(&cfg); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	// Validate the request, reporting every problem at once
+	var v validator
+	if cfg.URL == "" {
+		v.add("url", "URL is required")
+	} else if u, err := url.Parse(cfg.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add("url", "URL must be an absolute http or https URL")
+	}
+	v.webhook(&cfg)
+	if v.respond(w) {
+		return
+	}
+
+	// Refuse internal destinations before anything is sent, so the endpoint
+	// can't be used to probe the server's network
+	if err := webhook.CheckDestination(req.Context(), cfg.URL); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Forward headers just as a job's deliveries would
+	cfg.CaptureHeaders(req.Header)
+
+	respondSuccess(w, webhook.Test(req.Context(), cfg, r.webhookSecret))
+}
+
+// handleGetBatchWebhook returns the webhook delivery attempts for a batch job.
+func (r *Router) handleGetBatchWebhook(w http.ResponseWriter, req *http.Request) {
+	jobID := mux.Vars(req)["id"]
+	if _, err := r.storage.GetBatchJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, "Job not found: "+err.Error())
+		return
+	}
+	r.respondWebhookDeliveries(w, jobID)
+}
+
+// handleGetCrawlWebhook returns the webhook delivery attempts for a crawl job.
+func (r *Router) handleGetCrawlWebhook(w http.ResponseWriter, req *http.Request) {
+	jobID := mux.Vars(req)["id"]
+	if _, err := r.storage.GetCrawlJob(jobID); err != nil {
+		respondError(w, http.StatusNotFound, "Job not found: "+err.Error())
+		return
+	}
+	r.respondWebhookDeliveries(w, jobID)
+}
+
+// respondWebhookDeliveries writes a job's webhook delivery log.
+func (r *Router) respondWebhookDeliveries(w http.ResponseWriter, jobID string) {
+	deliveries, err := r.storage.GetWebhookDeliveries(jobID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to get webhook deliveries: "+err.Error())
+		return
+	}
+	respondSuccess(w, model.WebhookDeliveriesResponse{Deliveries: deliveries})
+}
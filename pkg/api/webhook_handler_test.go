@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/webhook"
+)
+
+func TestHandleTestWebhook(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer hook.Close()
+
+	// The stub receiver listens on loopback
+	webhook.AllowPrivateNetworks(true)
+	defer webhook.AllowPrivateNetworks(false)
+
+	r := &Router{webhookSecret: "s3cret"}
+
+	reqBody := `{"url": "` + hook.URL + `", "headers": {"X-Team": "search"}, "forwardHeaders": ["X-Tenant"], "metadata": {"env": "staging"}}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/webhook/test", strings.NewReader(reqBody))
+	req.Header.Set("X-Tenant", "acme")
+	rr := httptest.NewRecorder()
+
+	r.handleTestWebhook(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var resp struct {
+		Data model.WebhookTestResponse `json:"data"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Data.Delivered || resp.Data.StatusCode != http.StatusOK || resp.Data.Error != "" {
+		t.Errorf("Expected a successful delivery, got %+v", resp.Data)
+	}
+
+	// The sample is delivered like a real event
+	if got == nil {
+		t.Fatal("Expected the webhook to receive the sample event")
+	}
+	if sig := got.Header.Get(webhook.SignatureHeader); sig != webhook.Sign("s3cret", body) {
+		t.Errorf("Expected the payload to be signed, got %q", sig)
+	}
+	if got.Header.Get("X-Team") != "search" || got.Header.Get("X-Tenant") != "acme" {
+		t.Errorf("Expected configured and forwarded headers, got %v", got.Header)
+	}
+	var event model.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if event.Type != model.WebhookEventTest || event.Metadata["env"] != "staging" {
+		t.Errorf("Expected a test event echoing the metadata, got %+v", event)
+	}
+
+	// A failing receiver is reported, not retried
+	reqBody = `{"url": "` + hook.URL + `/broken"}`
+	rr = httptest.NewRecorder()
+	r.handleTestWebhook(rr, httptest.NewRequest(http.MethodPost, "/v1/webhook/test", strings.NewReader(reqBody)))
+
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Data.Delivered || resp.Data.StatusCode != http.StatusInternalServerError || resp.Data.Error == "" {
+		t.Errorf("Expected a failed delivery with its status, got %+v", resp.Data)
+	}
+
+	// The URL must be one a delivery could reach
+	rr = httptest.NewRecorder()
+	r.handleTestWebhook(rr, httptest.NewRequest(http.MethodPost, "/v1/webhook/test", strings.NewReader(`{"url": "ftp://example.com"}`)))
+
+	fields := decodeFieldErrors(t, rr)
+	if fields["url"] == "" {
+		t.Errorf("Expected an error for url, got %v", fields)
+	}
+}
+
+func TestHandleTestWebhookPrivateDestination(t *testing.T) {
+	var received bool
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer hook.Close()
+
+	r := &Router{}
+	for _, target := range []string{hook.URL, "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1:6379/"} {
+		rr := httptest.NewRecorder()
+		r.handleTestWebhook(rr, httptest.NewRequest(http.MethodPost, "/v1/webhook/test", strings.NewReader(`{"url": "`+target+`"}`)))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got status %d", target, rr.Code)
+		}
+	}
+	if received {
+		t.Error("Expected nothing to be sent to a loopback receiver")
+	}
+}
@@ -3,17 +3,29 @@ package config
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
+	"github.com/ncecere/rummage/pkg/export"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+	"github.com/ncecere/rummage/pkg/utils"
 	"github.com/spf13/viper"
 )
 
+// defaultUserAgent is the User-Agent sent when none is configured.
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"
+
 // Config represents the application configuration.
 type Config struct {
 	// Server configuration
 	Port    string
 	BaseURL string
+	// LogLevel is the least severe level logged
+	LogLevel slog.Level
+	// ShutdownTimeout bounds how long running jobs may finish at shutdown
+	// before they are cancelled
+	ShutdownTimeout time.Duration
 
 	// Redis configuration
 	RedisURL string
@@ -23,6 +35,64 @@ type Config struct {
 	DefaultWaitTime    time.Duration
 	MaxConcurrentJobs  int
 	JobExpirationHours int
+	MaxRequestTimeout  time.Duration
+	UserAgent          string
+	ImageHandling      string
+	Soft404Patterns    []string
+	RawContentTypes    []string
+	PaywallMarkers     []string
+	MaxResponseBytes   int
+	GlobalRPS          int
+	BrowserPath        string
+	MaxScreenshotBytes int
+	ProxyURL           string
+
+	// Crawler configuration
+	MaxIdleConnsPerHost   int
+	DisableKeepAlives     bool
+	HostHeaders           map[string]map[string]string
+	MaxSitemapConcurrency int
+
+	// Link discovery requests sent to each domain at once (default 5); keep
+	// it low for small sites
+	Parallelism int
+	// Pause between link discovery requests to the same domain (default 0,
+	// no pause)
+	DomainDelay time.Duration
+
+	// Export configuration
+	ExportCredentials map[string]export.Credentials
+
+	// Webhook configuration
+	WebhookSecret string
+	// WebhookAllowPrivateNetworks lets webhooks reach loopback, private and
+	// link-local addresses, for local development
+	WebhookAllowPrivateNetworks bool
+
+	// Admin configuration
+	AdminToken  string
+	EnablePprof bool
+
+	// Authentication configuration: keys accepted by the /v1 endpoints,
+	// which are open when there are none or DisableAuth is set
+	APIKeys     []string
+	DisableAuth bool
+
+	// Rate limit configuration: requests per minute the /v1 endpoints accept
+	// in total and per API key (zero is unlimited), and where they are
+	// counted, memory or redis
+	RequestsPerMinute    int
+	KeyRequestsPerMinute int
+	RateLimitBackend     string
+
+	// CORS configuration: origins browsers may call the API from, or * for
+	// any; none disables CORS
+	CORSOrigins []string
+
+	// LLM configuration for the json format
+	LLMBaseURL string
+	LLMAPIKey  string
+	LLMModel   string
 }
 
 // LoadConfig loads the configuration from environment variables and config files.
@@ -32,17 +102,58 @@ func LoadConfig() (*Config, error) {
 	// Set default values
 	v.SetDefault("server.port", "8080")
 	v.SetDefault("server.baseURL", "")
+	v.SetDefault("server.logLevel", "info")
+	v.SetDefault("server.shutdownTimeoutMS", 30000)
 	v.SetDefault("redis.url", "redis://localhost:6379")
 	v.SetDefault("scraper.defaultTimeoutMS", 30000)
 	v.SetDefault("scraper.defaultWaitTimeMS", 0)
 	v.SetDefault("scraper.maxConcurrentJobs", 10)
 	v.SetDefault("scraper.jobExpirationHours", 24)
+	v.SetDefault("scraper.maxRequestTimeoutMS", 120000)
+	v.SetDefault("scraper.userAgent", defaultUserAgent)
+	v.SetDefault("scraper.imageHandling", "keep")
+	v.SetDefault("scraper.globalRPS", 0)
+	v.SetDefault("scraper.browserPath", "")
+	v.SetDefault("scraper.maxScreenshotBytes", 5242880)
+	v.SetDefault("scraper.maxResponseBytes", 10485760)
+	v.SetDefault("scraper.proxyURL", "")
+	v.SetDefault("crawler.maxIdleConnsPerHost", 10)
+	v.SetDefault("crawler.disableKeepAlives", false)
+	v.SetDefault("crawler.maxSitemapConcurrency", 4)
+	v.SetDefault("crawler.parallelism", 5)
+	v.SetDefault("crawler.domainDelayMS", 0)
+	v.SetDefault("webhook.secret", "")
+	v.SetDefault("webhook.allowPrivateNetworks", false)
+	v.SetDefault("admin.token", "")
+	v.SetDefault("admin.pprof", false)
+	v.SetDefault("auth.disabled", false)
+	v.SetDefault("rateLimit.requestsPerMinute", 0)
+	v.SetDefault("rateLimit.keyRequestsPerMinute", 0)
+	v.SetDefault("rateLimit.backend", ratelimit.BackendMemory)
+	v.SetDefault("llm.baseURL", "")
+	v.SetDefault("llm.apiKey", "")
+	v.SetDefault("llm.model", "")
 
 	// Set environment variable prefix and bind environment variables
 	v.SetEnvPrefix("RUMMAGE")
 	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	v.AutomaticEnv()
 
+	// The timeout ceiling is also exposed under a shorter, flat name
+	if err := v.BindEnv("scraper.maxRequestTimeoutMS", "RUMMAGE_MAX_REQUEST_TIMEOUT_MS", "RUMMAGE_SCRAPER_MAXREQUESTTIMEOUTMS"); err != nil {
+		return nil, fmt.Errorf("failed to bind environment variable: %w", err)
+	}
+
+	// The global rate limit is also exposed under a shorter, flat name
+	if err := v.BindEnv("scraper.globalRPS", "RUMMAGE_GLOBAL_RPS", "RUMMAGE_SCRAPER_GLOBALRPS"); err != nil {
+		return nil, fmt.Errorf("failed to bind environment variable: %w", err)
+	}
+
+	// The default proxy is also read from the conventional flat name
+	if err := v.BindEnv("scraper.proxyURL", "RUMMAGE_PROXY_URL", "RUMMAGE_SCRAPER_PROXYURL", "PROXY_URL"); err != nil {
+		return nil, fmt.Errorf("failed to bind environment variable: %w", err)
+	}
+
 	// Read config file
 	v.SetConfigName("config")
 	v.SetConfigType("yaml")
@@ -62,8 +173,9 @@ func LoadConfig() (*Config, error) {
 	// Create config struct with default values
 	cfg := &Config{
 		// Server configuration
-		Port:    v.GetString("server.port"),
-		BaseURL: v.GetString("server.baseURL"),
+		Port:            v.GetString("server.port"),
+		BaseURL:         v.GetString("server.baseURL"),
+		ShutdownTimeout: time.Duration(getIntWithDefault(v, "server.shutdownTimeoutMS", 30000)) * time.Millisecond,
 
 		// Redis configuration
 		RedisURL: v.GetString("redis.url"),
@@ -73,6 +185,72 @@ func LoadConfig() (*Config, error) {
 		DefaultWaitTime:    time.Duration(getIntWithDefault(v, "scraper.defaultWaitTimeMS", 0)) * time.Millisecond,
 		MaxConcurrentJobs:  getIntWithDefault(v, "scraper.maxConcurrentJobs", 10),
 		JobExpirationHours: getIntWithDefault(v, "scraper.jobExpirationHours", 24),
+		MaxRequestTimeout:  time.Duration(getIntWithDefault(v, "scraper.maxRequestTimeoutMS", 120000)) * time.Millisecond,
+		UserAgent:          v.GetString("scraper.userAgent"),
+		ImageHandling:      v.GetString("scraper.imageHandling"),
+		Soft404Patterns:    v.GetStringSlice("scraper.soft404Patterns"),
+		RawContentTypes:    v.GetStringSlice("scraper.rawContentTypes"),
+		PaywallMarkers:     v.GetStringSlice("scraper.paywallMarkers"),
+		MaxResponseBytes:   getIntWithDefault(v, "scraper.maxResponseBytes", 10485760),
+		GlobalRPS:          getIntWithDefault(v, "scraper.globalRPS", 0),
+		BrowserPath:        v.GetString("scraper.browserPath"),
+		MaxScreenshotBytes: getIntWithDefault(v, "scraper.maxScreenshotBytes", 5242880),
+		ProxyURL:           v.GetString("scraper.proxyURL"),
+
+		// Crawler configuration
+		MaxIdleConnsPerHost:   getIntWithDefault(v, "crawler.maxIdleConnsPerHost", 10),
+		DisableKeepAlives:     v.GetBool("crawler.disableKeepAlives"),
+		HostHeaders:           getHostHeaders(v, "crawler.hostHeaders"),
+		MaxSitemapConcurrency: getIntWithDefault(v, "crawler.maxSitemapConcurrency", 4),
+		Parallelism:           getIntWithDefault(v, "crawler.parallelism", 5),
+		DomainDelay:           time.Duration(getIntWithDefault(v, "crawler.domainDelayMS", 0)) * time.Millisecond,
+
+		// Webhook configuration
+		WebhookSecret:               v.GetString("webhook.secret"),
+		WebhookAllowPrivateNetworks: v.GetBool("webhook.allowPrivateNetworks"),
+
+		// Admin configuration
+		AdminToken:  v.GetString("admin.token"),
+		EnablePprof: v.GetBool("admin.pprof"),
+
+		// Authentication configuration
+		APIKeys:     getList(v, "auth.apiKeys"),
+		DisableAuth: v.GetBool("auth.disabled"),
+
+		// Rate limit configuration
+		RequestsPerMinute:    getIntWithDefault(v, "rateLimit.requestsPerMinute", 0),
+		KeyRequestsPerMinute: getIntWithDefault(v, "rateLimit.keyRequestsPerMinute", 0),
+		RateLimitBackend:     v.GetString("rateLimit.backend"),
+
+		// CORS configuration
+		CORSOrigins: getList(v, "cors.origins"),
+
+		// LLM configuration
+		LLMBaseURL: v.GetString("llm.baseURL"),
+		LLMAPIKey:  v.GetString("llm.apiKey"),
+		LLMModel:   v.GetString("llm.model"),
+	}
+
+	// Named credentials for crawl result destinations
+	if err := v.UnmarshalKey("export.credentials", &cfg.ExportCredentials); err != nil {
+		return nil, fmt.Errorf("failed to read export credentials: %w", err)
+	}
+
+	// A default proxy the transport can't use would fail every request
+	if cfg.ProxyURL != "" {
+		if _, err := utils.ParseProxy(cfg.ProxyURL); err != nil {
+			return nil, fmt.Errorf("invalid scraper.proxyURL: %w", err)
+		}
+	}
+
+	// The log level must be one slog knows
+	if err := cfg.LogLevel.UnmarshalText([]byte(v.GetString("server.logLevel"))); err != nil {
+		return nil, fmt.Errorf("invalid server.logLevel %q: must be debug, info, warn or error", v.GetString("server.logLevel"))
+	}
+
+	// Incoming requests can only be counted where the server knows how
+	if !ratelimit.IsValidBackend(cfg.RateLimitBackend) {
+		return nil, fmt.Errorf("invalid rateLimit.backend %q: must be memory or redis", cfg.RateLimitBackend)
 	}
 
 	// If BaseURL is not set, derive it from Port
@@ -104,3 +282,39 @@ func getIntWithDefault(v *viper.Viper, key string, defaultValue int) int {
 
 	return value
 }
+
+// getList reads a list of strings from Viper. Entries may also be separated by
+// commas, as they are when set through an environment variable; empty entries
+// are dropped.
+func getList(v *viper.Viper, key string) []string {
+	var list []string
+	for _, value := range v.GetStringSlice(key) {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				list = append(list, entry)
+			}
+		}
+	}
+	return list
+}
+
+// getHostHeaders reads a map of host names to header maps from Viper. Host
+// names contain dots, so the nested maps are read directly rather than through
+// dotted keys. Host names are lowercased to match request hosts.
+func getHostHeaders(v *viper.Viper, key string) map[string]map[string]string {
+	hostHeaders := make(map[string]map[string]string)
+	for host, value := range v.GetStringMap(key) {
+		rawHeaders, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		headers := make(map[string]string, len(rawHeaders))
+		for name, headerValue := range rawHeaders {
+			headers[name] = fmt.Sprint(headerValue)
+		}
+		hostHeaders[strings.ToLower(host)] = headers
+	}
+
+	return hostHeaders
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"testing"
 	"time"
@@ -15,6 +16,8 @@ func TestLoadConfig(t *testing.T) {
 	origDefaultWaitTime := os.Getenv("RUMMAGE_SCRAPER_DEFAULTWAITTIMEMS")
 	origMaxConcurrentJobs := os.Getenv("RUMMAGE_SCRAPER_MAXCONCURRENTJOBS")
 	origJobExpirationHours := os.Getenv("RUMMAGE_SCRAPER_JOBEXPIRATIONHOURS")
+	origMaxRequestTimeout := os.Getenv("RUMMAGE_MAX_REQUEST_TIMEOUT_MS")
+	origGlobalRPS := os.Getenv("RUMMAGE_GLOBAL_RPS")
 
 	// Restore environment variables after the test
 	defer func() {
@@ -25,6 +28,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("RUMMAGE_SCRAPER_DEFAULTWAITTIMEMS", origDefaultWaitTime)
 		os.Setenv("RUMMAGE_SCRAPER_MAXCONCURRENTJOBS", origMaxConcurrentJobs)
 		os.Setenv("RUMMAGE_SCRAPER_JOBEXPIRATIONHOURS", origJobExpirationHours)
+		os.Setenv("RUMMAGE_MAX_REQUEST_TIMEOUT_MS", origMaxRequestTimeout)
+		os.Setenv("RUMMAGE_GLOBAL_RPS", origGlobalRPS)
 	}()
 
 	// Test with default values
@@ -37,6 +42,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Unsetenv("RUMMAGE_SCRAPER_DEFAULTWAITTIMEMS")
 		os.Unsetenv("RUMMAGE_SCRAPER_MAXCONCURRENTJOBS")
 		os.Unsetenv("RUMMAGE_SCRAPER_JOBEXPIRATIONHOURS")
+		os.Unsetenv("RUMMAGE_MAX_REQUEST_TIMEOUT_MS")
+		os.Unsetenv("RUMMAGE_GLOBAL_RPS")
 
 		cfg, err := LoadConfig()
 		if err != nil {
@@ -65,6 +72,57 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.JobExpirationHours != 24 {
 			t.Errorf("Expected default JobExpirationHours to be 24, got '%d'", cfg.JobExpirationHours)
 		}
+		if cfg.MaxRequestTimeout != 120000*time.Millisecond {
+			t.Errorf("Expected default MaxRequestTimeout to be 120000ms, got '%v'", cfg.MaxRequestTimeout)
+		}
+		if cfg.MaxIdleConnsPerHost != 10 {
+			t.Errorf("Expected default MaxIdleConnsPerHost to be 10, got '%d'", cfg.MaxIdleConnsPerHost)
+		}
+		if cfg.DisableKeepAlives {
+			t.Errorf("Expected default DisableKeepAlives to be false, got '%v'", cfg.DisableKeepAlives)
+		}
+		if cfg.UserAgent != defaultUserAgent {
+			t.Errorf("Expected default UserAgent to be '%s', got '%s'", defaultUserAgent, cfg.UserAgent)
+		}
+		if cfg.GlobalRPS != 0 {
+			t.Errorf("Expected default GlobalRPS to be 0, got '%d'", cfg.GlobalRPS)
+		}
+		if cfg.BrowserPath != "" {
+			t.Errorf("Expected no default BrowserPath, got '%s'", cfg.BrowserPath)
+		}
+		if cfg.ProxyURL != "" {
+			t.Errorf("Expected no default ProxyURL, got '%s'", cfg.ProxyURL)
+		}
+		if cfg.WebhookSecret != "" {
+			t.Errorf("Expected no default WebhookSecret, got '%s'", cfg.WebhookSecret)
+		}
+		if cfg.AdminToken != "" {
+			t.Errorf("Expected no default AdminToken, got '%s'", cfg.AdminToken)
+		}
+		if cfg.EnablePprof {
+			t.Errorf("Expected default EnablePprof to be false, got '%v'", cfg.EnablePprof)
+		}
+		if cfg.MaxScreenshotBytes != 5242880 {
+			t.Errorf("Expected default MaxScreenshotBytes to be 5242880, got '%d'", cfg.MaxScreenshotBytes)
+		}
+		if cfg.MaxResponseBytes != 10485760 {
+			t.Errorf("Expected default MaxResponseBytes to be 10485760, got '%d'", cfg.MaxResponseBytes)
+		}
+		if cfg.ImageHandling != "keep" {
+			t.Errorf("Expected default ImageHandling to be 'keep', got '%s'", cfg.ImageHandling)
+		}
+		if cfg.MaxSitemapConcurrency != 4 {
+			t.Errorf("Expected default MaxSitemapConcurrency to be 4, got '%d'", cfg.MaxSitemapConcurrency)
+		}
+		if cfg.Parallelism != 5 {
+			t.Errorf("Expected default Parallelism to be 5, got '%d'", cfg.Parallelism)
+		}
+		if cfg.DomainDelay != 0 {
+			t.Errorf("Expected default DomainDelay to be 0, got '%v'", cfg.DomainDelay)
+		}
+		if len(cfg.HostHeaders) != 0 {
+			t.Errorf("Expected no default HostHeaders, got '%v'", cfg.HostHeaders)
+		}
 	})
 
 	// Test with custom values
@@ -77,6 +135,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("RUMMAGE_SCRAPER_DEFAULTWAITTIMEMS", "1000")
 		os.Setenv("RUMMAGE_SCRAPER_MAXCONCURRENTJOBS", "5")
 		os.Setenv("RUMMAGE_SCRAPER_JOBEXPIRATIONHOURS", "48")
+		os.Setenv("RUMMAGE_MAX_REQUEST_TIMEOUT_MS", "60000")
+		os.Setenv("RUMMAGE_GLOBAL_RPS", "25")
 
 		cfg, err := LoadConfig()
 		if err != nil {
@@ -105,6 +165,12 @@ func TestLoadConfig(t *testing.T) {
 		if cfg.JobExpirationHours != 48 {
 			t.Errorf("Expected JobExpirationHours to be 48, got '%d'", cfg.JobExpirationHours)
 		}
+		if cfg.MaxRequestTimeout != 60000*time.Millisecond {
+			t.Errorf("Expected MaxRequestTimeout to be 60000ms, got '%v'", cfg.MaxRequestTimeout)
+		}
+		if cfg.GlobalRPS != 25 {
+			t.Errorf("Expected GlobalRPS to be 25, got '%d'", cfg.GlobalRPS)
+		}
 	})
 
 	// Test with invalid values
@@ -127,3 +193,89 @@ func TestLoadConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestLoadConfigProxy(t *testing.T) {
+	t.Setenv("PROXY_URL", "socks5://proxy.internal:1080")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.ProxyURL != "socks5://proxy.internal:1080" {
+		t.Errorf("Expected ProxyURL from PROXY_URL, got '%s'", cfg.ProxyURL)
+	}
+
+	// An unsupported scheme is rejected at startup
+	t.Setenv("PROXY_URL", "ftp://proxy.internal")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for an unsupported proxy scheme")
+	}
+}
+
+func TestLoadConfigCrawlerLimits(t *testing.T) {
+	t.Setenv("RUMMAGE_CRAWLER_PARALLELISM", "2")
+	t.Setenv("RUMMAGE_CRAWLER_DOMAINDELAYMS", "250")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Parallelism != 2 {
+		t.Errorf("Expected Parallelism to be 2, got '%d'", cfg.Parallelism)
+	}
+	if cfg.DomainDelay != 250*time.Millisecond {
+		t.Errorf("Expected DomainDelay to be 250ms, got '%v'", cfg.DomainDelay)
+	}
+}
+
+func TestLoadConfigAPIKeys(t *testing.T) {
+	t.Setenv("RUMMAGE_AUTH_APIKEYS", "key-one, key-two,")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.APIKeys) != 2 || cfg.APIKeys[0] != "key-one" || cfg.APIKeys[1] != "key-two" {
+		t.Errorf("Expected APIKeys [key-one key-two], got %q", cfg.APIKeys)
+	}
+	if cfg.DisableAuth {
+		t.Error("Expected DisableAuth to default to false")
+	}
+}
+
+func TestLoadConfigCORSOrigins(t *testing.T) {
+	t.Setenv("RUMMAGE_CORS_ORIGINS", "https://tools.example.com,https://admin.example.com")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[1] != "https://admin.example.com" {
+		t.Errorf("Expected two CORS origins, got %q", cfg.CORSOrigins)
+	}
+}
+
+func TestLoadConfigLogLevel(t *testing.T) {
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelInfo {
+		t.Errorf("Expected the info log level by default, got %v", cfg.LogLevel)
+	}
+
+	t.Setenv("RUMMAGE_SERVER_LOGLEVEL", "debug")
+	cfg, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("Expected the debug log level, got %v", cfg.LogLevel)
+	}
+
+	// An unknown level is rejected at startup
+	t.Setenv("RUMMAGE_SERVER_LOGLEVEL", "chatty")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for an unknown log level")
+	}
+}
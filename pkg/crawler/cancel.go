@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// runningJobs tracks the crawls running on this server so they can be
+// cancelled.
+type runningJobs struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// newRunningJobs creates an empty job registry.
+func newRunningJobs() *runningJobs {
+	return &runningJobs{cancels: make(map[string]context.CancelFunc)}
+}
+
+// start registers a running job and returns a context derived from ctx that
+// is also cancelled when the job is, along with a func to call once the job
+// finishes.
+func (j *runningJobs) start(ctx context.Context, jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	j.mu.Lock()
+	j.cancels[jobID] = cancel
+	j.mu.Unlock()
+
+	return ctx, func() {
+		j.mu.Lock()
+		delete(j.cancels, jobID)
+		j.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels a running job and reports whether it was running.
+func (j *runningJobs) cancel(jobID string) bool {
+	j.mu.Lock()
+	cancel, ok := j.cancels[jobID]
+	j.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// running returns the IDs of the running jobs.
+func (j *runningJobs) running() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ids := make([]string, 0, len(j.cancels))
+	for jobID := range j.cancels {
+		ids = append(ids, jobID)
+	}
+	return ids
+}
+
+// finishCancelled records a crawl stopped by cancellation: results buffered
+// so far are stored, the job is marked cancelled and the webhook is told.
+func (s *Service) finishCancelled(jobID string, req model.CrawlRequest) {
+	s.flushResults(jobID)
+	if s.updateJobStatusFn != nil {
+		_ = s.updateJobStatusFn(jobID, "cancelled", 0)
+	}
+	s.notifyWebhook(jobID, req, model.WebhookFailed, model.WebhookEvent{Error: "crawl cancelled"})
+}
@@ -0,0 +1,82 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// defaultCanonicalize is used when a map request doesn't set canonicalize.
+var defaultCanonicalize = model.CanonicalizeOptions{
+	StripFragments:    true,
+	StripDefaultPorts: true,
+	SortQuery:         true,
+}
+
+// defaultPorts maps each scheme to the port it implies.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// canonicalURL returns the form of a link used to compare it with others.
+// Links that don't parse are returned unchanged.
+func canonicalURL(rawURL string, opts model.CanonicalizeOptions) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if u.Path == "" && u.Host != "" {
+		u.Path = "/"
+	}
+
+	if opts.StripFragments {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+	if opts.StripDefaultPorts && u.Port() != "" && u.Port() == defaultPorts[u.Scheme] {
+		u.Host = u.Hostname()
+		if strings.Contains(u.Host, ":") {
+			u.Host = "[" + u.Host + "]"
+		}
+	}
+	switch {
+	case opts.StripQuery:
+		u.RawQuery = ""
+		u.ForceQuery = false
+	case opts.SortQuery:
+		// Encode sorts by key; values of a repeated key keep their order
+		u.RawQuery = u.Query().Encode()
+	}
+
+	return u.String()
+}
+
+// mapCanonicalize returns the options a map request compares links with:
+// its canonicalize options, dropping the query when it ignores query
+// parameters.
+func mapCanonicalize(req model.MapRequest) model.CanonicalizeOptions {
+	opts := defaultCanonicalize
+	if req.Canonicalize != nil {
+		opts = *req.Canonicalize
+	}
+	if req.IgnoreQueryParameters {
+		opts.StripQuery = true
+	}
+	return opts
+}
+
+// stripQuery removes the query string from a link.
+func stripQuery(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.RawQuery = ""
+	u.ForceQuery = false
+	return u.String()
+}
@@ -2,6 +2,8 @@
 package crawler
 
 import (
+	"context"
+	"fmt"
 	"net/url"
 	"strings"
 	"sync"
@@ -9,94 +11,157 @@ import (
 
 	"github.com/gocolly/colly/v2"
 	"github.com/google/uuid"
+	"github.com/ncecere/rummage/pkg/export"
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/storage"
+	"github.com/ncecere/rummage/pkg/utils"
 )
 
-// ProcessCrawlJob processes a crawl job in the background.
-func (s *Service) ProcessCrawlJob(jobID string, req model.CrawlRequest) {
+// ProcessCrawlJob processes a crawl job in the background. The crawl stops,
+// and is marked cancelled, when ctx is cancelled or CancelCrawl is called.
+func (s *Service) ProcessCrawlJob(ctx context.Context, jobID string, req model.CrawlRequest) {
+	ctx, done := s.jobs.start(ctx, jobID)
+	defer done()
+
+	// Each phase gets its own timeout; pages are scraped with the scrape one
+	discoveryTimeout, scrapeTimeout := req.PhaseTimeouts()
+	req.ScrapeOptions = withTimeout(req.ScrapeOptions, scrapeTimeout)
+	req.ScrapeOptions = withInternalHosts(req.ScrapeOptions, req.InternalHosts)
+
+	s.notifyWebhook(jobID, req, model.WebhookStarted, model.WebhookEvent{})
+
+	// Compile the URL rewrite rules once for the whole crawl, and check the
+	// filter expression compiles before discovery starts
+	rewriter, err := newURLRewriter(req.URLRewriteRules)
+	if err == nil {
+		err = ValidateFilterExpression(req.FilterExpression)
+	}
+	if err != nil {
+		if s.updateJobStatusFn != nil {
+			_ = s.updateJobStatusFn(jobID, "failed", 0)
+		}
+		s.notifyWebhook(jobID, req, model.WebhookFailed, model.WebhookEvent{Error: err.Error()})
+		return
+	}
+
+	// Export page results when a destination is requested
+	if req.Destination != nil {
+		writer, err := export.NewWriter(*req.Destination, s.exportCredentials)
+		if err != nil {
+			if s.updateJobStatusFn != nil {
+				_ = s.updateJobStatusFn(jobID, "failed", 0)
+			}
+			s.notifyWebhook(jobID, req, model.WebhookFailed, model.WebhookEvent{Error: err.Error()})
+			return
+		}
+		s = s.withDestination(writer, *req.Destination)
+	}
+
+	// Retry and buffer result writes so a storage outage doesn't lose pages
+	if s.updateJobFn != nil {
+		s = s.withBufferedResults(storage.NewBufferedWriter(s.updateJobFn, 0))
+	}
+
+	// Discover and scrape through a transport dedicated to this crawl, so
+	// its proxy and connection settings apply throughout
+	transport := s.newCrawlTransport(req)
+	defer transport.CloseIdleConnections()
+	crawl := s.withTransport(transport)
+
 	// First, use the Map function to discover URLs
+	delayMS, randomDelayMS := crawlDelays(req)
 	mapReq := model.MapRequest{
-		URL:               req.URL,
-		IgnoreSitemap:     req.IgnoreSitemap,
-		IncludeSubdomains: req.AllowExternalLinks,
-		Limit:             req.Limit,
-		ExcludePaths:      req.ExcludePaths,
-		IncludePaths:      req.IncludePaths,
+		URL:                   req.URL,
+		IgnoreSitemap:         req.IgnoreSitemap,
+		SitemapOnly:           req.SitemapOnly,
+		IncludeSubdomains:     req.AllowExternalLinks,
+		InternalHosts:         req.InternalHosts,
+		IgnoreBaseHref:        req.IgnoreBaseHref,
+		IgnoreQueryParameters: req.IgnoreQueryParameters,
+		Limit:                 req.Limit,
+		MaxDepth:              req.DiscoveryDepth(),
+		ExcludePaths:          req.ExcludePaths,
+		IncludePaths:          req.IncludePaths,
+		PathMatching:          req.PathMatching,
+		FilterExpression:      req.FilterExpression,
+		Timeout:               discoveryTimeout,
+		Parallelism:           req.Parallelism,
+		Delay:                 delayMS,
+		RandomDelay:           randomDelayMS,
+	}
+
+	// Cap discovery separately from the scrape limit
+	discoveryCapped := false
+	if req.MaxLinksDiscovered > 0 && req.MaxLinksDiscovered < mapReq.Limit {
+		mapReq.Limit = req.MaxLinksDiscovered
 	}
 
 	// Get all URLs from the map function
-	mapResult, err := s.Map(mapReq)
+	mapResult, err := crawl.Map(mapReq)
 	if err != nil {
 		// If map fails, fall back to the original crawl method
-		s.processCrawlJobOriginal(jobID, req)
+		s.processCrawlJobOriginal(ctx, jobID, req, rewriter)
+		return
+	}
+	if ctx.Err() != nil {
+		s.finishCancelled(jobID, req)
 		return
 	}
 
-	// Track errors
-	errors := make([]model.CrawlError, 0)
-	var errorsMutex sync.Mutex
+	// Rewrite discovered URLs before they are scraped
+	mapResult.Links = rewriter.rewriteAll(mapResult.Links)
+
+	// Record whether discovery stopped at the cap rather than the scrape limit
+	if req.MaxLinksDiscovered > 0 && req.MaxLinksDiscovered < req.Limit && len(mapResult.Links) >= req.MaxLinksDiscovered {
+		discoveryCapped = true
+	}
 
 	// Update the job status to set the initial total count
 	if s.updateJobStatusFn != nil {
 		_ = s.updateJobStatusFn(jobID, "scraping", len(mapResult.Links))
 	}
 
-	// Process each URL from the map result
-	for i, url := range mapResult.Links {
-		// Create a scrape request for this URL
-		scrapeReq := model.ScrapeRequest{
-			URL: url,
-		}
-
-		// Copy scrape options from crawl request
-		if req.ScrapeOptions != nil {
-			scrapeReq.Formats = req.ScrapeOptions.Formats
-			scrapeReq.OnlyMainContent = req.ScrapeOptions.OnlyMainContent
-			scrapeReq.IncludeTags = req.ScrapeOptions.IncludeTags
-			scrapeReq.ExcludeTags = req.ScrapeOptions.ExcludeTags
-			scrapeReq.Headers = req.ScrapeOptions.Headers
-			scrapeReq.WaitFor = req.ScrapeOptions.WaitFor
-			scrapeReq.Timeout = req.ScrapeOptions.Timeout
-		}
+	// Report each page to the webhook as it's recorded
+	total := len(mapResult.Links)
+	crawl = crawl.withWebhookPages(req, func() int { return total })
 
-		// Scrape the URL
-		result, err := s.scraper.Scrape(scrapeReq)
-		if err != nil {
-			// Create an error result
-			errorsMutex.Lock()
-			errors = append(errors, model.CrawlError{
-				ID:        uuid.New().String(),
-				Timestamp: time.Now().Format(time.RFC3339),
-				URL:       url,
-				Error:     err.Error(),
-			})
-			errorsMutex.Unlock()
-			continue
-		}
-
-		// Call the update job function
-		if s.updateJobFn != nil {
-			_ = s.updateJobFn(jobID, *result)
-		}
+	// Process each URL from the map result
+	crawlErrors, blocked := crawl.scrapeLinks(ctx, jobID, mapResult.Links, req.ScrapeOptions, 0, req.AutoRetryStrategy)
 
-		// Update job status periodically
-		if s.updateJobStatusFn != nil && i%10 == 0 {
-			_ = s.updateJobStatusFn(jobID, "scraping", len(mapResult.Links))
+	// If every early page failed, retry the whole crawl once with a fallback strategy
+	if blocked && ctx.Err() == nil {
+		if s.markRetriedFn != nil {
+			_ = s.markRetriedFn(jobID)
 		}
+		crawlErrors, _ = crawl.scrapeLinks(ctx, jobID, mapResult.Links, fallbackScrapeOptions(req.ScrapeOptions), fallbackDelay, false)
 	}
+	if ctx.Err() != nil {
+		s.finishCancelled(jobID, req)
+		return
+	}
+
+	// Store results buffered during a storage outage before completing
+	s.flushResults(jobID)
 
 	// Update job status to completed and set the total count
 	if s.updateJobStatusFn != nil {
 		_ = s.updateJobStatusFn(jobID, "completed", len(mapResult.Links))
 	}
 
-	// Store errors and robots blocked URLs
-	// Note: In a real implementation, we would store these in Redis or another storage
+	// Record that the discovery cap was hit
+	if discoveryCapped && s.discoveryCappedFn != nil {
+		_ = s.discoveryCappedFn(jobID)
+	}
+
+	s.notifyWebhook(jobID, req, model.WebhookCompleted, model.WebhookEvent{
+		Total:     len(mapResult.Links),
+		Completed: len(mapResult.Links) - len(crawlErrors),
+	})
 }
 
 // processCrawlJobOriginal is the original implementation of ProcessCrawlJob
 // It's kept as a fallback in case the Map function fails
-func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest) {
+func (s *Service) processCrawlJobOriginal(ctx context.Context, jobID string, req model.CrawlRequest, rewriter urlRewriter) {
 	// Parse the base URL
 	baseURL, err := url.Parse(req.URL)
 	if err != nil {
@@ -107,14 +172,25 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 	c := colly.NewCollector(
 		colly.MaxDepth(req.MaxDepth),
 		colly.Async(true),
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"),
+		colly.UserAgent(s.userAgent),
 	)
 
 	// Set concurrency limit
-	err = c.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		Parallelism: 5,
-	})
+	delayMS, randomDelayMS := crawlDelays(req)
+	err = c.Limit(s.limitRule(req.Parallelism, delayMS, randomDelayMS))
+	if err != nil {
+		return
+	}
+
+	// Use a transport dedicated to this crawl
+	transport := s.newCrawlTransport(req)
+	defer transport.CloseIdleConnections()
+	c.WithTransport(transport)
+	crawl := s.withTransport(transport)
+
+	// Compile the path filters and filter expression once for every link found
+	paths := newPathMatcher(req.IncludePaths, req.ExcludePaths, req.PathMatching)
+	paths.filter, err = newURLFilter(req.FilterExpression)
 	if err != nil {
 		return
 	}
@@ -130,6 +206,17 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 	// Add the initial URL to the discovered URLs
 	discoveredURLs = append(discoveredURLs, req.URL)
 
+	// Report each page to the webhook as it's recorded, against the pages
+	// discovered so far
+	s = s.withWebhookPages(req, func() int {
+		discoveredMutex.Lock()
+		defer discoveredMutex.Unlock()
+		return len(discoveredURLs)
+	})
+
+	// Track whether the discovery cap was hit
+	discoveryCapped := false
+
 	// Update the job status to set the initial total count
 	if s.updateJobStatusFn != nil {
 		_ = s.updateJobStatusFn(jobID, "scraping", 1)
@@ -141,12 +228,21 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 	var errorsMutex sync.Mutex
 
 	// Set timeout
-	timeout := 30000 // Default 30 seconds
-	if req.ScrapeOptions != nil && req.ScrapeOptions.Timeout > 0 {
-		timeout = req.ScrapeOptions.Timeout
+	requestedTimeout := 0
+	if req.ScrapeOptions != nil {
+		requestedTimeout = req.ScrapeOptions.Timeout
 	}
+	timeout, _ := utils.ResolveTimeout(requestedTimeout, defaultTimeoutMS, s.scraper.MaxTimeoutMS())
 	c.SetRequestTimeout(time.Duration(timeout) * time.Millisecond)
 
+	// Fetch nothing more once the crawl is cancelled. The global rate limit
+	// is taken once per page, by the scrape of each response
+	c.OnRequest(func(r *colly.Request) {
+		if ctx.Err() != nil {
+			r.Abort()
+		}
+	})
+
 	// Handle robots.txt
 	if !req.IgnoreSitemap {
 		c.IgnoreRobotsTxt = false
@@ -171,19 +267,22 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 			return
 		}
 
-		// Parse the link
-		linkURL, err := url.Parse(link)
+		// Resolve the link against the page's base URL
+		linkURL, err := resolveLink(e, link, req.IgnoreBaseHref)
 		if err != nil {
 			return
 		}
 
-		// Resolve relative URLs
-		if linkURL.IsAbs() == false {
-			linkURL = baseURL.ResolveReference(linkURL)
+		// Rewrite the URL before it is filtered and normalized
+		if len(rewriter) > 0 {
+			linkURL, err = url.Parse(rewriter.rewrite(linkURL.String()))
+			if err != nil {
+				return
+			}
 		}
 
 		// Skip external links if not allowed
-		if !req.AllowExternalLinks && linkURL.Host != baseURL.Host {
+		if !req.AllowExternalLinks && !utils.IsInternalHost(linkURL.Host, baseURL.Host, req.InternalHosts) {
 			return
 		}
 
@@ -192,8 +291,8 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 			return
 		}
 
-		// Apply include/exclude path filters
-		if !shouldProcessURL(linkURL.String(), req.IncludePaths, req.ExcludePaths) {
+		// Apply include/exclude path filters and the filter expression
+		if !paths.allowsAt(linkURL.String(), e.Request.Depth) {
 			return
 		}
 
@@ -212,8 +311,13 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 		}
 		visitedMutex.Unlock()
 
-		// Add to discovered URLs
+		// Add to discovered URLs, stopping once the discovery cap is hit
 		discoveredMutex.Lock()
+		if req.MaxLinksDiscovered > 0 && len(discoveredURLs) >= req.MaxLinksDiscovered {
+			discoveryCapped = true
+			discoveredMutex.Unlock()
+			return
+		}
 		if len(discoveredURLs) < req.Limit {
 			discoveredURLs = append(discoveredURLs, normalizedURL)
 		}
@@ -233,32 +337,20 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 		visitedMutex.Unlock()
 
 		// Create a scrape request for this URL
-		scrapeReq := model.ScrapeRequest{
-			URL: r.Request.URL.String(),
-		}
+		scrapeReq := newScrapeRequest(r.Request.URL.String(), req.ScrapeOptions)
 
-		// Copy scrape options from crawl request
-		if req.ScrapeOptions != nil {
-			scrapeReq.Formats = req.ScrapeOptions.Formats
-			scrapeReq.OnlyMainContent = req.ScrapeOptions.OnlyMainContent
-			scrapeReq.IncludeTags = req.ScrapeOptions.IncludeTags
-			scrapeReq.ExcludeTags = req.ScrapeOptions.ExcludeTags
-			scrapeReq.Headers = req.ScrapeOptions.Headers
-			scrapeReq.WaitFor = req.ScrapeOptions.WaitFor
-			scrapeReq.Timeout = req.ScrapeOptions.Timeout
+		// Scrape the URL; a page cut short by cancellation isn't recorded
+		result, err := crawl.scraper.ScrapeContext(ctx, scrapeReq)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = soft404Error(req.ScrapeOptions, result)
 		}
-
-		// Scrape the URL
-		result, err := s.scraper.Scrape(scrapeReq)
 		if err != nil {
 			// Create an error result
 			errorsMutex.Lock()
-			errors = append(errors, model.CrawlError{
-				ID:        uuid.New().String(),
-				Timestamp: time.Now().Format(time.RFC3339),
-				URL:       r.Request.URL.String(),
-				Error:     err.Error(),
-			})
+			errors = append(errors, s.recordError(jobID, r.Request.URL.String(), err))
 			errorsMutex.Unlock()
 			return
 		}
@@ -274,13 +366,11 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 		errorsMutex.Lock()
 		if strings.Contains(err.Error(), "blocked by robots.txt") {
 			robotsBlocked = append(robotsBlocked, r.Request.URL.String())
+			if s.storeRobotsBlockedFn != nil {
+				_ = s.storeRobotsBlockedFn(jobID, r.Request.URL.String())
+			}
 		} else {
-			errors = append(errors, model.CrawlError{
-				ID:        uuid.New().String(),
-				Timestamp: time.Now().Format(time.RFC3339),
-				URL:       r.Request.URL.String(),
-				Error:     err.Error(),
-			})
+			errors = append(errors, s.recordError(jobID, r.Request.URL.String(), err))
 		}
 		errorsMutex.Unlock()
 	})
@@ -290,16 +380,116 @@ func (s *Service) processCrawlJobOriginal(jobID string, req model.CrawlRequest)
 
 	// Wait for all requests to finish
 	c.Wait()
+	if ctx.Err() != nil {
+		s.finishCancelled(jobID, req)
+		return
+	}
+
+	// Store results buffered during a storage outage before completing
+	s.flushResults(jobID)
 
 	// Update job status to completed and set the total count
 	if s.updateJobStatusFn != nil {
 		// Update the job status to completed and set the total count
 		_ = s.updateJobStatusFn(jobID, "completed", len(discoveredURLs))
 	}
+
+	// Record that the discovery cap was hit
+	if discoveryCapped && s.discoveryCappedFn != nil {
+		_ = s.discoveryCappedFn(jobID)
+	}
+
+	s.notifyWebhook(jobID, req, model.WebhookCompleted, model.WebhookEvent{
+		Total:     len(discoveredURLs),
+		Completed: len(discoveredURLs) - len(errors),
+	})
 }
 
 // Helper functions
 
+// recordError builds the crawl error for a page that failed and stores it
+// with the job.
+func (s *Service) recordError(jobID, link string, err error) model.CrawlError {
+	crawlError := newCrawlError(link, err)
+	s.storeError(jobID, crawlError)
+	return crawlError
+}
+
+// newCrawlError builds the crawl error for a page that failed.
+func newCrawlError(link string, err error) model.CrawlError {
+	return model.CrawlError{
+		ID:        uuid.New().String(),
+		Timestamp: time.Now().Format(time.RFC3339),
+		URL:       link,
+		Error:     err.Error(),
+	}
+}
+
+// storeError stores a crawl error with the job.
+func (s *Service) storeError(jobID string, crawlError model.CrawlError) {
+	if s.storeErrorFn != nil {
+		_ = s.storeErrorFn(jobID, crawlError)
+	}
+}
+
+// withTimeout returns a copy of the scrape options with the given timeout, or
+// the options unchanged when the timeout is zero.
+func withTimeout(opts *model.CrawlScrapeOptions, timeoutMS int) *model.CrawlScrapeOptions {
+	if timeoutMS == 0 {
+		return opts
+	}
+
+	clone := model.CrawlScrapeOptions{}
+	if opts != nil {
+		clone = *opts
+	}
+	clone.Timeout = timeoutMS
+	return &clone
+}
+
+// withInternalHosts returns a copy of the scrape options that also counts the
+// crawl's internal hosts as internal, or the options unchanged when it has none.
+func withInternalHosts(opts *model.CrawlScrapeOptions, hosts []string) *model.CrawlScrapeOptions {
+	if len(hosts) == 0 {
+		return opts
+	}
+
+	clone := model.CrawlScrapeOptions{}
+	if opts != nil {
+		clone = *opts
+	}
+	clone.InternalHosts = append(append([]string(nil), clone.InternalHosts...), hosts...)
+	return &clone
+}
+
+// newScrapeRequest builds a scrape request for a URL using the crawl's scrape options.
+func newScrapeRequest(pageURL string, opts *model.CrawlScrapeOptions) model.ScrapeRequest {
+	if opts == nil {
+		return model.ScrapeRequest{URL: pageURL}
+	}
+
+	scrapeReq := opts.ScrapeOptions.Request(pageURL)
+	scrapeReq.DetectSoft404 = scrapeReq.DetectSoft404 || opts.Soft404AsError
+	// The crawl's transport already routes through the proxy
+	scrapeReq.Proxy = ""
+	return scrapeReq
+}
+
+// resolveLink resolves a link found on a page. Relative links resolve against
+// the page's <base href> when it declares one, unless ignoreBaseHref is set,
+// and against the page URL otherwise.
+func resolveLink(e *colly.HTMLElement, link string, ignoreBaseHref bool) (*url.URL, error) {
+	if ignoreBaseHref {
+		return e.Request.URL.Parse(link)
+	}
+
+	absURL := e.Request.AbsoluteURL(link)
+	if absURL == "" {
+		return nil, fmt.Errorf("cannot resolve link: %s", link)
+	}
+	return url.Parse(absURL)
+}
+
 // isBackwardLink checks if a link points to a parent directory.
 func isBackwardLink(basePath, linkPath string) bool {
 	baseParts := strings.Split(strings.Trim(basePath, "/"), "/")
@@ -319,31 +509,3 @@ func isBackwardLink(basePath, linkPath string) bool {
 
 	return false
 }
-
-// shouldProcessURL checks if a URL should be processed based on include/exclude paths.
-func shouldProcessURL(urlStr string, includePaths, excludePaths []string) bool {
-	// If include paths are specified, the URL must match one of them
-	if len(includePaths) > 0 {
-		matched := false
-		for _, includePath := range includePaths {
-			if strings.Contains(urlStr, includePath) {
-				matched = true
-				break
-			}
-		}
-		if !matched {
-			return false
-		}
-	}
-
-	// If exclude paths are specified, the URL must not match any of them
-	if len(excludePaths) > 0 {
-		for _, excludePath := range excludePaths {
-			if strings.Contains(urlStr, excludePath) {
-				return false
-			}
-		}
-	}
-
-	return true
-}
@@ -1,9 +1,23 @@
 package crawler
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+	"github.com/ncecere/rummage/pkg/webhook"
 )
 
 func TestCrawl(t *testing.T) {
@@ -88,3 +102,1643 @@ func TestCancelCrawl(t *testing.T) {
 		t.Fatalf("Failed to cancel crawl: %v", err)
 	}
 }
+
+func TestProcessCrawlJobCancel(t *testing.T) {
+	// Pages other than the seed hang until their request is aborted
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/slow</loc></url>
+<url><loc>%[1]s/never</loc></url>
+</urlset>`, server.URL)
+		case "/":
+			fmt.Fprint(w, `<html><body><p>Fast</p></body></html>`)
+		case "/slow", "/never":
+			<-r.Context().Done()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var results []model.ScrapeResult
+	var statuses []string
+	stored := make(chan struct{}, 10)
+	service := NewService(ServiceOptions{
+		UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			stored <- struct{}{}
+			return nil
+		},
+		UpdateJobStatusFn: func(_ string, status string, _ int) error {
+			mu.Lock()
+			statuses = append(statuses, status)
+			mu.Unlock()
+			return nil
+		},
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		service.ProcessCrawlJob(context.Background(), "job-1", model.CrawlRequest{
+			URL:           server.URL + "/",
+			Limit:         10,
+			SitemapOnly:   true,
+			ScrapeOptions: &model.CrawlScrapeOptions{ScrapeOptions: model.ScrapeOptions{Timeout: 60000}},
+		})
+	}()
+
+	// Cancel once the first page is stored and the second is in flight
+	select {
+	case <-stored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the first page to be stored")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := service.CancelCrawl("job-1"); err != nil {
+		t.Fatalf("Failed to cancel crawl: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected cancelling to stop the crawl")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(results) != 1 {
+		t.Errorf("Expected only the page stored before cancelling, got %d", len(results))
+	}
+	if last := statuses[len(statuses)-1]; last != "cancelled" {
+		t.Errorf("Expected the crawl to end cancelled, got statuses %v", statuses)
+	}
+}
+
+func TestProcessCrawlJobDiscoveryCap(t *testing.T) {
+	// Every page links to ten children, so discovery explodes combinatorially
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		var links strings.Builder
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&links, `<a href="%s/%d">link</a>`, path, i)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body>%s</body></html>", links.String())
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	scraped := 0
+	capped := false
+	total := 0
+
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		UpdateJobFn: func(string, model.ScrapeResult) error {
+			mu.Lock()
+			scraped++
+			mu.Unlock()
+			return nil
+		},
+		UpdateJobStatusFn: func(_ string, _ string, n int) error {
+			mu.Lock()
+			total = n
+			mu.Unlock()
+			return nil
+		},
+		DiscoveryCappedFn: func(string) error {
+			capped = true
+			return nil
+		},
+	})
+
+	req := model.CrawlRequest{
+		URL:                server.URL + "/",
+		MaxDepth:           4,
+		Limit:              1000,
+		MaxLinksDiscovered: 15,
+		AllowBackwardLinks: true,
+		IgnoreSitemap:      true,
+	}
+
+	service.processCrawlJobOriginal(context.Background(), "test-job-id", req, nil)
+
+	if !capped {
+		t.Error("Expected discovery cap to be recorded")
+	}
+	if total > req.MaxLinksDiscovered {
+		t.Errorf("Expected at most %d discovered URLs, got %d", req.MaxLinksDiscovered, total)
+	}
+	if scraped > req.MaxLinksDiscovered {
+		t.Errorf("Expected at most %d scraped pages, got %d", req.MaxLinksDiscovered, scraped)
+	}
+}
+
+func TestProcessCrawlJobGlobalRateLimit(t *testing.T) {
+	// The seed links to four pages
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path != "/" {
+			fmt.Fprint(w, "<html><body>leaf</body></html>")
+			return
+		}
+		fmt.Fprint(w, `<html><body><a href="/a">a</a><a href="/b">b</a><a href="/c">c</a><a href="/d">d</a></body></html>`)
+	}))
+	defer server.Close()
+
+	var scraped atomic.Int32
+	limiter := ratelimit.New(20)
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		Limiter: limiter,
+		UpdateJobFn: func(string, model.ScrapeResult) error {
+			scraped.Add(1)
+			return nil
+		},
+	})
+
+	req := model.CrawlRequest{
+		URL:                server.URL + "/",
+		MaxDepth:           2,
+		Limit:              10,
+		AllowBackwardLinks: true,
+		IgnoreSitemap:      true,
+	}
+
+	// Two jobs share the limiter of 20 requests per second
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, jobID := range []string{"job-a", "job-b"} {
+		wg.Add(1)
+		go func(jobID string) {
+			defer wg.Done()
+			service.processCrawlJobOriginal(context.Background(), jobID, req, nil)
+		}(jobID)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	pages := int64(scraped.Load())
+	if pages != 10 {
+		t.Fatalf("Expected 10 scraped pages, got %d", pages)
+	}
+
+	// Each page takes a single token, so 10 pages run at the configured rate
+	if got := limiter.Stats().TotalRequests; got != pages {
+		t.Errorf("Expected %d rate limited requests for %d pages, got %d", pages, pages, got)
+	}
+	if elapsed < 400*time.Millisecond {
+		t.Errorf("Expected 10 pages at 20 per second to take at least 400ms, took %v", elapsed)
+	}
+}
+
+func TestValidateSeed(t *testing.T) {
+	// Serve an HTML page and a JSON document
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "<html><body>ok</body></html>")
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, "{}")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// A server that is already closed acts as a dead seed
+	dead := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	deadURL := dead.URL
+	dead.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{name: "Good seed", url: server.URL + "/", wantErr: false},
+		{name: "Dead seed", url: deadURL + "/", wantErr: true},
+		{name: "Missing page", url: server.URL + "/missing", wantErr: true},
+		{name: "Non-HTML seed", url: server.URL + "/data.json", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.ValidateSeed(model.CrawlRequest{URL: tt.url})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateSeed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateSeedUsesCrawlOptions(t *testing.T) {
+	// Serve the seed over a self-signed certificate, only to a known header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Crawl-Token") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	// Without skipTlsVerification the certificate is rejected
+	if err := service.ValidateSeed(model.CrawlRequest{URL: server.URL + "/"}); err == nil {
+		t.Error("Expected a self-signed seed to fail without skipTlsVerification")
+	}
+
+	req := model.CrawlRequest{
+		URL: server.URL + "/",
+		ScrapeOptions: &model.CrawlScrapeOptions{
+			ScrapeOptions: model.ScrapeOptions{
+				SkipTlsVerification: true,
+				Headers:             map[string]string{"X-Crawl-Token": "secret"},
+			},
+		},
+	}
+	if err := service.ValidateSeed(req); err != nil {
+		t.Errorf("Expected the crawl's TLS settings and headers to apply, got %v", err)
+	}
+}
+
+func TestMapSendsConfiguredHeaders(t *testing.T) {
+	const userAgent = "RummageTest/1.0"
+
+	// Reject default Go clients and requests missing the per-host header
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.UserAgent() != userAgent || r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nSitemap: %s/pages.xml\n", server.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/a</loc></url>
+<url><loc>%[1]s/b</loc></url>
+</urlset>`, server.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{
+		BaseURL:   "http://localhost:8080",
+		UserAgent: userAgent,
+		HostHeaders: map[string]map[string]string{
+			"127.0.0.1": {"X-Api-Key": "secret"},
+		},
+	})
+
+	resp, err := service.Map(model.MapRequest{URL: server.URL + "/", SitemapOnly: true})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, link := range resp.Links {
+		found[link] = true
+	}
+	for _, want := range []string{server.URL + "/a", server.URL + "/b"} {
+		if !found[want] {
+			t.Errorf("Expected %s to be discovered from the sitemap, got %v", want, resp.Links)
+		}
+	}
+}
+
+func TestMapBaseHref(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><base href="/docs/v2/"></head><body><a href="intro">Intro</a></body></html>`)
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	tests := []struct {
+		name           string
+		ignoreBaseHref bool
+		want           string
+	}{
+		{name: "Resolve against base href", want: server.URL + "/docs/v2/intro"},
+		{name: "Ignore base href", ignoreBaseHref: true, want: server.URL + "/guide/intro"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := service.Map(model.MapRequest{
+				URL:            server.URL + "/guide/page",
+				IgnoreSitemap:  true,
+				IgnoreBaseHref: tt.ignoreBaseHref,
+			})
+			if err != nil {
+				t.Fatalf("Map() error = %v", err)
+			}
+
+			found := false
+			for _, link := range resp.Links {
+				if link == tt.want {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected %s to be discovered, got %v", tt.want, resp.Links)
+			}
+		})
+	}
+}
+
+func TestProcessCrawlJobAutoRetry(t *testing.T) {
+	// Block the default user agent, as sites that reject crawlers do
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.UserAgent(), "Chrome/109") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><head><title>Welcome</title></head><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	results := make([]model.ScrapeResult, 0)
+	stored := make([]model.CrawlError, 0)
+	retried := false
+
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			return nil
+		},
+		StoreErrorFn: func(_ string, crawlError model.CrawlError) error {
+			mu.Lock()
+			stored = append(stored, crawlError)
+			mu.Unlock()
+			return nil
+		},
+		MarkRetriedFn: func(string) error {
+			retried = true
+			return nil
+		},
+	})
+
+	req := model.CrawlRequest{
+		URL:               server.URL + "/",
+		Limit:             10,
+		IgnoreSitemap:     true,
+		AutoRetryStrategy: true,
+	}
+
+	service.ProcessCrawlJob(context.Background(), "test-job-id", req)
+
+	if !retried {
+		t.Error("Expected the crawl to be retried")
+	}
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 result after retry, got %d", len(results))
+	}
+	if results[0].Metadata.Title != "Welcome" {
+		t.Errorf("Expected title 'Welcome', got '%s'", results[0].Metadata.Title)
+	}
+
+	// The blocked attempt's failures aren't reported alongside the retry
+	if len(stored) != 0 {
+		t.Errorf("Expected no stored errors after a successful retry, got %v", stored)
+	}
+}
+
+func TestProcessCrawlJobScreenshotWithoutBrowser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/about">About</a><p>Hello</p></body></html>`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	results := make([]model.ScrapeResult, 0)
+	status := ""
+
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+			mu.Lock()
+			results = append(results, result)
+			mu.Unlock()
+			return nil
+		},
+		UpdateJobStatusFn: func(_ string, s string, _ int) error {
+			status = s
+			return nil
+		},
+	})
+
+	req := model.CrawlRequest{
+		URL:           server.URL + "/",
+		Limit:         10,
+		IgnoreSitemap: true,
+		ScrapeOptions: &model.CrawlScrapeOptions{ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown", "screenshot"}}},
+	}
+
+	service.ProcessCrawlJob(context.Background(), "test-job-id", req)
+
+	if status != "completed" {
+		t.Errorf("Expected the crawl to complete, got status %q", status)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected every page to be scraped, got %d results", len(results))
+	}
+	for _, result := range results {
+		if result.Screenshot != "" {
+			t.Error("Expected no screenshot without a browser")
+		}
+		if !strings.Contains(result.Warning, "screenshot skipped") {
+			t.Errorf("Expected a per-page screenshot warning, got %q", result.Warning)
+		}
+		if !strings.Contains(result.Markdown, "Hello") {
+			t.Errorf("Expected markdown alongside the skipped screenshot, got %q", result.Markdown)
+		}
+	}
+}
+
+func TestProcessCrawlJobPhaseTimeouts(t *testing.T) {
+	// Every response is slow; the sitemap lists a second page
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		if r.URL.Path == "/sitemap.xml" {
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<urlset><url><loc>%s/about</loc></url></urlset>`, server.URL)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><p>ok</p></body></html>`)
+	}))
+	defer server.Close()
+
+	crawl := func(discoveryTimeout, scrapeTimeout int) []string {
+		var mu sync.Mutex
+		scraped := make([]string, 0)
+		service := NewService(ServiceOptions{
+			BaseURL: "http://localhost:8080",
+			UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+				mu.Lock()
+				scraped = append(scraped, result.Metadata.SourceURL)
+				mu.Unlock()
+				return nil
+			},
+		})
+		service.ProcessCrawlJob(context.Background(), "test-job-id", model.CrawlRequest{
+			URL:                server.URL + "/",
+			Limit:              10,
+			DiscoveryTimeoutMS: discoveryTimeout,
+			ScrapeTimeoutMS:    scrapeTimeout,
+		})
+		return scraped
+	}
+
+	// A short discovery timeout misses the sitemap, but pages still scrape
+	if scraped := crawl(50, 2000); len(scraped) != 1 {
+		t.Errorf("Expected only the seed to be discovered and scraped, got %v", scraped)
+	}
+
+	// A short scrape timeout fails the pages that discovery found
+	if scraped := crawl(2000, 50); len(scraped) != 0 {
+		t.Errorf("Expected every page scrape to time out, got %v", scraped)
+	}
+
+	// Both phases succeed with generous timeouts
+	if scraped := crawl(2000, 2000); len(scraped) != 2 {
+		t.Errorf("Expected the seed and the sitemap page, got %v", scraped)
+	}
+}
+
+func TestProcessCrawlJobURLRewrite(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/en-us/path">Localized</a><a href="/path">Plain</a></body></html>`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	scraped := make([]string, 0)
+
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+			mu.Lock()
+			scraped = append(scraped, result.Metadata.SourceURL)
+			mu.Unlock()
+			return nil
+		},
+	})
+
+	req := model.CrawlRequest{
+		URL:           server.URL + "/",
+		Limit:         10,
+		IgnoreSitemap: true,
+		URLRewriteRules: []model.URLRewriteRule{
+			{Pattern: `/en-us(/.*)$`, Replacement: "$1"},
+		},
+	}
+
+	service.ProcessCrawlJob(context.Background(), "test-job-id", req)
+
+	count := 0
+	for _, u := range scraped {
+		if strings.Contains(u, "/en-us/") {
+			t.Errorf("Expected %s to be rewritten", u)
+		}
+		if u == server.URL+"/path" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Expected /path to be scraped once, got %d times in %v", count, scraped)
+	}
+}
+
+func TestNewURLRewriter(t *testing.T) {
+	if _, err := newURLRewriter([]model.URLRewriteRule{{Pattern: "("}}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+
+	rewriter, err := newURLRewriter([]model.URLRewriteRule{
+		{Pattern: `/amp/?$`, Replacement: ""},
+		{Pattern: `/(en|fr)-[a-z]{2}/`, Replacement: "/"},
+	})
+	if err != nil {
+		t.Fatalf("newURLRewriter() error = %v", err)
+	}
+
+	got := rewriter.rewrite("https://example.com/fr-ca/article/amp")
+	if want := "https://example.com/article"; got != want {
+		t.Errorf("rewrite() = %q, want %q", got, want)
+	}
+}
+
+func TestNewCrawlTransport(t *testing.T) {
+	service := NewService(ServiceOptions{
+		BaseURL:             "http://localhost:8080",
+		MaxIdleConnsPerHost: 4,
+		DisableKeepAlives:   true,
+	})
+
+	enabled := false
+	tests := []struct {
+		name                    string
+		req                     model.CrawlRequest
+		wantMaxIdleConnsPerHost int
+		wantDisableKeepAlives   bool
+	}{
+		{
+			name:                    "Service defaults",
+			req:                     model.CrawlRequest{URL: "https://example.com"},
+			wantMaxIdleConnsPerHost: 4,
+			wantDisableKeepAlives:   true,
+		},
+		{
+			name: "Request overrides",
+			req: model.CrawlRequest{
+				URL:                 "https://example.com",
+				MaxIdleConnsPerHost: 32,
+				DisableKeepAlives:   &enabled,
+			},
+			wantMaxIdleConnsPerHost: 32,
+			wantDisableKeepAlives:   false,
+		},
+	}
+
+	// The crawl's proxy overrides the service default
+	proxied := service.newCrawlTransport(model.CrawlRequest{
+		URL:           "https://example.com",
+		ScrapeOptions: &model.CrawlScrapeOptions{ScrapeOptions: model.ScrapeOptions{Proxy: "http://proxy.example.com:3128"}},
+	})
+	proxyURL, err := proxied.Proxy(httptest.NewRequest(http.MethodGet, "https://example.com/", nil))
+	if err != nil || proxyURL == nil || proxyURL.Host != "proxy.example.com:3128" {
+		t.Errorf("Expected the crawl's proxy, got %v (%v)", proxyURL, err)
+	}
+
+	// Skipping verification applies to the whole crawl
+	insecure := service.newCrawlTransport(model.CrawlRequest{
+		URL:           "https://example.com",
+		ScrapeOptions: &model.CrawlScrapeOptions{ScrapeOptions: model.ScrapeOptions{SkipTlsVerification: true}},
+	})
+	if insecure.TLSClientConfig == nil || !insecure.TLSClientConfig.InsecureSkipVerify {
+		t.Error("Expected skipTlsVerification to disable certificate verification")
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := service.newCrawlTransport(tt.req)
+			if transport.MaxIdleConnsPerHost != tt.wantMaxIdleConnsPerHost {
+				t.Errorf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, tt.wantMaxIdleConnsPerHost)
+			}
+			if transport.DisableKeepAlives != tt.wantDisableKeepAlives {
+				t.Errorf("DisableKeepAlives = %v, want %v", transport.DisableKeepAlives, tt.wantDisableKeepAlives)
+			}
+			if !transport.ForceAttemptHTTP2 || transport.TLSHandshakeTimeout == 0 {
+				t.Error("Expected the default transport's HTTP/2 and timeout settings")
+			}
+			if transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify {
+				t.Error("Expected certificate verification by default")
+			}
+
+			// The crawl's scraper should use the dedicated transport
+			crawl := service.withTransport(transport)
+			if crawl.scraper == service.scraper {
+				t.Error("Expected a dedicated scraper for the crawl")
+			}
+		})
+	}
+}
+
+func BenchmarkCrawlTransport(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body><h1>%s</h1></body></html>", r.URL.Path)
+	}))
+	defer server.Close()
+
+	// A 100-page single-host crawl
+	links := make([]string, 100)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/page/%d", server.URL, i)
+	}
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	b.Run("Shared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			service.scrapeLinks(context.Background(), "bench", links, nil, 0, false)
+		}
+	})
+
+	b.Run("Dedicated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			transport := service.newCrawlTransport(model.CrawlRequest{MaxIdleConnsPerHost: 16})
+			service.withTransport(transport).scrapeLinks(context.Background(), "bench", links, nil, 0, false)
+			transport.CloseIdleConnections()
+		}
+	})
+}
+
+func TestTimeoutCeiling(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{
+		BaseURL:           "http://localhost:8080",
+		MaxRequestTimeout: 5 * time.Second,
+	})
+
+	t.Run("Crawl", func(t *testing.T) {
+		response, _, err := service.Crawl(model.CrawlRequest{
+			URL:           server.URL,
+			ScrapeOptions: &model.CrawlScrapeOptions{ScrapeOptions: model.ScrapeOptions{Timeout: 60000}},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create crawl job: %v", err)
+		}
+		if response.Warning == "" {
+			t.Error("Expected a warning for a clamped crawl timeout")
+		}
+	})
+
+	t.Run("Map", func(t *testing.T) {
+		response, err := service.Map(model.MapRequest{
+			URL:           server.URL,
+			IgnoreSitemap: true,
+			Timeout:       60000,
+		})
+		if err != nil {
+			t.Fatalf("Failed to map: %v", err)
+		}
+		if response.Warning == "" {
+			t.Error("Expected a warning for a clamped map timeout")
+		}
+	})
+
+	t.Run("Within ceiling", func(t *testing.T) {
+		response, err := service.Map(model.MapRequest{
+			URL:           server.URL,
+			IgnoreSitemap: true,
+			Timeout:       1000,
+		})
+		if err != nil {
+			t.Fatalf("Failed to map: %v", err)
+		}
+		if response.Warning != "" {
+			t.Errorf("Expected no warning, got %q", response.Warning)
+		}
+	})
+}
+
+// recordingWriter is an export writer that keeps objects in memory.
+type recordingWriter struct {
+	keys []string
+	err  error
+}
+
+func (w *recordingWriter) Write(_ context.Context, key string, _ []byte, _ string) error {
+	if w.err != nil {
+		return w.err
+	}
+	w.keys = append(w.keys, key)
+	return nil
+}
+
+func TestWithDestination(t *testing.T) {
+	result := model.ScrapeResult{
+		Markdown: "# Page",
+		Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/page"},
+	}
+
+	tests := []struct {
+		name         string
+		skipRedis    bool
+		writeErr     error
+		wantExported bool
+		wantMarkdown string
+	}{
+		{name: "Export and keep in Redis", wantExported: true, wantMarkdown: "# Page"},
+		{name: "Export only", skipRedis: true, wantExported: true, wantMarkdown: ""},
+		{name: "Failed export keeps result", skipRedis: true, writeErr: errors.New("unavailable"), wantMarkdown: "# Page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored []model.ScrapeResult
+			service := NewService(ServiceOptions{
+				UpdateJobFn: func(_ string, r model.ScrapeResult) error {
+					stored = append(stored, r)
+					return nil
+				},
+			})
+
+			writer := &recordingWriter{err: tt.writeErr}
+			dest := model.CrawlDestination{Type: "s3", Bucket: "crawls", SkipRedis: tt.skipRedis}
+			_ = service.withDestination(writer, dest).updateJobFn("job-1", result)
+
+			if got := len(writer.keys) == 1; got != tt.wantExported {
+				t.Errorf("Expected exported = %v, got keys %v", tt.wantExported, writer.keys)
+			}
+			if len(stored) != 1 {
+				t.Fatalf("Expected 1 stored result, got %d", len(stored))
+			}
+			if stored[0].Markdown != tt.wantMarkdown {
+				t.Errorf("Expected stored markdown %q, got %q", tt.wantMarkdown, stored[0].Markdown)
+			}
+			if stored[0].Metadata == nil {
+				t.Error("Expected metadata to be kept in Redis")
+			}
+		})
+	}
+}
+
+func TestProcessCrawlJobWebhookEvents(t *testing.T) {
+	// The stub receiver listens on loopback
+	webhook.AllowPrivateNetworks(true)
+	defer webhook.AllowPrivateNetworks(false)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/about">About</a><p>Hello</p></body></html>`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var events []string
+	var pages []model.WebhookEvent
+	service := NewService(ServiceOptions{
+		WebhookFn: func(cfg *model.WebhookConfig, job, event string, payload model.WebhookEvent) {
+			if !cfg.Wants(event) {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if job != model.WebhookJobCrawl || payload.ID == "" {
+				t.Errorf("Expected a crawl event with the job ID, got %s %+v", job, payload)
+			}
+			events = append(events, event)
+			if event == model.WebhookPage {
+				pages = append(pages, payload)
+			}
+		},
+	})
+
+	webhookConfig := &model.WebhookConfig{
+		URL:    "https://hooks.example.com/crawl",
+		Events: []string{model.WebhookStarted, model.WebhookPage, model.WebhookCompleted, model.WebhookFailed},
+	}
+	req := model.CrawlRequest{URL: server.URL + "/", Limit: 10, IgnoreSitemap: true, Webhook: webhookConfig}
+	service.ProcessCrawlJob(context.Background(), "job-1", req)
+
+	mu.Lock()
+	want := "started,page,page,completed"
+	if got := strings.Join(events, ","); got != want {
+		t.Errorf("Expected events %s, got %s", want, got)
+	}
+	for i, page := range pages {
+		if page.Data == nil || !strings.Contains(page.Data.Markdown, "Hello") {
+			t.Errorf("Expected the page data in the page event, got %+v", page.Data)
+		}
+		if page.Total != 2 || page.Completed != i+1 {
+			t.Errorf("Expected running counts %d of 2, got %d of %d", i+1, page.Completed, page.Total)
+		}
+	}
+
+	// A crawl that can't start reports failure
+	events = nil
+	mu.Unlock()
+	req.URLRewriteRules = []model.URLRewriteRule{{Pattern: "("}}
+	service.ProcessCrawlJob(context.Background(), "job-2", req)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(events, ","); got != "started,failed" {
+		t.Errorf("Expected a failed crawl to report started,failed, got %s", got)
+	}
+}
+
+func TestSoft404Error(t *testing.T) {
+	soft404 := &model.ScrapeResult{Metadata: &model.ScrapeMetadata{Soft404: true}}
+	page := &model.ScrapeResult{Metadata: &model.ScrapeMetadata{}}
+
+	if err := soft404Error(&model.CrawlScrapeOptions{Soft404AsError: true}, soft404); err != errSoft404 {
+		t.Errorf("Expected errSoft404, got %v", err)
+	}
+	if err := soft404Error(&model.CrawlScrapeOptions{Soft404AsError: true}, page); err != nil {
+		t.Errorf("Expected no error for a normal page, got %v", err)
+	}
+	if err := soft404Error(&model.CrawlScrapeOptions{ScrapeOptions: model.ScrapeOptions{DetectSoft404: true}}, soft404); err != nil {
+		t.Errorf("Expected soft 404s to be kept as results when not treated as errors, got %v", err)
+	}
+}
+
+func TestNewScrapeRequest(t *testing.T) {
+	if req := newScrapeRequest("https://example.com/a", nil); req.URL != "https://example.com/a" {
+		t.Errorf("Expected the page URL without options, got %q", req.URL)
+	}
+
+	req := newScrapeRequest("https://example.com/a", &model.CrawlScrapeOptions{
+		ScrapeOptions: model.ScrapeOptions{
+			Formats:         []string{"html"},
+			BaseURLOverride: "https://cdn.example.com/",
+			Proxy:           "http://proxy.example.com:3128",
+		},
+		Soft404AsError: true,
+	})
+	if req.URL != "https://example.com/a" || len(req.Formats) != 1 || req.BaseURLOverride != "https://cdn.example.com/" {
+		t.Errorf("Expected the crawl's scrape options to carry over, got %+v", req)
+	}
+	if !req.DetectSoft404 {
+		t.Error("Expected soft404AsError to turn on soft 404 detection")
+	}
+	if req.Proxy != "" {
+		t.Errorf("Expected the proxy to be left to the crawl's transport, got %q", req.Proxy)
+	}
+}
+
+func TestMapSniffsGzippedSitemaps(t *testing.T) {
+	gzipped := func(body string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, _ = gz.Write([]byte(body))
+		_ = gz.Close()
+		return buf.Bytes()
+	}
+
+	// Both sitemaps are gzipped without a .gz extension or Content-Encoding
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			w.Header().Set("Content-Type", "text/xml")
+			_, _ = w.Write(gzipped(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>%s/pages</loc></sitemap>
+</sitemapindex>`, server.URL)))
+		case "/pages":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write(gzipped(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/a</loc></url>
+<url><loc>%[1]s/b</loc></url>
+</urlset>`, server.URL)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+	resp, err := service.Map(model.MapRequest{URL: server.URL + "/", SitemapOnly: true})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, link := range resp.Links {
+		found[link] = true
+	}
+	for _, want := range []string{server.URL + "/a", server.URL + "/b"} {
+		if !found[want] {
+			t.Errorf("Expected %s to be discovered from the gzipped sitemap, got %v", want, resp.Links)
+		}
+	}
+}
+
+func TestMapSitemapIndexConcurrency(t *testing.T) {
+	const (
+		sitemapFiles = 12
+		urlsPerFile  = 5
+		concurrency  = 3
+	)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+			for i := 0; i < sitemapFiles; i++ {
+				fmt.Fprintf(w, "<sitemap><loc>%s/sitemaps/%d.xml</loc></sitemap>", server.URL, i)
+			}
+			fmt.Fprint(w, `</sitemapindex>`)
+			return
+		}
+
+		var file int
+		if _, err := fmt.Sscanf(r.URL.Path, "/sitemaps/%d.xml", &file); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for i := 0; i < urlsPerFile; i++ {
+			fmt.Fprintf(w, "<url><loc>%s/pages/%d-%d</loc></url>", server.URL, file, i)
+		}
+		fmt.Fprint(w, `</urlset>`)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{
+		BaseURL:               "http://localhost:8080",
+		MaxSitemapConcurrency: concurrency,
+	})
+
+	resp, err := service.Map(model.MapRequest{URL: server.URL + "/", SitemapOnly: true})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, link := range resp.Links {
+		found[link] = true
+	}
+	for file := 0; file < sitemapFiles; file++ {
+		for i := 0; i < urlsPerFile; i++ {
+			want := fmt.Sprintf("%s/pages/%d-%d", server.URL, file, i)
+			if !found[want] {
+				t.Errorf("Expected %s to be discovered from the sitemap index", want)
+			}
+		}
+	}
+
+	if maxInFlight > concurrency {
+		t.Errorf("Expected at most %d sitemap fetches at once, got %d", concurrency, maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("Expected sitemaps to be fetched concurrently, got %d at once", maxInFlight)
+	}
+}
+
+func TestScrapeLinksConcurrency(t *testing.T) {
+	const (
+		pages       = 24
+		concurrency = 4
+	)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body><h1>%s</h1></body></html>", r.URL.Path)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	links := make([]string, pages)
+	for i := range links {
+		links[i] = fmt.Sprintf("%s/page/%d", server.URL, i)
+	}
+
+	// Job updates must never overlap, so counts read back from storage stay accurate
+	updating := 0
+	recorded := make(map[string]bool)
+	statusUpdates := 0
+	enter := func() {
+		if updating != 0 {
+			t.Error("Expected job updates to be serialized")
+		}
+		updating++
+	}
+
+	service := NewService(ServiceOptions{
+		BaseURL:           "http://localhost:8080",
+		MaxConcurrentJobs: concurrency,
+		UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+			enter()
+			defer func() { updating-- }()
+			recorded[result.Metadata.SourceURL] = true
+			return nil
+		},
+		UpdateJobStatusFn: func(_ string, status string, total int) error {
+			enter()
+			defer func() { updating-- }()
+			if status != "scraping" || total != pages {
+				t.Errorf("Expected status scraping with total %d, got %s with %d", pages, status, total)
+			}
+			statusUpdates++
+			return nil
+		},
+	})
+
+	crawlErrors, blocked := service.scrapeLinks(context.Background(), "job", links, nil, 0, true)
+	if blocked {
+		t.Error("Expected the crawl not to be reported as blocked")
+	}
+	if len(crawlErrors) != 0 {
+		t.Errorf("Expected no crawl errors, got %v", crawlErrors)
+	}
+
+	for _, link := range links {
+		if !recorded[link] {
+			t.Errorf("Expected %s to be scraped", link)
+		}
+	}
+	if want := (pages + 9) / 10; statusUpdates != want {
+		t.Errorf("Expected %d status updates, got %d", want, statusUpdates)
+	}
+
+	if maxInFlight > concurrency {
+		t.Errorf("Expected at most %d pages scraped at once, got %d", concurrency, maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("Expected pages to be scraped concurrently, got %d at once", maxInFlight)
+	}
+}
+
+func TestLimitRule(t *testing.T) {
+	tests := []struct {
+		name            string
+		opts            ServiceOptions
+		parallelism     int
+		domainDelayMS   int
+		wantParallelism int
+		wantDelay       time.Duration
+	}{
+		{
+			name:            "defaults",
+			wantParallelism: DefaultParallelism,
+		},
+		{
+			name:            "configured",
+			opts:            ServiceOptions{Parallelism: 2, DomainDelay: 500 * time.Millisecond},
+			wantParallelism: 2,
+			wantDelay:       500 * time.Millisecond,
+		},
+		{
+			name:            "request overrides",
+			opts:            ServiceOptions{Parallelism: 2, DomainDelay: 500 * time.Millisecond},
+			parallelism:     1,
+			domainDelayMS:   2000,
+			wantParallelism: 1,
+			wantDelay:       2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := NewService(tt.opts).limitRule(tt.parallelism, tt.domainDelayMS, 0)
+			if rule.DomainGlob != "*" {
+				t.Errorf("Expected the rule to cover every domain, got %q", rule.DomainGlob)
+			}
+			if rule.Parallelism != tt.wantParallelism {
+				t.Errorf("Expected parallelism %d, got %d", tt.wantParallelism, rule.Parallelism)
+			}
+			if rule.Delay != tt.wantDelay {
+				t.Errorf("Expected delay %v, got %v", tt.wantDelay, rule.Delay)
+			}
+		})
+	}
+}
+
+func TestScrapeLinksDelay(t *testing.T) {
+	const delay = 150 * time.Millisecond
+
+	var mu sync.Mutex
+	var requests []time.Time
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, time.Now())
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body><h1>%s</h1></body></html>", r.URL.Path)
+	}))
+	defer server.Close()
+
+	links := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+	opts := &model.CrawlScrapeOptions{Delay: int(delay / time.Millisecond), RandomDelay: 20}
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080", MaxConcurrentJobs: 4})
+	if crawlErrors, _ := service.scrapeLinks(context.Background(), "job", links, opts, 0, false); len(crawlErrors) != 0 {
+		t.Fatalf("Expected no crawl errors, got %v", crawlErrors)
+	}
+
+	if len(requests) != len(links) {
+		t.Fatalf("Expected %d requests, got %d", len(links), len(requests))
+	}
+	for i := 1; i < len(requests); i++ {
+		if gap := requests[i].Sub(requests[i-1]); gap < delay {
+			t.Errorf("Expected requests %d and %d at least %v apart, got %v", i-1, i, delay, gap)
+		}
+	}
+}
+
+func TestScrapeLinksDelayCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	links := []string{server.URL + "/a", server.URL + "/b", server.URL + "/c"}
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	// Cancelling during a long delay stops the crawl without waiting it out
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	service.scrapeLinks(ctx, "job", links, nil, 10*time.Second, false)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected cancellation to cut the delay short, took %v", elapsed)
+	}
+}
+
+func TestCrawlDelays(t *testing.T) {
+	service := NewService(ServiceOptions{DomainDelay: 100 * time.Millisecond})
+
+	// Without a crawl delay the configured one applies
+	delayMS, randomDelayMS := crawlDelays(model.CrawlRequest{})
+	rule := service.limitRule(0, delayMS, randomDelayMS)
+	if rule.Delay != 100*time.Millisecond || rule.RandomDelay != 0 {
+		t.Errorf("Expected the configured delay, got %v and %v random", rule.Delay, rule.RandomDelay)
+	}
+
+	// The scrape options' delays replace the configured one
+	delayMS, randomDelayMS = crawlDelays(model.CrawlRequest{
+		ScrapeOptions: &model.CrawlScrapeOptions{Delay: 500, RandomDelay: 250},
+	})
+	rule = service.limitRule(0, delayMS, randomDelayMS)
+	if rule.Delay != 500*time.Millisecond || rule.RandomDelay != 250*time.Millisecond {
+		t.Errorf("Expected a 500ms delay with 250ms random, got %v and %v random", rule.Delay, rule.RandomDelay)
+	}
+}
+
+func TestProcessCrawlJobDiscoveryDepth(t *testing.T) {
+	// Each page links one level deeper: / -> /a -> /a/b -> /a/b/c
+	pages := map[string]string{
+		"/":      `<a href="/a">A</a>`,
+		"/a":     `<a href="/a/b">B</a>`,
+		"/a/b":   `<a href="/a/b/c">C</a>`,
+		"/a/b/c": `<p>Deepest</p>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body>%s</body></html>", body)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name              string
+		maxDiscoveryDepth int
+		want              []string
+		notWant           []string
+	}{
+		{
+			name:    "start page links by default",
+			want:    []string{"/a"},
+			notWant: []string{"/a/b", "/a/b/c"},
+		},
+		{
+			name:              "two links deep",
+			maxDiscoveryDepth: 2,
+			want:              []string{"/a", "/a/b"},
+			notWant:           []string{"/a/b/c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			scraped := make(map[string]bool)
+
+			service := NewService(ServiceOptions{
+				BaseURL: "http://localhost:8080",
+				UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+					mu.Lock()
+					scraped[result.Metadata.SourceURL] = true
+					mu.Unlock()
+					return nil
+				},
+			})
+
+			service.ProcessCrawlJob(context.Background(), "test-job-id", model.CrawlRequest{
+				URL:               server.URL + "/",
+				Limit:             10,
+				MaxDepth:          10,
+				MaxDiscoveryDepth: tt.maxDiscoveryDepth,
+				IgnoreSitemap:     true,
+			})
+
+			for _, path := range tt.want {
+				if !scraped[server.URL+path] {
+					t.Errorf("Expected %s to be discovered, got %v", path, scraped)
+				}
+			}
+			for _, path := range tt.notWant {
+				if scraped[server.URL+path] {
+					t.Errorf("Expected %s to be beyond the discovery depth", path)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoveryCanonicalVariants(t *testing.T) {
+	variants := []string{
+		"https://example.com/docs?b=2&a=1",
+		"HTTPS://Example.com/docs?a=1&b=2",
+		"https://example.com:443/docs?b=2&a=1",
+		"https://example.com/docs?a=1&b=2#install",
+	}
+
+	tests := []struct {
+		name        string
+		links       []string
+		opts        *model.CanonicalizeOptions
+		ignoreQuery bool
+		want        []string
+	}{
+		{
+			name:  "Default options collapse variants",
+			links: variants,
+			want:  variants[:1],
+		},
+		{
+			name:  "Strip query",
+			links: []string{"https://example.com/a?utm=1", "https://example.com/a", "https://example.com/b"},
+			opts:  &model.CanonicalizeOptions{StripQuery: true},
+			want:  []string{"https://example.com/a?utm=1", "https://example.com/b"},
+		},
+		{
+			name:        "Ignored query parameters are dropped",
+			links:       []string{"https://example.com/a", "https://example.com/b?page=1", "https://example.com/b?page=2"},
+			ignoreQuery: true,
+			want:        []string{"https://example.com/a", "https://example.com/b"},
+		},
+		{
+			name:  "Fragments kept",
+			links: []string{"https://example.com/a#one", "https://example.com/a#two"},
+			opts:  &model.CanonicalizeOptions{StripDefaultPorts: true, SortQuery: true},
+			want:  []string{"https://example.com/a#one", "https://example.com/a#two"},
+		},
+		{
+			name:  "Empty path matches root",
+			links: []string{"https://example.com", "https://example.com/"},
+			want:  []string{"https://example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The first link is the page mapped; the rest are listed in its
+			// sitemap
+			found := newDiscovery(model.MapRequest{
+				URL:                   tt.links[0],
+				Limit:                 100,
+				Canonicalize:          tt.opts,
+				IgnoreQueryParameters: tt.ignoreQuery,
+			}, newPathMatcher(nil, nil, ""))
+			for _, link := range tt.links[1:] {
+				found.addSitemapURL(link)
+			}
+
+			if got := found.links(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("links() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCrawlJobIgnoreQueryParameters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/page?a=1">one</a><a href="/page?a=2">two</a></body></html>`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	scraped := make(map[string]int)
+
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		UpdateJobFn: func(_ string, result model.ScrapeResult) error {
+			mu.Lock()
+			scraped[result.Metadata.SourceURL]++
+			mu.Unlock()
+			return nil
+		},
+	})
+
+	service.ProcessCrawlJob(context.Background(), "test-job-id", model.CrawlRequest{
+		URL:                   server.URL + "/",
+		Limit:                 10,
+		MaxDepth:              2,
+		IgnoreSitemap:         true,
+		IgnoreQueryParameters: true,
+	})
+
+	if scraped[server.URL+"/page"] != 1 {
+		t.Errorf("Expected the query variants to collapse into one scrape of /page, got %v", scraped)
+	}
+	for link := range scraped {
+		if strings.Contains(link, "?") {
+			t.Errorf("Expected query strings to be stripped, got %s", link)
+		}
+	}
+}
+
+func TestMapStopsAtLimit(t *testing.T) {
+	// Every page links to ten children, so the site is far larger than the limit
+	var fetched atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched.Add(1)
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		var links strings.Builder
+		for i := 0; i < 10; i++ {
+			fmt.Fprintf(&links, `<a href="%s/%d">link</a>`, path, i)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html><body>%s</body></html>", links.String())
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	const limit = 5
+	resp, err := service.Map(model.MapRequest{
+		URL:           server.URL + "/",
+		IgnoreSitemap: true,
+		Limit:         limit,
+		MaxDepth:      4,
+	})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+
+	if len(resp.Links) != limit {
+		t.Errorf("Expected %d links, got %d", limit, len(resp.Links))
+	}
+	// The start page alone yields enough links, so its children are dropped
+	if n := fetched.Load(); n >= limit {
+		t.Errorf("Expected fetching to stop once the limit was reached, got %d fetches", n)
+	}
+}
+
+func TestProcessCrawlJobStoresErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/broken">broken</a><a href="/ok">ok</a></body></html>`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var stored []model.CrawlError
+
+	service := NewService(ServiceOptions{
+		BaseURL: "http://localhost:8080",
+		StoreErrorFn: func(jobID string, crawlError model.CrawlError) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if jobID != "test-job-id" {
+				t.Errorf("Expected the error stored for test-job-id, got %s", jobID)
+			}
+			stored = append(stored, crawlError)
+			return nil
+		},
+	})
+
+	service.ProcessCrawlJob(context.Background(), "test-job-id", model.CrawlRequest{
+		URL:           server.URL + "/",
+		Limit:         10,
+		IgnoreSitemap: true,
+	})
+
+	if len(stored) != 1 {
+		t.Fatalf("Expected one stored error, got %v", stored)
+	}
+	if stored[0].URL != server.URL+"/broken" || stored[0].ID == "" || stored[0].Error == "" {
+		t.Errorf("Expected the broken page's error, got %+v", stored[0])
+	}
+}
+
+func TestMapSitemapIndexStopsAtLimit(t *testing.T) {
+	const (
+		sitemapFiles = 30
+		urlsPerFile  = 5
+		concurrency  = 2
+	)
+
+	var fetches atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sitemap.xml" {
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+			for i := 0; i < sitemapFiles; i++ {
+				fmt.Fprintf(w, "<sitemap><loc>%s/sitemaps/%d.xml</loc></sitemap>", server.URL, i)
+			}
+			fmt.Fprint(w, `</sitemapindex>`)
+			return
+		}
+
+		var file int
+		if _, err := fmt.Sscanf(r.URL.Path, "/sitemaps/%d.xml", &file); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fetches.Add(1)
+		time.Sleep(10 * time.Millisecond)
+
+		fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+		for i := 0; i < urlsPerFile; i++ {
+			fmt.Fprintf(w, "<url><loc>%s/pages/%d-%d</loc></url>", server.URL, file, i)
+		}
+		fmt.Fprint(w, `</urlset>`)
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{
+		BaseURL:               "http://localhost:8080",
+		MaxSitemapConcurrency: concurrency,
+	})
+
+	resp, err := service.Map(model.MapRequest{URL: server.URL + "/", SitemapOnly: true, Limit: 8})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+	if len(resp.Links) != 8 {
+		t.Errorf("Expected 8 links, got %d", len(resp.Links))
+	}
+
+	// Two files fill the limit; at most a slot's worth more are in flight
+	// when it is reached
+	if got := fetches.Load(); got > 2+concurrency {
+		t.Errorf("Expected the index to stop fetching at the limit, got %d of %d sitemaps", got, sitemapFiles)
+	}
+}
+
+func TestReadSitemapLimit(t *testing.T) {
+	maxSitemapBytes = 1024
+	defer func() { maxSitemapBytes = 50 * 1024 * 1024 }()
+
+	// A small gzip stream that inflates past the limit
+	var bomb bytes.Buffer
+	gz := gzip.NewWriter(&bomb)
+	_, _ = gz.Write(bytes.Repeat([]byte("a"), 64*1024))
+	_ = gz.Close()
+
+	if _, err := readSitemap(bytes.NewReader(bomb.Bytes())); err == nil {
+		t.Error("Expected a sitemap inflating past the limit to be refused")
+	}
+	if _, err := readSitemap(strings.NewReader(strings.Repeat("a", 2048))); err == nil {
+		t.Error("Expected a sitemap larger than the limit to be refused")
+	}
+	if data, err := readSitemap(strings.NewReader("https://example.com/a")); err != nil || string(data) != "https://example.com/a" {
+		t.Errorf("Expected a small sitemap to be read, got %q, %v", data, err)
+	}
+}
+
+func TestMapCanonicalVariantsDontUseLimit(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/s?b=2&amp;a=1</loc></url>
+<url><loc>%[1]s/s?a=1&amp;b=2</loc></url>
+<url><loc>%[1]s/s?a=1&amp;b=2#top</loc></url>
+<url><loc>%[1]s/t</loc></url>
+</urlset>`, server.URL)
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><body>
+<a href="/a?y=2&x=1">A</a><a href="/a?x=1&y=2">A again</a><a href="/a?x=1&y=2#part">A part</a>
+<a href="/b">B</a><a href="/c">C</a>
+</body></html>`)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><body></body></html>`)
+		}
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+
+	// Sitemap variants of /s take one slot, leaving room for /t
+	resp, err := service.Map(model.MapRequest{URL: server.URL + "/", SitemapOnly: true, Limit: 3})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+	want := []string{server.URL + "/", server.URL + "/s?b=2&a=1", server.URL + "/t"}
+	if !reflect.DeepEqual(resp.Links, want) {
+		t.Errorf("Expected sitemap links %v, got %v", want, resp.Links)
+	}
+
+	// Page link variants of /a take one slot, leaving room for /b and /c
+	resp, err = service.Map(model.MapRequest{URL: server.URL + "/", IgnoreSitemap: true, Limit: 4})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+	want = []string{server.URL + "/", server.URL + "/a?y=2&x=1", server.URL + "/b", server.URL + "/c"}
+	if !reflect.DeepEqual(resp.Links, want) {
+		t.Errorf("Expected page links %v, got %v", want, resp.Links)
+	}
+}
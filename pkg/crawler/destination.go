@@ -0,0 +1,39 @@
+package crawler
+
+import (
+	"context"
+
+	"github.com/ncecere/rummage/pkg/export"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// ValidateDestination checks that a crawl destination can be written to with
+// the configured credentials.
+func (s *Service) ValidateDestination(dest model.CrawlDestination) error {
+	_, err := export.NewWriter(dest, s.exportCredentials)
+	return err
+}
+
+// withDestination returns a copy of the service that exports each page result
+// to the destination before recording it. When the destination skips Redis,
+// only the page metadata is recorded; a failed export records the full result
+// so it isn't lost.
+func (s *Service) withDestination(writer export.Writer, dest model.CrawlDestination) *Service {
+	clone := *s
+	updateJobFn := s.updateJobFn
+	clone.updateJobFn = func(jobID string, result model.ScrapeResult) error {
+		err := export.WriteResult(context.Background(), writer, dest.Prefix, jobID, result)
+		if err == nil && dest.SkipRedis {
+			result = model.ScrapeResult{Metadata: result.Metadata}
+		}
+
+		if updateJobFn != nil {
+			if updateErr := updateJobFn(jobID, result); updateErr != nil {
+				return updateErr
+			}
+		}
+
+		return err
+	}
+	return &clone
+}
@@ -0,0 +1,24 @@
+package crawler
+
+import (
+	"net/http"
+	"strings"
+)
+
+// fetch performs a GET request for discovery resources such as robots.txt and
+// sitemaps, sending the configured User-Agent and any headers configured for
+// the target host.
+func (s *Service) fetch(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", s.userAgent)
+	for key, value := range s.hostHeaders[strings.ToLower(req.URL.Hostname())] {
+		req.Header.Set(key, value)
+	}
+
+	s.limiter.Wait()
+	return s.client.Do(req)
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// sitemapDepth is the depth given to URLs listed in a sitemap, as if they
+// were linked from the start page.
+const sitemapDepth = 1
+
+// filterEnv holds the variables a filter expression can use.
+type filterEnv struct {
+	URL   string `expr:"url"`
+	Host  string `expr:"host"`
+	Path  string `expr:"path"`
+	Query string `expr:"query"`
+	Depth int    `expr:"depth"`
+}
+
+// urlFilter evaluates a crawl's filter expression against each discovered
+// URL. A nil filter allows every URL.
+type urlFilter struct {
+	program *vm.Program
+}
+
+// newURLFilter compiles a filter expression once for a crawl, returning nil
+// when there is none.
+func newURLFilter(expression string) (*urlFilter, error) {
+	if expression == "" {
+		return nil, nil
+	}
+
+	program, err := expr.Compile(expression, expr.Env(filterEnv{}), expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter expression: %w", err)
+	}
+	return &urlFilter{program: program}, nil
+}
+
+// allows reports whether the expression holds for a URL found depth links
+// from the start page. URLs that don't parse, and expressions that fail at
+// run time, are rejected.
+func (f *urlFilter) allows(urlStr string, depth int) bool {
+	if f == nil {
+		return true
+	}
+
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return false
+	}
+
+	out, err := expr.Run(f.program, filterEnv{
+		URL:   urlStr,
+		Host:  u.Hostname(),
+		Path:  u.Path,
+		Query: u.RawQuery,
+		Depth: depth,
+	})
+	if err != nil {
+		return false
+	}
+	allowed, _ := out.(bool)
+	return allowed
+}
+
+// ValidateFilterExpression reports whether a filter expression compiles to a
+// boolean over the url, host, path, query and depth variables.
+func ValidateFilterExpression(expression string) error {
+	_, err := newURLFilter(expression)
+	return err
+}
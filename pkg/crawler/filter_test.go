@@ -0,0 +1,123 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestURLFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		url        string
+		depth      int
+		want       bool
+	}{
+		{
+			name:       "No expression",
+			expression: "",
+			url:        "https://example.com/anything",
+			want:       true,
+		},
+		{
+			name:       "Path prefix",
+			expression: `path startsWith "/docs/"`,
+			url:        "https://example.com/docs/intro",
+			want:       true,
+		},
+		{
+			name:       "Path prefix rejected",
+			expression: `path startsWith "/docs/"`,
+			url:        "https://example.com/blog/post",
+			want:       false,
+		},
+		{
+			name:       "Host and depth",
+			expression: `host == "example.com" && depth <= 2`,
+			url:        "https://example.com/a/b",
+			depth:      3,
+			want:       false,
+		},
+		{
+			name:       "Regex over the URL",
+			expression: `url matches "/v[0-9]+/" and not (query contains "print=")`,
+			url:        "https://example.com/api/v2/users?page=2",
+			depth:      1,
+			want:       true,
+		},
+		{
+			name:       "Query rejected",
+			expression: `url matches "/v[0-9]+/" and not (query contains "print=")`,
+			url:        "https://example.com/api/v2/users?print=1",
+			depth:      1,
+			want:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newURLFilter(tt.expression)
+			if err != nil {
+				t.Fatalf("newURLFilter() error = %v", err)
+			}
+			if got := filter.allows(tt.url, tt.depth); got != tt.want {
+				t.Errorf("allows(%q, %d) = %v, want %v", tt.url, tt.depth, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateFilterExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{name: "Empty", expression: ""},
+		{name: "Boolean", expression: `depth < 3 && path != "/login"`},
+		{name: "Syntax error", expression: `path ==`, wantErr: true},
+		{name: "Unknown variable", expression: `title == "Home"`, wantErr: true},
+		{name: "Not a boolean", expression: `path`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFilterExpression(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateFilterExpression(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMapFilterExpression(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/docs/intro">Intro</a><a href="/blog/post">Post</a></body></html>`)
+	}))
+	defer server.Close()
+
+	service := NewService(ServiceOptions{BaseURL: "http://localhost:8080"})
+	resp, err := service.Map(model.MapRequest{
+		URL:              server.URL + "/",
+		IgnoreSitemap:    true,
+		FilterExpression: `path startsWith "/docs/"`,
+	})
+	if err != nil {
+		t.Fatalf("Map() error = %v", err)
+	}
+
+	want := map[string]bool{server.URL + "/": true, server.URL + "/docs/intro": true}
+	if len(resp.Links) != len(want) {
+		t.Fatalf("Expected links %v, got %v", want, resp.Links)
+	}
+	for _, link := range resp.Links {
+		if !want[link] {
+			t.Errorf("Unexpected link %s", link)
+		}
+	}
+}
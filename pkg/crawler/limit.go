@@ -0,0 +1,38 @@
+package crawler
+
+import (
+	"time"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// limitRule returns the collector limit for a crawl or map, applying the
+// request's parallelism and per-domain delays on top of the service defaults.
+func (s *Service) limitRule(parallelism, delayMS, randomDelayMS int) *colly.LimitRule {
+	if parallelism <= 0 {
+		parallelism = s.parallelism
+	}
+
+	delay := s.domainDelay
+	if delayMS > 0 {
+		delay = time.Duration(delayMS) * time.Millisecond
+	}
+
+	return &colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: parallelism,
+		Delay:       delay,
+		RandomDelay: time.Duration(randomDelayMS) * time.Millisecond,
+	}
+}
+
+// crawlDelays returns the per-domain delays in milliseconds for a crawl's
+// link discovery, from its scrape options. The same delays space the crawl's
+// page scrapes; zero leaves discovery at the configured default.
+func crawlDelays(req model.CrawlRequest) (delayMS, randomDelayMS int) {
+	if opts := req.ScrapeOptions; opts != nil {
+		return opts.Delay, opts.RandomDelay
+	}
+	return 0, 0
+}
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"bytes"
 	"compress/gzip"
 	"encoding/xml"
 	"fmt"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/gocolly/colly/v2"
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
 )
 
 // XML structures for sitemap parsing
@@ -50,7 +52,10 @@ func (s *Service) Map(req model.MapRequest) (*model.MapResponse, error) {
 
 	// Set default values
 	if req.Limit <= 0 {
-		req.Limit = 5000
+		req.Limit = DefaultMapLimit
+	}
+	if req.MaxDepth <= 0 {
+		req.MaxDepth = DefaultMapDepth
 	}
 
 	// Parse the base URL
@@ -59,18 +64,26 @@ func (s *Service) Map(req model.MapRequest) (*model.MapResponse, error) {
 		return nil, fmt.Errorf("invalid URL: %w", err)
 	}
 
-	// Track discovered URLs and visited URLs
-	discoveredURLs := make([]string, 0)
-	visitedURLs := make(map[string]bool)
-	var discoveredMutex sync.Mutex
-	var visitedMutex sync.Mutex
+	// The timeout bounds robots.txt and sitemap fetches as well as pages
+	timeout, warning := utils.ResolveTimeout(req.Timeout, defaultTimeoutMS, s.scraper.MaxTimeoutMS())
+	s = s.withFetchTimeout(time.Duration(timeout) * time.Millisecond)
+
+	// Compile the path filters and filter expression once for every URL
+	// discovered
+	paths := newPathMatcher(req.IncludePaths, req.ExcludePaths, req.PathMatching)
+	paths.filter, err = newURLFilter(req.FilterExpression)
+	if err != nil {
+		return nil, err
+	}
 
-	// Add the initial URL to the discovered URLs
-	discoveredURLs = append(discoveredURLs, req.URL)
-	visitedURLs[req.URL] = true
+	// Collect discovered URLs, starting with the initial URL
+	found := newDiscovery(req, paths)
 
 	// First, try to fetch the sitemap.xml if not ignored
 	if !req.IgnoreSitemap {
+		// Bounds the nested sitemap fetches in flight at once
+		sitemapSlots := make(chan struct{}, s.maxSitemapConcurrency)
+
 		// Try to find sitemap URLs
 		sitemapURLs := []string{
 			fmt.Sprintf("%s://%s/sitemap.xml", baseURL.Scheme, baseURL.Host),
@@ -89,7 +102,7 @@ func (s *Service) Map(req model.MapRequest) (*model.MapResponse, error) {
 
 		// Try to find sitemap in robots.txt
 		robotsTxtURL := fmt.Sprintf("%s://%s/robots.txt", baseURL.Scheme, baseURL.Host)
-		robotsTxtResp, err := s.client.Get(robotsTxtURL)
+		robotsTxtResp, err := s.fetch(robotsTxtURL)
 		if err == nil && robotsTxtResp.StatusCode == http.StatusOK {
 			defer robotsTxtResp.Body.Close()
 
@@ -110,134 +123,60 @@ func (s *Service) Map(req model.MapRequest) (*model.MapResponse, error) {
 		// Process all potential sitemap URLs
 		for _, sitemapURL := range sitemapURLs {
 			// Skip if we've already reached the limit
-			if len(discoveredURLs) >= req.Limit {
+			if found.full() {
 				break
 			}
 
-			sitemapResp, err := s.client.Get(sitemapURL)
-			if err != nil || sitemapResp.StatusCode != http.StatusOK {
-				continue
-			}
-			defer sitemapResp.Body.Close()
-
-			// Check if the response is gzipped
-			var reader io.Reader = sitemapResp.Body
-			if strings.HasSuffix(sitemapURL, ".gz") || sitemapResp.Header.Get("Content-Encoding") == "gzip" {
-				gzReader, err := gzip.NewReader(sitemapResp.Body)
-				if err != nil {
-					continue
-				}
-				defer gzReader.Close()
-				reader = gzReader
-			}
-
-			// Try to parse as sitemap index first
-			var sitemapIndex SitemapIndex
-			indexData, err := io.ReadAll(reader)
+			sitemapData, err := s.fetchSitemap(sitemapURL)
 			if err != nil {
 				continue
 			}
-
-			// Try to parse as sitemap index
-			if err := xml.Unmarshal(indexData, &sitemapIndex); err == nil && len(sitemapIndex.Sitemaps) > 0 {
-				// Process each sitemap in the index
-				for _, sitemap := range sitemapIndex.Sitemaps {
-					// Skip if we've already reached the limit
-					if len(discoveredURLs) >= req.Limit {
-						break
-					}
-
-					// Process the individual sitemap
-					s.processSitemap(sitemap.Loc, req, &discoveredURLs, visitedURLs, &discoveredMutex, &visitedMutex)
-				}
-			} else {
-				// Try to parse as regular sitemap
-				var urlset URLSet
-				if err := xml.Unmarshal(indexData, &urlset); err == nil && len(urlset.URLs) > 0 {
-					// Add all URLs from sitemap to discovered URLs
-					discoveredMutex.Lock()
-					for _, u := range urlset.URLs {
-						if len(discoveredURLs) < req.Limit && shouldProcessURL(u.Loc, req.IncludePaths, req.ExcludePaths) {
-							// Check if URL matches search term
-							if req.Search == "" || strings.Contains(strings.ToLower(u.Loc), strings.ToLower(req.Search)) {
-								// Check if we've already visited this URL
-								visitedMutex.Lock()
-								if !visitedURLs[u.Loc] {
-									visitedURLs[u.Loc] = true
-									discoveredURLs = append(discoveredURLs, u.Loc)
-								}
-								visitedMutex.Unlock()
-							}
-						}
-					}
-					discoveredMutex.Unlock()
-				} else {
-					// Try to handle non-standard sitemap formats
-					// Some sitemaps might just be a plain list of URLs
-					contentStr := string(indexData)
-
-					// Check if it's a plain text list of URLs (one per line)
-					lines := strings.Split(contentStr, "\n")
-					discoveredMutex.Lock()
-					for _, line := range lines {
-						line = strings.TrimSpace(line)
-						if line == "" || strings.HasPrefix(line, "#") {
-							continue // Skip empty lines and comments
-						}
-
-						// Check if it looks like a URL
-						if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
-							if len(discoveredURLs) < req.Limit && shouldProcessURL(line, req.IncludePaths, req.ExcludePaths) {
-								// Check if URL matches search term
-								if req.Search == "" || strings.Contains(strings.ToLower(line), strings.ToLower(req.Search)) {
-									// Check if we've already visited this URL
-									visitedMutex.Lock()
-									if !visitedURLs[line] {
-										visitedURLs[line] = true
-										discoveredURLs = append(discoveredURLs, line)
-									}
-									visitedMutex.Unlock()
-								}
-							}
-						}
-					}
-					discoveredMutex.Unlock()
-				}
-			}
+			s.processSitemapData(sitemapData, found, sitemapSlots)
 		}
 
 		// If sitemapOnly is true, return the discovered URLs
 		if req.SitemapOnly {
 			return &model.MapResponse{
 				Success: true,
-				Links:   discoveredURLs,
+				Links:   found.links(),
 			}, nil
 		}
 	}
 
 	// Create a new collector with the specified options
+	// The start page is depth 1, so pages up to MaxDepth-1 links away are
+	// visited and their links discovered
 	c := colly.NewCollector(
-		colly.MaxDepth(1), // Only visit the initial page for mapping
+		colly.MaxDepth(req.MaxDepth),
 		colly.Async(true),
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"),
+		colly.UserAgent(s.userAgent),
 	)
 
 	// Set concurrency limit
-	err = c.Limit(&colly.LimitRule{
-		DomainGlob:  "*",
-		Parallelism: 5,
-	})
+	err = c.Limit(s.limitRule(req.Parallelism, req.Delay, req.RandomDelay))
 	if err != nil {
 		return nil, fmt.Errorf("failed to set concurrency limit: %w", err)
 	}
 
 	// Set timeout
-	timeout := 30000 // Default 30 seconds
-	if req.Timeout > 0 {
-		timeout = req.Timeout
-	}
 	c.SetRequestTimeout(time.Duration(timeout) * time.Millisecond)
 
+	// Use the same transport as discovery fetches
+	if s.client.Transport != nil {
+		c.WithTransport(s.client.Transport)
+	}
+
+	// Pages queued before the limit was reached can only add links past it,
+	// so drop them instead of fetching them. Respect the global rate limit for
+	// every page the collector does fetch
+	c.OnRequest(func(r *colly.Request) {
+		if found.full() {
+			r.Abort()
+			return
+		}
+		s.limiter.Wait()
+	})
+
 	// Handle on HTML callback
 	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
 		// Extract the link
@@ -246,50 +185,34 @@ func (s *Service) Map(req model.MapRequest) (*model.MapResponse, error) {
 			return
 		}
 
-		// Parse the link
-		linkURL, err := url.Parse(link)
+		// Resolve the link against the page's base URL
+		linkURL, err := resolveLink(e, link, req.IgnoreBaseHref)
 		if err != nil {
 			return
 		}
 
-		// Resolve relative URLs
-		if linkURL.IsAbs() == false {
-			linkURL = baseURL.ResolveReference(linkURL)
-		}
-
 		// Skip external links if not allowed
-		if !req.IncludeSubdomains && linkURL.Host != baseURL.Host {
-			return
-		}
-
-		// Apply include/exclude path filters
-		if !shouldProcessURL(linkURL.String(), req.IncludePaths, req.ExcludePaths) {
+		if !req.IncludeSubdomains && !utils.IsInternalHost(linkURL.Host, baseURL.Host, req.InternalHosts) {
 			return
 		}
 
-		// Check if URL matches search term
-		if req.Search != "" && !strings.Contains(strings.ToLower(linkURL.String()), strings.ToLower(req.Search)) {
+		// Apply include/exclude path filters and the filter expression
+		if !paths.allowsAt(linkURL.String(), e.Request.Depth) {
 			return
 		}
 
 		// Normalize the URL
-		normalizedURL := linkURL.String()
-
-		// Check if we've already visited this URL
-		visitedMutex.Lock()
-		if visitedURLs[normalizedURL] {
-			visitedMutex.Unlock()
-			return
+		if req.IgnoreQueryParameters {
+			linkURL.RawQuery = ""
+			linkURL.ForceQuery = false
 		}
-		visitedURLs[normalizedURL] = true
-		visitedMutex.Unlock()
+		normalizedURL := linkURL.String()
 
-		// Add to discovered URLs
-		discoveredMutex.Lock()
-		if len(discoveredURLs) < req.Limit {
-			discoveredURLs = append(discoveredURLs, normalizedURL)
+		// Follow new links for deeper links until the limit is reached; the
+		// collector stops at MaxDepth
+		if found.addPageLink(normalizedURL) {
+			_ = e.Request.Visit(normalizedURL)
 		}
-		discoveredMutex.Unlock()
 	})
 
 	// Start crawling
@@ -300,104 +223,213 @@ func (s *Service) Map(req model.MapRequest) (*model.MapResponse, error) {
 
 	return &model.MapResponse{
 		Success: true,
-		Links:   discoveredURLs,
+		Links:   found.links(),
+		Warning: warning,
 	}, nil
 }
 
-// processSitemap fetches and processes a sitemap URL, adding discovered URLs to the results
-func (s *Service) processSitemap(sitemapURL string, req model.MapRequest, discoveredURLs *[]string, visitedURLs map[string]bool, discoveredMutex, visitedMutex *sync.Mutex) {
-	// Fetch the sitemap
-	sitemapResp, err := s.client.Get(sitemapURL)
-	if err != nil || sitemapResp.StatusCode != http.StatusOK {
-		return
+// processSitemapIndex processes the sitemaps listed in an index concurrently,
+// stopping early once the limit is reached. A sitemap is only started once a
+// slot is free, so the limit is checked again after every earlier download.
+func (s *Service) processSitemapIndex(index SitemapIndex, found *discovery, slots chan struct{}) {
+	var wg sync.WaitGroup
+	for _, sitemap := range index.Sitemaps {
+		// Take a slot for the download, then skip the rest if the sitemaps
+		// fetched meanwhile reached the limit
+		slots <- struct{}{}
+		if found.full() {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func(loc string) {
+			defer wg.Done()
+			s.processSitemap(loc, found, slots)
+		}(sitemap.Loc)
+	}
+	wg.Wait()
+}
+
+// fetchSitemap downloads a sitemap, decompressing it if it is gzipped.
+func (s *Service) fetchSitemap(sitemapURL string) ([]byte, error) {
+	sitemapResp, err := s.fetch(sitemapURL)
+	if err != nil {
+		return nil, err
 	}
 	defer sitemapResp.Body.Close()
 
-	// Check if the response is gzipped
-	var reader io.Reader = sitemapResp.Body
-	if strings.HasSuffix(sitemapURL, ".gz") || sitemapResp.Header.Get("Content-Encoding") == "gzip" {
-		gzReader, err := gzip.NewReader(sitemapResp.Body)
-		if err != nil {
-			return
-		}
-		defer gzReader.Close()
-		reader = gzReader
+	if sitemapResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap returned status %d", sitemapResp.StatusCode)
+	}
+
+	return readSitemap(sitemapResp.Body)
+}
+
+// gzipMagic opens every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// maxSitemapBytes caps a sitemap read, before and after decompression, at
+// the 50MB the sitemap protocol allows.
+var maxSitemapBytes int64 = 50 * 1024 * 1024
+
+// readSitemap reads a sitemap body, decompressing it if it is gzipped. The
+// body itself is checked for gzip, since servers often send gzipped
+// sitemaps without a .gz extension or a Content-Encoding header. Sitemaps
+// larger than maxSitemapBytes either way are refused.
+func readSitemap(body io.Reader) ([]byte, error) {
+	data, err := readSitemapBytes(body)
+	if err != nil || !bytes.HasPrefix(data, gzipMagic) {
+		return data, err
 	}
 
-	// Read the sitemap content
-	sitemapData, err := io.ReadAll(reader)
+	gzReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gzReader.Close()
+
+	return readSitemapBytes(gzReader)
+}
+
+// readSitemapBytes reads r to the end, failing once it passes
+// maxSitemapBytes.
+func readSitemapBytes(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxSitemapBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSitemapBytes {
+		return nil, fmt.Errorf("sitemap is larger than %d bytes", maxSitemapBytes)
+	}
+	return data, nil
+}
+
+// processSitemap fetches and processes a sitemap URL, adding discovered URLs
+// to the results. The caller takes a slot for the download.
+func (s *Service) processSitemap(sitemapURL string, found *discovery, slots chan struct{}) {
+	// Hold the slot only while the sitemap downloads so nested indexes can't
+	// starve their own children
+	sitemapData, err := s.fetchSitemap(sitemapURL)
+	<-slots
 	if err != nil {
 		return
 	}
+	s.processSitemapData(sitemapData, found, slots)
+}
 
+// processSitemapData adds the URLs listed in a downloaded sitemap. The
+// sitemaps of an index are processed in turn, and a plain list of URLs, one
+// per line, is accepted too.
+func (s *Service) processSitemapData(sitemapData []byte, found *discovery, slots chan struct{}) {
 	// Try to parse as sitemap index first
 	var sitemapIndex SitemapIndex
 	if err := xml.Unmarshal(sitemapData, &sitemapIndex); err == nil && len(sitemapIndex.Sitemaps) > 0 {
-		// Process each sitemap in the index (recursively)
-		for _, sitemap := range sitemapIndex.Sitemaps {
-			// Skip if we've already reached the limit
-			discoveredMutex.Lock()
-			if len(*discoveredURLs) >= req.Limit {
-				discoveredMutex.Unlock()
-				return
-			}
-			discoveredMutex.Unlock()
+		s.processSitemapIndex(sitemapIndex, found, slots)
+		return
+	}
 
-			// Process the individual sitemap
-			s.processSitemap(sitemap.Loc, req, discoveredURLs, visitedURLs, discoveredMutex, visitedMutex)
+	// Try to parse as regular sitemap
+	var urlset URLSet
+	if err := xml.Unmarshal(sitemapData, &urlset); err == nil && len(urlset.URLs) > 0 {
+		for _, u := range urlset.URLs {
+			found.addSitemapURL(u.Loc)
 		}
-	} else {
-		// Try to parse as regular sitemap
-		var urlset URLSet
-		if err := xml.Unmarshal(sitemapData, &urlset); err == nil && len(urlset.URLs) > 0 {
-			// Add all URLs from sitemap to discovered URLs
-			discoveredMutex.Lock()
-			for _, u := range urlset.URLs {
-				if len(*discoveredURLs) < req.Limit && shouldProcessURL(u.Loc, req.IncludePaths, req.ExcludePaths) {
-					// Check if URL matches search term
-					if req.Search == "" || strings.Contains(strings.ToLower(u.Loc), strings.ToLower(req.Search)) {
-						// Check if we've already visited this URL
-						visitedMutex.Lock()
-						if !visitedURLs[u.Loc] {
-							visitedURLs[u.Loc] = true
-							*discoveredURLs = append(*discoveredURLs, u.Loc)
-						}
-						visitedMutex.Unlock()
-					}
-				}
-			}
-			discoveredMutex.Unlock()
-		} else {
-			// Try to handle non-standard sitemap formats
-			// Some sitemaps might just be a plain list of URLs
-			contentStr := string(sitemapData)
-
-			// Check if it's a plain text list of URLs (one per line)
-			lines := strings.Split(contentStr, "\n")
-			discoveredMutex.Lock()
-			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line == "" || strings.HasPrefix(line, "#") {
-					continue // Skip empty lines and comments
-				}
+		return
+	}
 
-				// Check if it looks like a URL
-				if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
-					if len(*discoveredURLs) < req.Limit && shouldProcessURL(line, req.IncludePaths, req.ExcludePaths) {
-						// Check if URL matches search term
-						if req.Search == "" || strings.Contains(strings.ToLower(line), strings.ToLower(req.Search)) {
-							// Check if we've already visited this URL
-							visitedMutex.Lock()
-							if !visitedURLs[line] {
-								visitedURLs[line] = true
-								*discoveredURLs = append(*discoveredURLs, line)
-							}
-							visitedMutex.Unlock()
-						}
-					}
-				}
-			}
-			discoveredMutex.Unlock()
+	// Some sitemaps are just a plain list of URLs, one per line
+	for _, line := range strings.Split(string(sitemapData), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+			found.addSitemapURL(line)
 		}
 	}
 }
+
+// discovery collects the URLs a map finds, up to its limit. URLs are compared
+// by their canonical form as they are found, so variants of a URL don't use
+// up the limit.
+type discovery struct {
+	req       model.MapRequest
+	paths     *pathMatcher
+	canonical model.CanonicalizeOptions
+
+	mu   sync.Mutex
+	urls []string
+	seen map[string]bool
+}
+
+// newDiscovery starts collecting URLs for a map request with the URL mapped.
+func newDiscovery(req model.MapRequest, paths *pathMatcher) *discovery {
+	d := &discovery{
+		req:       req,
+		paths:     paths,
+		canonical: mapCanonicalize(req),
+		urls:      []string{req.URL},
+		seen:      make(map[string]bool),
+	}
+	d.seen[canonicalURL(req.URL, d.canonical)] = true
+	return d
+}
+
+// full reports whether the limit has been reached.
+func (d *discovery) full() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.urls) >= d.req.Limit
+}
+
+// links returns the URLs found so far.
+func (d *discovery) links() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.urls...)
+}
+
+// matchesSearch reports whether a URL contains the request's search term.
+func (d *discovery) matchesSearch(link string) bool {
+	return d.req.Search == "" || strings.Contains(strings.ToLower(link), strings.ToLower(d.req.Search))
+}
+
+// addPageLink records a link found on a page, which the caller has already
+// filtered. A new link is reported if it matches the search, and followed
+// for more links until the limit is reached; it returns whether to follow it.
+func (d *discovery) addPageLink(link string) bool {
+	key := canonicalURL(link, d.canonical)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen[key] {
+		return false
+	}
+	d.seen[key] = true
+
+	full := len(d.urls) >= d.req.Limit
+	if !full && d.matchesSearch(link) {
+		d.urls = append(d.urls, link)
+	}
+	return !full
+}
+
+// addSitemapURL records a URL listed in a sitemap if it passes the path
+// filters and search, and is new, until the limit is reached. Its query is
+// dropped first when the request ignores query parameters, as it is for
+// links found on pages.
+func (d *discovery) addSitemapURL(loc string) {
+	if d.req.IgnoreQueryParameters {
+		loc = stripQuery(loc)
+	}
+	if !d.paths.allows(loc) || !d.matchesSearch(loc) {
+		return
+	}
+	key := canonicalURL(loc, d.canonical)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.urls) >= d.req.Limit || d.seen[key] {
+		return
+	}
+	d.seen[key] = true
+	d.urls = append(d.urls, loc)
+}
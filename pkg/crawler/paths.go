@@ -0,0 +1,279 @@
+package crawler
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// regexPrefix marks an include or exclude path as a regular expression.
+const regexPrefix = "regex:"
+
+// urlMatcher reports whether a URL matches any of a set of patterns.
+type urlMatcher interface {
+	matches(urlStr string) bool
+}
+
+// pathMatcher applies a crawl's include and exclude paths. Each list is
+// compiled once, as globs or as a substring automaton, so checking a URL
+// doesn't rescan the patterns.
+type pathMatcher struct {
+	include urlMatcher
+	exclude urlMatcher
+
+	// filter is the request's filter expression, if any
+	filter *urlFilter
+}
+
+// newPathMatcher compiles the include and exclude paths for the given
+// matching mode; an empty mode means globs.
+func newPathMatcher(includePaths, excludePaths []string, mode string) *pathMatcher {
+	compile := func(patterns []string) urlMatcher {
+		if mode == model.PathMatchingSubstring {
+			if m := newSubstringMatcher(patterns); m != nil {
+				return m
+			}
+			return nil
+		}
+		if m := newGlobMatcher(patterns); m != nil {
+			return m
+		}
+		return nil
+	}
+
+	return &pathMatcher{
+		include: compile(includePaths),
+		exclude: compile(excludePaths),
+	}
+}
+
+// allows reports whether a URL listed in a sitemap should be processed.
+func (m *pathMatcher) allows(urlStr string) bool {
+	return m.allowsAt(urlStr, sitemapDepth)
+}
+
+// allowsAt reports whether a URL found depth links from the start page should
+// be processed: it must match an include path, if any are set, must not match
+// an exclude path, and must satisfy the filter expression.
+func (m *pathMatcher) allowsAt(urlStr string, depth int) bool {
+	if m.include != nil && !m.include.matches(urlStr) {
+		return false
+	}
+	if m.exclude != nil && m.exclude.matches(urlStr) {
+		return false
+	}
+	return m.filter.allows(urlStr, depth)
+}
+
+// substringMatcher is an Aho-Corasick automaton reporting whether a string
+// contains any of a set of patterns. Bytes that appear in no pattern share a
+// class, which keeps the transition table small.
+type substringMatcher struct {
+	// class maps each byte to its column in the transition table
+	class [256]uint16
+	// classes is the number of columns
+	classes int
+	// delta holds the transitions, one row per state; state 0 is the root
+	delta []int32
+	// found marks states where a pattern, or a suffix of one, ends
+	found []bool
+	// any is set by an empty pattern, which every string contains
+	any bool
+}
+
+// newSubstringMatcher builds the automaton for patterns, or returns nil when
+// there are none.
+func newSubstringMatcher(patterns []string) *substringMatcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	m := &substringMatcher{classes: 1}
+	for _, pattern := range patterns {
+		for i := 0; i < len(pattern); i++ {
+			if m.class[pattern[i]] == 0 {
+				m.class[pattern[i]] = uint16(m.classes)
+				m.classes++
+			}
+		}
+	}
+
+	// Build the trie of patterns; a zero transition means none yet, since
+	// nothing leads back to the root
+	trie := [][]int32{make([]int32, m.classes)}
+	m.found = []bool{false}
+	for _, pattern := range patterns {
+		if pattern == "" {
+			m.any = true
+			continue
+		}
+
+		state := int32(0)
+		for i := 0; i < len(pattern); i++ {
+			c := m.class[pattern[i]]
+			if trie[state][c] == 0 {
+				trie[state][c] = int32(len(trie))
+				trie = append(trie, make([]int32, m.classes))
+				m.found = append(m.found, false)
+			}
+			state = trie[state][c]
+		}
+		m.found[state] = true
+	}
+
+	// Fill in every missing transition with the one from the state's
+	// longest proper suffix in the trie, breadth first so those rows are
+	// complete before they are copied
+	m.delta = make([]int32, len(trie)*m.classes)
+	fail := make([]int32, len(trie))
+	queue := make([]int32, 0, len(trie))
+	copy(m.delta, trie[0])
+	for _, child := range trie[0] {
+		if child != 0 {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		row := m.delta[int(state)*m.classes : int(state+1)*m.classes]
+		fallback := m.delta[int(fail[state])*m.classes : int(fail[state]+1)*m.classes]
+		for c, child := range trie[state] {
+			if child == 0 {
+				row[c] = fallback[c]
+				continue
+			}
+			row[c] = child
+			fail[child] = fallback[c]
+			m.found[child] = m.found[child] || m.found[fail[child]]
+			queue = append(queue, child)
+		}
+	}
+
+	return m
+}
+
+// matches reports whether s contains any of the patterns.
+func (m *substringMatcher) matches(s string) bool {
+	if m.any {
+		return true
+	}
+
+	state := int32(0)
+	for i := 0; i < len(s); i++ {
+		state = m.delta[int(state)*m.classes+int(m.class[s[i]])]
+		if m.found[state] {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePathPattern reports whether an include or exclude path compiles.
+// Only regex: patterns can fail.
+func ValidatePathPattern(pattern string) error {
+	if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+		_, err := regexp.Compile(expr)
+		return err
+	}
+	return nil
+}
+
+// globMatcher matches URLs against glob and regex: patterns. Globs are
+// anchored at the start of the URL path and match it whole or up to a slash,
+// so /admin covers /admin/users but not /administration. A * matches within
+// one path segment and ** across segments. Globs that start with a scheme
+// are matched against the URL without its query instead.
+type globMatcher struct {
+	// path holds the patterns matched against the URL path
+	path *regexp.Regexp
+	// url holds the patterns matched against scheme, host and path
+	url *regexp.Regexp
+}
+
+// newGlobMatcher compiles patterns, or returns nil when there are none.
+// Regex patterns that don't compile are skipped.
+func newGlobMatcher(patterns []string) *globMatcher {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	var pathExprs, urlExprs []string
+	for _, pattern := range patterns {
+		if expr, ok := strings.CutPrefix(pattern, regexPrefix); ok {
+			if _, err := regexp.Compile(expr); err == nil {
+				pathExprs = append(pathExprs, expr)
+			}
+			continue
+		}
+		if strings.Contains(pattern, "://") {
+			urlExprs = append(urlExprs, globExpr(pattern))
+			continue
+		}
+		if !strings.HasPrefix(pattern, "/") {
+			pattern = "/" + pattern
+		}
+		pathExprs = append(pathExprs, globExpr(pattern))
+	}
+
+	return &globMatcher{
+		path: joinExprs(pathExprs),
+		url:  joinExprs(urlExprs),
+	}
+}
+
+// globExpr translates a glob into an anchored regular expression that also
+// matches anything below it.
+func globExpr(glob string) string {
+	glob = strings.TrimSuffix(glob, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i += 2
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		default:
+			j := i
+			for j < len(glob) && glob[j] != '*' {
+				j++
+			}
+			b.WriteString(regexp.QuoteMeta(glob[i:j]))
+			i = j
+		}
+	}
+	b.WriteString("(?:/.*)?$")
+	return b.String()
+}
+
+// joinExprs combines expressions into one alternation, or returns nil when
+// there are none.
+func joinExprs(exprs []string) *regexp.Regexp {
+	if len(exprs) == 0 {
+		return nil
+	}
+	return regexp.MustCompile("(?:" + strings.Join(exprs, ")|(?:") + ")")
+}
+
+// matches reports whether the URL matches any of the patterns.
+func (m *globMatcher) matches(urlStr string) bool {
+	path := urlStr
+	full := urlStr
+	if u, err := url.Parse(urlStr); err == nil {
+		path = u.Path
+		if path == "" {
+			path = "/"
+		}
+		full = u.Scheme + "://" + u.Host + path
+	}
+
+	return (m.path != nil && m.path.MatchString(path)) ||
+		(m.url != nil && m.url.MatchString(full))
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// naiveAllows is the reference behavior pathMatcher must reproduce.
+func naiveAllows(urlStr string, includePaths, excludePaths []string) bool {
+	if len(includePaths) > 0 {
+		matched := false
+		for _, includePath := range includePaths {
+			if strings.Contains(urlStr, includePath) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, excludePath := range excludePaths {
+		if strings.Contains(urlStr, excludePath) {
+			return false
+		}
+	}
+	return true
+}
+
+// testPatterns returns n path patterns, many sharing prefixes and suffixes
+// so the automaton's failure links are exercised.
+func testPatterns(rng *rand.Rand, n int) []string {
+	words := []string{"blog", "docs", "api", "v1", "v2", "en", "de", "post", "page", "a", "ab", "abc", "bc"}
+	patterns := make([]string, n)
+	for i := range patterns {
+		parts := make([]string, 1+rng.Intn(3))
+		for j := range parts {
+			parts[j] = words[rng.Intn(len(words))]
+		}
+		patterns[i] = "/" + strings.Join(parts, "/")
+	}
+	return patterns
+}
+
+// testURLs returns n URLs built from the same vocabulary as testPatterns.
+func testURLs(rng *rand.Rand, n int) []string {
+	words := []string{"blog", "docs", "api", "v1", "v2", "en", "de", "post", "page", "a", "ab", "abc", "bc", "x"}
+	urls := make([]string, n)
+	for i := range urls {
+		parts := make([]string, 1+rng.Intn(5))
+		for j := range parts {
+			parts[j] = words[rng.Intn(len(words))]
+		}
+		urls[i] = fmt.Sprintf("https://example.com/%s?id=%d", strings.Join(parts, "/"), i)
+	}
+	return urls
+}
+
+func TestPathMatcher(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		url     string
+		want    bool
+	}{
+		{name: "No filters", url: "https://example.com/blog", want: true},
+		{name: "Included", include: []string{"/blog"}, url: "https://example.com/blog/post", want: true},
+		{name: "Not included", include: []string{"/blog"}, url: "https://example.com/docs", want: false},
+		{name: "Excluded", exclude: []string{"/private"}, url: "https://example.com/private/x", want: false},
+		{name: "Included then excluded", include: []string{"/blog"}, exclude: []string{"draft"}, url: "https://example.com/blog/draft-1", want: false},
+		{name: "Overlapping patterns", include: []string{"abcd", "bce"}, url: "https://example.com/abce", want: true},
+		{name: "Empty pattern matches everything", include: []string{""}, url: "https://example.com/", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPathMatcher(tt.include, tt.exclude, model.PathMatchingSubstring).allows(tt.url); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPathMatcherGlob(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		url     string
+		want    bool
+	}{
+		{name: "Wildcard segment", include: []string{"/blog/*"}, url: "https://example.com/blog/post", want: true},
+		{name: "Wildcard below segment", include: []string{"/blog/*"}, url: "https://example.com/blog/2024/post", want: true},
+		{name: "Wildcard needs a segment", include: []string{"/blog/*"}, url: "https://example.com/blog", want: false},
+		{name: "Wildcard stays in segment", include: []string{"/blog/*/comments"}, url: "https://example.com/blog/2024/post/comments", want: false},
+		{name: "Double wildcard crosses segments", include: []string{"/blog/**/comments"}, url: "https://example.com/blog/2024/post/comments", want: true},
+		{name: "Anchored at segment", exclude: []string{"/admin"}, url: "https://example.com/administration", want: true},
+		{name: "Anchored below segment", exclude: []string{"/admin"}, url: "https://example.com/admin/users", want: false},
+		{name: "Anchored at path start", exclude: []string{"/admin"}, url: "https://example.com/en/admin", want: true},
+		{name: "Leading slash optional", include: []string{"docs"}, url: "https://example.com/docs/intro", want: true},
+		{name: "Query ignored", include: []string{"/docs"}, url: "https://example.com/docs?page=2", want: true},
+		{name: "Full URL", include: []string{"https://example.com/blog"}, url: "https://example.com/blog/post", want: true},
+		{name: "Full URL on another host", include: []string{"https://example.com/blog"}, url: "https://other.com/blog/post", want: false},
+		{name: "Regex", include: []string{`regex:^/posts/\d+$`}, url: "https://example.com/posts/42", want: true},
+		{name: "Regex no match", include: []string{`regex:^/posts/\d+$`}, url: "https://example.com/posts/new", want: false},
+		{name: "Invalid regex skipped", include: []string{"regex:(", "/docs"}, url: "https://example.com/docs", want: true},
+		{name: "Root matches everything", include: []string{"/"}, url: "https://example.com/any/page", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newPathMatcher(tt.include, tt.exclude, model.PathMatchingGlob).allows(tt.url); got != tt.want {
+				t.Errorf("allows(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePathPattern(t *testing.T) {
+	if err := ValidatePathPattern("/blog/*"); err != nil {
+		t.Errorf("Expected globs to be valid, got %v", err)
+	}
+	if err := ValidatePathPattern("regex:^/posts/[0-9]+$"); err != nil {
+		t.Errorf("Expected a valid regex to pass, got %v", err)
+	}
+	if err := ValidatePathPattern("regex:("); err == nil {
+		t.Error("Expected an invalid regex to fail")
+	}
+}
+
+func TestPathMatcherMatchesNaive(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	urls := testURLs(rng, 2000)
+
+	for round := 0; round < 20; round++ {
+		include := testPatterns(rng, rng.Intn(20))
+		exclude := testPatterns(rng, rng.Intn(20))
+		matcher := newPathMatcher(include, exclude, model.PathMatchingSubstring)
+
+		for _, u := range urls {
+			if got, want := matcher.allows(u), naiveAllows(u, include, exclude); got != want {
+				t.Fatalf("allows(%q) = %v, want %v (include %v, exclude %v)", u, got, want, include, exclude)
+			}
+		}
+	}
+}
+
+func BenchmarkPathMatcher(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	include := testPatterns(rng, 100)
+	exclude := testPatterns(rng, 100)
+	urls := testURLs(rng, 10000)
+
+	b.Run("Matcher", func(b *testing.B) {
+		matcher := newPathMatcher(include, exclude, model.PathMatchingSubstring)
+		for i := 0; i < b.N; i++ {
+			for _, u := range urls {
+				matcher.allows(u)
+			}
+		}
+	})
+	b.Run("Naive", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, u := range urls {
+				naiveAllows(u, include, exclude)
+			}
+		}
+	})
+}
@@ -0,0 +1,25 @@
+package crawler
+
+import "github.com/ncecere/rummage/pkg/storage"
+
+// withBufferedResults returns a copy of the service whose page result writes
+// go through the buffered writer.
+func (s *Service) withBufferedResults(results *storage.BufferedWriter) *Service {
+	clone := *s
+	clone.results = results
+	clone.updateJobFn = results.Write
+	return &clone
+}
+
+// flushResults stores the results buffered during a storage outage and marks
+// the job degraded if storage failed at any point.
+func (s *Service) flushResults(jobID string) {
+	if s.results == nil {
+		return
+	}
+
+	s.results.Flush()
+	if s.results.Degraded() && s.markDegradedFn != nil {
+		_ = s.markDegradedFn(jobID)
+	}
+}
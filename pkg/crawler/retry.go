@@ -0,0 +1,208 @@
+package crawler
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+const (
+	// earlyFailureWindow is the number of leading pages inspected to decide
+	// whether a crawl is being blocked outright.
+	earlyFailureWindow = 5
+	// fallbackDelay is the pause between requests when retrying a blocked crawl.
+	fallbackDelay = 1 * time.Second
+)
+
+// fallbackUserAgents are rotated through when retrying a blocked crawl.
+var fallbackUserAgents = []string{
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 13_4) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:115.0) Gecko/20100101 Firefox/115.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:115.0) Gecko/20100101 Firefox/115.0",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1",
+}
+
+// scrapeLinks scrapes the links with up to maxConcurrentJobs pages in flight,
+// reporting results through the update job function. When detectBlock is set,
+// the early failure window is scraped first, and if every page in it fails it
+// stops and reports the crawl as blocked; the window's errors are only stored
+// once the crawl is known not to be blocked, so a retry doesn't leave stale
+// failures behind. A delay between requests scrapes one
+// page at a time; the scrape options' delay applies when it is longer, with
+// their random delay added to each pause. It stops early, recording nothing
+// more, once ctx is cancelled.
+func (s *Service) scrapeLinks(ctx context.Context, jobID string, links []string, opts *model.CrawlScrapeOptions, delay time.Duration, detectBlock bool) ([]model.CrawlError, bool) {
+	var randomDelay time.Duration
+	if opts != nil {
+		if optsDelay := time.Duration(opts.Delay) * time.Millisecond; optsDelay > delay {
+			delay = optsDelay
+		}
+		randomDelay = time.Duration(opts.RandomDelay) * time.Millisecond
+	}
+
+	workers := s.maxConcurrentJobs
+	if delay > 0 || randomDelay > 0 || workers <= 0 {
+		workers = 1
+	}
+	pool := &linkPool{service: s, jobID: jobID, total: len(links), opts: opts, delay: delay, randomDelay: randomDelay, workers: workers}
+
+	if detectBlock {
+		window := earlyFailureWindow
+		if len(links) < window {
+			window = len(links)
+		}
+
+		// Every page in the window failed
+		pool.holdErrors = true
+		pool.run(ctx, links[:window])
+		if window > 0 && len(pool.errors) == window {
+			return pool.errors, true
+		}
+		pool.holdErrors = false
+		for _, crawlError := range pool.errors {
+			s.storeError(jobID, crawlError)
+		}
+		links = links[window:]
+	}
+
+	pool.run(ctx, links)
+	return pool.errors, false
+}
+
+// linkPool scrapes a crawl's links across a bounded set of workers. Results
+// are recorded one at a time, so job updates and status counts stay in step.
+type linkPool struct {
+	service *Service
+	jobID   string
+	total   int
+	opts    *model.CrawlScrapeOptions
+	delay   time.Duration
+	workers int
+
+	// Jitter of up to randomDelay is added to each pause
+	randomDelay time.Duration
+
+	// Scrapes started so far, touched only by run
+	started int
+	// holdErrors keeps errors out of storage until the caller stores them;
+	// set only between runs
+	holdErrors bool
+
+	// Guards the fields below and serializes job updates
+	mu        sync.Mutex
+	errors    []model.CrawlError
+	processed int
+}
+
+// run scrapes the links, returning once every started scrape is recorded.
+func (p *linkPool) run(ctx context.Context, links []string) {
+	if p.errors == nil {
+		p.errors = make([]model.CrawlError, 0)
+	}
+
+	// Bounds the scrapes in flight at once
+	slots := make(chan struct{}, p.workers)
+	var wg sync.WaitGroup
+
+	for _, link := range links {
+		// Space out requests when a delay is requested
+		if p.started > 0 {
+			if pause := p.pause(); pause > 0 {
+				timer := time.NewTimer(pause)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
+			}
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		p.started++
+		wg.Add(1)
+		go func(link string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			p.scrape(ctx, link)
+		}(link)
+	}
+
+	wg.Wait()
+}
+
+// pause returns the wait before the next scrape: the delay plus a random
+// share of the random delay.
+func (p *linkPool) pause() time.Duration {
+	pause := p.delay
+	if p.randomDelay > 0 {
+		pause += time.Duration(rand.Int63n(int64(p.randomDelay)))
+	}
+	return pause
+}
+
+// scrape scrapes one link and records its result or error.
+func (p *linkPool) scrape(ctx context.Context, link string) {
+	s := p.service
+
+	// Scrape the URL; a page cut short by cancellation isn't recorded
+	result, err := s.scraper.ScrapeContext(ctx, newScrapeRequest(link, p.opts))
+	if ctx.Err() != nil {
+		return
+	}
+	if err == nil {
+		err = soft404Error(p.opts, result)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	processed := p.processed
+	p.processed++
+
+	if err != nil {
+		crawlError := newCrawlError(link, err)
+		if !p.holdErrors {
+			s.storeError(p.jobID, crawlError)
+		}
+		p.errors = append(p.errors, crawlError)
+		return
+	}
+
+	// Call the update job function
+	if s.updateJobFn != nil {
+		_ = s.updateJobFn(p.jobID, *result)
+	}
+
+	// Update job status periodically
+	if s.updateJobStatusFn != nil && processed%10 == 0 {
+		_ = s.updateJobStatusFn(p.jobID, "scraping", p.total)
+	}
+}
+
+// fallbackScrapeOptions returns a copy of the scrape options with a randomly
+// chosen alternative User-Agent header.
+func fallbackScrapeOptions(opts *model.CrawlScrapeOptions) *model.CrawlScrapeOptions {
+	fallback := model.CrawlScrapeOptions{}
+	if opts != nil {
+		fallback = *opts
+	}
+
+	headers := make(map[string]string, len(fallback.Headers)+1)
+	for key, value := range fallback.Headers {
+		headers[key] = value
+	}
+	headers["User-Agent"] = fallbackUserAgents[rand.Intn(len(fallbackUserAgents))]
+	fallback.Headers = headers
+
+	return &fallback
+}
@@ -0,0 +1,58 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// urlRewriter applies a crawl's URL rewrite rules in order.
+type urlRewriter []compiledRewriteRule
+
+// compiledRewriteRule is a rewrite rule with its pattern compiled.
+type compiledRewriteRule struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// newURLRewriter compiles the rewrite rules once for a crawl.
+func newURLRewriter(rules []model.URLRewriteRule) (urlRewriter, error) {
+	rewriter := make(urlRewriter, 0, len(rules))
+	for _, rule := range rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL rewrite pattern %q: %w", rule.Pattern, err)
+		}
+		rewriter = append(rewriter, compiledRewriteRule{pattern: pattern, replacement: rule.Replacement})
+	}
+	return rewriter, nil
+}
+
+// rewrite applies every rule to the URL in order.
+func (rw urlRewriter) rewrite(rawURL string) string {
+	for _, rule := range rw {
+		rawURL = rule.pattern.ReplaceAllString(rawURL, rule.replacement)
+	}
+	return rawURL
+}
+
+// rewriteAll rewrites each URL, dropping any that collapse into a URL already
+// in the list.
+func (rw urlRewriter) rewriteAll(urls []string) []string {
+	if len(rw) == 0 {
+		return urls
+	}
+
+	seen := make(map[string]bool, len(urls))
+	rewritten := make([]string, 0, len(urls))
+	for _, u := range urls {
+		u = rw.rewrite(u)
+		if seen[u] {
+			continue
+		}
+		seen[u] = true
+		rewritten = append(rewritten, u)
+	}
+	return rewritten
+}
@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// ValidateSeed checks that the seed URL is reachable and serves HTML before a
+// crawl is scheduled. The check uses the crawl's proxy, TLS settings and
+// headers, so a seed the crawl can reach is not rejected.
+func (s *Service) ValidateSeed(crawlReq model.CrawlRequest) error {
+	req, err := http.NewRequest(http.MethodGet, crawlReq.URL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid seed URL: %w", err)
+	}
+	req.Header.Set("User-Agent", s.userAgent)
+	if crawlReq.ScrapeOptions != nil {
+		for key, value := range crawlReq.ScrapeOptions.Headers {
+			req.Header.Set(key, value)
+		}
+	}
+
+	transport := s.newCrawlTransport(crawlReq)
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Timeout:   s.client.Timeout,
+		Transport: transport,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("seed URL is unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body before the connection is closed
+	_, _ = io.CopyN(io.Discard, resp.Body, 4096)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("seed URL returned status %d", resp.StatusCode)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return fmt.Errorf("seed URL returned non-HTML content type %q", contentType)
+	}
+
+	return nil
+}
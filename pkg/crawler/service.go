@@ -4,11 +4,42 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/ncecere/rummage/pkg/export"
+	"github.com/ncecere/rummage/pkg/llm"
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/ratelimit"
 	"github.com/ncecere/rummage/pkg/scraper"
+	"github.com/ncecere/rummage/pkg/storage"
+	"github.com/ncecere/rummage/pkg/utils"
+	"github.com/ncecere/rummage/pkg/webhook"
+)
+
+// defaultTimeoutMS is the request timeout used when a crawl or map doesn't set one.
+const defaultTimeoutMS = 30000
+
+const (
+	// DefaultCrawlLimit is the page limit used when a crawl doesn't set one.
+	DefaultCrawlLimit = 1000
+	// DefaultMaxDepth is the link depth used when a crawl doesn't set one.
+	DefaultMaxDepth = 10
+	// DefaultMapLimit is the link limit used when a map doesn't set one.
+	DefaultMapLimit = 5000
+	// DefaultMapDepth is the link depth used when a map doesn't set one:
+	// only links on the start page are discovered.
+	DefaultMapDepth = 1
+	// DefaultMaxSitemapConcurrency is the number of nested sitemaps fetched
+	// at once when none is configured.
+	DefaultMaxSitemapConcurrency = 4
+	// DefaultMaxConcurrentJobs is the number of pages a crawl scrapes at once
+	// when none is configured.
+	DefaultMaxConcurrentJobs = 10
+	// DefaultParallelism is the number of requests crawls and maps send to
+	// each domain at once when none is configured.
+	DefaultParallelism = 5
 )
 
 // Service provides website crawling functionality.
@@ -18,6 +49,50 @@ type Service struct {
 	baseURL           string
 	updateJobFn       func(string, model.ScrapeResult) error
 	updateJobStatusFn func(string, string, int) error
+	discoveryCappedFn func(string) error
+	markRetriedFn     func(string) error
+	markDegradedFn    func(string) error
+
+	// Persist page failures and robots.txt refusals as they happen
+	storeErrorFn         func(string, model.CrawlError) error
+	storeRobotsBlockedFn func(string, string) error
+
+	// Retries and buffers page result writes during storage outages; set
+	// per crawl
+	results *storage.BufferedWriter
+
+	// Connection tuning defaults for per-crawl transports
+	maxIdleConnsPerHost int
+	disableKeepAlives   bool
+
+	// Nested sitemaps fetched at once during a map
+	maxSitemapConcurrency int
+
+	// Pages scraped at once during a crawl
+	maxConcurrentJobs int
+
+	// Link discovery requests per domain at once, and the pause between them
+	parallelism int
+	domainDelay time.Duration
+
+	// Headers sent with robots.txt and sitemap fetches
+	userAgent   string
+	hostHeaders map[string]map[string]string
+
+	// Credentials for crawl result destinations, keyed by reference
+	exportCredentials map[string]export.Credentials
+
+	// Server-wide outbound rate limit
+	limiter *ratelimit.Limiter
+
+	// Default proxy for crawls that don't set one; nil connects directly
+	proxy *url.URL
+
+	// Reports lifecycle events to crawl webhooks
+	webhookFn func(*model.WebhookConfig, string, string, model.WebhookEvent)
+
+	// Crawls running on this server, shared with copies of the service
+	jobs *runningJobs
 }
 
 // ServiceOptions contains options for creating a crawler service.
@@ -25,18 +100,160 @@ type ServiceOptions struct {
 	BaseURL           string
 	UpdateJobFn       func(string, model.ScrapeResult) error
 	UpdateJobStatusFn func(string, string, int) error
+	DiscoveryCappedFn func(string) error
+	MarkRetriedFn     func(string) error
+	// MarkDegradedFn records that storage failed during a crawl, so results
+	// were buffered or lost.
+	MarkDegradedFn func(string) error
+	// StoreErrorFn records a page that failed to scrape, and
+	// StoreRobotsBlockedFn a page robots.txt disallowed, as the crawl runs.
+	StoreErrorFn         func(string, model.CrawlError) error
+	StoreRobotsBlockedFn func(string, string) error
+
+	// MaxIdleConnsPerHost and DisableKeepAlives are the connection tuning
+	// defaults used when a crawl doesn't override them.
+	MaxIdleConnsPerHost int
+	DisableKeepAlives   bool
+
+	// MaxRequestTimeout is the ceiling applied to every requested timeout.
+	MaxRequestTimeout time.Duration
+
+	// MaxSitemapConcurrency caps the nested sitemaps fetched at once while
+	// mapping a sitemap index. Defaults to DefaultMaxSitemapConcurrency.
+	MaxSitemapConcurrency int
+
+	// MaxConcurrentJobs caps the pages a crawl scrapes at once. Defaults to
+	// DefaultMaxConcurrentJobs.
+	MaxConcurrentJobs int
+
+	// Parallelism caps the link discovery requests sent to each domain at
+	// once. Defaults to DefaultParallelism.
+	Parallelism int
+	// DomainDelay is the pause between link discovery requests to the same
+	// domain. Zero sends them without waiting.
+	DomainDelay time.Duration
+
+	// UserAgent is sent with every request. Defaults to scraper.DefaultUserAgent.
+	UserAgent string
+	// ImageHandling is the default markdown image handling for scraped pages.
+	ImageHandling string
+	// Soft404Patterns are the phrases that mark a page as a soft 404.
+	Soft404Patterns []string
+	// RawContentTypes are the media types the rawHtml format may return.
+	RawContentTypes []string
+	// PaywallMarkers are the CSS selectors that mark a page as paywalled.
+	PaywallMarkers []string
+	// MaxResponseBytes caps the response body read for each page. Defaults
+	// to scraper.DefaultMaxResponseBytes.
+	MaxResponseBytes int
+	// BrowserPath is the Chrome or Chromium binary used for screenshot
+	// formats. Empty disables them.
+	BrowserPath string
+	// MaxScreenshotBytes caps the size of each page's screenshot. Defaults
+	// to scraper.DefaultMaxScreenshotBytes.
+	MaxScreenshotBytes int
+	// LLM runs the extraction for the json format. Nil disables it.
+	LLM *llm.Client
+	// HostHeaders are extra headers sent with robots.txt and sitemap fetches,
+	// keyed by lowercase host name.
+	HostHeaders map[string]map[string]string
+	// ExportCredentials are the named credentials crawl destinations may
+	// reference.
+	ExportCredentials map[string]export.Credentials
+	// Limiter is the server-wide outbound rate limit. Nil means unlimited.
+	Limiter *ratelimit.Limiter
+	// ProxyURL routes requests through an HTTP, HTTPS or SOCKS5 proxy
+	// unless a crawl sets its own. Empty connects directly.
+	ProxyURL string
+	// WebhookFn reports crawl lifecycle events to the crawl's webhook; it
+	// must not block. Defaults to an unsigned webhook.Notifier.
+	WebhookFn func(cfg *model.WebhookConfig, job, event string, payload model.WebhookEvent)
 }
 
 // NewService creates a new crawler service.
 func NewService(opts ServiceOptions) *Service {
+	maxIdleConnsPerHost := opts.MaxIdleConnsPerHost
+	if maxIdleConnsPerHost <= 0 {
+		maxIdleConnsPerHost = 10
+	}
+	maxSitemapConcurrency := opts.MaxSitemapConcurrency
+	if maxSitemapConcurrency <= 0 {
+		maxSitemapConcurrency = DefaultMaxSitemapConcurrency
+	}
+	maxConcurrentJobs := opts.MaxConcurrentJobs
+	if maxConcurrentJobs <= 0 {
+		maxConcurrentJobs = DefaultMaxConcurrentJobs
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = DefaultParallelism
+	}
+
+	scraperService := scraper.NewServiceWithOptions(scraper.ServiceOptions{
+		MaxRequestTimeout: opts.MaxRequestTimeout,
+		UserAgent:         opts.UserAgent,
+		ImageHandling:     opts.ImageHandling,
+		Soft404Patterns:   opts.Soft404Patterns,
+		RawContentTypes:   opts.RawContentTypes,
+		PaywallMarkers:    opts.PaywallMarkers,
+		MaxResponseBytes:  opts.MaxResponseBytes,
+		Limiter:           opts.Limiter,
+		BrowserPath:       opts.BrowserPath,
+		LLM:               opts.LLM,
+		ProxyURL:          opts.ProxyURL,
+
+		MaxScreenshotBytes: opts.MaxScreenshotBytes,
+	})
+
+	webhookFn := opts.WebhookFn
+	if webhookFn == nil {
+		webhookFn = webhook.NewNotifier("").Notify
+	}
+
+	// Route robots.txt, sitemap and seed fetches through the default proxy
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	var proxy *url.URL
+	if opts.ProxyURL != "" {
+		if u, err := utils.ParseProxy(opts.ProxyURL); err == nil {
+			proxy = u
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			utils.UseProxy(transport, proxy)
+			client.Transport = transport
+		}
+	}
+
 	return &Service{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		scraper:           scraper.NewService(),
+		client:            client,
+		scraper:           scraperService,
 		baseURL:           opts.BaseURL,
 		updateJobFn:       opts.UpdateJobFn,
 		updateJobStatusFn: opts.UpdateJobStatusFn,
+		discoveryCappedFn: opts.DiscoveryCappedFn,
+		markRetriedFn:     opts.MarkRetriedFn,
+		markDegradedFn:    opts.MarkDegradedFn,
+
+		storeErrorFn:         opts.StoreErrorFn,
+		storeRobotsBlockedFn: opts.StoreRobotsBlockedFn,
+
+		maxIdleConnsPerHost: maxIdleConnsPerHost,
+		disableKeepAlives:   opts.DisableKeepAlives,
+
+		maxSitemapConcurrency: maxSitemapConcurrency,
+		maxConcurrentJobs:     maxConcurrentJobs,
+
+		parallelism: parallelism,
+		domainDelay: opts.DomainDelay,
+
+		userAgent:   scraperService.UserAgent(),
+		hostHeaders: opts.HostHeaders,
+
+		exportCredentials: opts.ExportCredentials,
+		limiter:           opts.Limiter,
+		proxy:             proxy,
+		webhookFn:         webhookFn,
+		jobs:              newRunningJobs(),
 	}
 }
 
@@ -46,17 +263,24 @@ func (s *Service) Crawl(req model.CrawlRequest) (*model.CrawlResponse, string, e
 		return nil, "", errors.New("URL is required")
 	}
 
+	// The proxy must be one the transport can use
+	if req.ScrapeOptions != nil && req.ScrapeOptions.Proxy != "" {
+		if _, err := utils.ParseProxy(req.ScrapeOptions.Proxy); err != nil {
+			return nil, "", err
+		}
+	}
+
 	jobID := uuid.New().String()
 
 	if req.MaxDepth <= 0 {
-		req.MaxDepth = 10
+		req.MaxDepth = DefaultMaxDepth
 	}
 	if req.Limit <= 0 {
-		req.Limit = 1000
+		req.Limit = DefaultCrawlLimit
 	}
 	if req.ScrapeOptions == nil {
 		req.ScrapeOptions = &model.CrawlScrapeOptions{
-			Formats: []string{"markdown"},
+			ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown"}},
 		}
 	} else if len(req.ScrapeOptions.Formats) == 0 {
 		req.ScrapeOptions.Formats = []string{"markdown"}
@@ -68,6 +292,13 @@ func (s *Service) Crawl(req model.CrawlRequest) (*model.CrawlResponse, string, e
 		URL:     fmt.Sprintf("%s/v1/crawl/%s", s.baseURL, jobID),
 	}
 
+	// Warn when a requested timeout exceeds the ceiling
+	discoveryTimeout, scrapeTimeout := req.PhaseTimeouts()
+	_, response.Warning = utils.ResolveTimeout(scrapeTimeout, defaultTimeoutMS, s.scraper.MaxTimeoutMS())
+	if response.Warning == "" {
+		_, response.Warning = utils.ResolveTimeout(discoveryTimeout, defaultTimeoutMS, s.scraper.MaxTimeoutMS())
+	}
+
 	return response, jobID, nil
 }
 
@@ -79,7 +310,14 @@ func (s *Service) GetCrawlErrors(jobID string) (*model.CrawlErrorsResponse, erro
 	}, nil
 }
 
-// CancelCrawl cancels a crawl job.
+// CancelCrawl stops a crawl job running on this server, aborting its
+// in-flight scrapes. Cancelling a job that isn't running here does nothing.
 func (s *Service) CancelCrawl(jobID string) error {
+	s.jobs.cancel(jobID)
 	return nil
 }
+
+// RunningCrawls returns the IDs of the crawl jobs running on this server.
+func (s *Service) RunningCrawls() []string {
+	return s.jobs.running()
+}
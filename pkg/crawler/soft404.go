@@ -0,0 +1,20 @@
+package crawler
+
+import (
+	"errors"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// errSoft404 is recorded for pages flagged as soft 404s when the crawl treats
+// them as errors.
+var errSoft404 = errors.New("page looks like a soft 404")
+
+// soft404Error returns errSoft404 when the result is a soft 404 that the crawl
+// should record as an error rather than a result.
+func soft404Error(opts *model.CrawlScrapeOptions, result *model.ScrapeResult) error {
+	if opts == nil || !opts.Soft404AsError || result.Metadata == nil || !result.Metadata.Soft404 {
+		return nil
+	}
+	return errSoft404
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// newCrawlTransport builds a dedicated transport for a single crawl, applying
+// the request's connection tuning on top of the service defaults.
+func (s *Service) newCrawlTransport(req model.CrawlRequest) *http.Transport {
+	maxIdleConnsPerHost := s.maxIdleConnsPerHost
+	if req.MaxIdleConnsPerHost > 0 {
+		maxIdleConnsPerHost = req.MaxIdleConnsPerHost
+	}
+
+	disableKeepAlives := s.disableKeepAlives
+	if req.DisableKeepAlives != nil {
+		disableKeepAlives = *req.DisableKeepAlives
+	}
+
+	// Start from the default transport, so crawls keep HTTP/2 and the
+	// environment proxy, and only tune the connection pool
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxIdleConnsPerHost * 2
+	transport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	transport.DisableKeepAlives = disableKeepAlives
+
+	// Use the crawl's proxy, then the service default, then the environment
+	proxy := s.proxy
+	if req.ScrapeOptions != nil && req.ScrapeOptions.Proxy != "" {
+		if u, err := utils.ParseProxy(req.ScrapeOptions.Proxy); err == nil {
+			proxy = u
+		}
+	}
+	if proxy != nil {
+		utils.UseProxy(transport, proxy)
+	}
+
+	// Self-signed hosts are only reachable without certificate verification
+	if req.ScrapeOptions != nil && req.ScrapeOptions.SkipTlsVerification {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return transport
+}
+
+// withTransport returns a copy of the service whose page scrapes, robots.txt
+// and sitemap fetches go through the given transport.
+func (s *Service) withTransport(rt http.RoundTripper) *Service {
+	clone := *s
+	clone.client = &http.Client{
+		Timeout:   s.client.Timeout,
+		Transport: rt,
+	}
+	clone.scraper = s.scraper.WithTransport(rt)
+	return &clone
+}
+
+// withFetchTimeout returns a copy of the service whose robots.txt and sitemap
+// fetches time out after d.
+func (s *Service) withFetchTimeout(d time.Duration) *Service {
+	clone := *s
+	clone.client = &http.Client{
+		Timeout:   d,
+		Transport: s.client.Transport,
+	}
+	return &clone
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"sync/atomic"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// notifyWebhook reports a lifecycle event for the crawl to its webhook.
+func (s *Service) notifyWebhook(jobID string, req model.CrawlRequest, event string, payload model.WebhookEvent) {
+	if req.Webhook == nil || s.webhookFn == nil {
+		return
+	}
+
+	payload.ID = jobID
+	s.webhookFn(req.Webhook, model.WebhookJobCrawl, event, payload)
+}
+
+// withWebhookPages returns a copy of the service that reports a page event
+// to the crawl's webhook for each page result it records. total reports how
+// many pages the crawl has found so far.
+func (s *Service) withWebhookPages(req model.CrawlRequest, total func() int) *Service {
+	if req.Webhook == nil || !req.Webhook.Wants(model.WebhookPage) {
+		return s
+	}
+
+	clone := *s
+	updateJobFn := s.updateJobFn
+	var completed int64
+	clone.updateJobFn = func(jobID string, result model.ScrapeResult) error {
+		var err error
+		if updateJobFn != nil {
+			err = updateJobFn(jobID, result)
+		}
+
+		s.notifyWebhook(jobID, req, model.WebhookPage, model.WebhookEvent{
+			Total:     total(),
+			Completed: int(atomic.AddInt64(&completed, 1)),
+			Data:      &result,
+		})
+		return err
+	}
+	return &clone
+}
@@ -0,0 +1,95 @@
+// Package export provides writers that send crawl results to external storage.
+package export
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// defaultCredentialsRef is used when a destination doesn't name its credentials.
+const defaultCredentialsRef = "default"
+
+// unsafeKeyChars matches characters that are replaced in object keys.
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Writer stores objects in an external store.
+type Writer interface {
+	Write(ctx context.Context, key string, data []byte, contentType string) error
+}
+
+// Credentials holds the connection details for an S3-compatible store.
+type Credentials struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	AccessKeyID     string `mapstructure:"accessKeyId"`
+	SecretAccessKey string `mapstructure:"secretAccessKey"`
+	UsePathStyle    bool   `mapstructure:"usePathStyle"`
+}
+
+// NewWriter creates a writer for the destination, looking up its credentials
+// by reference in the configured credentials.
+func NewWriter(dest model.CrawlDestination, credentials map[string]Credentials) (Writer, error) {
+	if dest.Bucket == "" {
+		return nil, fmt.Errorf("destination bucket is required")
+	}
+
+	ref := dest.CredentialsRef
+	if ref == "" {
+		ref = defaultCredentialsRef
+	}
+
+	switch dest.Type {
+	case "s3":
+		creds, ok := credentials[strings.ToLower(ref)]
+		if !ok {
+			return nil, fmt.Errorf("unknown credentials reference: %s", ref)
+		}
+		return NewS3Writer(creds, dest.Bucket)
+	default:
+		return nil, fmt.Errorf("unsupported destination type: %s", dest.Type)
+	}
+}
+
+// WriteResult stores a scrape result as a JSON object named after its page.
+func WriteResult(ctx context.Context, w Writer, prefix, jobID string, result model.ScrapeResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode result: %w", err)
+	}
+
+	pageURL := ""
+	if result.Metadata != nil {
+		pageURL = result.Metadata.SourceURL
+	}
+
+	return w.Write(ctx, ObjectKey(prefix, jobID, pageURL), data, "application/json")
+}
+
+// ObjectKey returns the key for a page's result. Keys are grouped by job and
+// named after the page's host and path, with a short hash of the full URL so
+// pages differing only by query string don't collide.
+func ObjectKey(prefix, jobID, pageURL string) string {
+	return path.Join(prefix, jobID, pageFileName(pageURL, ".json"))
+}
+
+// pageFileName names a file after the page's host and path, with a short hash
+// of the full URL and the given extension.
+func pageFileName(pageURL, ext string) string {
+	name := pageURL
+	if u, err := url.Parse(pageURL); err == nil && u.Host != "" {
+		name = u.Host + u.Path
+	}
+	name = strings.Trim(unsafeKeyChars.ReplaceAllString(name, "_"), "_")
+
+	sum := sha1.Sum([]byte(pageURL))
+	return name + "-" + hex.EncodeToString(sum[:4]) + ext
+}
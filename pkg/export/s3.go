@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// defaultRegion is used when credentials don't set a region.
+const defaultRegion = "us-east-1"
+
+// S3Writer writes objects to an S3-compatible bucket.
+type S3Writer struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Writer creates a writer for the given bucket.
+func NewS3Writer(creds Credentials, bucket string) (*S3Writer, error) {
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key ID and secret access key are required")
+	}
+
+	region := creds.Region
+	if region == "" {
+		region = defaultRegion
+	}
+
+	client := s3.New(s3.Options{
+		Region:       region,
+		Credentials:  credentials.NewStaticCredentialsProvider(creds.AccessKeyID, creds.SecretAccessKey, ""),
+		UsePathStyle: creds.UsePathStyle,
+		BaseEndpoint: optionalString(creds.Endpoint),
+	})
+
+	return &S3Writer{
+		client: client,
+		bucket: bucket,
+	}, nil
+}
+
+// Write uploads an object to the bucket.
+func (w *S3Writer) Write(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := w.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(w.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// optionalString returns nil for an empty string so SDK defaults apply.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
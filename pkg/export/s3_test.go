@@ -0,0 +1,133 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// mockS3 is a minimal path-style S3 server that records uploaded objects.
+type mockS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *mockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.objects[strings.TrimPrefix(r.URL.Path, "/")] = body
+	m.mu.Unlock()
+
+	w.Header().Set("ETag", `"mock"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestS3WriterWriteResult(t *testing.T) {
+	mock := &mockS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(mock)
+	defer server.Close()
+
+	dest := model.CrawlDestination{
+		Type:           "s3",
+		Bucket:         "crawls",
+		Prefix:         "exports",
+		CredentialsRef: "local",
+	}
+	credentials := map[string]Credentials{
+		"local": {
+			Endpoint:        server.URL,
+			AccessKeyID:     "test",
+			SecretAccessKey: "test",
+			UsePathStyle:    true,
+		},
+	}
+
+	writer, err := NewWriter(dest, credentials)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	result := model.ScrapeResult{
+		Markdown: "# Hello",
+		Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/docs/intro"},
+	}
+	if err := WriteResult(context.Background(), writer, dest.Prefix, "job-1", result); err != nil {
+		t.Fatalf("WriteResult() error = %v", err)
+	}
+
+	key := "crawls/" + ObjectKey(dest.Prefix, "job-1", "https://example.com/docs/intro")
+	body, ok := mock.objects[key]
+	if !ok {
+		t.Fatalf("Expected object %s to be written, got %v", key, mock.objects)
+	}
+
+	var stored model.ScrapeResult
+	if err := json.Unmarshal(body, &stored); err != nil {
+		t.Fatalf("Failed to decode stored object: %v", err)
+	}
+	if stored.Markdown != result.Markdown {
+		t.Errorf("Expected markdown %q, got %q", result.Markdown, stored.Markdown)
+	}
+}
+
+func TestNewWriterErrors(t *testing.T) {
+	credentials := map[string]Credentials{
+		"default": {AccessKeyID: "test", SecretAccessKey: "test"},
+	}
+
+	tests := []struct {
+		name string
+		dest model.CrawlDestination
+	}{
+		{name: "Missing bucket", dest: model.CrawlDestination{Type: "s3"}},
+		{name: "Unsupported type", dest: model.CrawlDestination{Type: "ftp", Bucket: "crawls"}},
+		{name: "Unknown credentials", dest: model.CrawlDestination{Type: "s3", Bucket: "crawls", CredentialsRef: "missing"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWriter(tt.dest, credentials); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+
+	// An empty reference falls back to the default credentials
+	if _, err := NewWriter(model.CrawlDestination{Type: "s3", Bucket: "crawls"}, credentials); err != nil {
+		t.Errorf("Expected default credentials to be used, got %v", err)
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	key := ObjectKey("exports", "job-1", "https://example.com/docs/intro?page=2")
+	if !strings.HasPrefix(key, "exports/job-1/example.com_docs_intro-") || !strings.HasSuffix(key, ".json") {
+		t.Errorf("Unexpected object key %q", key)
+	}
+
+	// Pages that differ only by query string get distinct keys
+	other := ObjectKey("exports", "job-1", "https://example.com/docs/intro?page=3")
+	if key == other {
+		t.Errorf("Expected distinct keys, got %q for both", key)
+	}
+}
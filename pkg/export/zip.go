@@ -0,0 +1,85 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// manifestName is the archive entry listing the pages in a markdown archive.
+const manifestName = "manifest.json"
+
+// ManifestEntry describes one page file in a markdown archive.
+type ManifestEntry struct {
+	File       string `json:"file"`
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+	StatusCode int    `json:"statusCode,omitempty"`
+}
+
+// MarkdownArchive writes a ZIP archive with one markdown file per result,
+// named after its page, and a manifest.json mapping files back to URLs. Each
+// result is written to the underlying writer as it is added, so the archive
+// can be streamed without holding every result in memory.
+type MarkdownArchive struct {
+	zw       *zip.Writer
+	manifest []ManifestEntry
+}
+
+// NewMarkdownArchive starts an archive written to w.
+func NewMarkdownArchive(w io.Writer) *MarkdownArchive {
+	return &MarkdownArchive{
+		zw:       zip.NewWriter(w),
+		manifest: make([]ManifestEntry, 0),
+	}
+}
+
+// Add writes the results' markdown files to the archive.
+func (a *MarkdownArchive) Add(results ...model.ScrapeResult) error {
+	for _, result := range results {
+		entry := ManifestEntry{}
+		if result.Metadata != nil {
+			entry.URL = result.Metadata.SourceURL
+			entry.Title = result.Metadata.Title
+			entry.StatusCode = result.Metadata.StatusCode
+		}
+		entry.File = pageFileName(entry.URL, ".md")
+
+		f, err := a.zw.Create(entry.File)
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", entry.File, err)
+		}
+		if _, err := io.WriteString(f, result.Markdown); err != nil {
+			return fmt.Errorf("failed to write %s: %w", entry.File, err)
+		}
+		a.manifest = append(a.manifest, entry)
+	}
+	return nil
+}
+
+// Close writes the manifest and finishes the archive.
+func (a *MarkdownArchive) Close() error {
+	f, err := a.zw.Create(manifestName)
+	if err != nil {
+		return fmt.Errorf("failed to add manifest: %w", err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(a.manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return a.zw.Close()
+}
+
+// WriteMarkdownArchive writes a markdown archive of the results to w.
+func WriteMarkdownArchive(w io.Writer, results []model.ScrapeResult) error {
+	archive := NewMarkdownArchive(w)
+	if err := archive.Add(results...); err != nil {
+		return err
+	}
+	return archive.Close()
+}
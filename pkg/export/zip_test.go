@@ -0,0 +1,94 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestWriteMarkdownArchive(t *testing.T) {
+	results := []model.ScrapeResult{
+		{Markdown: "# Home", Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/", Title: "Home"}},
+		{Markdown: "# Intro", Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/docs/intro"}},
+		{Markdown: "# Intro, page 2", Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/docs/intro?page=2"}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteMarkdownArchive(&buf, results); err != nil {
+		t.Fatalf("WriteMarkdownArchive() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if len(zr.File) != len(results)+1 {
+		t.Fatalf("Expected %d files, got %d", len(results)+1, len(zr.File))
+	}
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+
+	var manifest []ManifestEntry
+	if err := json.Unmarshal([]byte(files[manifestName]), &manifest); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if len(manifest) != len(results) {
+		t.Fatalf("Expected %d manifest entries, got %d", len(results), len(manifest))
+	}
+	for i, entry := range manifest {
+		if entry.URL != results[i].Metadata.SourceURL {
+			t.Errorf("Manifest entry %d URL = %q, want %q", i, entry.URL, results[i].Metadata.SourceURL)
+		}
+		if !strings.HasSuffix(entry.File, ".md") {
+			t.Errorf("Expected a markdown file name, got %q", entry.File)
+		}
+		if files[entry.File] != results[i].Markdown {
+			t.Errorf("File %s = %q, want %q", entry.File, files[entry.File], results[i].Markdown)
+		}
+	}
+	if !strings.HasPrefix(manifest[1].File, "example.com_docs_intro-") {
+		t.Errorf("Expected the file to be named after the page, got %q", manifest[1].File)
+	}
+}
+
+func TestMarkdownArchiveAddInPages(t *testing.T) {
+	var buf bytes.Buffer
+	archive := NewMarkdownArchive(&buf)
+	pages := [][]model.ScrapeResult{
+		{{Markdown: "# One", Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/one"}}},
+		{{Markdown: "# Two", Metadata: &model.ScrapeMetadata{SourceURL: "https://example.com/two"}}},
+	}
+	for _, page := range pages {
+		if err := archive.Add(page...); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if len(zr.File) != 3 {
+		t.Fatalf("Expected 2 pages and a manifest, got %d files", len(zr.File))
+	}
+	if zr.File[2].Name != manifestName {
+		t.Errorf("Expected the manifest last, got %q", zr.File[2].Name)
+	}
+}
@@ -0,0 +1,136 @@
+// Package llm calls OpenAI-compatible chat completion APIs for extraction.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the API used when only an API key is configured.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// DefaultModel is the model used when none is configured.
+const DefaultModel = "gpt-4o-mini"
+
+// requestTimeout bounds a single completion request.
+const requestTimeout = 120 * time.Second
+
+// Options configures a Client.
+type Options struct {
+	// BaseURL is the API root, e.g. https://api.openai.com/v1 or a local
+	// OpenAI-compatible server. Defaults to DefaultBaseURL.
+	BaseURL string
+	APIKey  string
+	// Model defaults to DefaultModel.
+	Model string
+}
+
+// Client sends chat completion requests.
+type Client struct {
+	baseURL string
+	apiKey  string
+	model   string
+	http    *http.Client
+}
+
+// NewClient creates a client for an OpenAI-compatible API.
+func NewClient(opts Options) *Client {
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	model := opts.Model
+	if model == "" {
+		model = DefaultModel
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  opts.APIKey,
+		model:   model,
+		http:    &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// chatMessage is a single message in a chat completion request.
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// responseFormat asks the model for a particular output format.
+type responseFormat struct {
+	Type string `json:"type"`
+}
+
+// chatRequest is the body of a chat completion request.
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	Temperature    float64         `json:"temperature"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+// chatResponse is the part of a chat completion response we use.
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+// Complete sends the system and user prompts and returns the model's reply.
+// When jsonMode is set the model is asked to reply with a JSON object.
+func (c *Client) Complete(ctx context.Context, system, user string, jsonMode bool) (string, error) {
+	body := chatRequest{
+		Model: c.model,
+		Messages: []chatMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: user},
+		},
+	}
+	if jsonMode {
+		body.ResponseFormat = &responseFormat{Type: "json_object"}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode completion request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("invalid LLM base URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("LLM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("LLM returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var completion chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", fmt.Errorf("failed to decode LLM response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("LLM returned no choices")
+	}
+
+	return completion.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,55 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientComplete(t *testing.T) {
+	var got chatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer test-key" {
+			t.Errorf("Expected bearer auth, got %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"{\"title\":\"Hello\"}"}}]}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{BaseURL: server.URL + "/v1/", APIKey: "test-key", Model: "test-model"})
+	reply, err := client.Complete(context.Background(), "system", "user", true)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+
+	if reply != `{"title":"Hello"}` {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+	if got.Model != "test-model" || len(got.Messages) != 2 || got.Messages[1].Content != "user" {
+		t.Errorf("Unexpected request %+v", got)
+	}
+	if got.ResponseFormat == nil || got.ResponseFormat.Type != "json_object" {
+		t.Error("Expected JSON mode to request a json_object response")
+	}
+}
+
+func TestClientCompleteError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	if _, err := NewClient(Options{BaseURL: server.URL}).Complete(context.Background(), "system", "user", false); err == nil {
+		t.Error("Expected an error for a failed request")
+	}
+}
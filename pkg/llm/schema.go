@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// ValidateSchema checks a decoded JSON value against a JSON Schema and returns
+// a message for each violation. It supports the subset used to describe
+// extraction output: type, properties, required, items and enum.
+func ValidateSchema(value interface{}, schema map[string]interface{}) []string {
+	var problems []string
+	validate("$", value, schema, &problems)
+	return problems
+}
+
+// validate checks value at path against schema, appending any problems.
+func validate(path string, value interface{}, schema map[string]interface{}, problems *[]string) {
+	if types := schemaTypes(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if hasType(value, t) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			*problems = append(*problems, fmt.Sprintf("%s: expected %v, got %s", path, joinTypes(types), typeName(value)))
+			return
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if reflect.DeepEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			*problems = append(*problems, fmt.Sprintf("%s: value %v is not one of %v", path, value, enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				key, _ := name.(string)
+				if _, present := v[key]; !present {
+					*problems = append(*problems, fmt.Sprintf("%s: missing required property %q", path, key))
+				}
+			}
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			keys := make([]string, 0, len(properties))
+			for key := range properties {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				propSchema, ok := properties[key].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if propValue, present := v[key]; present {
+					validate(path+"."+key, propValue, propSchema, problems)
+				}
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(fmt.Sprintf("%s[%d]", path, i), item, items, problems)
+			}
+		}
+	}
+}
+
+// schemaTypes returns the types a schema's "type" keyword allows.
+func schemaTypes(t interface{}) []string {
+	switch t := t.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	default:
+		return nil
+	}
+}
+
+// hasType reports whether a decoded JSON value is of the given schema type.
+func hasType(value interface{}, t string) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		// Unknown types aren't enforced
+		return true
+	}
+}
+
+// typeName describes a decoded JSON value's type.
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// joinTypes formats the allowed types for a message.
+func joinTypes(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
@@ -0,0 +1,54 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"required": ["title", "price"],
+		"properties": {
+			"title": {"type": "string"},
+			"price": {"type": "number"},
+			"stock": {"type": "integer"},
+			"status": {"enum": ["new", "used"]},
+			"tags": {"type": "array", "items": {"type": "string"}}
+		}
+	}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "Valid", value: `{"title": "Lamp", "price": 9.5, "stock": 3, "status": "new", "tags": ["home"]}`},
+		{name: "Missing required", value: `{"title": "Lamp"}`, want: []string{`$: missing required property "price"`}},
+		{name: "Wrong types", value: `{"title": 1, "price": 2, "stock": 1.5}`, want: []string{"$.stock: expected integer", "$.title: expected string"}},
+		{name: "Enum and items", value: `{"title": "Lamp", "price": 1, "status": "broken", "tags": ["a", 2]}`, want: []string{"$.status: value broken", "$.tags[1]: expected string"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+
+			problems := ValidateSchema(value, schema)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("Expected %d problems, got %v", len(tt.want), problems)
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(problems[i], want) {
+					t.Errorf("Expected problem %q, got %q", want, problems[i])
+				}
+			}
+		})
+	}
+}
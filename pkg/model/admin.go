@@ -0,0 +1,9 @@
+package model
+
+// PruneResponse reports the orphaned keys removed by a prune.
+type PruneResponse struct {
+	// Pruned is the number of keys deleted, keyed by key prefix.
+	Pruned map[string]int `json:"pruned"`
+	// Total is the number of keys deleted across every prefix.
+	Total int `json:"total"`
+}
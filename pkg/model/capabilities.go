@@ -0,0 +1,21 @@
+package model
+
+// CapabilitiesResponse describes what a deployment supports so clients can
+// adapt to it.
+type CapabilitiesResponse struct {
+	Formats        []string             `json:"formats"`
+	Browser        bool                 `json:"browser"`
+	StorageBackend string               `json:"storageBackend"`
+	Defaults       CapabilitiesDefaults `json:"defaults"`
+}
+
+// CapabilitiesDefaults lists the defaults and limits applied to requests.
+type CapabilitiesDefaults struct {
+	TimeoutMS     int    `json:"timeoutMs"`
+	MaxTimeoutMS  int    `json:"maxTimeoutMs,omitempty"`
+	CrawlLimit    int    `json:"crawlLimit"`
+	CrawlMaxDepth int    `json:"crawlMaxDepth"`
+	MapLimit      int    `json:"mapLimit"`
+	GlobalRPS     int    `json:"globalRps,omitempty"`
+	ImageHandling string `json:"imageHandling"`
+}
@@ -1,39 +1,177 @@
 // Package model contains data structures used throughout the application.
 package model
 
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
 // CrawlRequest represents a request to crawl a website and its subpages.
 type CrawlRequest struct {
 	URL                   string              `json:"url"`
 	ExcludePaths          []string            `json:"excludePaths,omitempty"`
 	IncludePaths          []string            `json:"includePaths,omitempty"`
+	PathMatching          string              `json:"pathMatching,omitempty"`
+	FilterExpression      string              `json:"filterExpression,omitempty"`
+	URLRewriteRules       []URLRewriteRule    `json:"urlRewriteRules,omitempty"`
 	MaxDepth              int                 `json:"maxDepth,omitempty"`
 	MaxDiscoveryDepth     int                 `json:"maxDiscoveryDepth,omitempty"`
 	IgnoreSitemap         bool                `json:"ignoreSitemap,omitempty"`
+	SitemapOnly           bool                `json:"sitemapOnly,omitempty"`
 	IgnoreQueryParameters bool                `json:"ignoreQueryParameters,omitempty"`
 	Limit                 int                 `json:"limit,omitempty"`
+	MaxLinksDiscovered    int                 `json:"maxLinksDiscovered,omitempty"`
 	AllowBackwardLinks    bool                `json:"allowBackwardLinks,omitempty"`
 	AllowExternalLinks    bool                `json:"allowExternalLinks,omitempty"`
+	InternalHosts         []string            `json:"internalHosts,omitempty"`
+	IgnoreBaseHref        bool                `json:"ignoreBaseHref,omitempty"`
+	ValidateSeed          *bool               `json:"validateSeed,omitempty"`
+	AutoRetryStrategy     bool                `json:"autoRetryStrategy,omitempty"`
+	MaxIdleConnsPerHost   int                 `json:"maxIdleConnsPerHost,omitempty"`
+	DisableKeepAlives     *bool               `json:"disableKeepAlives,omitempty"`
+	Parallelism           int                 `json:"parallelism,omitempty"`
+	DiscoveryTimeoutMS    int                 `json:"discoveryTimeoutMs,omitempty"`
+	ScrapeTimeoutMS       int                 `json:"scrapeTimeoutMs,omitempty"`
+	Destination           *CrawlDestination   `json:"destination,omitempty"`
 	Webhook               *WebhookConfig      `json:"webhook,omitempty"`
 	ScrapeOptions         *CrawlScrapeOptions `json:"scrapeOptions,omitempty"`
 }
 
+// ShouldValidateSeed reports whether the seed URL should be checked before
+// the crawl is scheduled. Validation is on unless explicitly disabled.
+func (r CrawlRequest) ShouldValidateSeed() bool {
+	return r.ValidateSeed == nil || *r.ValidateSeed
+}
+
+// DiscoveryDepth returns how many links away from the seed the crawl's link
+// discovery looks: MaxDiscoveryDepth, capped at MaxDepth, or 1 when unset.
+func (r CrawlRequest) DiscoveryDepth() int {
+	depth := r.MaxDiscoveryDepth
+	if depth <= 0 {
+		depth = 1
+	}
+	if r.MaxDepth > 0 && depth > r.MaxDepth {
+		depth = r.MaxDepth
+	}
+	return depth
+}
+
+// PhaseTimeouts returns the timeouts in milliseconds for discovering links
+// and for scraping each page. ScrapeTimeoutMS takes precedence over the scrape
+// options' timeout, and when only one phase sets a timeout both use it. Zero
+// means the default.
+func (r CrawlRequest) PhaseTimeouts() (discovery, scrape int) {
+	discovery = r.DiscoveryTimeoutMS
+	scrape = r.ScrapeTimeoutMS
+	if scrape == 0 && r.ScrapeOptions != nil {
+		scrape = r.ScrapeOptions.Timeout
+	}
+
+	if discovery == 0 {
+		discovery = scrape
+	}
+	if scrape == 0 {
+		scrape = discovery
+	}
+	return discovery, scrape
+}
+
+// Validate checks the request for options that contradict each other.
+func (r CrawlRequest) Validate() error {
+	if r.IgnoreSitemap && r.SitemapOnly {
+		return errors.New("ignoreSitemap and sitemapOnly cannot both be set")
+	}
+
+	// Include paths on other hosts can never match without external links
+	if !r.AllowExternalLinks {
+		seed, err := url.Parse(r.URL)
+		if err == nil && seed.Host != "" {
+			for _, includePath := range r.IncludePaths {
+				u, err := url.Parse(includePath)
+				if err != nil || u.Host == "" {
+					continue
+				}
+				if !utils.IsInternalHost(u.Host, seed.Host, r.InternalHosts) {
+					return fmt.Errorf("includePaths entry %q is on another host; set allowExternalLinks to crawl it", includePath)
+				}
+			}
+		}
+	}
+
+	// Rewrite patterns must compile before the crawl starts
+	for _, rule := range r.URLRewriteRules {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			return fmt.Errorf("invalid urlRewriteRules pattern %q: %v", rule.Pattern, err)
+		}
+	}
+
+	// A path that is both included and excluded can never be crawled
+	for _, includePath := range r.IncludePaths {
+		for _, excludePath := range r.ExcludePaths {
+			if includePath == excludePath {
+				return fmt.Errorf("path %q is in both includePaths and excludePaths", includePath)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Matching modes for include and exclude paths.
+const (
+	// PathMatchingGlob matches paths as anchored globs, or as regular
+	// expressions when prefixed with regex:.
+	PathMatchingGlob = "glob"
+	// PathMatchingSubstring matches paths anywhere in the URL.
+	PathMatchingSubstring = "substring"
+)
+
+// IsValidPathMatching reports whether mode is a known path matching mode.
+func IsValidPathMatching(mode string) bool {
+	switch mode {
+	case PathMatchingGlob, PathMatchingSubstring:
+		return true
+	default:
+		return false
+	}
+}
+
+// URLRewriteRule rewrites discovered URLs with a regular expression
+// replacement before they are scraped. Replacements may use $1-style groups.
+type URLRewriteRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// CrawlDestination represents external storage that receives crawl results,
+// one object per page.
+type CrawlDestination struct {
+	Type           string `json:"type"`
+	Bucket         string `json:"bucket"`
+	Prefix         string `json:"prefix,omitempty"`
+	CredentialsRef string `json:"credentialsRef,omitempty"`
+	// SkipRedis keeps only page metadata in Redis once a page is exported.
+	SkipRedis bool `json:"skipRedis,omitempty"`
+}
+
 // CrawlScrapeOptions represents options for scraping during a crawl.
 type CrawlScrapeOptions struct {
-	Formats             []string          `json:"formats,omitempty"`
-	OnlyMainContent     bool              `json:"onlyMainContent,omitempty"`
-	IncludeTags         []string          `json:"includeTags,omitempty"`
-	ExcludeTags         []string          `json:"excludeTags,omitempty"`
-	Headers             map[string]string `json:"headers,omitempty"`
-	WaitFor             int               `json:"waitFor,omitempty"`
-	Mobile              bool              `json:"mobile,omitempty"`
-	SkipTlsVerification bool              `json:"skipTlsVerification,omitempty"`
-	Timeout             int               `json:"timeout,omitempty"`
-	JSONOptions         *JSONOptions      `json:"jsonOptions,omitempty"`
-	Actions             []CrawlAction     `json:"actions,omitempty"`
-	Location            *LocationOptions  `json:"location,omitempty"`
-	RemoveBase64Images  bool              `json:"removeBase64Images,omitempty"`
-	BlockAds            bool              `json:"blockAds,omitempty"`
-	Proxy               string            `json:"proxy,omitempty"`
+	ScrapeOptions
+	RemoveBase64Images bool `json:"removeBase64Images,omitempty"`
+
+	// Soft404AsError records soft-404 pages as crawl errors instead of
+	// results. It implies DetectSoft404.
+	Soft404AsError bool `json:"soft404AsError,omitempty"`
+
+	// Delay spaces the crawl's requests to the same host, in milliseconds;
+	// RandomDelay adds up to that many milliseconds of jitter to each pause.
+	Delay       int `json:"delay,omitempty"`
+	RandomDelay int `json:"randomDelay,omitempty"`
 }
 
 // JSONOptions represents options for JSON extraction.
@@ -43,24 +181,113 @@ type JSONOptions struct {
 	Prompt       string                 `json:"prompt,omitempty"`
 }
 
+// ValidateJSONFormat checks that the json format, when requested, comes with
+// a schema or a prompt to extract with.
+func ValidateJSONFormat(formats []string, opts *JSONOptions) error {
+	for _, format := range formats {
+		if format == "json" && (opts == nil || (len(opts.Schema) == 0 && opts.Prompt == "")) {
+			return errors.New("the json format requires jsonOptions with a schema or a prompt")
+		}
+	}
+	return nil
+}
+
 // CrawlAction represents an action to perform during crawling.
 type CrawlAction struct {
 	Type         string `json:"type"`
 	Milliseconds int    `json:"milliseconds,omitempty"`
 	Selector     string `json:"selector,omitempty"`
+	// Text is typed into the selected element by write actions.
+	Text string `json:"text,omitempty"`
+}
+
+// Action types run in the browser before a page is scraped.
+const (
+	// ActionWait pauses for Milliseconds, or until Selector is visible.
+	ActionWait = "wait"
+	// ActionClick clicks the element matching Selector.
+	ActionClick = "click"
+	// ActionScroll scrolls Selector into view, or down one screen.
+	ActionScroll = "scroll"
+	// ActionWrite types Text into the element matching Selector.
+	ActionWrite = "write"
+)
+
+// ValidateActions checks that each action has a known type and the fields it
+// needs.
+func ValidateActions(actions []CrawlAction) error {
+	for i, action := range actions {
+		if err := action.Validate(); err != nil {
+			return fmt.Errorf("actions[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the action has a known type and the fields it needs.
+func (a CrawlAction) Validate() error {
+	switch a.Type {
+	case ActionWait:
+		if a.Milliseconds <= 0 && a.Selector == "" {
+			return errors.New("wait needs milliseconds or a selector")
+		}
+	case ActionClick:
+		if a.Selector == "" {
+			return errors.New("click needs a selector")
+		}
+	case ActionScroll:
+	case ActionWrite:
+		if a.Selector == "" || a.Text == "" {
+			return errors.New("write needs a selector and text")
+		}
+	default:
+		return fmt.Errorf("unknown action type %q", a.Type)
+	}
+	return nil
 }
 
 // LocationOptions represents location options for crawling.
 type LocationOptions struct {
-	Country   string   `json:"country,omitempty"`
+	// Country is an ISO 3166-1 alpha-2 code, such as "DE".
+	Country string `json:"country,omitempty"`
+	// Languages lists the preferred languages in order, such as "de" or
+	// "en-US".
 	Languages []string `json:"languages,omitempty"`
 }
 
+// AcceptLanguage returns the Accept-Language header value for the languages,
+// each weighted lower than the one before it, or "" when there are none.
+func (l *LocationOptions) AcceptLanguage() string {
+	if l == nil {
+		return ""
+	}
+
+	parts := make([]string, 0, len(l.Languages))
+	for _, language := range l.Languages {
+		language = strings.TrimSpace(language)
+		if language == "" {
+			continue
+		}
+		if len(parts) == 0 {
+			parts = append(parts, language)
+			continue
+		}
+		// Weights step down by 0.1 and bottom out at 0.1
+		weight := 10 - len(parts)
+		if weight < 1 {
+			weight = 1
+		}
+		parts = append(parts, fmt.Sprintf("%s;q=0.%d", language, weight))
+	}
+	return strings.Join(parts, ", ")
+}
+
 // CrawlResponse represents the response to a crawl request.
 type CrawlResponse struct {
 	Success bool   `json:"success"`
 	ID      string `json:"id"`
 	URL     string `json:"url"`
+	Warning string `json:"warning,omitempty"`
 }
 
 // CrawlStatus represents the status of a crawl job.
@@ -71,6 +298,16 @@ type CrawlStatus struct {
 	ExpiresAt string         `json:"expiresAt"`
 	Next      string         `json:"next,omitempty"`
 	Data      []ScrapeResult `json:"data,omitempty"`
+	// DiscoveryCapped is set when the crawl stopped discovering links
+	// because MaxLinksDiscovered was reached.
+	DiscoveryCapped bool `json:"discoveryCapped,omitempty"`
+	// Retried is set when the crawl was restarted with a fallback strategy
+	// after its first pages all failed.
+	Retried bool `json:"retried,omitempty"`
+	// Degraded is set when storage was unavailable during the crawl, so
+	// results were delayed or, if the buffer filled up, lost.
+	Degraded bool `json:"degraded,omitempty"`
+	TransferStats
 }
 
 // CrawlError represents an error that occurred during crawling.
@@ -83,6 +320,8 @@ type CrawlError struct {
 
 // CrawlErrorsResponse represents the response to a crawl errors request.
 type CrawlErrorsResponse struct {
-	Errors        []CrawlError `json:"errors"`
-	RobotsBlocked []string     `json:"robotsBlocked"`
+	Errors        []CrawlError   `json:"errors"`
+	RobotsBlocked []string       `json:"robotsBlocked"`
+	TotalErrors   int            `json:"totalErrors"`
+	ErrorSummary  map[string]int `json:"errorSummary,omitempty"`
 }
@@ -0,0 +1,148 @@
+package model
+
+import "testing"
+
+func TestCrawlRequestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     CrawlRequest
+		wantErr bool
+	}{
+		{
+			name: "No conflicts",
+			req: CrawlRequest{
+				URL:          "https://example.com",
+				IncludePaths: []string{"/docs", "https://example.com/blog"},
+				ExcludePaths: []string{"/admin"},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "ignoreSitemap with sitemapOnly",
+			req:     CrawlRequest{URL: "https://example.com", IgnoreSitemap: true, SitemapOnly: true},
+			wantErr: true,
+		},
+		{
+			name:    "External include path without allowExternalLinks",
+			req:     CrawlRequest{URL: "https://example.com", IncludePaths: []string{"https://other.com/docs"}},
+			wantErr: true,
+		},
+		{
+			name: "External include path with allowExternalLinks",
+			req: CrawlRequest{
+				URL:                "https://example.com",
+				IncludePaths:       []string{"https://other.com/docs"},
+				AllowExternalLinks: true,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid rewrite pattern",
+			req: CrawlRequest{
+				URL:             "https://example.com",
+				URLRewriteRules: []URLRewriteRule{{Pattern: "(", Replacement: ""}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Path both included and excluded",
+			req: CrawlRequest{
+				URL:          "https://example.com",
+				IncludePaths: []string{"/docs"},
+				ExcludePaths: []string{"/docs"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCrawlRequestPhaseTimeouts(t *testing.T) {
+	tests := []struct {
+		name          string
+		req           CrawlRequest
+		wantDiscovery int
+		wantScrape    int
+	}{
+		{"Neither set", CrawlRequest{}, 0, 0},
+		{"Both set", CrawlRequest{DiscoveryTimeoutMS: 5000, ScrapeTimeoutMS: 60000}, 5000, 60000},
+		{"Only discovery", CrawlRequest{DiscoveryTimeoutMS: 5000}, 5000, 5000},
+		{"Only scrape", CrawlRequest{ScrapeTimeoutMS: 60000}, 60000, 60000},
+		{"Scrape options timeout", CrawlRequest{ScrapeOptions: &CrawlScrapeOptions{ScrapeOptions: ScrapeOptions{Timeout: 20000}}}, 20000, 20000},
+		{"Scrape timeout overrides scrape options", CrawlRequest{ScrapeTimeoutMS: 60000, ScrapeOptions: &CrawlScrapeOptions{ScrapeOptions: ScrapeOptions{Timeout: 20000}}}, 60000, 60000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discovery, scrape := tt.req.PhaseTimeouts()
+			if discovery != tt.wantDiscovery || scrape != tt.wantScrape {
+				t.Errorf("PhaseTimeouts() = (%d, %d), want (%d, %d)", discovery, scrape, tt.wantDiscovery, tt.wantScrape)
+			}
+		})
+	}
+}
+
+func TestCrawlRequestDiscoveryDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		req  CrawlRequest
+		want int
+	}{
+		{"Unset", CrawlRequest{}, 1},
+		{"Discovery depth", CrawlRequest{MaxDiscoveryDepth: 3, MaxDepth: 10}, 3},
+		{"Capped at max depth", CrawlRequest{MaxDiscoveryDepth: 5, MaxDepth: 2}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.DiscoveryDepth(); got != tt.want {
+				t.Errorf("DiscoveryDepth() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocationOptionsAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		location *LocationOptions
+		want     string
+	}{
+		{
+			name:     "No location",
+			location: nil,
+			want:     "",
+		},
+		{
+			name:     "Country only",
+			location: &LocationOptions{Country: "DE"},
+			want:     "",
+		},
+		{
+			name:     "One language",
+			location: &LocationOptions{Languages: []string{"de"}},
+			want:     "de",
+		},
+		{
+			name:     "Several languages",
+			location: &LocationOptions{Languages: []string{"de-DE", "de", " ", "en"}},
+			want:     "de-DE, de;q=0.9, en;q=0.8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.location.AcceptLanguage(); got != tt.want {
+				t.Errorf("AcceptLanguage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
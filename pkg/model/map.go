@@ -3,19 +3,39 @@ package model
 
 // MapRequest represents a request to map a website's URLs.
 type MapRequest struct {
-	URL               string   `json:"url"`
-	Search            string   `json:"search,omitempty"`
-	IgnoreSitemap     bool     `json:"ignoreSitemap,omitempty"`
-	SitemapOnly       bool     `json:"sitemapOnly,omitempty"`
-	IncludeSubdomains bool     `json:"includeSubdomains,omitempty"`
-	Limit             int      `json:"limit,omitempty"`
-	Timeout           int      `json:"timeout,omitempty"`
-	ExcludePaths      []string `json:"excludePaths,omitempty"`
-	IncludePaths      []string `json:"includePaths,omitempty"`
+	URL                   string               `json:"url"`
+	Search                string               `json:"search,omitempty"`
+	IgnoreSitemap         bool                 `json:"ignoreSitemap,omitempty"`
+	SitemapOnly           bool                 `json:"sitemapOnly,omitempty"`
+	IncludeSubdomains     bool                 `json:"includeSubdomains,omitempty"`
+	InternalHosts         []string             `json:"internalHosts,omitempty"`
+	IgnoreBaseHref        bool                 `json:"ignoreBaseHref,omitempty"`
+	IgnoreQueryParameters bool                 `json:"ignoreQueryParameters,omitempty"`
+	Limit                 int                  `json:"limit,omitempty"`
+	MaxDepth              int                  `json:"maxDepth,omitempty"`
+	Timeout               int                  `json:"timeout,omitempty"`
+	ExcludePaths          []string             `json:"excludePaths,omitempty"`
+	IncludePaths          []string             `json:"includePaths,omitempty"`
+	PathMatching          string               `json:"pathMatching,omitempty"`
+	FilterExpression      string               `json:"filterExpression,omitempty"`
+	Parallelism           int                  `json:"parallelism,omitempty"`
+	Delay                 int                  `json:"delay,omitempty"`
+	RandomDelay           int                  `json:"randomDelay,omitempty"`
+	Canonicalize          *CanonicalizeOptions `json:"canonicalize,omitempty"`
+}
+
+// CanonicalizeOptions selects the normalization steps applied before two
+// mapped links are compared. Scheme and host are always lowercased.
+type CanonicalizeOptions struct {
+	StripFragments    bool `json:"stripFragments,omitempty"`
+	StripDefaultPorts bool `json:"stripDefaultPorts,omitempty"`
+	SortQuery         bool `json:"sortQuery,omitempty"`
+	StripQuery        bool `json:"stripQuery,omitempty"`
 }
 
 // MapResponse represents the response to a map request.
 type MapResponse struct {
 	Success bool     `json:"success"`
 	Links   []string `json:"links"`
+	Warning string   `json:"warning,omitempty"`
 }
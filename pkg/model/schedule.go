@@ -0,0 +1,62 @@
+package model
+
+import "errors"
+
+// ScheduleRequest represents a request to run a scrape or crawl on a cron
+// schedule. Exactly one of Scrape and Crawl must be set.
+type ScheduleRequest struct {
+	// Cron is a standard five-field cron expression, or a descriptor such
+	// as "@hourly" or "@every 30m". Times are in the server's time zone.
+	Cron   string         `json:"cron"`
+	Scrape *ScrapeRequest `json:"scrape,omitempty"`
+	Crawl  *CrawlRequest  `json:"crawl,omitempty"`
+}
+
+// Validate checks that the request names exactly one job to run.
+func (r ScheduleRequest) Validate() error {
+	switch {
+	case r.Scrape == nil && r.Crawl == nil:
+		return errors.New("one of scrape or crawl is required")
+	case r.Scrape != nil && r.Crawl != nil:
+		return errors.New("only one of scrape or crawl can be scheduled")
+	}
+	return nil
+}
+
+// Schedule is a stored scheduled job.
+type Schedule struct {
+	ID        string         `json:"id"`
+	Cron      string         `json:"cron"`
+	Scrape    *ScrapeRequest `json:"scrape,omitempty"`
+	Crawl     *CrawlRequest  `json:"crawl,omitempty"`
+	CreatedAt string         `json:"createdAt"`
+}
+
+// ScheduleResponse represents the response to a schedule request.
+type ScheduleResponse struct {
+	Success bool   `json:"success"`
+	ID      string `json:"id"`
+	URL     string `json:"url"`
+}
+
+// ScheduleRun records one run of a scheduled job.
+type ScheduleRun struct {
+	ID         string `json:"id"`
+	StartedAt  string `json:"startedAt"`
+	FinishedAt string `json:"finishedAt,omitempty"`
+	// Status is "completed" or "failed" for scrapes, and "started" or
+	// "failed" for crawls, which keep running under their own job.
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Data holds the result of a scheduled scrape.
+	Data *ScrapeResult `json:"data,omitempty"`
+	// CrawlID and CrawlURL identify the crawl job a scheduled crawl started.
+	CrawlID  string `json:"crawlId,omitempty"`
+	CrawlURL string `json:"crawlUrl,omitempty"`
+}
+
+// ScheduleRunsResponse lists the recorded runs of a schedule, newest first.
+type ScheduleRunsResponse struct {
+	Schedule Schedule      `json:"schedule"`
+	Runs     []ScheduleRun `json:"runs"`
+}
@@ -1,45 +1,328 @@
 // Package model contains data structures used throughout the application.
 package model
 
+import (
+	"net/http"
+	"time"
+)
+
 // ScrapeRequest represents a request to scrape a single URL.
 type ScrapeRequest struct {
-	URL             string            `json:"url"`
+	URL string `json:"url"`
+	ScrapeOptions
+}
+
+// ScrapeOptions are the options for scraping a page. Scrape, batch scrape and
+// crawl requests all embed them, so each page is scraped the same way.
+type ScrapeOptions struct {
 	Formats         []string          `json:"formats,omitempty"`
 	OnlyMainContent bool              `json:"onlyMainContent,omitempty"`
 	IncludeTags     []string          `json:"includeTags,omitempty"`
 	ExcludeTags     []string          `json:"excludeTags,omitempty"`
+	StripElements   []string          `json:"stripElements,omitempty"`
 	Headers         map[string]string `json:"headers,omitempty"`
 	WaitFor         int               `json:"waitFor,omitempty"`
+	Mobile          bool              `json:"mobile,omitempty"`
 	Timeout         int               `json:"timeout,omitempty"`
+	AnchorHeadings  bool              `json:"anchorHeadings,omitempty"`
+	BaseURLOverride string            `json:"baseURLOverride,omitempty"`
+	LinkDetails     bool              `json:"linkDetails,omitempty"`
+	RemoveComments  bool              `json:"removeComments,omitempty"`
+
+	SkipTlsVerification   bool   `json:"skipTlsVerification,omitempty"`
+	Proxy                 string `json:"proxy,omitempty"`
+	IncludeConnectionInfo bool   `json:"includeConnectionInfo,omitempty"`
+	IncludeByteCounts     bool   `json:"includeByteCounts,omitempty"`
+	StripInlineStyles     bool   `json:"stripInlineStyles,omitempty"`
+	StripClassAndID       bool   `json:"stripClassAndId,omitempty"`
+	StripStopwords        bool   `json:"stripStopwords,omitempty"`
+	ImageHandling         string `json:"imageHandling,omitempty"`
+	DetectSoft404         bool   `json:"detectSoft404,omitempty"`
+	IgnoreBaseHref        bool   `json:"ignoreBaseHref,omitempty"`
+	UseLinkTitles         bool   `json:"useLinkTitles,omitempty"`
+	ResolveStructuredURLs bool   `json:"resolveStructuredUrls,omitempty"`
+	PrependTitle          bool   `json:"prependTitle,omitempty"`
+	DeobfuscateEmails     bool   `json:"deobfuscateEmails,omitempty"`
+	IncludeDOMStats       bool   `json:"includeDomStats,omitempty"`
+	BlockAds              bool   `json:"blockAds,omitempty"`
+	UnicodeNormalization  string `json:"unicodeNormalization,omitempty"`
+	RawLinks              bool   `json:"rawLinks,omitempty"`
+	DetectPaywall         bool   `json:"detectPaywall,omitempty"`
+	IncludeOriginalHTML   bool   `json:"includeOriginalHtml,omitempty"`
+	FetchThemeColor       bool   `json:"fetchThemeColor,omitempty"`
+	// InternalHosts are hosts besides the page's own whose links count as
+	// internal in linkDetails.
+	InternalHosts []string `json:"internalHosts,omitempty"`
+	// MaxResponseBytes caps the response body read, within the server's
+	// maximum; longer bodies are truncated with a warning.
+	MaxResponseBytes int `json:"maxResponseBytes,omitempty"`
+	// ContentSelector restricts markdown, html and text output to the first
+	// element matching this CSS selector.
+	ContentSelector string `json:"contentSelector,omitempty"`
+	// JSONOptions configures the LLM extraction for the json format.
+	JSONOptions *JSONOptions `json:"jsonOptions,omitempty"`
+	// Actions run in the browser before the page is scraped.
+	Actions []CrawlAction `json:"actions,omitempty"`
+	// Location sets the Accept-Language header and, in the browser, the
+	// geolocation and time zone.
+	Location *LocationOptions `json:"location,omitempty"`
+
+	// WaitForSelector is checked in the static HTML after WaitFor; the page
+	// is re-fetched until it appears or WaitForSelectorTimeout expires.
+	WaitForSelector        string `json:"waitForSelector,omitempty"`
+	WaitForSelectorTimeout int    `json:"waitForSelectorTimeout,omitempty"`
+
+	// AcceptLanguages lists the page languages wanted, such as "en" or
+	// "pt-BR". Other languages add a warning, or fail the scrape when
+	// ErrorOnLanguageMismatch is set.
+	AcceptLanguages         []string `json:"acceptLanguages,omitempty"`
+	ErrorOnLanguageMismatch bool     `json:"errorOnLanguageMismatch,omitempty"`
+}
+
+// Request returns a request to scrape pageURL with these options.
+func (o ScrapeOptions) Request(pageURL string) ScrapeRequest {
+	return ScrapeRequest{URL: pageURL, ScrapeOptions: o}
+}
+
+// Image handling modes for markdown output.
+const (
+	// ImageHandlingKeep renders images as ![alt](src).
+	ImageHandlingKeep = "keep"
+	// ImageHandlingStrip removes images entirely.
+	ImageHandlingStrip = "strip"
+	// ImageHandlingAlt replaces images with their alt text.
+	ImageHandlingAlt = "alt"
+)
+
+// IsValidImageHandling reports whether mode is a known image handling mode.
+func IsValidImageHandling(mode string) bool {
+	switch mode {
+	case ImageHandlingKeep, ImageHandlingStrip, ImageHandlingAlt:
+		return true
+	default:
+		return false
+	}
+}
+
+// Unicode normalization forms for markdown and text output.
+const (
+	// UnicodeNormalizationNone leaves text as the page encoded it.
+	UnicodeNormalizationNone = "none"
+	// UnicodeNormalizationNFC composes characters canonically, so "e" plus a
+	// combining acute accent becomes "é".
+	UnicodeNormalizationNFC = "nfc"
+	// UnicodeNormalizationNFKC also folds compatibility characters, such as
+	// ligatures and full-width letters, into their plain forms.
+	UnicodeNormalizationNFKC = "nfkc"
+)
+
+// IsValidUnicodeNormalization reports whether form is a known normalization
+// form.
+func IsValidUnicodeNormalization(form string) bool {
+	switch form {
+	case UnicodeNormalizationNone, UnicodeNormalizationNFC, UnicodeNormalizationNFKC:
+		return true
+	default:
+		return false
+	}
 }
 
 // BatchScrapeRequest represents a request to scrape multiple URLs.
 type BatchScrapeRequest struct {
-	URLs              []string          `json:"urls"`
-	Formats           []string          `json:"formats,omitempty"`
-	OnlyMainContent   bool              `json:"onlyMainContent,omitempty"`
-	IncludeTags       []string          `json:"includeTags,omitempty"`
-	ExcludeTags       []string          `json:"excludeTags,omitempty"`
-	Headers           map[string]string `json:"headers,omitempty"`
-	WaitFor           int               `json:"waitFor,omitempty"`
-	Timeout           int               `json:"timeout,omitempty"`
-	IgnoreInvalidURLs bool              `json:"ignoreInvalidURLs,omitempty"`
-	Webhook           *WebhookConfig    `json:"webhook,omitempty"`
+	URLs              []string       `json:"urls"`
+	IgnoreInvalidURLs bool           `json:"ignoreInvalidURLs,omitempty"`
+	DedupeURLs        *bool          `json:"dedupeUrls,omitempty"`
+	Webhook           *WebhookConfig `json:"webhook,omitempty"`
+	// Wait holds the response until every URL is scraped, for up to
+	// WaitTimeoutMS, and returns the results inline.
+	Wait          bool `json:"wait,omitempty"`
+	WaitTimeoutMS int  `json:"waitTimeoutMs,omitempty"`
+	ScrapeOptions
 }
 
 // WebhookConfig represents webhook configuration for batch scraping.
 type WebhookConfig struct {
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers,omitempty"`
+	// ForwardHeaders names headers of the original API request, such as a
+	// tenant ID, that are echoed to the webhook.
+	ForwardHeaders []string `json:"forwardHeaders,omitempty"`
+	// Metadata is echoed unchanged in every event.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Events lists the lifecycle events to deliver: started, page,
+	// completed and failed. Defaults to completed only.
+	Events []string `json:"events,omitempty"`
+
+	// ForwardedHeaders holds the values captured from the original request.
+	ForwardedHeaders map[string]string `json:"-"`
+}
+
+// CaptureHeaders records the values of the ForwardHeaders present in the
+// original request so they can be sent with the webhook later.
+func (c *WebhookConfig) CaptureHeaders(h http.Header) {
+	for _, name := range c.ForwardHeaders {
+		value := h.Get(name)
+		if value == "" {
+			continue
+		}
+		if c.ForwardedHeaders == nil {
+			c.ForwardedHeaders = make(map[string]string)
+		}
+		c.ForwardedHeaders[http.CanonicalHeaderKey(name)] = value
+	}
+}
+
+// Wants reports whether the webhook subscribes to the lifecycle event.
+func (c WebhookConfig) Wants(event string) bool {
+	if len(c.Events) == 0 {
+		return event == WebhookCompleted
+	}
+	for _, e := range c.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhook lifecycle events, as listed in WebhookConfig.Events.
+const (
+	WebhookStarted   = "started"
+	WebhookPage      = "page"
+	WebhookCompleted = "completed"
+	WebhookFailed    = "failed"
+)
+
+// IsValidWebhookEvent reports whether event is a known lifecycle event.
+func IsValidWebhookEvent(event string) bool {
+	switch event {
+	case WebhookStarted, WebhookPage, WebhookCompleted, WebhookFailed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Webhook event types.
+const (
+	WebhookEventBatchCompleted = "batch_scrape.completed"
+	WebhookEventCrawlCompleted = "crawl.completed"
+	WebhookEventTest           = "webhook.test"
+)
+
+// Job kinds that prefix webhook event types, as in "crawl.page".
+const (
+	WebhookJobBatch = "batch_scrape"
+	WebhookJobCrawl = "crawl"
+)
+
+// WebhookEvent is the payload delivered to a webhook as a job progresses.
+type WebhookEvent struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Total     int    `json:"total"`
+	Completed int    `json:"completed"`
+	// Data is the scraped page, for page events.
+	Data *ScrapeResult `json:"data,omitempty"`
+	// Error explains a failed page or job.
+	Error string `json:"error,omitempty"`
+	// Metadata echoes WebhookConfig.Metadata.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Headers echoes the headers forwarded from the original request.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// WebhookTestResponse reports the outcome of a test delivery.
+type WebhookTestResponse struct {
+	// Delivered is true when the webhook answered with a 2xx status.
+	Delivered bool `json:"delivered"`
+	// StatusCode is the webhook's response status; zero if it never answered.
+	StatusCode int    `json:"statusCode,omitempty"`
+	LatencyMS  int64  `json:"latencyMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WebhookDelivery records one attempt to deliver a job's webhook event.
+type WebhookDelivery struct {
+	Type      string `json:"type"`
+	Attempt   int    `json:"attempt"`
+	Timestamp string `json:"timestamp"`
+	// StatusCode is the webhook's response status; zero if it never answered.
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// WebhookDeliveriesResponse lists a job's webhook delivery attempts, oldest
+// first.
+type WebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
 }
 
 // ScrapeResult represents the result of a scrape operation.
 type ScrapeResult struct {
-	Markdown string          `json:"markdown,omitempty"`
-	HTML     string          `json:"html,omitempty"`
-	RawHTML  string          `json:"rawHtml,omitempty"`
-	Links    []string        `json:"links,omitempty"`
-	Metadata *ScrapeMetadata `json:"metadata,omitempty"`
+	Markdown    string          `json:"markdown,omitempty"`
+	HTML        string          `json:"html,omitempty"`
+	RawHTML     string          `json:"rawHtml,omitempty"`
+	Text        string          `json:"text,omitempty"`
+	IndexText   string          `json:"indexText,omitempty"`
+	Links       []string        `json:"links,omitempty"`
+	LinkDetails []LinkDetail    `json:"linkDetails,omitempty"`
+	Anchors     []HeadingAnchor `json:"anchors,omitempty"`
+	Dates       []string        `json:"dates,omitempty"`
+	Breadcrumbs []Breadcrumb    `json:"breadcrumbs,omitempty"`
+	Emails      []string        `json:"emails,omitempty"`
+	Warning     string          `json:"warning,omitempty"`
+	Metadata    *ScrapeMetadata `json:"metadata,omitempty"`
+
+	// JSONLD holds each JSON-LD block on the page, as parsed.
+	JSONLD []interface{} `json:"jsonLd,omitempty"`
+	// StructuredData holds every JSON-LD object on the page, with arrays
+	// and @graph containers expanded.
+	StructuredData []map[string]interface{} `json:"structuredData,omitempty"`
+
+	// Screenshot is a base64-encoded PNG, set for the screenshot formats.
+	Screenshot string `json:"screenshot,omitempty"`
+	// JSON holds data extracted with jsonOptions.schema; Extract holds the
+	// free-form answer when only a prompt is given.
+	JSON    map[string]interface{} `json:"json,omitempty"`
+	Extract string                 `json:"extract,omitempty"`
+	// Actions records how each requested action ran.
+	Actions []ActionResult `json:"actions,omitempty"`
+	// OriginalHTML is the page before content filters were applied, when
+	// requested, for comparing with HTML.
+	OriginalHTML string `json:"originalHtml,omitempty"`
+	// Formats lists the requested formats the result holds content for. It
+	// is set on batch results.
+	Formats []string `json:"formats,omitempty"`
+	// Error is set on the placeholder result of a batch URL that failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ActionResult records how a browser action ran before scraping.
+type ActionResult struct {
+	Type       string `json:"type"`
+	Selector   string `json:"selector,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+// LinkDetail describes a link found on a scraped page.
+type LinkDetail struct {
+	URL      string `json:"url"`
+	Internal bool   `json:"internal"`
+	Rel      string `json:"rel,omitempty"`
+}
+
+// Breadcrumb is a single step in a page's breadcrumb trail.
+type Breadcrumb struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// HeadingAnchor maps a markdown heading to the anchor ID injected for it.
+type HeadingAnchor struct {
+	Heading string `json:"heading"`
+	Anchor  string `json:"anchor"`
 }
 
 // ScrapeMetadata contains metadata about the scraped page.
@@ -49,6 +332,67 @@ type ScrapeMetadata struct {
 	Language    string `json:"language,omitempty"`
 	SourceURL   string `json:"sourceURL,omitempty"`
 	StatusCode  int    `json:"statusCode,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+
+	// Document metadata from meta and link tags; the dates fall back to
+	// JSON-LD datePublished and dateModified
+	Author        string `json:"author,omitempty"`
+	Keywords      string `json:"keywords,omitempty"`
+	CanonicalURL  string `json:"canonicalURL,omitempty"`
+	OGTitle       string `json:"ogTitle,omitempty"`
+	OGDescription string `json:"ogDescription,omitempty"`
+	OGImage       string `json:"ogImage,omitempty"`
+	PublishedTime string `json:"publishedTime,omitempty"`
+	ModifiedTime  string `json:"modifiedTime,omitempty"`
+	ThemeColor    string `json:"themeColor,omitempty"`
+
+	// Soft404 is set when soft-404 detection was requested and the page
+	// looks like a "not found" page despite its success status.
+	Soft404 bool `json:"soft404,omitempty"`
+	// Paywalled is set when paywall detection was requested and the page's
+	// content is likely held back behind a subscription.
+	Paywalled bool `json:"paywalled,omitempty"`
+	// SelectorFound reports whether WaitForSelector matched, when one was given.
+	SelectorFound *bool `json:"selectorFound,omitempty"`
+	// RequiresBrowser hints that the page renders its content with
+	// JavaScript: the selector only appears in comments or templates.
+	RequiresBrowser bool `json:"requiresBrowser,omitempty"`
+	// DOMStats describes the page's complexity, when requested.
+	DOMStats *DOMStats `json:"domStats,omitempty"`
+
+	// Connection details, only populated for HTTPS targets when requested
+	RemoteIP string   `json:"remoteIP,omitempty"`
+	TLSInfo  *TLSInfo `json:"tlsInfo,omitempty"`
+
+	// Bytes sent and received fetching the page, including redirects, when
+	// requested
+	BytesSent     int64 `json:"bytesSent,omitempty"`
+	BytesReceived int64 `json:"bytesReceived,omitempty"`
+}
+
+// DOMStats counts the elements of a parsed page.
+type DOMStats struct {
+	// NodeCount is the number of elements in the document.
+	NodeCount int `json:"nodeCount"`
+	// MaxDepth is the deepest element nesting, counting <html> as 1.
+	MaxDepth int `json:"maxDepth"`
+	// ScriptCount is the number of <script> elements.
+	ScriptCount int `json:"scriptCount"`
+	// StyleCount is the number of <style> elements and stylesheet links.
+	StyleCount int `json:"styleCount"`
+}
+
+// TLSInfo describes the certificate presented by an HTTPS server.
+type TLSInfo struct {
+	Issuer   string    `json:"issuer"`
+	Subject  string    `json:"subject"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// ShouldDedupeURLs reports whether URLs that normalize alike are scraped
+// once. Deduplication is on unless explicitly disabled.
+func (r BatchScrapeRequest) ShouldDedupeURLs() bool {
+	return r.DedupeURLs == nil || *r.DedupeURLs
 }
 
 // BatchScrapeResponse represents the response to a batch scrape request.
@@ -56,6 +400,11 @@ type BatchScrapeResponse struct {
 	ID          string   `json:"id"`
 	URL         string   `json:"url"`
 	InvalidURLs []string `json:"invalidURLs,omitempty"`
+	// DuplicateURLs are the URLs left out as repeats of earlier ones.
+	DuplicateURLs []string `json:"duplicateURLs,omitempty"`
+	// Job is the finished job when the request waited for it.
+	Job     *BatchScrapeStatus `json:"job,omitempty"`
+	Warning string             `json:"warning,omitempty"`
 }
 
 // BatchScrapeStatus represents the status of a batch scrape job.
@@ -65,4 +414,103 @@ type BatchScrapeStatus struct {
 	Completed int            `json:"completed"`
 	ExpiresAt string         `json:"expiresAt"`
 	Data      []ScrapeResult `json:"data,omitempty"`
+	// Results reports each processed URL's outcome in the order processed,
+	// so callers can match them to the submitted URLs.
+	Results []BatchURLStatus `json:"results,omitempty"`
+	TransferStats
+	CreditUsage
+}
+
+// BatchURLStatus is the outcome of scraping one URL of a batch.
+type BatchURLStatus struct {
+	URL        string `json:"url"`
+	Success    bool   `json:"success"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// URLStatus summarizes the result as the outcome of its URL.
+func (r ScrapeResult) URLStatus() BatchURLStatus {
+	status := BatchURLStatus{
+		Success: r.Error == "",
+		Error:   r.Error,
+	}
+	if r.Metadata != nil {
+		status.URL = r.Metadata.SourceURL
+		status.StatusCode = r.Metadata.StatusCode
+	}
+	return status
+}
+
+// TransferStats totals the bytes a job's pages sent and received, for pages
+// scraped with byte counts included.
+type TransferStats struct {
+	TotalBytesSent     int64 `json:"totalBytesSent,omitempty"`
+	TotalBytesReceived int64 `json:"totalBytesReceived,omitempty"`
+}
+
+// Add counts a scraped page's bytes towards the totals.
+func (t *TransferStats) Add(metadata *ScrapeMetadata) {
+	if metadata == nil {
+		return
+	}
+	t.TotalBytesSent += metadata.BytesSent
+	t.TotalBytesReceived += metadata.BytesReceived
+}
+
+// Credit weights charged per scraped URL. Every URL costs CreditsBase; the
+// others are added when the page needed the extra work.
+const (
+	// CreditsBase is charged for every processed URL, as for plain markdown.
+	CreditsBase = 1
+	// CreditsScreenshot is added when a screenshot was taken.
+	CreditsScreenshot = 1
+	// CreditsExtraction is added when data was extracted with the LLM.
+	CreditsExtraction = 4
+	// CreditsBrowser is added when actions were run in the browser.
+	CreditsBrowser = 1
+)
+
+// CreditBreakdown splits credits by the work they paid for.
+type CreditBreakdown struct {
+	Base       int `json:"base"`
+	Screenshot int `json:"screenshot,omitempty"`
+	Extraction int `json:"extraction,omitempty"`
+	Browser    int `json:"browser,omitempty"`
+}
+
+// Total returns the credits across all kinds of work.
+func (b CreditBreakdown) Total() int {
+	return b.Base + b.Screenshot + b.Extraction + b.Browser
+}
+
+// Credits returns what scraping the result's URL costs, weighted by the
+// formats and options that produced it.
+func (r ScrapeResult) Credits() CreditBreakdown {
+	credits := CreditBreakdown{Base: CreditsBase}
+	if r.Screenshot != "" {
+		credits.Screenshot = CreditsScreenshot
+	}
+	if r.JSON != nil || r.Extract != "" {
+		credits.Extraction = CreditsExtraction
+	}
+	if len(r.Actions) > 0 {
+		credits.Browser = CreditsBrowser
+	}
+	return credits
+}
+
+// CreditUsage totals the credits a job's URLs cost.
+type CreditUsage struct {
+	CreditsUsed     int             `json:"creditsUsed"`
+	CreditBreakdown CreditBreakdown `json:"creditBreakdown"`
+}
+
+// Add charges a scraped URL's credits to the totals.
+func (u *CreditUsage) Add(credits CreditBreakdown) {
+	u.CreditBreakdown.Base += credits.Base
+	u.CreditBreakdown.Screenshot += credits.Screenshot
+	u.CreditBreakdown.Extraction += credits.Extraction
+	u.CreditBreakdown.Browser += credits.Browser
+	u.CreditsUsed = u.CreditBreakdown.Total()
 }
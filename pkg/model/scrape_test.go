@@ -8,16 +8,18 @@ import (
 func TestScrapeRequestJSON(t *testing.T) {
 	// Test marshaling and unmarshaling of ScrapeRequest
 	req := ScrapeRequest{
-		URL:             "https://example.com",
-		Formats:         []string{"markdown", "html"},
-		OnlyMainContent: true,
-		IncludeTags:     []string{"article", "section"},
-		ExcludeTags:     []string{"nav", "footer"},
-		Headers: map[string]string{
-			"User-Agent": "Test Agent",
+		URL: "https://example.com",
+		ScrapeOptions: ScrapeOptions{
+			Formats:         []string{"markdown", "html"},
+			OnlyMainContent: true,
+			IncludeTags:     []string{"article", "section"},
+			ExcludeTags:     []string{"nav", "footer"},
+			Headers: map[string]string{
+				"User-Agent": "Test Agent",
+			},
+			WaitFor: 1000,
+			Timeout: 30000,
 		},
-		WaitFor: 1000,
-		Timeout: 30000,
 	}
 
 	// Marshal to JSON
@@ -74,18 +76,20 @@ func TestBatchScrapeRequestJSON(t *testing.T) {
 	// Test marshaling and unmarshaling of BatchScrapeRequest
 	req := BatchScrapeRequest{
 		URLs:              []string{"https://example.com", "https://example.org"},
-		Formats:           []string{"markdown", "html"},
-		OnlyMainContent:   true,
-		IncludeTags:       []string{"article", "section"},
-		ExcludeTags:       []string{"nav", "footer"},
-		Headers:           map[string]string{"User-Agent": "Test Agent"},
-		WaitFor:           1000,
-		Timeout:           30000,
 		IgnoreInvalidURLs: true,
 		Webhook: &WebhookConfig{
 			URL:     "https://webhook.example.com",
 			Headers: map[string]string{"Authorization": "Bearer token"},
 		},
+		ScrapeOptions: ScrapeOptions{
+			Formats:         []string{"markdown", "html"},
+			OnlyMainContent: true,
+			IncludeTags:     []string{"article", "section"},
+			ExcludeTags:     []string{"nav", "footer"},
+			Headers:         map[string]string{"User-Agent": "Test Agent"},
+			WaitFor:         1000,
+			Timeout:         30000,
+		},
 	}
 
 	// Marshal to JSON
@@ -180,3 +184,46 @@ func TestScrapeResultJSON(t *testing.T) {
 		}
 	}
 }
+
+func TestScrapeResultCredits(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ScrapeResult
+		want   CreditBreakdown
+	}{
+		{
+			name:   "plain markdown",
+			result: ScrapeResult{Markdown: "# Example"},
+			want:   CreditBreakdown{Base: CreditsBase},
+		},
+		{
+			name:   "screenshot",
+			result: ScrapeResult{Screenshot: "iVBORw0KGgo="},
+			want:   CreditBreakdown{Base: CreditsBase, Screenshot: CreditsScreenshot},
+		},
+		{
+			name:   "extraction and actions",
+			result: ScrapeResult{JSON: map[string]interface{}{"title": "Example"}, Actions: []ActionResult{{}}},
+			want:   CreditBreakdown{Base: CreditsBase, Extraction: CreditsExtraction, Browser: CreditsBrowser},
+		},
+	}
+
+	var usage CreditUsage
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.result.Credits()
+			if got != tt.want {
+				t.Errorf("Credits() = %+v, want %+v", got, tt.want)
+			}
+			usage.Add(got)
+		})
+	}
+
+	want := 3*CreditsBase + CreditsScreenshot + CreditsExtraction + CreditsBrowser
+	if usage.CreditsUsed != want {
+		t.Errorf("CreditsUsed = %d, want %d", usage.CreditsUsed, want)
+	}
+	if usage.CreditBreakdown.Base != 3*CreditsBase {
+		t.Errorf("Base credits = %d, want %d", usage.CreditBreakdown.Base, 3*CreditsBase)
+	}
+}
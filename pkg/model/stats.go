@@ -0,0 +1,20 @@
+package model
+
+// StatsResponse represents server-wide usage statistics.
+type StatsResponse struct {
+	GlobalRateLimit RateLimitStats `json:"globalRateLimit"`
+}
+
+// RateLimitStats reports the global rate limit's configuration and recent usage.
+type RateLimitStats struct {
+	// Limit is the configured requests per second, or zero when unlimited.
+	Limit int `json:"limit"`
+	// CurrentRPS is the number of requests allowed in the last second.
+	CurrentRPS int `json:"currentRps"`
+	// Utilization is CurrentRPS as a fraction of Limit.
+	Utilization float64 `json:"utilization"`
+	// Waiting is the number of requests currently waiting for a token.
+	Waiting int `json:"waiting"`
+	// TotalRequests is the number of requests allowed since startup.
+	TotalRequests int64 `json:"totalRequests"`
+}
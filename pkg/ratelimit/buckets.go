@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Backends for the incoming request limits.
+const (
+	// BackendMemory keeps buckets in each instance's memory.
+	BackendMemory = "memory"
+	// BackendRedis shares buckets between instances through Redis.
+	BackendRedis = "redis"
+)
+
+// IsValidBackend reports whether backend is a known rate limit backend.
+func IsValidBackend(backend string) bool {
+	switch backend {
+	case BackendMemory, BackendRedis:
+		return true
+	}
+	return false
+}
+
+// TakeFunc takes a token from the named bucket, which holds perMinute tokens
+// and refills at perMinute tokens a minute. When the bucket is empty it
+// reports how long until a token is available.
+type TakeFunc func(key string, perMinute int) (allowed bool, retryAfter time.Duration, err error)
+
+// Buckets is an in-memory set of named token buckets for limiting incoming
+// requests on a single instance. Buckets left idle long enough to refill are
+// dropped, so clients that come and go don't pile up.
+type Buckets struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// bucket is the state of one token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewBuckets creates an empty set of token buckets.
+func NewBuckets() *Buckets {
+	return &Buckets{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from the named bucket, starting it full. It never fails
+// and satisfies TakeFunc.
+func (b *Buckets) Take(key string, perMinute int) (bool, time.Duration, error) {
+	if perMinute <= 0 {
+		return true, 0, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	bk, ok := b.buckets[key]
+	if !ok {
+		bk = &bucket{tokens: float64(perMinute), last: now}
+		b.buckets[key] = bk
+	}
+
+	// Refill for the time elapsed, up to a minute's worth
+	rate := float64(perMinute) / time.Minute.Seconds()
+	bk.tokens += now.Sub(bk.last).Seconds() * rate
+	if bk.tokens > float64(perMinute) {
+		bk.tokens = float64(perMinute)
+	}
+	bk.last = now
+
+	if bk.tokens < 1 {
+		return false, time.Duration((1 - bk.tokens) / rate * float64(time.Second)), nil
+	}
+	bk.tokens--
+	return true, 0, nil
+}
+
+// sweep drops the buckets idle for a minute, which would be full again, at
+// most once a minute. The caller holds b.mu.
+func (b *Buckets) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+
+	for key, bk := range b.buckets {
+		if now.Sub(bk.last) >= time.Minute {
+			delete(b.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketsTake(t *testing.T) {
+	now := time.Now()
+	buckets := NewBuckets()
+	buckets.now = func() time.Time { return now }
+
+	// A full bucket allows a minute's worth of requests at once
+	for i := 0; i < 3; i++ {
+		if allowed, _, _ := buckets.Take("key", 3); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter, err := buckets.Take("key", 3)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if allowed {
+		t.Fatal("Expected the 4th request to be refused")
+	}
+	if retryAfter != 20*time.Second {
+		t.Errorf("Expected to retry after 20s, got %v", retryAfter)
+	}
+
+	// Other buckets are counted separately
+	if allowed, _, _ := buckets.Take("other", 3); !allowed {
+		t.Error("Expected another bucket to allow a request")
+	}
+
+	// A token is back once its share of the minute has passed
+	now = now.Add(20 * time.Second)
+	if allowed, _, _ := buckets.Take("key", 3); !allowed {
+		t.Error("Expected a request to be allowed after the bucket refilled")
+	}
+}
+
+func TestBucketsEvictIdle(t *testing.T) {
+	now := time.Now()
+	buckets := NewBuckets()
+	buckets.now = func() time.Time { return now }
+
+	buckets.Take("idle", 3)
+	now = now.Add(30 * time.Second)
+	buckets.Take("busy", 3)
+
+	// Only the bucket idle for a full minute is dropped
+	now = now.Add(45 * time.Second)
+	buckets.Take("busy", 3)
+	if _, ok := buckets.buckets["idle"]; ok {
+		t.Error("Expected the idle bucket to be dropped")
+	}
+	if _, ok := buckets.buckets["busy"]; !ok {
+		t.Error("Expected the busy bucket to be kept")
+	}
+}
@@ -0,0 +1,126 @@
+// Package ratelimit provides a server-wide limit on outbound request rate,
+// and token buckets for limiting incoming requests.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// Limiter is a token bucket shared by every outbound request. A nil Limiter,
+// or one created with a non-positive rate, never blocks.
+type Limiter struct {
+	mu     sync.Mutex
+	rps    int
+	tokens float64
+	last   time.Time
+
+	waiting int
+	total   int64
+	// granted holds the times at which recent requests were allowed through,
+	// used to report the current rate.
+	granted []time.Time
+}
+
+// New creates a limiter allowing rps requests per second across all callers.
+func New(rps int) *Limiter {
+	return &Limiter{
+		rps:    rps,
+		tokens: 1,
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent.
+func (l *Limiter) Wait() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+
+	// Unlimited limiters only count requests
+	if l.rps <= 0 {
+		l.total++
+		l.record(now)
+		l.mu.Unlock()
+		return
+	}
+
+	// Refill at the configured rate with a burst of one, then take a token;
+	// a negative balance is the time this caller must wait for its turn
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rps)
+	if l.tokens > 1 {
+		l.tokens = 1
+	}
+	l.last = now
+	l.tokens--
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(l.rps) * float64(time.Second))
+	}
+
+	l.total++
+	l.record(now.Add(delay))
+	l.waiting++
+	l.mu.Unlock()
+
+	time.Sleep(delay)
+
+	l.mu.Lock()
+	l.waiting--
+	l.mu.Unlock()
+}
+
+// Stats returns the current usage.
+func (l *Limiter) Stats() model.RateLimitStats {
+	if l == nil {
+		return model.RateLimitStats{}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+
+	current := 0
+	for _, t := range l.granted {
+		if !t.After(now) {
+			current++
+		}
+	}
+
+	stats := model.RateLimitStats{
+		Limit:         l.rps,
+		CurrentRPS:    current,
+		Waiting:       l.waiting,
+		TotalRequests: l.total,
+	}
+	if l.rps > 0 {
+		stats.Utilization = float64(current) / float64(l.rps)
+	}
+
+	return stats
+}
+
+// record notes a granted request and drops ones older than a second.
+// The caller must hold l.mu.
+func (l *Limiter) record(at time.Time) {
+	l.prune(time.Now())
+	l.granted = append(l.granted, at)
+}
+
+// prune drops granted times older than a second. The caller must hold l.mu.
+func (l *Limiter) prune(now time.Time) {
+	cutoff := now.Add(-time.Second)
+	i := 0
+	for i < len(l.granted) && !l.granted[i].After(cutoff) {
+		i++
+	}
+	l.granted = l.granted[i:]
+}
@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterWait(t *testing.T) {
+	limiter := New(20)
+
+	// 11 requests at 20 per second need at least half a second
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 11; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limiter.Wait()
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+		t.Errorf("Expected 11 requests to take at least 450ms, took %v", elapsed)
+	}
+
+	stats := limiter.Stats()
+	if stats.Limit != 20 {
+		t.Errorf("Expected limit 20, got %d", stats.Limit)
+	}
+	if stats.TotalRequests != 11 {
+		t.Errorf("Expected 11 total requests, got %d", stats.TotalRequests)
+	}
+	if stats.CurrentRPS == 0 || stats.Utilization == 0 {
+		t.Errorf("Expected recent usage to be reported, got %+v", stats)
+	}
+	if stats.Waiting != 0 {
+		t.Errorf("Expected no waiting requests, got %d", stats.Waiting)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	var limiter *Limiter
+	limiter.Wait()
+	if stats := limiter.Stats(); stats.Limit != 0 {
+		t.Errorf("Expected a nil limiter to report no limit, got %+v", stats)
+	}
+
+	limiter = New(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		limiter.Wait()
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Expected an unlimited limiter not to block, took %v", elapsed)
+	}
+	if stats := limiter.Stats(); stats.TotalRequests != 100 {
+		t.Errorf("Expected 100 total requests, got %d", stats.TotalRequests)
+	}
+}
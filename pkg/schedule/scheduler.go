@@ -0,0 +1,154 @@
+// Package schedule runs scrapes and crawls on cron schedules.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/robfig/cron/v3"
+)
+
+// Options contains configuration options for the scheduler.
+type Options struct {
+	// SaveFn persists a new schedule
+	SaveFn func(schedule model.Schedule) error
+	// LoadFn returns the persisted schedules to resume on start
+	LoadFn func() ([]model.Schedule, error)
+	// RecordRunFn stores the outcome of a run
+	RecordRunFn func(scheduleID string, run model.ScheduleRun) error
+
+	// ScrapeFn runs a scheduled scrape
+	ScrapeFn func(ctx context.Context, req model.ScrapeRequest) (*model.ScrapeResult, error)
+	// CrawlFn starts a scheduled crawl, returning its job ID and status URL
+	CrawlFn func(req model.CrawlRequest) (string, string, error)
+}
+
+// Scheduler runs stored schedules. A run that is still going when its
+// schedule fires again is not started twice.
+type Scheduler struct {
+	cron *cron.Cron
+	opts Options
+}
+
+// New creates a scheduler; call Start to resume stored schedules.
+func New(opts Options) *Scheduler {
+	return &Scheduler{
+		cron: cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		opts: opts,
+	}
+}
+
+// ValidateCron checks that expr is a standard five-field cron expression or
+// a descriptor such as "@hourly" or "@every 30m".
+func ValidateCron(expr string) error {
+	if _, err := cron.ParseStandard(expr); err != nil {
+		return fmt.Errorf("invalid cron expression: %w", err)
+	}
+	return nil
+}
+
+// Start resumes the stored schedules and starts running them. A stored
+// schedule that can no longer be parsed is skipped.
+func (s *Scheduler) Start() error {
+	if s.opts.LoadFn != nil {
+		schedules, err := s.opts.LoadFn()
+		if err != nil {
+			return fmt.Errorf("failed to load schedules: %w", err)
+		}
+		for _, schedule := range schedules {
+			if err := s.register(schedule); err != nil {
+				log.Printf("skipping schedule %s: %v", schedule.ID, err)
+			}
+		}
+	}
+
+	s.cron.Start()
+	return nil
+}
+
+// Stop stops scheduling runs and waits for running ones to finish.
+func (s *Scheduler) Stop() {
+	<-s.cron.Stop().Done()
+}
+
+// Add stores a new schedule and starts running it.
+func (s *Scheduler) Add(req model.ScheduleRequest) (*model.Schedule, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := ValidateCron(req.Cron); err != nil {
+		return nil, err
+	}
+
+	schedule := model.Schedule{
+		ID:        uuid.New().String(),
+		Cron:      req.Cron,
+		Scrape:    req.Scrape,
+		Crawl:     req.Crawl,
+		CreatedAt: time.Now().Format(time.RFC3339),
+	}
+
+	if s.opts.SaveFn != nil {
+		if err := s.opts.SaveFn(schedule); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.register(schedule); err != nil {
+		return nil, err
+	}
+
+	return &schedule, nil
+}
+
+// register adds a schedule to the cron runner.
+func (s *Scheduler) register(schedule model.Schedule) error {
+	_, err := s.cron.AddFunc(schedule.Cron, func() {
+		s.run(schedule)
+	})
+	return err
+}
+
+// run performs one run of a schedule and records its outcome.
+func (s *Scheduler) run(schedule model.Schedule) {
+	run := model.ScheduleRun{
+		ID:        uuid.New().String(),
+		StartedAt: time.Now().Format(time.RFC3339),
+	}
+
+	switch {
+	case schedule.Scrape != nil && s.opts.ScrapeFn != nil:
+		result, err := s.opts.ScrapeFn(context.Background(), *schedule.Scrape)
+		if err != nil {
+			run.Status = "failed"
+			run.Error = err.Error()
+		} else {
+			run.Status = "completed"
+			run.Data = result
+		}
+	case schedule.Crawl != nil && s.opts.CrawlFn != nil:
+		// The crawl runs on under its own job; the run links to it
+		id, url, err := s.opts.CrawlFn(*schedule.Crawl)
+		if err != nil {
+			run.Status = "failed"
+			run.Error = err.Error()
+		} else {
+			run.Status = "started"
+			run.CrawlID = id
+			run.CrawlURL = url
+		}
+	default:
+		run.Status = "failed"
+		run.Error = "nothing to run"
+	}
+	run.FinishedAt = time.Now().Format(time.RFC3339)
+
+	if s.opts.RecordRunFn != nil {
+		if err := s.opts.RecordRunFn(schedule.ID, run); err != nil {
+			log.Printf("failed to record run of schedule %s: %v", schedule.ID, err)
+		}
+	}
+}
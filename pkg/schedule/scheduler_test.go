@@ -0,0 +1,132 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestSchedulerRunsScrape(t *testing.T) {
+	var saved []model.Schedule
+	runs := make(chan model.ScheduleRun, 10)
+	runIDs := make(chan string, 10)
+
+	scheduler := New(Options{
+		SaveFn: func(schedule model.Schedule) error {
+			saved = append(saved, schedule)
+			return nil
+		},
+		RecordRunFn: func(scheduleID string, run model.ScheduleRun) error {
+			runIDs <- scheduleID
+			runs <- run
+			return nil
+		},
+		ScrapeFn: func(_ context.Context, req model.ScrapeRequest) (*model.ScrapeResult, error) {
+			return &model.ScrapeResult{Markdown: "# " + req.URL}, nil
+		},
+	})
+	if err := scheduler.Start(); err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	defer scheduler.Stop()
+
+	created, err := scheduler.Add(model.ScheduleRequest{
+		Cron:   "@every 1s",
+		Scrape: &model.ScrapeRequest{URL: "https://example.com"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add schedule: %v", err)
+	}
+	if len(saved) != 1 || saved[0].ID != created.ID {
+		t.Fatalf("Expected the schedule to be saved, got %v", saved)
+	}
+
+	select {
+	case run := <-runs:
+		if id := <-runIDs; id != created.ID {
+			t.Errorf("Expected the run recorded under %s, got %s", created.ID, id)
+		}
+		if run.Status != "completed" {
+			t.Errorf("Expected a completed run, got %+v", run)
+		}
+		if run.Data == nil || run.Data.Markdown != "# https://example.com" {
+			t.Errorf("Expected the scrape result in the run, got %+v", run.Data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the schedule to fire")
+	}
+}
+
+func TestSchedulerResumesStoredSchedules(t *testing.T) {
+	crawled := make(chan model.CrawlRequest, 10)
+	runs := make(chan model.ScheduleRun, 10)
+
+	scheduler := New(Options{
+		LoadFn: func() ([]model.Schedule, error) {
+			return []model.Schedule{
+				{ID: "nightly", Cron: "@every 1s", Crawl: &model.CrawlRequest{URL: "https://example.com"}},
+				{ID: "broken", Cron: "not a cron", Crawl: &model.CrawlRequest{URL: "https://example.org"}},
+			}, nil
+		},
+		RecordRunFn: func(_ string, run model.ScheduleRun) error {
+			runs <- run
+			return nil
+		},
+		CrawlFn: func(req model.CrawlRequest) (string, string, error) {
+			crawled <- req
+			return "job-1", "http://localhost:8080/v1/crawl/job-1", nil
+		},
+	})
+	if err := scheduler.Start(); err != nil {
+		t.Fatalf("Failed to start scheduler: %v", err)
+	}
+	defer scheduler.Stop()
+
+	select {
+	case req := <-crawled:
+		if req.URL != "https://example.com" {
+			t.Errorf("Expected the stored crawl to run, got %s", req.URL)
+		}
+		run := <-runs
+		if run.Status != "started" || run.CrawlID != "job-1" {
+			t.Errorf("Expected the run to link the started crawl, got %+v", run)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stored schedule to fire")
+	}
+}
+
+func TestSchedulerAddValidation(t *testing.T) {
+	scheduler := New(Options{
+		SaveFn: func(model.Schedule) error {
+			return errors.New("should not be saved")
+		},
+	})
+
+	tests := []struct {
+		name string
+		req  model.ScheduleRequest
+	}{
+		{name: "Invalid cron", req: model.ScheduleRequest{Cron: "every day", Scrape: &model.ScrapeRequest{URL: "https://example.com"}}},
+		{name: "Nothing to run", req: model.ScheduleRequest{Cron: "@hourly"}},
+		{
+			name: "Both scrape and crawl",
+			req: model.ScheduleRequest{
+				Cron:   "@hourly",
+				Scrape: &model.ScrapeRequest{URL: "https://example.com"},
+				Crawl:  &model.CrawlRequest{URL: "https://example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := scheduler.Add(tt.req); err == nil || err.Error() == "should not be saved" {
+				t.Errorf("Expected a validation error, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// renderWithActions runs the request's actions in the browser and returns the
+// page as it is afterwards.
+func (s *Service) renderWithActions(req model.ScrapeRequest) (*RenderedPage, error) {
+	if s.browser == nil {
+		if s.browserErr != nil {
+			return nil, fmt.Errorf("actions require a browser: %w", s.browserErr)
+		}
+		return nil, errors.New("actions require a browser; configure scraper.browserPath")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Timeout)*time.Millisecond)
+	defer cancel()
+
+	return s.browser.Render(ctx, req.URL, RenderOptions{
+		PageOptions: s.pageOptions(req),
+		Actions:     req.Actions,
+	})
+}
+
+// renderedTransport answers every request with a page rendered by the
+// browser, so it goes through the usual extraction.
+type renderedTransport struct {
+	html string
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t renderedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(t.html)),
+		ContentLength: int64(len(t.html)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestScrapeActions(t *testing.T) {
+	server := newTestServer(`<html><body><button id="more">More</button></body></html>`)
+	defer server.Close()
+
+	browser := &fakeBrowser{html: `<html><body><p>Loaded after click</p></body></html>`}
+	service := NewServiceWithOptions(ServiceOptions{Browser: browser})
+
+	actions := []model.CrawlAction{
+		{Type: model.ActionClick, Selector: "#more"},
+		{Type: model.ActionWait, Milliseconds: 100},
+	}
+	result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Actions: actions}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Loaded after click") {
+		t.Errorf("Expected markdown of the rendered page, got %q", result.Markdown)
+	}
+	if len(browser.renderOpts.Actions) != 2 {
+		t.Errorf("Expected the actions to be passed to the browser, got %v", browser.renderOpts.Actions)
+	}
+	if len(result.Actions) != 2 || result.Actions[0].Type != model.ActionClick || result.Actions[0].DurationMS != 5 {
+		t.Errorf("Expected the action timings in the result, got %+v", result.Actions)
+	}
+}
+
+func TestScrapeActionsWithoutBrowser(t *testing.T) {
+	server := newTestServer(`<html><body><p>Hello</p></body></html>`)
+	defer server.Close()
+
+	service := NewService()
+	_, err := service.Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Actions: []model.CrawlAction{{Type: model.ActionScroll}},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "browser") {
+		t.Errorf("Expected an error about the missing browser, got %v", err)
+	}
+}
+
+func TestValidateActions(t *testing.T) {
+	tests := []struct {
+		action model.CrawlAction
+		valid  bool
+	}{
+		{model.CrawlAction{Type: model.ActionWait, Milliseconds: 500}, true},
+		{model.CrawlAction{Type: model.ActionWait, Selector: "#done"}, true},
+		{model.CrawlAction{Type: model.ActionWait}, false},
+		{model.CrawlAction{Type: model.ActionClick}, false},
+		{model.CrawlAction{Type: model.ActionScroll}, true},
+		{model.CrawlAction{Type: model.ActionWrite, Selector: "#q"}, false},
+		{model.CrawlAction{Type: "hover", Selector: "#menu"}, false},
+	}
+
+	for _, tt := range tests {
+		err := model.ValidateActions([]model.CrawlAction{tt.action})
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateActions(%+v) = %v, want valid=%v", tt.action, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package scraper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+var (
+	// headingPattern matches ATX markdown headings such as "## Title". A
+	// closing run of #s only counts when whitespace separates it from the text.
+	headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.+?)(?:\s+#+)?\s*$`)
+	// existingAnchorPattern matches an explicit heading ID such as "{#title}".
+	existingAnchorPattern = regexp.MustCompile(`\s*\{#[^}]*\}$`)
+	// slugInvalidChars matches runs of characters that are not allowed in an
+	// anchor: anything but letters, their combining marks and digits, in any script.
+	slugInvalidChars = regexp.MustCompile(`[^\p{L}\p{M}\p{Nd}]+`)
+)
+
+// anchorHeadings injects stable anchor IDs into markdown headings and returns
+// the rewritten markdown along with the heading to anchor mapping.
+// Duplicate headings receive numeric suffixes so every anchor is unique.
+func anchorHeadings(markdown string) (string, []model.HeadingAnchor) {
+	lines := strings.Split(markdown, "\n")
+	anchors := make([]model.HeadingAnchor, 0)
+	used := make(map[string]int)
+	inFence := false
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		// Don't touch anything inside fenced code blocks
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		match := headingPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		heading := existingAnchorPattern.ReplaceAllString(match[2], "")
+		anchor := uniqueAnchor(slugify(heading), used)
+
+		lines[i] = fmt.Sprintf("%s %s {#%s}", match[1], heading, anchor)
+		anchors = append(anchors, model.HeadingAnchor{
+			Heading: heading,
+			Anchor:  anchor,
+		})
+	}
+
+	return strings.Join(lines, "\n"), anchors
+}
+
+// slugify converts heading text into a lowercase, hyphen separated anchor.
+func slugify(text string) string {
+	slug := slugInvalidChars.ReplaceAllString(strings.ToLower(text), "-")
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		return "section"
+	}
+	return slug
+}
+
+// uniqueAnchor returns the slug, suffixed with a counter if it has been used before.
+func uniqueAnchor(slug string, used map[string]int) string {
+	anchor := slug
+	for used[anchor] > 0 {
+		anchor = fmt.Sprintf("%s-%d", slug, used[slug])
+		used[slug]++
+	}
+	used[anchor]++
+	return anchor
+}
@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnchorHeadings(t *testing.T) {
+	markdown := strings.Join([]string{
+		"# Getting Started",
+		"",
+		"Some text.",
+		"",
+		"## Install",
+		"",
+		"```",
+		"# not a heading",
+		"```",
+		"",
+		"## Install",
+		"",
+		"### What's New? {#old}",
+		"",
+		"## Установка и настройка",
+		"",
+		"## 快速开始",
+		"",
+		"## C#",
+		"",
+		"## Closed ##",
+	}, "\n")
+
+	got, anchors := anchorHeadings(markdown)
+
+	want := []struct {
+		heading string
+		anchor  string
+	}{
+		{"Getting Started", "getting-started"},
+		{"Install", "install"},
+		{"Install", "install-1"},
+		{"What's New?", "what-s-new"},
+		{"Установка и настройка", "установка-и-настройка"},
+		{"快速开始", "快速开始"},
+		{"C#", "c"},
+		{"Closed", "closed"},
+	}
+
+	if len(anchors) != len(want) {
+		t.Fatalf("Expected %d anchors, got %d", len(want), len(anchors))
+	}
+
+	seen := make(map[string]bool)
+	for i, w := range want {
+		if anchors[i].Heading != w.heading {
+			t.Errorf("Heading mismatch at index %d: got %v, want %v", i, anchors[i].Heading, w.heading)
+		}
+		if anchors[i].Anchor != w.anchor {
+			t.Errorf("Anchor mismatch at index %d: got %v, want %v", i, anchors[i].Anchor, w.anchor)
+		}
+		if seen[anchors[i].Anchor] {
+			t.Errorf("Duplicate anchor %v", anchors[i].Anchor)
+		}
+		seen[anchors[i].Anchor] = true
+	}
+
+	// Headings should carry their anchors and code blocks should be untouched
+	if !strings.Contains(got, "## Install {#install-1}") {
+		t.Errorf("Expected anchored duplicate heading in output, got:\n%s", got)
+	}
+	if !strings.Contains(got, "## C# {#c}") {
+		t.Errorf("Expected a trailing # in the heading text to be kept, got:\n%s", got)
+	}
+	if !strings.Contains(got, "# not a heading\n") {
+		t.Errorf("Expected fenced code to be left alone, got:\n%s", got)
+	}
+
+	// Anchoring the same document again must produce the same result
+	again, _ := anchorHeadings(markdown)
+	if again != got {
+		t.Errorf("Expected stable output across runs")
+	}
+}
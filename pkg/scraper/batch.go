@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// batchJobs tracks the running batch jobs so they can be cancelled.
+type batchJobs struct {
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+// newBatchJobs creates an empty batch job registry.
+func newBatchJobs() *batchJobs {
+	return &batchJobs{cancels: make(map[string]context.CancelFunc)}
+}
+
+// start registers a running job and returns the context that is cancelled
+// when the job is, along with a func to call once the job finishes.
+func (b *batchJobs) start(jobID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b.mu.Lock()
+	b.cancels[jobID] = cancel
+	b.mu.Unlock()
+
+	return ctx, func() {
+		b.mu.Lock()
+		delete(b.cancels, jobID)
+		b.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancel cancels a running job and reports whether it was running.
+func (b *batchJobs) cancel(jobID string) bool {
+	b.mu.Lock()
+	cancel, ok := b.cancels[jobID]
+	b.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// running returns the IDs of the running jobs.
+func (b *batchJobs) running() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]string, 0, len(b.cancels))
+	for jobID := range b.cancels {
+		ids = append(ids, jobID)
+	}
+	return ids
+}
+
+// CancelBatchJob stops a running batch job, aborting its in-flight scrape,
+// and reports whether the job was running on this server.
+func (s *Service) CancelBatchJob(jobID string) bool {
+	return s.batches.cancel(jobID)
+}
+
+// RunningBatchJobs returns the IDs of the batch jobs running on this server.
+func (s *Service) RunningBatchJobs() []string {
+	return s.batches.running()
+}
+
+// cancelTransport aborts the requests it carries when ctx is cancelled, so
+// cancelling a batch stops the fetch in progress.
+type cancelTransport struct {
+	base http.RoundTripper
+	ctx  context.Context
+}
+
+// newCancelTransport wraps base, falling back to the default transport.
+func newCancelTransport(base http.RoundTripper, ctx context.Context) *cancelTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cancelTransport{base: base, ctx: ctx}
+}
+
+// RoundTrip performs the request, aborting it if ctx is cancelled before the
+// response body is closed.
+func (t *cancelTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(t.ctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases the request's cancellation hook once closed.
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close closes the body and releases the hook.
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,57 @@
+package scraper
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// DefaultMaxResponseBytes is the largest response body read when no cap is
+// configured, matching colly's own default.
+const DefaultMaxResponseBytes = 10 << 20
+
+// maxOriginalHTMLBytes caps the originalHtml output, which repeats the page
+// alongside the filtered formats.
+const maxOriginalHTMLBytes = 1 << 20
+
+// resolveMaxResponseBytes returns the response body cap for a request: its
+// own cap when set and within the server's, otherwise the server's. It warns
+// when the request asked for more than the server allows.
+func resolveMaxResponseBytes(requested, max int) (int, string) {
+	if requested <= 0 {
+		return max, ""
+	}
+	if max > 0 && requested > max {
+		return max, fmt.Sprintf("requested maxResponseBytes of %d exceeds the maximum of %d and was clamped", requested, max)
+	}
+	return requested, ""
+}
+
+// truncationWarning explains a response body cut short at the cap.
+func truncationWarning(truncated bool, limit int) string {
+	if !truncated {
+		return ""
+	}
+	return fmt.Sprintf("response body truncated to %d bytes", limit)
+}
+
+// originalHTML returns the body as originalHtml output, cut at a character
+// boundary within maxOriginalHTMLBytes, and whether it was cut.
+func originalHTML(body []byte) (string, bool) {
+	if len(body) <= maxOriginalHTMLBytes {
+		return string(body), false
+	}
+
+	cut := maxOriginalHTMLBytes
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return string(body[:cut]), true
+}
+
+// originalHTMLWarning explains originalHtml output cut short at its cap.
+func originalHTMLWarning(truncated bool) string {
+	if !truncated {
+		return ""
+	}
+	return fmt.Sprintf("originalHtml truncated to %d bytes", maxOriginalHTMLBytes)
+}
@@ -0,0 +1,119 @@
+package scraper
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// extractBreadcrumbs returns the page's breadcrumb trail, preferring JSON-LD
+// BreadcrumbList data over breadcrumb navigation markup.
+func (s *scraper) extractBreadcrumbs(doc *goquery.Document) []model.Breadcrumb {
+	if crumbs := breadcrumbsFromJSONLD(doc); len(crumbs) > 0 {
+		return crumbs
+	}
+	return breadcrumbsFromNav(doc)
+}
+
+// breadcrumbsFromJSONLD reads the first BreadcrumbList in the page's JSON-LD.
+func breadcrumbsFromJSONLD(doc *goquery.Document) []model.Breadcrumb {
+	for _, obj := range jsonLDObjects(doc) {
+		if !jsonLDHasType(obj, "BreadcrumbList") {
+			continue
+		}
+
+		items, _ := obj["itemListElement"].([]interface{})
+		type positioned struct {
+			position float64
+			crumb    model.Breadcrumb
+		}
+		list := make([]positioned, 0, len(items))
+
+		for i, raw := range items {
+			item, ok := raw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			crumb := model.Breadcrumb{Name: jsonLDString(item, "name")}
+
+			// The item may be a URL or a nested Thing with its own @id and name
+			switch target := item["item"].(type) {
+			case string:
+				crumb.URL = strings.TrimSpace(target)
+			case map[string]interface{}:
+				crumb.URL = jsonLDString(target, "@id")
+				if crumb.URL == "" {
+					crumb.URL = jsonLDString(target, "url")
+				}
+				if crumb.Name == "" {
+					crumb.Name = jsonLDString(target, "name")
+				}
+			}
+
+			position, ok := item["position"].(float64)
+			if !ok {
+				position = float64(i + 1)
+			}
+			list = append(list, positioned{position: position, crumb: crumb})
+		}
+
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].position < list[j].position
+		})
+
+		crumbs := make([]model.Breadcrumb, 0, len(list))
+		for _, p := range list {
+			crumbs = append(crumbs, p.crumb)
+		}
+		if len(crumbs) > 0 {
+			return crumbs
+		}
+	}
+
+	return nil
+}
+
+// resolveBreadcrumbURLs rewrites relative breadcrumb URLs against base.
+func resolveBreadcrumbURLs(crumbs []model.Breadcrumb, base *url.URL) {
+	for i := range crumbs {
+		if resolved, ok := resolveURL(base, crumbs[i].URL); ok {
+			crumbs[i].URL = resolved
+		}
+	}
+}
+
+// breadcrumbsFromNav reads breadcrumbs from a nav element labelled "breadcrumb".
+func breadcrumbsFromNav(doc *goquery.Document) []model.Breadcrumb {
+	nav := doc.Find("nav[aria-label]").FilterFunction(func(_ int, sel *goquery.Selection) bool {
+		return strings.EqualFold(strings.TrimSpace(sel.AttrOr("aria-label", "")), "breadcrumb")
+	}).First()
+	if nav.Length() == 0 {
+		return nil
+	}
+
+	crumbs := make([]model.Breadcrumb, 0)
+
+	// Prefer list items so the current page, which is often unlinked, is kept
+	items := nav.Find("li")
+	if items.Length() == 0 {
+		items = nav.Find("a")
+	}
+
+	items.Each(func(_ int, sel *goquery.Selection) {
+		name := strings.Join(strings.Fields(sel.Text()), " ")
+		if name == "" {
+			return
+		}
+		href := sel.AttrOr("href", "")
+		if href == "" {
+			href = sel.Find("a[href]").First().AttrOr("href", "")
+		}
+		crumbs = append(crumbs, model.Breadcrumb{Name: name, URL: href})
+	})
+
+	return crumbs
+}
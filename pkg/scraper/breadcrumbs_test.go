@@ -0,0 +1,82 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestExtractBreadcrumbs(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []model.Breadcrumb
+	}{
+		{
+			name: "JSON-LD BreadcrumbList preferred over nav",
+			html: `<html><head>
+				<script type="application/ld+json">
+				{
+					"@context": "https://schema.org",
+					"@type": "BreadcrumbList",
+					"itemListElement": [
+						{"@type": "ListItem", "position": 2, "name": "Books", "item": "https://example.com/books"},
+						{"@type": "ListItem", "position": 1, "name": "Home", "item": "https://example.com/"},
+						{"@type": "ListItem", "position": 3, "item": {"@id": "https://example.com/books/sf", "name": "Science Fiction"}}
+					]
+				}
+				</script>
+			</head><body>
+				<nav aria-label="breadcrumb"><a href="/">Ignored</a></nav>
+			</body></html>`,
+			want: []model.Breadcrumb{
+				{Name: "Home", URL: "https://example.com/"},
+				{Name: "Books", URL: "https://example.com/books"},
+				{Name: "Science Fiction", URL: "https://example.com/books/sf"},
+			},
+		},
+		{
+			name: "Nav fallback",
+			html: `<html><body>
+				<nav aria-label="Breadcrumb"><ol>
+					<li><a href="/">Home</a></li>
+					<li><a href="/docs">Docs</a></li>
+					<li aria-current="page">Install</li>
+				</ol></nav>
+			</body></html>`,
+			want: []model.Breadcrumb{
+				{Name: "Home", URL: "/"},
+				{Name: "Docs", URL: "/docs"},
+				{Name: "Install"},
+			},
+		},
+		{
+			name: "No breadcrumbs",
+			html: `<html><body><p>Nothing here</p></body></html>`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+
+			s := &scraper{}
+			got := s.extractBreadcrumbs(doc)
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d breadcrumbs, got %d: %+v", len(tt.want), len(got), got)
+			}
+			for i, w := range tt.want {
+				if got[i] != w {
+					t.Errorf("Breadcrumb mismatch at index %d: got %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// Viewport emulated for mobile pages, matching an iPhone 14.
+const (
+	mobileViewportWidth  = 390
+	mobileViewportHeight = 844
+	mobileViewportScale  = 3
+)
+
+// Browser renders pages in a headless browser for formats and options that a
+// plain HTTP fetch can't handle.
+type Browser interface {
+	// Screenshot loads the page and returns it as a PNG image.
+	Screenshot(ctx context.Context, pageURL string, opts ScreenshotOptions) ([]byte, error)
+	// Render loads the page, runs the actions in order and returns the
+	// resulting HTML.
+	Render(ctx context.Context, pageURL string, opts RenderOptions) (*RenderedPage, error)
+}
+
+// PageOptions controls how the browser presents itself while loading a page.
+type PageOptions struct {
+	UserAgent string
+	// Mobile emulates a phone's viewport and touch support.
+	Mobile  bool
+	Headers map[string]string
+	// Location sets the browser's locale and, for known countries, its
+	// geolocation and time zone.
+	Location *model.LocationOptions
+}
+
+// ScreenshotOptions controls how a page is captured.
+type ScreenshotOptions struct {
+	PageOptions
+	// FullPage captures the whole scrollable page instead of the viewport.
+	FullPage bool
+}
+
+// RenderOptions controls how a page is rendered.
+type RenderOptions struct {
+	PageOptions
+	Actions []model.CrawlAction
+}
+
+// RenderedPage is the page state after its actions ran.
+type RenderedPage struct {
+	HTML    string
+	Actions []model.ActionResult
+}
+
+// chromeBrowser drives a local Chrome or Chromium binary over the DevTools
+// protocol. Each page runs in a fresh browser process.
+type chromeBrowser struct {
+	execPath string
+}
+
+// NewChromeBrowser returns a Browser backed by the Chrome or Chromium binary
+// at execPath. It fails if the binary can't be found.
+func NewChromeBrowser(execPath string) (Browser, error) {
+	path, err := exec.LookPath(execPath)
+	if err != nil {
+		return nil, fmt.Errorf("browser not available at %q: %w", execPath, err)
+	}
+	return &chromeBrowser{execPath: path}, nil
+}
+
+// Screenshot implements Browser.
+func (b *chromeBrowser) Screenshot(ctx context.Context, pageURL string, opts ScreenshotOptions) ([]byte, error) {
+	var image []byte
+	capture := chromedp.CaptureScreenshot(&image)
+	if opts.FullPage {
+		// Quality 100 keeps the capture lossless PNG
+		capture = chromedp.FullScreenshot(&image, 100)
+	}
+
+	if err := b.run(ctx, opts.PageOptions, chromedp.Navigate(pageURL), capture); err != nil {
+		return nil, fmt.Errorf("failed to capture screenshot: %w", err)
+	}
+	return image, nil
+}
+
+// Render implements Browser.
+func (b *chromeBrowser) Render(ctx context.Context, pageURL string, opts RenderOptions) (*RenderedPage, error) {
+	page := &RenderedPage{}
+
+	tasks := chromedp.Tasks{chromedp.Navigate(pageURL)}
+	for _, action := range opts.Actions {
+		tasks = append(tasks, timedAction(action, browserAction(action), page))
+	}
+	tasks = append(tasks, chromedp.OuterHTML("html", &page.HTML, chromedp.ByQuery))
+
+	if err := b.run(ctx, opts.PageOptions, tasks...); err != nil {
+		return nil, fmt.Errorf("failed to render page: %w", err)
+	}
+	return page, nil
+}
+
+// run starts a browser and runs the tasks, sending the User-Agent and extra
+// headers with every request. Mobile pages get a phone-sized viewport, and
+// the location is emulated, before anything loads.
+func (b *chromeBrowser) run(ctx context.Context, page PageOptions, tasks ...chromedp.Action) error {
+	allocOpts := append(chromedp.DefaultExecAllocatorOptions[:], chromedp.ExecPath(b.execPath))
+	if page.UserAgent != "" {
+		allocOpts = append(allocOpts, chromedp.UserAgent(page.UserAgent))
+	}
+
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, allocOpts...)
+	defer cancelAlloc()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+
+	all := chromedp.Tasks{}
+	if page.Mobile {
+		all = append(all, chromedp.EmulateViewport(mobileViewportWidth, mobileViewportHeight,
+			chromedp.EmulateScale(mobileViewportScale), chromedp.EmulateMobile, chromedp.EmulateTouch))
+	}
+	if page.Location != nil {
+		all = append(all, emulateLocation(page.Location)...)
+	}
+	if len(page.Headers) > 0 {
+		extra := make(network.Headers, len(page.Headers))
+		for key, value := range page.Headers {
+			extra[key] = value
+		}
+		all = append(all, network.Enable(), network.SetExtraHTTPHeaders(extra))
+	}
+	all = append(all, tasks...)
+
+	return chromedp.Run(browserCtx, all)
+}
+
+// browserAction translates a crawl action into browser steps. Actions are
+// validated before they get here.
+func browserAction(action model.CrawlAction) chromedp.Action {
+	switch action.Type {
+	case model.ActionWait:
+		if action.Selector != "" {
+			return chromedp.WaitVisible(action.Selector, chromedp.ByQuery)
+		}
+		return chromedp.Sleep(time.Duration(action.Milliseconds) * time.Millisecond)
+	case model.ActionClick:
+		return chromedp.Click(action.Selector, chromedp.ByQuery)
+	case model.ActionScroll:
+		if action.Selector != "" {
+			return chromedp.ScrollIntoView(action.Selector, chromedp.ByQuery)
+		}
+		return chromedp.Evaluate(`window.scrollBy(0, window.innerHeight)`, nil)
+	case model.ActionWrite:
+		return chromedp.SendKeys(action.Selector, action.Text, chromedp.ByQuery)
+	default:
+		return chromedp.ActionFunc(func(context.Context) error {
+			return fmt.Errorf("unsupported action type: %s", action.Type)
+		})
+	}
+}
+
+// timedAction runs the step and records how long it took on the page.
+func timedAction(action model.CrawlAction, step chromedp.Action, page *RenderedPage) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		start := time.Now()
+		err := step.Do(ctx)
+
+		result := model.ActionResult{
+			Type:       action.Type,
+			Selector:   action.Selector,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		page.Actions = append(page.Actions, result)
+		return err
+	})
+}
@@ -0,0 +1,76 @@
+package scraper
+
+import (
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// byteCountTransport totals the bytes sent and received by the requests it
+// carries. Sizes are those of HTTP/1.1 messages: request and status lines,
+// headers and bodies, with bodies counted as read, after any decompression.
+type byteCountTransport struct {
+	base http.RoundTripper
+
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+// newByteCountTransport wraps base, falling back to the default transport.
+func newByteCountTransport(base http.RoundTripper) *byteCountTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &byteCountTransport{base: base}
+}
+
+// RoundTrip performs the request, counting both messages as they go.
+func (t *byteCountTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.sent.Add(int64(len(req.Method) + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n")))
+	t.sent.Add(headerSize(req.Header) + int64(len("Host: \r\n\r\n")+len(req.Host)))
+	if req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &countingReader{ReadCloser: req.Body, n: &t.sent}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	t.received.Add(int64(len("HTTP/1.1 \r\n")+len(resp.Status)) + headerSize(resp.Header) + int64(len("\r\n")))
+	resp.Body = &countingReader{ReadCloser: resp.Body, n: &t.received}
+	return resp, nil
+}
+
+// apply copies the totals into the metadata.
+func (t *byteCountTransport) apply(metadata *model.ScrapeMetadata) {
+	metadata.BytesSent = t.sent.Load()
+	metadata.BytesReceived = t.received.Load()
+}
+
+// headerSize returns the size of the header lines as written on the wire.
+func headerSize(header http.Header) int64 {
+	var n int64
+	for key, values := range header {
+		for _, value := range values {
+			n += int64(len(key) + len(": ") + len(value) + len("\r\n"))
+		}
+	}
+	return n
+}
+
+// countingReader adds the bytes read through it to n.
+type countingReader struct {
+	io.ReadCloser
+	n *atomic.Int64
+}
+
+// Read reads from the underlying body, counting what was read.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// connInfoTransport records the remote IP and TLS state of the connections
+// used by the requests it carries. After redirects, the last response wins.
+type connInfoTransport struct {
+	base http.RoundTripper
+
+	mu       sync.Mutex
+	remoteIP string
+	tlsState *tls.ConnectionState
+}
+
+// newConnInfoTransport wraps base, falling back to the default transport.
+func newConnInfoTransport(base http.RoundTripper) *connInfoTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &connInfoTransport{base: base}
+}
+
+// RoundTrip performs the request while tracing the connection it used.
+func (t *connInfoTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var remoteIP string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+				remoteIP = host
+			}
+		},
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return resp, err
+	}
+
+	t.mu.Lock()
+	t.remoteIP = remoteIP
+	t.tlsState = resp.TLS
+	t.mu.Unlock()
+
+	return resp, nil
+}
+
+// apply copies the recorded connection info into the metadata. Nothing is
+// recorded for plain HTTP targets.
+func (t *connInfoTransport) apply(metadata *model.ScrapeMetadata) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tlsState == nil {
+		return
+	}
+
+	metadata.RemoteIP = t.remoteIP
+	if len(t.tlsState.PeerCertificates) > 0 {
+		cert := t.tlsState.PeerCertificates[0]
+		metadata.TLSInfo = &model.TLSInfo{
+			Issuer:   cert.Issuer.String(),
+			Subject:  cert.Subject.String(),
+			NotAfter: cert.NotAfter,
+		}
+	}
+}
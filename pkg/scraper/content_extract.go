@@ -1,23 +1,22 @@
 package scraper
 
 import (
+	"net/url"
+	"strings"
+
 	html2md "github.com/JohannesKaufmann/html-to-markdown"
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 )
 
 // extractMarkdown extracts markdown content from the document.
 func (s *scraper) extractMarkdown(doc *goquery.Document) string {
-	docCopy := cloneDocument(doc)
-	s.applyContentFilters(docCopy)
-
-	converter := html2md.NewConverter("", true, nil)
-
-	html, err := docCopy.Html()
+	html, err := s.filteredDocument(doc).Html()
 	if err != nil {
 		return ""
 	}
 
-	markdown, err := converter.ConvertString(html)
+	markdown, err := s.markdownConverter().ConvertString(html)
 	if err != nil {
 		return ""
 	}
@@ -25,35 +24,119 @@ func (s *scraper) extractMarkdown(doc *goquery.Document) string {
 	return markdown
 }
 
-// extractHTML extracts processed HTML content from the document.
-func (s *scraper) extractHTML(doc *goquery.Document) string {
+// markdownConverter returns a converter with the rules the request asks for.
+func (s *scraper) markdownConverter() *html2md.Converter {
+	converter := html2md.NewConverter("", true, nil)
+	converter.AddRules(imageRules(s.request.ImageHandling)...)
+	if s.request.UseLinkTitles {
+		converter.AddRules(linkTitleRules()...)
+	}
+	return converter
+}
+
+// filteredDocument returns a copy of the document with the request's content
+// filters applied.
+func (s *scraper) filteredDocument(doc *goquery.Document) *goquery.Document {
 	docCopy := cloneDocument(doc)
 	s.applyContentFilters(docCopy)
+	return docCopy
+}
 
-	html, err := docCopy.Html()
+// extractHTML extracts processed HTML content from the document.
+func (s *scraper) extractHTML(doc *goquery.Document) string {
+	html, err := s.filteredDocument(doc).Html()
 	if err != nil {
 		return ""
 	}
 	return html
 }
 
-// extractLinks extracts all links from the document.
+// extractLinks extracts all links from the document, resolved to absolute
+// URLs and deduplicated in page order. With rawLinks set, hrefs are returned
+// as written, only resolved against a <base href>, duplicates included.
 func (s *scraper) extractLinks(doc *goquery.Document) []string {
 	links := make([]string, 0)
+	seen := make(map[string]bool)
 
-	doc.Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
+	// Relative links are relative to the page's <base href>, then its URL
+	base := s.baseHref(doc)
+	if base == nil && !s.request.RawLinks {
+		base, _ = url.Parse(s.request.URL)
+	}
+
+	s.tagFilteredDocument(doc).Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
 		href, exists := sel.Attr("href")
 		if !exists || href == "" || href[0] == '#' {
 			return
 		}
+
+		if base != nil {
+			if resolved, ok := resolveURL(base, href); ok {
+				href = resolved
+			}
+		}
+		if !s.request.RawLinks {
+			if seen[href] {
+				return
+			}
+			seen[href] = true
+		}
 		links = append(links, href)
 	})
 
 	return links
 }
 
+// defaultStripElements are removed when extracting the main content, unless
+// the request sets its own list.
+var defaultStripElements = []string{
+	"header", "nav", "footer", "aside", ".sidebar", ".nav", ".menu", ".advertisement", "script", "style", "noscript",
+}
+
+// adSelectors match common ad and tracker containers, removed when blockAds
+// is set.
+var adSelectors = []string{
+	// Ad network and tracker frames
+	`iframe[src*="doubleclick.net"]`,
+	`iframe[src*="googlesyndication.com"]`,
+	`iframe[src*="adservice.google"]`,
+	`iframe[src*="amazon-adsystem.com"]`,
+	`iframe[src*="taboola.com"]`,
+	`iframe[src*="outbrain.com"]`,
+	`img[src*="facebook.com/tr"]`,
+	`img[width="1"][height="1"]`,
+
+	// Ad slots
+	"ins.adsbygoogle",
+	"[id*=google_ads]",
+	"[id^=div-gpt-ad]",
+	"[data-ad-slot]",
+	"[data-ad-client]",
+	".ad",
+	".ads",
+	".adsbox",
+	".ad-banner",
+	".ad-container",
+	".ad-slot",
+	".advert",
+	".advertisement",
+	".sponsored",
+	".taboola",
+	".OUTBRAIN",
+}
+
 // applyContentFilters applies content filters based on the request options.
 func (s *scraper) applyContentFilters(doc *goquery.Document) {
+	if s.request.ContentSelector != "" {
+		restrictToRegion(doc, s.request.ContentSelector)
+	}
+	if s.request.BlockAds {
+		removeElements(doc, adSelectors)
+	}
+	// A request's own strip list applies with or without main content extraction
+	if s.request.OnlyMainContent || s.request.StripElements != nil {
+		removeElements(doc, s.stripElements())
+	}
 	if s.request.OnlyMainContent {
 		s.extractMainContent(doc)
 	}
@@ -63,12 +146,36 @@ func (s *scraper) applyContentFilters(doc *goquery.Document) {
 	if len(s.request.ExcludeTags) > 0 {
 		s.excludeTags(doc, s.request.ExcludeTags)
 	}
+	if s.request.RemoveComments {
+		removeComments(doc.Selection)
+	}
+	if s.request.StripInlineStyles {
+		doc.Find("[style]").RemoveAttr("style")
+	}
+	if s.request.StripClassAndID {
+		doc.Find("[class]").RemoveAttr("class")
+		doc.Find("[id]").RemoveAttr("id")
+	}
+}
+
+// stripElements returns the elements to remove: the request's list when it
+// sets one, even an empty one, or defaultStripElements.
+func (s *scraper) stripElements() []string {
+	if s.request.StripElements != nil {
+		return s.request.StripElements
+	}
+	return defaultStripElements
+}
+
+// removeElements removes every element matching one of the selectors.
+func removeElements(doc *goquery.Document, selectors []string) {
+	if len(selectors) > 0 {
+		doc.Find(strings.Join(selectors, ", ")).Remove()
+	}
 }
 
 // extractMainContent attempts to extract the main content from the document.
 func (s *scraper) extractMainContent(doc *goquery.Document) {
-	doc.Find("header, nav, footer, aside, .sidebar, .nav, .menu, .advertisement, script, style, noscript").Remove()
-
 	mainContent := doc.Find("main, article, .content, .post, .entry, #content, #main, #post")
 	if mainContent.Length() > 0 {
 		body := doc.Find("body")
@@ -77,6 +184,15 @@ func (s *scraper) extractMainContent(doc *goquery.Document) {
 	}
 }
 
+// restrictToRegion replaces the body with the first element matching the
+// selector.
+func restrictToRegion(doc *goquery.Document, selector string) {
+	region := doc.Find(selector).First()
+	body := doc.Find("body")
+	body.Empty()
+	body.AppendSelection(region)
+}
+
 // includeOnlyTags keeps only the specified tags in the document.
 func (s *scraper) includeOnlyTags(doc *goquery.Document, includeTags []string) {
 	body := doc.Find("body")
@@ -99,6 +215,44 @@ func (s *scraper) includeOnlyTags(doc *goquery.Document, includeTags []string) {
 	body.AppendSelection(container.Children())
 }
 
+// removeComments strips HTML comment nodes, including conditional comments.
+func removeComments(sel *goquery.Selection) {
+	for _, root := range sel.Nodes {
+		removeCommentNodes(root)
+	}
+}
+
+// removeCommentNodes recursively removes comment children of the node.
+func removeCommentNodes(n *html.Node) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.CommentNode {
+			n.RemoveChild(child)
+		} else {
+			removeCommentNodes(child)
+		}
+		child = next
+	}
+}
+
+// tagFilteredDocument returns a copy of the document restricted by the
+// request's includeTags and excludeTags, or the document itself when neither
+// is set.
+func (s *scraper) tagFilteredDocument(doc *goquery.Document) *goquery.Document {
+	if len(s.request.IncludeTags) == 0 && len(s.request.ExcludeTags) == 0 {
+		return doc
+	}
+
+	docCopy := cloneDocument(doc)
+	if len(s.request.IncludeTags) > 0 {
+		s.includeOnlyTags(docCopy, s.request.IncludeTags)
+	}
+	if len(s.request.ExcludeTags) > 0 {
+		s.excludeTags(docCopy, s.request.ExcludeTags)
+	}
+	return docCopy
+}
+
 // excludeTags removes the specified tags from the document.
 func (s *scraper) excludeTags(doc *goquery.Document, excludeTags []string) {
 	for _, tag := range excludeTags {
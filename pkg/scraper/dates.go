@@ -0,0 +1,78 @@
+package scraper
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// dateLayouts lists the layouts tried, in order, when normalizing a date string.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"2 Jan 2006",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// textDatePattern matches recognizable date strings in running text.
+var textDatePattern = regexp.MustCompile(
+	`\b\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2})?(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?)?\b` +
+		`|\b(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\.? \d{1,2}, \d{4}\b` +
+		`|\b\d{1,2} (?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:tember)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?) \d{4}\b`)
+
+// extractDates collects dates from <time> elements and recognizable date
+// strings in the page text, normalized to RFC 3339 where parseable.
+func (s *scraper) extractDates(doc *goquery.Document) []string {
+	dates := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(raw string) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			return
+		}
+		date := normalizeDate(raw)
+		if !seen[date] {
+			seen[date] = true
+			dates = append(dates, date)
+		}
+	}
+
+	// Prefer the machine-readable datetime attribute, falling back to the text
+	doc.Find("time").Each(func(_ int, sel *goquery.Selection) {
+		if datetime, ok := sel.Attr("datetime"); ok && strings.TrimSpace(datetime) != "" {
+			add(datetime)
+			return
+		}
+		add(sel.Text())
+	})
+
+	// Pick up dates mentioned in the content itself
+	body := doc.Find("body").Clone()
+	body.Find("time, script, style, noscript").Remove()
+	for _, match := range textDatePattern.FindAllString(body.Text(), -1) {
+		add(match)
+	}
+
+	return dates
+}
+
+// normalizeDate converts a date string to RFC 3339, returning it unchanged
+// when no known layout matches.
+func normalizeDate(raw string) string {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return raw
+}
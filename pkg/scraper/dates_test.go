@@ -0,0 +1,47 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractDates(t *testing.T) {
+	html := `<html><body>
+		<article>
+			<p>Published <time datetime="2024-03-15T09:30:00Z">March 15</time></p>
+			<p>Updated <time datetime="2024-04-01">April 1st</time></p>
+			<p>Event on <time>June 5, 2024</time></p>
+			<p>Sometime <time>next tuesday</time></p>
+			<p>Duplicate <time datetime="2024-04-01">again</time></p>
+			<p>Deadline is 2024-07-20 and the launch was January 2, 2023.</p>
+		</article>
+	</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	s := &scraper{}
+	dates := s.extractDates(doc)
+
+	want := []string{
+		"2024-03-15T09:30:00Z",
+		"2024-04-01T00:00:00Z",
+		"2024-06-05T00:00:00Z",
+		"next tuesday",
+		"2024-07-20T00:00:00Z",
+		"2023-01-02T00:00:00Z",
+	}
+
+	if len(dates) != len(want) {
+		t.Fatalf("Expected %d dates, got %d: %v", len(want), len(dates), dates)
+	}
+	for i, w := range want {
+		if dates[i] != w {
+			t.Errorf("Date mismatch at index %d: got %v, want %v", i, dates[i], w)
+		}
+	}
+}
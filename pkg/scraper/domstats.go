@@ -0,0 +1,60 @@
+package scraper
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+	"golang.org/x/net/html"
+)
+
+// domStats walks the whole parsed document, before any content filters, and
+// counts its elements.
+func domStats(doc *goquery.Document) *model.DOMStats {
+	stats := &model.DOMStats{}
+	for _, node := range doc.Nodes {
+		walkDOMStats(node, 0, stats)
+	}
+	return stats
+}
+
+// walkDOMStats records n and its descendants, where depth is the number of
+// elements enclosing n.
+func walkDOMStats(n *html.Node, depth int, stats *model.DOMStats) {
+	if n.Type == html.ElementNode {
+		depth++
+		stats.NodeCount++
+		if depth > stats.MaxDepth {
+			stats.MaxDepth = depth
+		}
+
+		switch n.Data {
+		case "script":
+			stats.ScriptCount++
+		case "style":
+			stats.StyleCount++
+		case "link":
+			if isStylesheetLink(n) {
+				stats.StyleCount++
+			}
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		walkDOMStats(child, depth, stats)
+	}
+}
+
+// isStylesheetLink reports whether a <link> element loads a stylesheet.
+func isStylesheetLink(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "rel" {
+			for _, rel := range strings.Fields(attr.Val) {
+				if strings.EqualFold(rel, "stylesheet") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
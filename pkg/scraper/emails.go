@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+var (
+	// emailPattern matches candidate email addresses in running text.
+	emailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}`)
+	// obfuscatedAtPattern matches "@" written out, such as " [at] " or "(at)".
+	obfuscatedAtPattern = regexp.MustCompile(`(?i)\s*[\[({]\s*at\s*[\])}]\s*`)
+	// obfuscatedDotPattern matches "." written out, such as " [dot] " or "(dot)".
+	obfuscatedDotPattern = regexp.MustCompile(`(?i)\s*[\[({]\s*dot\s*[\])}]\s*`)
+)
+
+// extractEmails collects the email addresses in mailto: links and the page
+// text, lowercased and in order of first appearance. Addresses that fail
+// validation are dropped.
+func (s *scraper) extractEmails(doc *goquery.Document) []string {
+	emails := make([]string, 0)
+	seen := make(map[string]bool)
+
+	add := func(candidate string) {
+		email := strings.ToLower(strings.Trim(strings.TrimSpace(candidate), "."))
+		if !seen[email] && utils.IsValidEmail(email) {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+
+	// A mailto: link may list several comma-separated recipients
+	doc.Find(`a[href]`).Each(func(_ int, sel *goquery.Selection) {
+		href := strings.TrimSpace(sel.AttrOr("href", ""))
+		if len(href) < len("mailto:") || !strings.EqualFold(href[:len("mailto:")], "mailto:") {
+			return
+		}
+		recipients, _, _ := strings.Cut(href[len("mailto:"):], "?")
+		if unescaped, err := url.PathUnescape(recipients); err == nil {
+			recipients = unescaped
+		}
+		for _, recipient := range strings.Split(recipients, ",") {
+			add(recipient)
+		}
+	})
+
+	// Scan the visible text, with blocks separated so addresses don't run together
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	var sb strings.Builder
+	for _, node := range body.Nodes {
+		writeText(&sb, node)
+	}
+	text := sb.String()
+	if s.request.DeobfuscateEmails {
+		text = deobfuscateEmails(text)
+	}
+	for _, match := range emailPattern.FindAllString(text, -1) {
+		add(match)
+	}
+
+	return emails
+}
+
+// deobfuscateEmails rewrites spelled-out addresses such as
+// "user [at] example [dot] com" as "user@example.com".
+func deobfuscateEmails(text string) string {
+	text = obfuscatedAtPattern.ReplaceAllString(text, "@")
+	return obfuscatedDotPattern.ReplaceAllString(text, ".")
+}
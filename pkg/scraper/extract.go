@@ -0,0 +1,108 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/llm"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// formatJSON is the LLM extraction format.
+const formatJSON = "json"
+
+// maxExtractChars caps the page markdown sent to the LLM.
+const maxExtractChars = 100000
+
+// defaultExtractSystemPrompt is used when a request doesn't set one.
+const defaultExtractSystemPrompt = "You extract information from web pages. Only use information present in the page content."
+
+// hasFormat reports whether the format was requested.
+func hasFormat(formats []string, format string) bool {
+	for _, f := range formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// extractJSON runs the LLM extraction for the json format over the page
+// markdown. With a schema the result is a JSON object validated against it;
+// with only a prompt it is free-form text. Problems are returned as a warning
+// rather than failing the scrape.
+func (s *Service) extractJSON(req model.ScrapeRequest, result *model.ScrapeResult, markdown string) string {
+	if !hasFormat(req.Formats, formatJSON) || req.JSONOptions == nil {
+		return ""
+	}
+	if s.llm == nil {
+		return "json extraction skipped: no LLM configured"
+	}
+
+	opts := req.JSONOptions
+	system := opts.SystemPrompt
+	if system == "" {
+		system = defaultExtractSystemPrompt
+	}
+
+	if len(markdown) > maxExtractChars {
+		markdown = markdown[:maxExtractChars]
+	}
+
+	var user strings.Builder
+	if opts.Prompt != "" {
+		user.WriteString(opts.Prompt + "\n\n")
+	}
+	if len(opts.Schema) > 0 {
+		schema, err := json.Marshal(opts.Schema)
+		if err != nil {
+			return "json extraction skipped: invalid schema: " + err.Error()
+		}
+		user.WriteString("Reply with a single JSON object that matches this JSON Schema:\n")
+		user.Write(schema)
+		user.WriteString("\n\n")
+	}
+	user.WriteString("Page content:\n")
+	user.WriteString(markdown)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Timeout)*time.Millisecond)
+	defer cancel()
+
+	reply, err := s.llm.Complete(ctx, system, user.String(), len(opts.Schema) > 0)
+	if err != nil {
+		return "json extraction failed: " + err.Error()
+	}
+
+	// Without a schema the reply is the extracted text
+	if len(opts.Schema) == 0 {
+		result.Extract = strings.TrimSpace(reply)
+		return ""
+	}
+
+	var extracted map[string]interface{}
+	if err := json.Unmarshal([]byte(stripCodeFence(reply)), &extracted); err != nil {
+		return fmt.Sprintf("json extraction failed: LLM reply is not a JSON object: %v", err)
+	}
+	result.JSON = extracted
+
+	if problems := llm.ValidateSchema(extracted, opts.Schema); len(problems) > 0 {
+		return "json does not match schema: " + strings.Join(problems, "; ")
+	}
+	return ""
+}
+
+// stripCodeFence removes a markdown code fence around a model reply.
+func stripCodeFence(reply string) string {
+	reply = strings.TrimSpace(reply)
+	if !strings.HasPrefix(reply, "```") {
+		return reply
+	}
+	reply = strings.TrimPrefix(reply, "```")
+	if newline := strings.IndexByte(reply, '\n'); newline >= 0 {
+		reply = reply[newline+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(reply), "```"))
+}
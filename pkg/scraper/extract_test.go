@@ -0,0 +1,139 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/llm"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// newFakeLLM answers every completion with the given content and records the
+// last user prompt.
+func newFakeLLM(content string, prompt *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if prompt != nil && len(req.Messages) > 1 {
+			*prompt = req.Messages[1].Content
+		}
+
+		reply, _ := json.Marshal(content)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":` + string(reply) + `}}]}`))
+	}))
+}
+
+func TestScrapeJSONExtraction(t *testing.T) {
+	page := newTestServer(`<html><body><h1>Desk Lamp</h1><p>Price: $19.99</p></body></html>`)
+	defer page.Close()
+
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name", "price"},
+		"properties": map[string]interface{}{
+			"name":  map[string]interface{}{"type": "string"},
+			"price": map[string]interface{}{"type": "number"},
+		},
+	}
+
+	t.Run("Schema", func(t *testing.T) {
+		var prompt string
+		fake := newFakeLLM("```json\n{\"name\": \"Desk Lamp\", \"price\": 19.99}\n```", &prompt)
+		defer fake.Close()
+
+		service := NewServiceWithOptions(ServiceOptions{LLM: llm.NewClient(llm.Options{BaseURL: fake.URL})})
+		result, err := service.Scrape(model.ScrapeRequest{
+			URL: page.URL,
+			ScrapeOptions: model.ScrapeOptions{
+				Formats:     []string{"json"},
+				JSONOptions: &model.JSONOptions{Schema: schema},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to scrape: %v", err)
+		}
+
+		if result.JSON["name"] != "Desk Lamp" || result.JSON["price"] != 19.99 {
+			t.Errorf("Unexpected extracted JSON %v", result.JSON)
+		}
+		if result.Warning != "" {
+			t.Errorf("Expected no warning, got %q", result.Warning)
+		}
+		if result.Markdown != "" {
+			t.Error("Expected markdown to be omitted when only json is requested")
+		}
+		if !strings.Contains(prompt, "Desk Lamp") {
+			t.Errorf("Expected the page markdown in the prompt, got %q", prompt)
+		}
+	})
+
+	t.Run("Schema mismatch", func(t *testing.T) {
+		fake := newFakeLLM(`{"name": "Desk Lamp", "price": "cheap"}`, nil)
+		defer fake.Close()
+
+		service := NewServiceWithOptions(ServiceOptions{LLM: llm.NewClient(llm.Options{BaseURL: fake.URL})})
+		result, err := service.Scrape(model.ScrapeRequest{
+			URL: page.URL,
+			ScrapeOptions: model.ScrapeOptions{
+				Formats:     []string{"json"},
+				JSONOptions: &model.JSONOptions{Schema: schema},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to scrape: %v", err)
+		}
+		if !strings.Contains(result.Warning, "$.price: expected number") {
+			t.Errorf("Expected a schema validation warning, got %q", result.Warning)
+		}
+	})
+
+	t.Run("Prompt only", func(t *testing.T) {
+		fake := newFakeLLM("The lamp costs $19.99.", nil)
+		defer fake.Close()
+
+		service := NewServiceWithOptions(ServiceOptions{LLM: llm.NewClient(llm.Options{BaseURL: fake.URL})})
+		result, err := service.Scrape(model.ScrapeRequest{
+			URL: page.URL,
+			ScrapeOptions: model.ScrapeOptions{
+				Formats:     []string{"json"},
+				JSONOptions: &model.JSONOptions{Prompt: "How much is the lamp?"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to scrape: %v", err)
+		}
+		if result.Extract != "The lamp costs $19.99." || result.JSON != nil {
+			t.Errorf("Expected free-form extract, got %q and %v", result.Extract, result.JSON)
+		}
+	})
+
+	t.Run("No LLM configured", func(t *testing.T) {
+		result, err := NewService().Scrape(model.ScrapeRequest{
+			URL: page.URL,
+			ScrapeOptions: model.ScrapeOptions{
+				Formats:     []string{"json"},
+				JSONOptions: &model.JSONOptions{Prompt: "How much is the lamp?"},
+			},
+		})
+		if err != nil {
+			t.Fatalf("Failed to scrape: %v", err)
+		}
+		if !strings.Contains(result.Warning, "no LLM configured") {
+			t.Errorf("Expected a warning without an LLM, got %q", result.Warning)
+		}
+	})
+
+	t.Run("Missing options", func(t *testing.T) {
+		if _, err := NewService().Scrape(model.ScrapeRequest{URL: page.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"json"}}}); err == nil {
+			t.Error("Expected an error for the json format without jsonOptions")
+		}
+	})
+}
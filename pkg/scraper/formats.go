@@ -0,0 +1,106 @@
+package scraper
+
+import "github.com/ncecere/rummage/pkg/model"
+
+// formats are the output formats the scraper can produce.
+var formats = []string{
+	"markdown",
+	"html",
+	"rawHtml",
+	"links",
+	"text",
+	"index",
+	"dates",
+	"breadcrumbs",
+	"jsonLd",
+	"structured",
+	"emails",
+}
+
+// formatAliases maps alternative format names used by other scrapers to the
+// formats above.
+var formatAliases = map[string]string{
+	"md":       "markdown",
+	"raw":      "rawHtml",
+	"raw_html": "rawHtml",
+	"txt":      "text",
+}
+
+// normalizeFormats replaces format aliases with their canonical names,
+// dropping duplicates.
+func normalizeFormats(requested []string) []string {
+	normalized := make([]string, 0, len(requested))
+	seen := make(map[string]bool, len(requested))
+	for _, format := range requested {
+		if canonical, ok := formatAliases[format]; ok {
+			format = canonical
+		}
+		if !seen[format] {
+			seen[format] = true
+			normalized = append(normalized, format)
+		}
+	}
+	return normalized
+}
+
+// Formats returns the output formats the service supports. The json and
+// screenshot formats are only listed when an LLM or a browser backend is
+// available.
+func (s *Service) Formats() []string {
+	supported := append([]string(nil), formats...)
+	if s.llm != nil {
+		supported = append(supported, formatJSON)
+	}
+	if s.HasBrowser() {
+		supported = append(supported, formatScreenshot, formatScreenshotFullPage)
+	}
+	return supported
+}
+
+// HasBrowser reports whether a browser backend is available for formats that
+// need page rendering, such as screenshots.
+func (s *Service) HasBrowser() bool {
+	return s.browser != nil
+}
+
+// populatedFormats returns the requested formats that the result holds
+// content for, in the order requested. Formats that produced nothing, such as
+// links on a page without any, are left out.
+func populatedFormats(requested []string, result *model.ScrapeResult) []string {
+	populated := []string{}
+	for _, format := range normalizeFormats(requested) {
+		var ok bool
+		switch format {
+		case "markdown":
+			ok = result.Markdown != ""
+		case "html":
+			ok = result.HTML != ""
+		case "rawHtml":
+			ok = result.RawHTML != ""
+		case "links":
+			ok = len(result.Links) > 0 || len(result.LinkDetails) > 0
+		case "text":
+			ok = result.Text != ""
+		case "index":
+			ok = result.IndexText != ""
+		case "dates":
+			ok = len(result.Dates) > 0
+		case "breadcrumbs":
+			ok = len(result.Breadcrumbs) > 0
+		case "jsonLd":
+			ok = len(result.JSONLD) > 0
+		case "structured":
+			ok = len(result.StructuredData) > 0
+		case "emails":
+			ok = len(result.Emails) > 0
+		case formatJSON:
+			ok = len(result.JSON) > 0 || result.Extract != ""
+		case formatScreenshot, formatScreenshotFullPage:
+			ok = result.Screenshot != ""
+		}
+		if ok {
+			populated = append(populated, format)
+		}
+	}
+	return populated
+}
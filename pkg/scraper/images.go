@@ -0,0 +1,33 @@
+package scraper
+
+import (
+	"strings"
+
+	html2md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// imageRules returns the converter rules for an image handling mode. Kept
+// images use the converter's default rule.
+func imageRules(mode string) []html2md.Rule {
+	switch mode {
+	case model.ImageHandlingStrip:
+		return []html2md.Rule{{
+			Filter: []string{"img"},
+			Replacement: func(_ string, _ *goquery.Selection, _ *html2md.Options) *string {
+				return html2md.String("")
+			},
+		}}
+	case model.ImageHandlingAlt:
+		return []html2md.Rule{{
+			Filter: []string{"img"},
+			Replacement: func(_ string, selec *goquery.Selection, _ *html2md.Options) *string {
+				alt := strings.Join(strings.Fields(selec.AttrOr("alt", "")), " ")
+				return html2md.String(alt)
+			},
+		}}
+	default:
+		return nil
+	}
+}
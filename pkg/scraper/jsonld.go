@@ -0,0 +1,191 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// jsonLDObjects parses every JSON-LD script block in the document and returns
+// the top-level objects, flattening arrays and @graph containers.
+func jsonLDObjects(doc *goquery.Document) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0)
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, sel *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(sel.Text())), &data); err != nil {
+			return
+		}
+		objects = append(objects, flattenJSONLD(data)...)
+	})
+
+	return objects
+}
+
+// flattenJSONLD expands arrays and @graph containers into a flat object list.
+func flattenJSONLD(data interface{}) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0)
+
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			objects = append(objects, flattenJSONLD(item)...)
+		}
+	case map[string]interface{}:
+		if graph, ok := v["@graph"]; ok {
+			objects = append(objects, flattenJSONLD(graph)...)
+		}
+		objects = append(objects, v)
+	}
+
+	return objects
+}
+
+// jsonLDHasType reports whether a JSON-LD object has the given @type.
+func jsonLDHasType(obj map[string]interface{}, typeName string) bool {
+	switch t := obj["@type"].(type) {
+	case string:
+		return t == typeName
+	case []interface{}:
+		for _, item := range t {
+			if s, ok := item.(string); ok && s == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonLDString returns a string field from a JSON-LD object.
+func jsonLDString(obj map[string]interface{}, key string) string {
+	if s, ok := obj[key].(string); ok {
+		return strings.TrimSpace(s)
+	}
+	return ""
+}
+
+// jsonLDURLKeys are the JSON-LD properties whose string values are URLs.
+var jsonLDURLKeys = map[string]bool{
+	"@id":              true,
+	"url":              true,
+	"image":            true,
+	"logo":             true,
+	"photo":            true,
+	"thumbnailUrl":     true,
+	"contentUrl":       true,
+	"embedUrl":         true,
+	"downloadUrl":      true,
+	"sameAs":           true,
+	"item":             true,
+	"mainEntityOfPage": true,
+}
+
+// extractJSONLD returns every JSON-LD script block in the document as
+// parsed, resolving relative URLs when resolveStructuredUrls is set.
+func (s *scraper) extractJSONLD(doc *goquery.Document, pageURL *url.URL) []interface{} {
+	blocks := make([]interface{}, 0)
+	base := s.structuredBase(pageURL)
+
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, sel *goquery.Selection) {
+		var data interface{}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(sel.Text())), &data); err != nil {
+			return
+		}
+		if base != nil {
+			resolveJSONLDURLs(data, base)
+		}
+		blocks = append(blocks, data)
+	})
+
+	return blocks
+}
+
+// extractStructuredData returns every JSON-LD object in the document, with
+// arrays and @graph containers expanded, resolving relative URLs when
+// resolveStructuredUrls is set. Blocks that fail to parse are skipped.
+func (s *scraper) extractStructuredData(doc *goquery.Document, pageURL *url.URL) []map[string]interface{} {
+	objects := make([]map[string]interface{}, 0)
+	base := s.structuredBase(pageURL)
+
+	for _, obj := range jsonLDObjects(doc) {
+		// A bare @graph container adds nothing beyond the objects it holds
+		if isGraphContainer(obj) {
+			continue
+		}
+		if base != nil {
+			resolveJSONLDURLs(obj, base)
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects
+}
+
+// isGraphContainer reports whether a JSON-LD object only wraps a @graph.
+func isGraphContainer(obj map[string]interface{}) bool {
+	if _, ok := obj["@graph"]; !ok {
+		return false
+	}
+	for key := range obj {
+		if key != "@graph" && key != "@context" {
+			return false
+		}
+	}
+	return true
+}
+
+// structuredBase returns the URL that relative URLs in structured data
+// resolve against: the base URL override, or the page URL. It returns nil
+// unless resolveStructuredUrls is set.
+func (s *scraper) structuredBase(pageURL *url.URL) *url.URL {
+	if !s.request.ResolveStructuredURLs {
+		return nil
+	}
+	if s.request.BaseURLOverride != "" {
+		if base, err := url.Parse(s.request.BaseURLOverride); err == nil {
+			return base
+		}
+	}
+	return pageURL
+}
+
+// resolveJSONLDURLs rewrites relative URLs under URL-bearing keys in a
+// parsed JSON-LD value in place, at any depth.
+func resolveJSONLDURLs(data interface{}, base *url.URL) {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			resolveJSONLDURLs(item, base)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			if jsonLDURLKeys[key] {
+				v[key] = resolveJSONLDValue(value, base)
+			}
+			resolveJSONLDURLs(value, base)
+		}
+	}
+}
+
+// resolveJSONLDValue resolves a URL value, or each URL in a list of them.
+// Strings that can't be URLs, such as ones containing spaces, are kept.
+func resolveJSONLDValue(value interface{}, base *url.URL) interface{} {
+	switch v := value.(type) {
+	case string:
+		if strings.ContainsAny(strings.TrimSpace(v), " \t\n") {
+			return v
+		}
+		if resolved, ok := resolveURL(base, v); ok {
+			return resolved
+		}
+	case []interface{}:
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				v[i] = resolveJSONLDValue(s, base)
+			}
+		}
+	}
+	return value
+}
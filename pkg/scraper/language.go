@@ -0,0 +1,44 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// baseLanguage returns the lowercase primary subtag of a language tag, such
+// as "en" for "en-US".
+func baseLanguage(language string) string {
+	base := strings.ToLower(strings.TrimSpace(language))
+	if i := strings.IndexAny(base, "-_"); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// languageAccepted reports whether the page language matches an entry in the
+// allowlist. A bare entry like "en" accepts every regional variant, while
+// "en-GB" accepts only that variant.
+func languageAccepted(language string, accepted []string) bool {
+	normalized := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(language)), "_", "-")
+	for _, want := range accepted {
+		want = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(want)), "_", "-")
+		if want == normalized || (!strings.Contains(want, "-") && want == baseLanguage(language)) {
+			return true
+		}
+	}
+	return false
+}
+
+// languageMismatch explains why a page's language isn't in the request's
+// allowlist. Pages that don't declare a language are let through.
+func languageMismatch(req model.ScrapeRequest, result *model.ScrapeResult) string {
+	if len(req.AcceptLanguages) == 0 || result.Metadata == nil || result.Metadata.Language == "" {
+		return ""
+	}
+	if languageAccepted(result.Metadata.Language, req.AcceptLanguages) {
+		return ""
+	}
+	return fmt.Sprintf("page language %q is not in acceptLanguages", result.Metadata.Language)
+}
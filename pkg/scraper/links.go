@@ -0,0 +1,54 @@
+package scraper
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// extractLinkDetails extracts all links from the document along with whether
+// they point at the scraped page's host and their rel attribute.
+func (s *scraper) extractLinkDetails(doc *goquery.Document) []model.LinkDetail {
+	links := make([]model.LinkDetail, 0)
+
+	pageURL, err := url.Parse(s.request.URL)
+	if err != nil {
+		return links
+	}
+	base := s.baseHref(doc)
+
+	s.tagFilteredDocument(doc).Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
+		href, exists := sel.Attr("href")
+		if !exists || href == "" || href[0] == '#' {
+			return
+		}
+
+		// Relative links are relative to the page's <base href>, not its URL
+		if base != nil {
+			if resolved, ok := resolveURL(base, href); ok {
+				href = resolved
+			}
+		}
+
+		links = append(links, model.LinkDetail{
+			URL:      href,
+			Internal: isInternalLink(pageURL, href, s.request.InternalHosts),
+			Rel:      strings.TrimSpace(sel.AttrOr("rel", "")),
+		})
+	})
+
+	return links
+}
+
+// isInternalLink reports whether href resolves to the same host as the page,
+// or to one of internalHosts.
+func isInternalLink(pageURL *url.URL, href string, internalHosts []string) bool {
+	linkURL, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	return utils.IsInternalHost(pageURL.ResolveReference(linkURL).Hostname(), pageURL.Hostname(), internalHosts)
+}
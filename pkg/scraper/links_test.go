@@ -0,0 +1,81 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestExtractLinkDetails(t *testing.T) {
+	html := `<html><body>
+		<a href="/about">About</a>
+		<a href="contact">Contact</a>
+		<a href="https://www.example.com/blog">Blog</a>
+		<a href="https://EXAMPLE.com/docs">Docs</a>
+		<a href="https://other.org/" rel="nofollow noopener">Other</a>
+		<a href="//cdn.example.net/file">CDN</a>
+		<a href="#section">Skip</a>
+	</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	s := newScraper(nil, model.ScrapeRequest{URL: "https://example.com/index.html"})
+	links := s.extractLinkDetails(doc)
+
+	want := []model.LinkDetail{
+		{URL: "/about", Internal: true},
+		{URL: "contact", Internal: true},
+		{URL: "https://www.example.com/blog", Internal: false},
+		{URL: "https://EXAMPLE.com/docs", Internal: true},
+		{URL: "https://other.org/", Internal: false, Rel: "nofollow noopener"},
+		{URL: "//cdn.example.net/file", Internal: false},
+	}
+
+	if len(links) != len(want) {
+		t.Fatalf("Expected %d links, got %d", len(want), len(links))
+	}
+	for i, w := range want {
+		if links[i] != w {
+			t.Errorf("Link mismatch at index %d: got %+v, want %+v", i, links[i], w)
+		}
+	}
+}
+
+func TestExtractLinkDetailsInternalHosts(t *testing.T) {
+	html := `<html><body>
+		<a href="//cdn.example.net/file">CDN</a>
+		<a href="https://other.org/">Other</a>
+	</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	s := newScraper(nil, model.ScrapeRequest{
+		URL: "https://example.com/index.html",
+		ScrapeOptions: model.ScrapeOptions{
+			InternalHosts: []string{"cdn.example.net"},
+		},
+	})
+	links := s.extractLinkDetails(doc)
+
+	want := []model.LinkDetail{
+		{URL: "//cdn.example.net/file", Internal: true},
+		{URL: "https://other.org/", Internal: false},
+	}
+
+	if len(links) != len(want) {
+		t.Fatalf("Expected %d links, got %d", len(want), len(links))
+	}
+	for i, w := range want {
+		if links[i] != w {
+			t.Errorf("Link mismatch at index %d: got %+v, want %+v", i, links[i], w)
+		}
+	}
+}
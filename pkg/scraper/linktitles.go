@@ -0,0 +1,51 @@
+package scraper
+
+import (
+	"strings"
+
+	html2md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/PuerkitoBio/goquery"
+)
+
+// linkTitleRules returns converter rules that label links without visible
+// text with their title or aria-label attribute. The converter already does
+// this for empty links, but image-only links render as a bare image; here the
+// label is appended after it.
+func linkTitleRules() []html2md.Rule {
+	return []html2md.Rule{{
+		Filter: []string{"a"},
+		Replacement: func(content string, selec *goquery.Selection, _ *html2md.Options) *string {
+			href, ok := selec.Attr("href")
+			if !ok || strings.TrimSpace(selec.Text()) != "" {
+				// Fall back to the default link rule
+				return nil
+			}
+
+			label := linkLabel(selec)
+			if label == "" {
+				return nil
+			}
+
+			text := escapeLinkText(label)
+			if content = strings.TrimSpace(content); content != "" {
+				text = content + " " + text
+			}
+			return html2md.String("[" + text + "](" + strings.TrimSpace(href) + ")")
+		},
+	}}
+}
+
+// linkLabel returns the link's title or aria-label, whitespace-collapsed.
+func linkLabel(selec *goquery.Selection) string {
+	for _, attr := range []string{"title", "aria-label"} {
+		if label := strings.Join(strings.Fields(selec.AttrOr(attr, "")), " "); label != "" {
+			return label
+		}
+	}
+	return ""
+}
+
+// escapeLinkText escapes brackets that would end the markdown link text early.
+func escapeLinkText(text string) string {
+	return strings.NewReplacer("[", `\[`, "]", `\]`).Replace(text)
+}
@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/chromedp/cdproto/browser"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// place is where the browser claims to be for a country: its capital's time
+// zone and coordinates.
+type place struct {
+	timezone  string
+	latitude  float64
+	longitude float64
+}
+
+// countryPlaces maps ISO 3166-1 alpha-2 country codes to the place emulated
+// for them.
+var countryPlaces = map[string]place{
+	"AR": {"America/Argentina/Buenos_Aires", -34.6037, -58.3816},
+	"AT": {"Europe/Vienna", 48.2082, 16.3738},
+	"AU": {"Australia/Sydney", -33.8688, 151.2093},
+	"BE": {"Europe/Brussels", 50.8503, 4.3517},
+	"BR": {"America/Sao_Paulo", -23.5505, -46.6333},
+	"CA": {"America/Toronto", 43.6532, -79.3832},
+	"CH": {"Europe/Zurich", 47.3769, 8.5417},
+	"CL": {"America/Santiago", -33.4489, -70.6693},
+	"CN": {"Asia/Shanghai", 39.9042, 116.4074},
+	"CZ": {"Europe/Prague", 50.0755, 14.4378},
+	"DE": {"Europe/Berlin", 52.5200, 13.4050},
+	"DK": {"Europe/Copenhagen", 55.6761, 12.5683},
+	"EG": {"Africa/Cairo", 30.0444, 31.2357},
+	"ES": {"Europe/Madrid", 40.4168, -3.7038},
+	"FI": {"Europe/Helsinki", 60.1699, 24.9384},
+	"FR": {"Europe/Paris", 48.8566, 2.3522},
+	"GB": {"Europe/London", 51.5074, -0.1278},
+	"GR": {"Europe/Athens", 37.9838, 23.7275},
+	"HK": {"Asia/Hong_Kong", 22.3193, 114.1694},
+	"ID": {"Asia/Jakarta", -6.2088, 106.8456},
+	"IE": {"Europe/Dublin", 53.3498, -6.2603},
+	"IL": {"Asia/Jerusalem", 31.7683, 35.2137},
+	"IN": {"Asia/Kolkata", 28.6139, 77.2090},
+	"IT": {"Europe/Rome", 41.9028, 12.4964},
+	"JP": {"Asia/Tokyo", 35.6762, 139.6503},
+	"KR": {"Asia/Seoul", 37.5665, 126.9780},
+	"MX": {"America/Mexico_City", 19.4326, -99.1332},
+	"NG": {"Africa/Lagos", 6.5244, 3.3792},
+	"NL": {"Europe/Amsterdam", 52.3676, 4.9041},
+	"NO": {"Europe/Oslo", 59.9139, 10.7522},
+	"NZ": {"Pacific/Auckland", -36.8485, 174.7633},
+	"PL": {"Europe/Warsaw", 52.2297, 21.0122},
+	"PT": {"Europe/Lisbon", 38.7223, -9.1393},
+	"RU": {"Europe/Moscow", 55.7558, 37.6173},
+	"SE": {"Europe/Stockholm", 59.3293, 18.0686},
+	"SG": {"Asia/Singapore", 1.3521, 103.8198},
+	"TR": {"Europe/Istanbul", 41.0082, 28.9784},
+	"TW": {"Asia/Taipei", 25.0330, 121.5654},
+	"UA": {"Europe/Kyiv", 50.4501, 30.5234},
+	"US": {"America/New_York", 40.7128, -74.0060},
+	"ZA": {"Africa/Johannesburg", -26.2041, 28.0473},
+}
+
+// requestHeaders returns the headers to send for the request: an
+// Accept-Language header for its location's languages, overridden by any
+// headers the request sets itself.
+func requestHeaders(req model.ScrapeRequest) map[string]string {
+	acceptLanguage := req.Location.AcceptLanguage()
+	if acceptLanguage == "" {
+		return req.Headers
+	}
+
+	headers := make(map[string]string, len(req.Headers)+1)
+	headers["Accept-Language"] = acceptLanguage
+	for key, value := range req.Headers {
+		headers[http.CanonicalHeaderKey(key)] = value
+	}
+	return headers
+}
+
+// emulateLocation returns the browser steps that make a page see the
+// location: its first language as the locale and, for a known country, the
+// country's time zone and geolocation.
+func emulateLocation(loc *model.LocationOptions) chromedp.Tasks {
+	tasks := chromedp.Tasks{}
+	if len(loc.Languages) > 0 {
+		tasks = append(tasks, emulation.SetLocaleOverride().WithLocale(loc.Languages[0]))
+	}
+
+	if p, ok := countryPlaces[strings.ToUpper(loc.Country)]; ok {
+		tasks = append(tasks,
+			emulation.SetTimezoneOverride(p.timezone),
+			browser.GrantPermissions([]browser.PermissionType{browser.PermissionTypeGeolocation}),
+			emulation.SetGeolocationOverride().WithLatitude(p.latitude).WithLongitude(p.longitude).WithAccuracy(100),
+		)
+	}
+	return tasks
+}
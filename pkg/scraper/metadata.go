@@ -0,0 +1,52 @@
+package scraper
+
+import (
+	"net/url"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// extractDocumentMetadata fills in the author, keywords, canonical URL, Open
+// Graph fields, theme color and publication dates. URLs are resolved against the page URL
+// and dates normalized to RFC 3339 where parseable.
+func extractDocumentMetadata(doc *goquery.Document, meta *model.ScrapeMetadata, pageURL *url.URL) {
+	meta.Author = utils.GetMetaContent(doc, "author")
+	meta.Keywords = utils.GetMetaContent(doc, "keywords")
+	meta.OGTitle = utils.GetMetaContent(doc, "og:title")
+	meta.OGDescription = utils.GetMetaContent(doc, "og:description")
+	meta.OGImage = resolveMetaURL(pageURL, utils.GetMetaContent(doc, "og:image"))
+	meta.CanonicalURL = resolveMetaURL(pageURL, doc.Find(`link[rel="canonical"]`).First().AttrOr("href", ""))
+	meta.ThemeColor = themeColor(doc)
+
+	meta.PublishedTime = utils.GetMetaContent(doc, "article:published_time")
+	meta.ModifiedTime = utils.GetMetaContent(doc, "article:modified_time")
+	if meta.PublishedTime == "" || meta.ModifiedTime == "" {
+		for _, obj := range jsonLDObjects(doc) {
+			if meta.PublishedTime == "" {
+				meta.PublishedTime = jsonLDString(obj, "datePublished")
+			}
+			if meta.ModifiedTime == "" {
+				meta.ModifiedTime = jsonLDString(obj, "dateModified")
+			}
+		}
+	}
+	if meta.PublishedTime != "" {
+		meta.PublishedTime = normalizeDate(meta.PublishedTime)
+	}
+	if meta.ModifiedTime != "" {
+		meta.ModifiedTime = normalizeDate(meta.ModifiedTime)
+	}
+}
+
+// resolveMetaURL resolves a URL from a meta or link tag against the page URL,
+// returning it as written when it can't be resolved.
+func resolveMetaURL(pageURL *url.URL, ref string) string {
+	if pageURL != nil {
+		if resolved, ok := resolveURL(pageURL, ref); ok {
+			return resolved
+		}
+	}
+	return ref
+}
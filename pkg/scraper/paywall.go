@@ -0,0 +1,125 @@
+package scraper
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// paywallTruncatedLength is the article text length below which a subscribe
+// prompt marks the page as paywalled.
+const paywallTruncatedLength = 1500
+
+// DefaultPaywallMarkers are the CSS selectors of paywall overlays and gated
+// content containers used when no markers are configured.
+var DefaultPaywallMarkers = []string{
+	"[class*=paywall]",
+	"[id*=paywall]",
+	"[data-paywall]",
+	".regwall",
+	".meteredContent",
+	".tp-modal",
+	".piano-offer",
+	".subscriber-only",
+	".premium-content",
+}
+
+// paywallPrompts are the subscribe calls to action that, in a short article,
+// mark the rest of it as held back.
+var paywallPrompts = []string{
+	"subscribe to continue reading",
+	"subscribe to read",
+	"subscribe to keep reading",
+	"subscribe to unlock",
+	"to continue reading, please",
+	"sign in to continue reading",
+	"log in to continue reading",
+	"already a subscriber",
+	"this article is for subscribers",
+	"this content is for subscribers",
+	"exclusive to subscribers",
+}
+
+// paywallDetector flags pages whose content is likely behind a paywall.
+type paywallDetector struct {
+	markers []cascadia.Selector
+}
+
+// newPaywallDetector creates a detector matching the given CSS selectors.
+// Selectors that don't parse are ignored.
+func newPaywallDetector(markers []string) *paywallDetector {
+	if len(markers) == 0 {
+		markers = DefaultPaywallMarkers
+	}
+
+	compiled := make([]cascadia.Selector, 0, len(markers))
+	for _, marker := range markers {
+		if sel, err := cascadia.Compile(strings.TrimSpace(marker)); err == nil {
+			compiled = append(compiled, sel)
+		}
+	}
+
+	return &paywallDetector{markers: compiled}
+}
+
+// isPaywalled reports whether the page looks paywalled: its JSON-LD marks it
+// as not free to access, it contains a paywall marker, or its article is short
+// and ends in a subscribe prompt.
+func (d *paywallDetector) isPaywalled(doc *goquery.Document) bool {
+	for _, obj := range jsonLDObjects(doc) {
+		if notAccessibleForFree(obj) {
+			return true
+		}
+	}
+
+	for _, marker := range d.markers {
+		if doc.FindMatcher(marker).Length() > 0 {
+			return true
+		}
+	}
+
+	article := doc.Find("article, main").First()
+	if article.Length() == 0 {
+		article = doc.Find("body")
+	}
+	text := strings.Join(strings.Fields(article.Text()), " ")
+	if len(text) >= paywallTruncatedLength {
+		return false
+	}
+
+	prompt := strings.ToLower(pageText(doc))
+	for _, phrase := range paywallPrompts {
+		if strings.Contains(prompt, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// notAccessibleForFree reports whether a JSON-LD object, or one of its parts,
+// sets isAccessibleForFree to false.
+func notAccessibleForFree(obj map[string]interface{}) bool {
+	switch free := obj["isAccessibleForFree"].(type) {
+	case bool:
+		if !free {
+			return true
+		}
+	case string:
+		if strings.EqualFold(strings.TrimSpace(free), "false") {
+			return true
+		}
+	}
+
+	switch parts := obj["hasPart"].(type) {
+	case map[string]interface{}:
+		return notAccessibleForFree(parts)
+	case []interface{}:
+		for _, part := range parts {
+			if p, ok := part.(map[string]interface{}); ok && notAccessibleForFree(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
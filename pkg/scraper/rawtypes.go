@@ -0,0 +1,53 @@
+package scraper
+
+import (
+	"errors"
+	"mime"
+	"strings"
+)
+
+// DefaultRawContentTypes are the media types the rawHtml format returns by
+// default: images, JSON, XML and text, including HTML.
+var DefaultRawContentTypes = []string{
+	"image/*",
+	"text/*",
+	"application/json",
+	"application/*+json",
+	"application/xml",
+	"application/*+xml",
+	"application/xhtml+xml",
+}
+
+// ErrRawContentType is returned when the rawHtml format is requested for a
+// page whose media type isn't allowed.
+var ErrRawContentType = errors.New("content type not allowed for the rawHtml format")
+
+// mediaTypeAllowed reports whether a Content-Type header's media type matches
+// one of the allowed patterns. A pattern is a media type such as
+// "application/json", a wildcard subtype such as "image/*" or "*/*", or a
+// structured suffix such as "application/*+json". A missing or unparsable
+// Content-Type matches nothing.
+func mediaTypeAllowed(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	typ, subtype, ok := strings.Cut(mediaType, "/")
+	if !ok {
+		return false
+	}
+
+	for _, pattern := range allowed {
+		patternType, patternSubtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(pattern)), "/")
+		if !ok || (patternType != "*" && patternType != typ) {
+			continue
+		}
+		switch {
+		case patternSubtype == "*", patternSubtype == subtype:
+			return true
+		case strings.HasPrefix(patternSubtype, "*+") && strings.HasSuffix(subtype, patternSubtype[1:]):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package scraper
+
+import "testing"
+
+func TestMediaTypeAllowed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"image/png", true},
+		{"application/json", true},
+		{"application/ld+json", true},
+		{"application/rss+xml", true},
+		{"APPLICATION/XML", true},
+		{"application/octet-stream", false},
+		{"application/zip", false},
+		{"video/mp4", false},
+		{"", false},
+		{"not a media type", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := mediaTypeAllowed(tt.contentType, DefaultRawContentTypes); got != tt.want {
+				t.Errorf("mediaTypeAllowed(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+
+	if !mediaTypeAllowed("application/zip", []string{"*/*"}) {
+		t.Error("Expected */* to allow any media type")
+	}
+}
@@ -2,8 +2,10 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
@@ -13,12 +15,35 @@ import (
 
 // scraper handles the scraping of a single URL.
 type scraper struct {
-	client  *http.Client
-	request model.ScrapeRequest
+	client    *http.Client
+	request   model.ScrapeRequest
+	userAgent string
+	soft404   *soft404Detector
+	paywall   *paywallDetector
+	// rawContentTypes are the media types rawHtml may return; nil allows any
+	rawContentTypes []string
+	// maxResponseBytes caps the body read; truncated records that it was hit
+	maxResponseBytes int
+	truncated        bool
+	// originalTruncated records that originalHtml was cut at its own cap
+	originalTruncated bool
+	// rendered replaces the HTTP fetch with a page the browser rendered
+	rendered *RenderedPage
+	// streamMarkdown keeps the filtered page in markdownDoc instead of
+	// converting it, so it can be streamed block by block
+	streamMarkdown bool
+	markdownDoc    *goquery.Document
+	// ctx aborts the fetch when cancelled; nil never aborts
+	ctx context.Context
 }
 
 // newScraper creates a new scraper for the given request.
 func newScraper(client *http.Client, req model.ScrapeRequest) *scraper {
+	// Self-signed hosts and proxies need a transport of their own
+	if req.SkipTlsVerification || req.Proxy != "" {
+		client = requestClient(client, req)
+	}
+
 	return &scraper{
 		client:  client,
 		request: req,
@@ -27,15 +52,58 @@ func newScraper(client *http.Client, req model.ScrapeRequest) *scraper {
 
 // scrape performs the scraping operation and returns the result.
 func (s *scraper) scrape() (*model.ScrapeResult, error) {
+	userAgent := s.userAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
 	c := colly.NewCollector(
-		colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"),
+		colly.UserAgent(userAgent),
 	)
 
+	var transport http.RoundTripper
+	if s.client != nil && s.client.Transport != nil {
+		transport = s.client.Transport
+	}
+	if s.rendered != nil {
+		transport = renderedTransport{html: s.rendered.HTML}
+	}
+
+	// Abort the fetch if the job is cancelled
+	if s.ctx != nil && s.ctx.Done() != nil {
+		transport = newCancelTransport(transport, s.ctx)
+	}
+
+	// Trace the connection when connection info is requested
+	var connInfo *connInfoTransport
+	if s.request.IncludeConnectionInfo {
+		connInfo = newConnInfoTransport(transport)
+		transport = connInfo
+	}
+
+	// Count the bytes on the wire when requested; a rendered page has
+	// already been fetched by the browser
+	var byteCount *byteCountTransport
+	if s.request.IncludeByteCounts && s.rendered == nil {
+		byteCount = newByteCountTransport(transport)
+		transport = byteCount
+	}
+
+	if transport != nil {
+		c.WithTransport(transport)
+	}
+
 	c.SetRequestTimeout(time.Duration(s.request.Timeout) * time.Millisecond)
 
-	if len(s.request.Headers) > 0 {
+	// Read one byte past the cap so a truncated body can be told apart
+	s.truncated = false
+	if s.maxResponseBytes > 0 {
+		c.MaxBodySize = s.maxResponseBytes + 1
+	}
+
+	if headers := requestHeaders(s.request); len(headers) > 0 {
 		c.OnRequest(func(r *colly.Request) {
-			for key, value := range s.request.Headers {
+			for key, value := range headers {
 				r.Headers.Set(key, value)
 			}
 		})
@@ -47,14 +115,33 @@ func (s *scraper) scrape() (*model.ScrapeResult, error) {
 		},
 	}
 
-	if s.request.WaitFor > 0 {
-		c.OnRequest(func(r *colly.Request) {
-			time.Sleep(time.Duration(s.request.WaitFor) * time.Millisecond)
-		})
-	}
+	var regionErr, rawErr error
 
 	c.OnResponse(func(r *colly.Response) {
+		// Give the page its fixed wait once it has been received
+		if s.request.WaitFor > 0 {
+			time.Sleep(time.Duration(s.request.WaitFor) * time.Millisecond)
+		}
+
+		if s.maxResponseBytes > 0 && len(r.Body) > s.maxResponseBytes {
+			r.Body = r.Body[:s.maxResponseBytes]
+			s.truncated = true
+		}
+
 		result.Metadata.StatusCode = r.StatusCode
+		result.Metadata.ContentType = r.Headers.Get("Content-Type")
+
+		// Raw bodies are only passed through for allowed media types
+		if hasFormat(s.request.Formats, "rawHtml") && s.rawContentTypes != nil && !mediaTypeAllowed(result.Metadata.ContentType, s.rawContentTypes) {
+			rawErr = fmt.Errorf("%w: %q", ErrRawContentType, result.Metadata.ContentType)
+			return
+		}
+
+		// Keep the body as served, before anything rewrites the document, for
+		// comparing with the filtered output
+		if s.request.IncludeOriginalHTML {
+			result.OriginalHTML, s.originalTruncated = originalHTML(r.Body)
+		}
 
 		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
 		if err != nil {
@@ -64,17 +151,86 @@ func (s *scraper) scrape() (*model.ScrapeResult, error) {
 		result.Metadata.Title = doc.Find("title").Text()
 		result.Metadata.Description = doc.Find("meta[name=description]").AttrOr("content", "")
 		result.Metadata.Language = doc.Find("html").AttrOr("lang", "")
+		extractDocumentMetadata(doc, result.Metadata, r.Request.URL)
+		if result.Metadata.ThemeColor == "" && s.request.FetchThemeColor {
+			result.Metadata.ThemeColor = fetchThemeColor(s.client, userAgent, doc, r.Request.URL)
+		}
+		if s.request.IncludeDOMStats {
+			result.Metadata.DOMStats = domStats(doc)
+		}
+
+		// The requested region must exist to extract it
+		if s.request.ContentSelector != "" && doc.Find(s.request.ContentSelector).Length() == 0 {
+			regionErr = fmt.Errorf("contentSelector %q matched nothing", s.request.ContentSelector)
+			return
+		}
+
+		// Check for the awaited selector, and whether it only exists in
+		// markup that scripts would render
+		if s.request.WaitForSelector != "" {
+			found := selectorRendered(doc, s.request.WaitForSelector)
+			result.Metadata.SelectorFound = &found
+			result.Metadata.RequiresBrowser = !found && selectorInInertContent(doc, s.request.WaitForSelector)
+		}
+
+		// Flag "not found" pages served with a success status
+		if s.request.DetectSoft404 && s.soft404 != nil && r.StatusCode < http.StatusMultipleChoices {
+			result.Metadata.Soft404 = s.soft404.isSoft404(s.client, userAgent, r.Request.URL.String(), doc)
+		}
+
+		// Flag content held back behind a subscription
+		if s.request.DetectPaywall && s.paywall != nil {
+			result.Metadata.Paywalled = s.paywall.isPaywalled(doc)
+		}
+
+		// Resolve relative links and images against the caller's base URL
+		if s.request.BaseURLOverride != "" {
+			if base, err := url.Parse(s.request.BaseURLOverride); err == nil {
+				absolutizeURLs(doc, base)
+			}
+		}
 
 		for _, format := range s.request.Formats {
 			switch format {
 			case "markdown":
-				result.Markdown = s.extractMarkdown(doc)
+				if s.streamMarkdown {
+					s.markdownDoc = s.filteredDocument(doc)
+					continue
+				}
+				result.Markdown = normalizeUnicode(s.extractMarkdown(doc), s.request.UnicodeNormalization)
+				if s.request.PrependTitle {
+					result.Markdown = prependTitle(result.Markdown, result.Metadata.Title)
+				}
+				if s.request.AnchorHeadings {
+					result.Markdown, result.Anchors = anchorHeadings(result.Markdown)
+				}
 			case "html":
 				result.HTML = s.extractHTML(doc)
 			case "rawHtml":
 				result.RawHTML = string(r.Body)
 			case "links":
-				result.Links = s.extractLinks(doc)
+				if s.request.LinkDetails {
+					result.LinkDetails = s.extractLinkDetails(doc)
+				} else {
+					result.Links = s.extractLinks(doc)
+				}
+			case "text":
+				result.Text = normalizeUnicode(s.extractText(doc), s.request.UnicodeNormalization)
+			case "index":
+				result.IndexText = normalizeUnicode(s.extractIndexText(doc, result.Metadata.Language), s.request.UnicodeNormalization)
+			case "dates":
+				result.Dates = s.extractDates(doc)
+			case "emails":
+				result.Emails = s.extractEmails(doc)
+			case "breadcrumbs":
+				result.Breadcrumbs = s.extractBreadcrumbs(doc)
+				if base := s.structuredBase(r.Request.URL); base != nil {
+					resolveBreadcrumbURLs(result.Breadcrumbs, base)
+				}
+			case "jsonLd":
+				result.JSONLD = s.extractJSONLD(doc, r.Request.URL)
+			case "structured":
+				result.StructuredData = s.extractStructuredData(doc, r.Request.URL)
 			}
 		}
 	})
@@ -83,6 +239,22 @@ func (s *scraper) scrape() (*model.ScrapeResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to scrape URL: %w", err)
 	}
+	if regionErr != nil {
+		return nil, regionErr
+	}
+	if rawErr != nil {
+		return nil, rawErr
+	}
+
+	if connInfo != nil {
+		connInfo.apply(result.Metadata)
+	}
+	if byteCount != nil {
+		byteCount.apply(result.Metadata)
+	}
+	if s.rendered != nil {
+		result.Actions = s.rendered.Actions
+	}
 
 	return result, nil
 }
@@ -0,0 +1,1842 @@
+package scraper
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+	"github.com/ncecere/rummage/pkg/webhook"
+)
+
+// newTestServer serves the given HTML for every request.
+func newTestServer(html string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, html)
+	}))
+}
+
+func TestScrapeRemoveComments(t *testing.T) {
+	server := newTestServer(`<html><head><title>Comments</title></head><body>
+		<!-- a large hidden blob -->
+		<p>Visible text</p>
+		<!--[if IE]><p>Old browser</p><![endif]-->
+	</body></html>`)
+	defer server.Close()
+
+	service := NewService()
+	result, err := service.Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Formats:        []string{"markdown", "html", "rawHtml"},
+			RemoveComments: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	for name, output := range map[string]string{"html": result.HTML, "markdown": result.Markdown} {
+		if strings.Contains(output, "hidden blob") || strings.Contains(output, "Old browser") {
+			t.Errorf("Expected comments to be removed from %s, got:\n%s", name, output)
+		}
+		if !strings.Contains(output, "Visible text") {
+			t.Errorf("Expected visible text to be kept in %s, got:\n%s", name, output)
+		}
+	}
+
+	if !strings.Contains(result.RawHTML, "<!-- a large hidden blob -->") {
+		t.Errorf("Expected comments to be retained in rawHtml")
+	}
+}
+
+func TestScrapeTimeoutCeiling(t *testing.T) {
+	server := newTestServer(`<html><body><p>ok</p></body></html>`)
+	defer server.Close()
+
+	service := NewServiceWithOptions(ServiceOptions{MaxRequestTimeout: 5 * time.Second})
+
+	tests := []struct {
+		name        string
+		timeout     int
+		wantWarning bool
+	}{
+		{name: "Within ceiling", timeout: 1000, wantWarning: false},
+		{name: "Above ceiling", timeout: 60000, wantWarning: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Timeout: tt.timeout}})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if (result.Warning != "") != tt.wantWarning {
+				t.Errorf("Warning = %q, wantWarning %v", result.Warning, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestScrapeConnectionInfo(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><body><p>secure</p></body></html>`)
+	}))
+	defer server.Close()
+
+	// Trust the test server's self-signed certificate
+	service := NewService().WithTransport(server.Client().Transport)
+
+	result, err := service.Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			IncludeConnectionInfo: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	if result.Metadata.RemoteIP != "127.0.0.1" {
+		t.Errorf("Expected remote IP '127.0.0.1', got '%s'", result.Metadata.RemoteIP)
+	}
+	if result.Metadata.TLSInfo == nil {
+		t.Fatal("Expected TLS info, got nil")
+	}
+
+	cert := server.Certificate()
+	if result.Metadata.TLSInfo.Subject != cert.Subject.String() {
+		t.Errorf("Subject mismatch: got %v, want %v", result.Metadata.TLSInfo.Subject, cert.Subject.String())
+	}
+	if result.Metadata.TLSInfo.Issuer != cert.Issuer.String() {
+		t.Errorf("Issuer mismatch: got %v, want %v", result.Metadata.TLSInfo.Issuer, cert.Issuer.String())
+	}
+	if !result.Metadata.TLSInfo.NotAfter.Equal(cert.NotAfter) {
+		t.Errorf("NotAfter mismatch: got %v, want %v", result.Metadata.TLSInfo.NotAfter, cert.NotAfter)
+	}
+
+	// Plain HTTP targets don't get connection info
+	plain := newTestServer(`<html><body><p>plain</p></body></html>`)
+	defer plain.Close()
+
+	result, err = NewService().Scrape(model.ScrapeRequest{
+		URL: plain.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			IncludeConnectionInfo: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.RemoteIP != "" || result.Metadata.TLSInfo != nil {
+		t.Errorf("Expected no connection info for HTTP target, got %+v", result.Metadata)
+	}
+}
+
+func TestScrapeStripInlineStyles(t *testing.T) {
+	page := `<html><body>
+		<div id="main" class="wrapper" style="color: red; margin: 0">
+			<p style="font-weight: bold">Styled text</p>
+		</div>
+	</body></html>`
+	server := newTestServer(page)
+	defer server.Close()
+
+	service := NewService()
+	plain, err := service.Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Formats: []string{"markdown", "html"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	stripped, err := service.Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Formats:           []string{"markdown", "html"},
+			StripInlineStyles: true,
+			StripClassAndID:   true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	if !strings.Contains(plain.HTML, "style=") {
+		t.Errorf("Expected styles to be preserved by default, got:\n%s", plain.HTML)
+	}
+	for _, attr := range []string{"style=", "class=", "id="} {
+		if strings.Contains(stripped.HTML, attr) {
+			t.Errorf("Expected %s to be removed from HTML, got:\n%s", attr, stripped.HTML)
+		}
+	}
+	if !strings.Contains(stripped.HTML, "Styled text") {
+		t.Errorf("Expected content to be kept, got:\n%s", stripped.HTML)
+	}
+
+	// Markdown has no styles to begin with and must be unaffected
+	if stripped.Markdown != plain.Markdown {
+		t.Errorf("Expected markdown to be unaffected: got %q, want %q", stripped.Markdown, plain.Markdown)
+	}
+}
+
+func TestScrapeImageHandling(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<p>Before <img src="/cat.png" alt="A sleeping cat"> after</p>
+	</body></html>`)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		serviceDef string
+		mode       string
+		want       string
+		notWant    []string
+	}{
+		{name: "Default keeps images", want: "![A sleeping cat](/cat.png)"},
+		{name: "Keep", mode: "keep", want: "![A sleeping cat](/cat.png)"},
+		{name: "Strip", mode: "strip", want: "after", notWant: []string{"cat.png", "A sleeping cat"}},
+		{name: "Alt", mode: "alt", want: "Before A sleeping cat after", notWant: []string{"cat.png", "!["}},
+		{name: "Configured default", serviceDef: "alt", want: "Before A sleeping cat after", notWant: []string{"cat.png"}},
+		{name: "Request overrides configured default", serviceDef: "strip", mode: "keep", want: "![A sleeping cat](/cat.png)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewServiceWithOptions(ServiceOptions{ImageHandling: tt.serviceDef})
+			result, err := service.Scrape(model.ScrapeRequest{
+				URL: server.URL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:       []string{"markdown"},
+					ImageHandling: tt.mode,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+
+			if !strings.Contains(result.Markdown, tt.want) {
+				t.Errorf("Expected markdown to contain %q, got:\n%s", tt.want, result.Markdown)
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(result.Markdown, s) {
+					t.Errorf("Expected markdown not to contain %q, got:\n%s", s, result.Markdown)
+				}
+			}
+		})
+	}
+
+	// Unknown modes are rejected
+	if _, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{ImageHandling: "blur"}}); err == nil {
+		t.Error("Expected an error for an unknown image handling mode")
+	}
+}
+
+func TestScrapeContentType(t *testing.T) {
+	server := newTestServer(`<html><body><p>ok</p></body></html>`)
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	if got := result.Metadata.ContentType; got != "text/html; charset=utf-8" {
+		t.Errorf("Expected content type 'text/html; charset=utf-8', got '%s'", got)
+	}
+}
+
+func TestGlobalRateLimitAcrossJobs(t *testing.T) {
+	var mu sync.Mutex
+	requests := make([]time.Time, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		requests = append(requests, time.Now())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer server.Close()
+
+	// Two batch jobs share one limiter of 10 requests per second
+	limiter := ratelimit.New(10)
+	service := NewServiceWithOptions(ServiceOptions{Limiter: limiter})
+
+	urls := make([]string, 5)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/page/%d", server.URL, i)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, jobID := range []string{"job-a", "job-b"} {
+		wg.Add(1)
+		go func(jobID string) {
+			defer wg.Done()
+			service.ProcessBatchJob(jobID, urls, model.BatchScrapeRequest{URLs: urls}, nil)
+		}(jobID)
+	}
+	wg.Wait()
+
+	if len(requests) != 10 {
+		t.Fatalf("Expected 10 requests, got %d", len(requests))
+	}
+
+	// Each request takes a single token
+	if got := limiter.Stats().TotalRequests; got != 10 {
+		t.Errorf("Expected 10 rate limited requests, got %d", got)
+	}
+
+	// 10 requests at 10 per second need at least 900ms in total
+	if elapsed := time.Since(start); elapsed < 850*time.Millisecond {
+		t.Errorf("Expected the jobs to take at least 850ms together, took %v", elapsed)
+	}
+}
+
+func TestScrapeBaseHref(t *testing.T) {
+	server := newTestServer(`<html><head><base href="/docs/v2/"></head><body>
+		<a href="intro">Intro</a>
+		<a href="/about">About</a>
+		<a href="#top">Top</a>
+	</body></html>`)
+	defer server.Close()
+
+	tests := []struct {
+		name           string
+		ignoreBaseHref bool
+		rawLinks       bool
+		want           []string
+	}{
+		{name: "Resolve against base href", want: []string{server.URL + "/docs/v2/intro", server.URL + "/about"}},
+		{name: "Ignore base href", ignoreBaseHref: true, want: []string{server.URL + "/guide/intro", server.URL + "/about"}},
+		{name: "Raw links resolve against base href", rawLinks: true, want: []string{server.URL + "/docs/v2/intro", server.URL + "/about"}},
+		{name: "Raw links ignoring base href", ignoreBaseHref: true, rawLinks: true, want: []string{"intro", "/about"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewService().Scrape(model.ScrapeRequest{
+				URL: server.URL + "/guide/page",
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:        []string{"links"},
+					IgnoreBaseHref: tt.ignoreBaseHref,
+					RawLinks:       tt.rawLinks,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+
+			if strings.Join(result.Links, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("Expected links %v, got %v", tt.want, result.Links)
+			}
+		})
+	}
+}
+
+func TestScrapeWaitForSelector(t *testing.T) {
+	// An SPA shell: the content only exists in a template and a comment
+	shell := newTestServer(`<html><head><title>App</title></head><body>
+		<div id="root"></div>
+		<template id="tpl"><article class="post"><h1>Post</h1></article></template>
+		<!-- <article class="post">prerender placeholder</article> -->
+		<script src="/app.js"></script>
+	</body></html>`)
+	defer shell.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: shell.URL, ScrapeOptions: model.ScrapeOptions{WaitForSelector: "article.post"}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.SelectorFound == nil || *result.Metadata.SelectorFound {
+		t.Errorf("Expected selectorFound to be false, got %v", result.Metadata.SelectorFound)
+	}
+	if !result.Metadata.RequiresBrowser {
+		t.Error("Expected requiresBrowser hint for an SPA shell")
+	}
+	if !strings.Contains(result.Warning, "did not appear") || !strings.Contains(result.Warning, "JavaScript") {
+		t.Errorf("Expected a warning for the missing selector, got %q", result.Warning)
+	}
+
+	// A selector missing everywhere gives no browser hint
+	result, err = NewService().Scrape(model.ScrapeRequest{URL: shell.URL, ScrapeOptions: model.ScrapeOptions{WaitForSelector: "#missing"}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.RequiresBrowser {
+		t.Error("Expected no requiresBrowser hint when the selector is absent from templates")
+	}
+
+	// The page renders the selector on its second fetch
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		requests++
+		n := requests
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		if n == 1 {
+			fmt.Fprint(w, `<html><body><div id="root">Loading</div></body></html>`)
+			return
+		}
+		fmt.Fprint(w, `<html><body><div id="root"><p class="ready">Done</p></div></body></html>`)
+	}))
+	defer server.Close()
+
+	result, err = NewService().Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			WaitForSelector:        ".ready",
+			WaitForSelectorTimeout: 2000,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.SelectorFound == nil || !*result.Metadata.SelectorFound {
+		t.Error("Expected the selector to be found after polling")
+	}
+	if !strings.Contains(result.Markdown, "Done") {
+		t.Errorf("Expected the rendered content, got %q", result.Markdown)
+	}
+	if result.Warning != "" {
+		t.Errorf("Expected no warning once the selector appears, got %q", result.Warning)
+	}
+
+	// A selector that can't parse is rejected
+	if _, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{WaitForSelector: "div["}}); err == nil {
+		t.Error("Expected an error for an invalid waitForSelector")
+	}
+}
+
+func TestScrapeAcceptLanguages(t *testing.T) {
+	server := newTestServer(`<html lang="fr-FR"><head><title>Accueil</title></head><body><p>Bonjour</p></body></html>`)
+	defer server.Close()
+
+	// A page in another language is returned with a warning
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{AcceptLanguages: []string{"en"}}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Warning, `"fr-FR"`) {
+		t.Errorf("Expected a language warning, got %q", result.Warning)
+	}
+	if !strings.Contains(result.Markdown, "Bonjour") {
+		t.Errorf("Expected the page content, got %q", result.Markdown)
+	}
+
+	// Or rejected when mismatches are errors
+	_, err = NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{AcceptLanguages: []string{"en", "fr-CA"}, ErrorOnLanguageMismatch: true}})
+	if err == nil {
+		t.Error("Expected an error for a non-matching language")
+	}
+
+	// A bare language accepts its regional variants
+	result, err = NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{AcceptLanguages: []string{"FR"}, ErrorOnLanguageMismatch: true}})
+	if err != nil {
+		t.Fatalf("Expected fr to accept fr-FR, got %v", err)
+	}
+	if result.Warning != "" {
+		t.Errorf("Expected no warning, got %q", result.Warning)
+	}
+}
+
+func TestScrapeSkipTlsVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><p>Self-signed</p></body></html>`)
+	}))
+	defer server.Close()
+
+	service := NewService()
+
+	// The test server's certificate isn't trusted by default
+	if _, err := service.Scrape(model.ScrapeRequest{URL: server.URL}); err == nil {
+		t.Error("Expected a certificate error without skipTlsVerification")
+	}
+
+	result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{SkipTlsVerification: true}})
+	if err != nil {
+		t.Fatalf("Expected the scrape to succeed with skipTlsVerification, got %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Self-signed") {
+		t.Errorf("Expected the page content, got %q", result.Markdown)
+	}
+}
+
+func TestScrapeProxy(t *testing.T) {
+	// A plain HTTP proxy receives the absolute target URL
+	var mu sync.Mutex
+	proxied := make([]string, 0)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.String())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><p>Via proxy</p></body></html>`)
+	}))
+	defer proxy.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: "http://example.invalid/page", ScrapeOptions: model.ScrapeOptions{Proxy: proxy.URL}})
+	if err != nil {
+		t.Fatalf("Failed to scrape through the proxy: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Via proxy") {
+		t.Errorf("Expected the proxied page, got %q", result.Markdown)
+	}
+	if len(proxied) == 0 || proxied[0] != "http://example.invalid/page" {
+		t.Errorf("Expected the proxy to receive the target URL, got %v", proxied)
+	}
+
+	// The service default applies when the request doesn't set one
+	proxied = proxied[:0]
+	service := NewServiceWithOptions(ServiceOptions{ProxyURL: proxy.URL})
+	if _, err := service.Scrape(model.ScrapeRequest{URL: "http://example.invalid/default"}); err != nil {
+		t.Fatalf("Failed to scrape through the default proxy: %v", err)
+	}
+	if len(proxied) == 0 || proxied[0] != "http://example.invalid/default" {
+		t.Errorf("Expected the default proxy to be used, got %v", proxied)
+	}
+
+	// Unsupported schemes are rejected before fetching
+	_, err = NewService().Scrape(model.ScrapeRequest{URL: "http://example.invalid/page", ScrapeOptions: model.ScrapeOptions{Proxy: "ftp://proxy.example.com"}})
+	if err == nil || !strings.Contains(err.Error(), "unsupported proxy scheme") {
+		t.Errorf("Expected an unsupported scheme error, got %v", err)
+	}
+}
+
+func TestScrapeUseLinkTitles(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<p><a href="https://github.com/example" title="GitHub"><svg><path d="M0 0"></path></svg></a></p>
+		<p><a href="/search" aria-label="Search"><i class="icon-search"></i></a></p>
+		<p><a href="/" title="Home"><img src="/logo.png"></a></p>
+		<p><a href="/docs" title="Documentation">Docs</a></p>
+	</body></html>`)
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{UseLinkTitles: true}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	for _, want := range []string{"[GitHub](https://github.com/example)", "[Search](/search)", "[![](/logo.png) Home](/)", "[Docs](/docs"} {
+		if !strings.Contains(result.Markdown, want) {
+			t.Errorf("Expected markdown to contain %q, got %q", want, result.Markdown)
+		}
+	}
+
+	// Without the option the image-only link is just the image
+	result, err = NewService().Scrape(model.ScrapeRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if strings.Contains(result.Markdown, "[![](/logo.png) Home]") {
+		t.Errorf("Expected no link title without useLinkTitles, got %q", result.Markdown)
+	}
+}
+
+func TestScrapeJSONLDResolveStructuredURLs(t *testing.T) {
+	server := newTestServer(`<html><head>
+		<script type="application/ld+json">{
+			"@context": "https://schema.org",
+			"@type": "Product",
+			"@id": "#product",
+			"name": "Kettle",
+			"image": ["/img/kettle.jpg", "https://cdn.example.com/kettle-2.jpg"],
+			"brand": {"@type": "Brand", "logo": "../logo.png"},
+			"description": "Boils water fast"
+		}</script>
+	</head><body><p>Kettle</p></body></html>`)
+	defer server.Close()
+
+	jsonLD := func(result *model.ScrapeResult) map[string]interface{} {
+		t.Helper()
+		if len(result.JSONLD) != 1 {
+			t.Fatalf("Expected 1 JSON-LD block, got %v", result.JSONLD)
+		}
+		block, ok := result.JSONLD[0].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected a JSON-LD object, got %T", result.JSONLD[0])
+		}
+		return block
+	}
+
+	req := model.ScrapeRequest{URL: server.URL + "/shop/kettle", ScrapeOptions: model.ScrapeOptions{Formats: []string{"jsonLd"}}}
+	result, err := NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if image := jsonLD(result)["image"].([]interface{}); image[0] != "/img/kettle.jpg" {
+		t.Errorf("Expected relative URLs kept without resolveStructuredUrls, got %v", image[0])
+	}
+
+	req.ResolveStructuredURLs = true
+	result, err = NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	block := jsonLD(result)
+	image := block["image"].([]interface{})
+	if image[0] != server.URL+"/img/kettle.jpg" || image[1] != "https://cdn.example.com/kettle-2.jpg" {
+		t.Errorf("Expected the relative image resolved and the absolute one kept, got %v", image)
+	}
+	if logo := block["brand"].(map[string]interface{})["logo"]; logo != server.URL+"/logo.png" {
+		t.Errorf("Expected the nested logo resolved, got %v", logo)
+	}
+	if block["@id"] != "#product" || block["description"] != "Boils water fast" {
+		t.Errorf("Expected fragment IDs and non-URL keys untouched, got %v", block)
+	}
+}
+
+func TestScrapeContentSelector(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<nav>Site navigation</nav>
+		<div id="article"><h1>Release notes</h1><p>Version 2 is out.</p></div>
+		<aside>Related posts</aside>
+	</body></html>`)
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Formats:         []string{"markdown", "html", "text"},
+			ContentSelector: "#article",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	for name, output := range map[string]string{"markdown": result.Markdown, "html": result.HTML, "text": result.Text} {
+		if !strings.Contains(output, "Version 2 is out.") {
+			t.Errorf("Expected %s to contain the article, got %q", name, output)
+		}
+		if strings.Contains(output, "Site navigation") || strings.Contains(output, "Related posts") {
+			t.Errorf("Expected %s to contain only the article, got %q", name, output)
+		}
+	}
+
+	if _, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{ContentSelector: "#missing"}}); err == nil {
+		t.Error("Expected an error when the content selector matches nothing")
+	}
+	if _, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{ContentSelector: "div["}}); err == nil {
+		t.Error("Expected an error for an invalid content selector")
+	}
+}
+
+func TestBatchWebhookForwardHeaders(t *testing.T) {
+	// The stub receiver listens on loopback
+	webhook.AllowPrivateNetworks(true)
+	defer webhook.AllowPrivateNetworks(false)
+
+	page := newTestServer(`<html><body><p>Hello</p></body></html>`)
+	defer page.Close()
+
+	delivered := make(chan *http.Request, 1)
+	var payload model.WebhookEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("Failed to decode webhook payload: %v", err)
+		}
+		delivered <- r
+	}))
+	defer hook.Close()
+
+	// Headers of the original API request
+	original := http.Header{}
+	original.Set("X-Tenant-ID", "tenant-42")
+	original.Set("Authorization", "Bearer secret")
+
+	webhookConfig := &model.WebhookConfig{URL: hook.URL, ForwardHeaders: []string{"x-tenant-id"}}
+	webhookConfig.CaptureHeaders(original)
+
+	notifier := webhook.NewNotifier("")
+	NewServiceWithOptions(ServiceOptions{WebhookFn: notifier.Notify}).ProcessBatchJob("job-1", []string{page.URL}, model.BatchScrapeRequest{Webhook: webhookConfig}, nil)
+	defer notifier.Close(context.Background())
+
+	select {
+	case r := <-delivered:
+		if got := r.Header.Get("X-Tenant-ID"); got != "tenant-42" {
+			t.Errorf("Expected forwarded X-Tenant-ID header, got %q", got)
+		}
+		if r.Header.Get("Authorization") != "" {
+			t.Error("Expected headers not listed in forwardHeaders to stay private")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the webhook to be delivered")
+	}
+
+	if payload.Type != model.WebhookEventBatchCompleted || payload.ID != "job-1" || payload.Completed != 1 {
+		t.Errorf("Unexpected webhook payload: %+v", payload)
+	}
+	if payload.Headers["X-Tenant-Id"] != "tenant-42" {
+		t.Errorf("Expected the forwarded header in the payload, got %v", payload.Headers)
+	}
+}
+
+func TestBatchWebhookLifecycle(t *testing.T) {
+	// The stub receiver listens on loopback
+	webhook.AllowPrivateNetworks(true)
+	defer webhook.AllowPrivateNetworks(false)
+
+	var mu sync.Mutex
+	var events []model.WebhookEvent
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event model.WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook payload: %v", err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+
+	// Every URL fails, but the batch still completes
+	webhookConfig := &model.WebhookConfig{
+		URL:      hook.URL,
+		Events:   []string{model.WebhookStarted, model.WebhookPage, model.WebhookCompleted},
+		Metadata: map[string]interface{}{"run": "nightly"},
+	}
+	urls := []string{"http://127.0.0.1:1/a", "http://127.0.0.1:1/b"}
+	notifier := webhook.NewNotifier("")
+	NewServiceWithOptions(ServiceOptions{WebhookFn: notifier.Notify}).ProcessBatchJob("job-2", urls, model.BatchScrapeRequest{Webhook: webhookConfig}, nil)
+
+	// Events are delivered in the background until the notifier drains
+	if err := notifier.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var types []string
+	for _, event := range events {
+		types = append(types, event.Type)
+		if event.ID != "job-2" || event.Metadata["run"] != "nightly" {
+			t.Errorf("Expected the job ID and metadata in every event, got %+v", event)
+		}
+	}
+	want := []string{"batch_scrape.started", "batch_scrape.page", "batch_scrape.page", "batch_scrape.completed"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Fatalf("Expected events %v, got %v", want, types)
+	}
+	if page := events[1]; page.Error == "" || page.Data == nil || page.Data.Metadata.SourceURL != urls[0] {
+		t.Errorf("Expected the failed page and its error, got %+v", page)
+	}
+	if done := events[3]; done.Total != 2 || done.Completed != 0 {
+		t.Errorf("Expected 0 of 2 pages completed, got %+v", done)
+	}
+}
+
+func TestCancelBatchJob(t *testing.T) {
+	// The second page hangs until the test ends
+	hang := make(chan struct{})
+	defer close(hang)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-hang:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><p>Fast</p></body></html>`)
+	}))
+	defer server.Close()
+
+	service := NewService()
+	if service.CancelBatchJob("job-3") {
+		t.Error("Expected a job that isn't running not to be cancelled")
+	}
+
+	var results []model.ScrapeResult
+	stored := make(chan struct{}, 1)
+	done := make(chan struct{})
+	urls := []string{server.URL + "/fast", server.URL + "/slow", server.URL + "/never"}
+	go func() {
+		defer close(done)
+		service.ProcessBatchJob("job-3", urls, model.BatchScrapeRequest{ScrapeOptions: model.ScrapeOptions{Timeout: 60000}}, func(_ string, result model.ScrapeResult) error {
+			results = append(results, result)
+			stored <- struct{}{}
+			return nil
+		})
+	}()
+
+	// Cancel once the first page is stored and the second is in flight
+	<-stored
+	time.Sleep(50 * time.Millisecond)
+	if !service.CancelBatchJob("job-3") {
+		t.Fatal("Expected the running job to be cancelled")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected cancelling to stop the in-flight scrape")
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Markdown, "Fast") {
+		t.Errorf("Expected only the page scraped before cancelling, got %d results", len(results))
+	}
+}
+
+func TestScrapeFormatAliases(t *testing.T) {
+	server := newTestServer(`<html><body><h1>Aliases</h1><p>Some text</p></body></html>`)
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"md", "raw"}}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	if !strings.Contains(result.Markdown, "# Aliases") {
+		t.Errorf("Expected markdown output for the md alias, got %q", result.Markdown)
+	}
+	if !strings.Contains(result.RawHTML, "<h1>Aliases</h1>") {
+		t.Errorf("Expected raw HTML output for the raw alias, got %q", result.RawHTML)
+	}
+}
+
+func TestScrapePrependTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "Content without a heading",
+			html: `<html><head><title>Release Notes</title></head><body><p>Version 2 is out.</p></body></html>`,
+			want: "# Release Notes\n\nVersion 2 is out.",
+		},
+		{
+			name: "Content opening with an H1",
+			html: `<html><head><title>Release Notes | Example</title></head><body><h1>Release Notes</h1><p>Version 2 is out.</p></body></html>`,
+			want: "# Release Notes\n\nVersion 2 is out.",
+		},
+		{
+			name: "Page without a title",
+			html: `<html><body><p>Version 2 is out.</p></body></html>`,
+			want: "Version 2 is out.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(tt.html)
+			defer server.Close()
+
+			result, err := NewService().Scrape(model.ScrapeRequest{
+				URL: server.URL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:      []string{"markdown"},
+					PrependTitle: true,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if result.Markdown != tt.want {
+				t.Errorf("Expected markdown %q, got %q", tt.want, result.Markdown)
+			}
+		})
+	}
+}
+
+func TestScrapeStripElements(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<nav><a href="/docs">Docs</a></nav>
+		<div class="promo">Subscribe now</div>
+		<p>Body text</p>
+		<footer>Footer text</footer>
+	</body></html>`)
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		stripElements []string
+		wantKept      []string
+		wantRemoved   []string
+	}{
+		{
+			name:        "Default list",
+			wantKept:    []string{"Body text", "Subscribe now"},
+			wantRemoved: []string{"Docs", "Footer text"},
+		},
+		{
+			name:          "Keep nav",
+			stripElements: []string{"footer", ".promo"},
+			wantKept:      []string{"Body text", "Docs"},
+			wantRemoved:   []string{"Subscribe now", "Footer text"},
+		},
+		{
+			name:          "Strip nothing",
+			stripElements: []string{},
+			wantKept:      []string{"Body text", "Docs", "Subscribe now", "Footer text"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewService().Scrape(model.ScrapeRequest{
+				URL: server.URL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:         []string{"markdown", "html"},
+					OnlyMainContent: true,
+					StripElements:   tt.stripElements,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+
+			for _, output := range []string{result.Markdown, result.HTML} {
+				for _, text := range tt.wantKept {
+					if !strings.Contains(output, text) {
+						t.Errorf("Expected %q to be kept, got %q", text, output)
+					}
+				}
+				for _, text := range tt.wantRemoved {
+					if strings.Contains(output, text) {
+						t.Errorf("Expected %q to be removed, got %q", text, output)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScrapeDocumentMetadata(t *testing.T) {
+	server := newTestServer(`<html><head>
+		<title>Kettle Review</title>
+		<meta name="author" content="Sam Lee">
+		<meta name="keywords" content="kettles, reviews">
+		<meta property="og:title" content="The Best Kettle">
+		<meta property="og:description" content="We boiled a lot of water.">
+		<meta property="og:image" content="/img/kettle.jpg">
+		<meta property="article:published_time" content="2024-03-05T09:30:00Z">
+		<link rel="canonical" href="/reviews/kettle">
+		<script type="application/ld+json">{
+			"@type": "Article",
+			"datePublished": "2020-01-01",
+			"dateModified": "2024-03-06"
+		}</script>
+	</head><body><p>Kettle</p></body></html>`)
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL + "/reviews/kettle?ref=home"})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	meta := result.Metadata
+	want := map[string]string{
+		"author":        "Sam Lee",
+		"keywords":      "kettles, reviews",
+		"canonicalURL":  server.URL + "/reviews/kettle",
+		"ogTitle":       "The Best Kettle",
+		"ogDescription": "We boiled a lot of water.",
+		"ogImage":       server.URL + "/img/kettle.jpg",
+		// The meta tag takes precedence over JSON-LD
+		"publishedTime": "2024-03-05T09:30:00Z",
+		"modifiedTime":  "2024-03-06T00:00:00Z",
+	}
+	got := map[string]string{
+		"author":        meta.Author,
+		"keywords":      meta.Keywords,
+		"canonicalURL":  meta.CanonicalURL,
+		"ogTitle":       meta.OGTitle,
+		"ogDescription": meta.OGDescription,
+		"ogImage":       meta.OGImage,
+		"publishedTime": meta.PublishedTime,
+		"modifiedTime":  meta.ModifiedTime,
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("Expected %s %q, got %q", field, value, got[field])
+		}
+	}
+}
+
+// benchmarkPage builds an article-sized page with navigation, links, images
+// and a table.
+func benchmarkPage() string {
+	var sb strings.Builder
+	sb.WriteString(`<html><head><title>Benchmark</title><meta name="description" content="A long page"></head><body>`)
+	sb.WriteString(`<header><nav><ul>`)
+	for i := 0; i < 30; i++ {
+		fmt.Fprintf(&sb, `<li><a href="/section/%d">Section %d</a></li>`, i, i)
+	}
+	sb.WriteString(`</ul></nav></header><main><article><h1>Benchmark</h1>`)
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&sb, `<h2>Heading %d</h2><p>Paragraph %d with <strong>bold</strong>, <em>emphasis</em> and a <a href="/page/%d">link</a>.</p>`, i, i, i)
+		if i%20 == 0 {
+			fmt.Fprintf(&sb, `<img src="/img/%d.png" alt="Figure %d"><table><tr><th>Key</th><th>Value</th></tr><tr><td>%d</td><td>%d</td></tr></table>`, i, i, i, i*i)
+		}
+	}
+	sb.WriteString(`</article></main><footer><p>Footer</p></footer></body></html>`)
+	return sb.String()
+}
+
+func BenchmarkScrape(b *testing.B) {
+	server := newTestServer(benchmarkPage())
+	defer server.Close()
+
+	service := NewService()
+	req := model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Formats:         []string{"markdown", "html", "links"},
+			OnlyMainContent: true,
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := service.Scrape(req); err != nil {
+			b.Fatalf("Failed to scrape: %v", err)
+		}
+	}
+}
+
+func BenchmarkExtractMarkdown(b *testing.B) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(benchmarkPage()))
+	if err != nil {
+		b.Fatalf("Failed to parse page: %v", err)
+	}
+	s := &scraper{request: model.ScrapeRequest{ScrapeOptions: model.ScrapeOptions{OnlyMainContent: true}}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if s.extractMarkdown(doc) == "" {
+			b.Fatal("Expected markdown output")
+		}
+	}
+}
+
+func TestScrapeStructuredData(t *testing.T) {
+	server := newTestServer(`<html><head>
+		<script type="application/ld+json">{"@type": "Organization", "name": "Example Co"}</script>
+		<script type="application/ld+json">[
+			{"@type": "WebSite", "name": "Example"},
+			{"@type": "Person", "name": "Sam Lee"}
+		]</script>
+		<script type="application/ld+json">{
+			"@context": "https://schema.org",
+			"@graph": [{"@type": "Article", "headline": "Kettles"}]
+		}</script>
+		<script type="application/ld+json">{"@type": "Broken",</script>
+	</head><body><p>Kettle</p></body></html>`)
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"structured"}}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	types := make([]string, 0, len(result.StructuredData))
+	for _, obj := range result.StructuredData {
+		types = append(types, fmt.Sprint(obj["@type"]))
+	}
+	want := []string{"Organization", "WebSite", "Person", "Article"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected structured data types %v, got %v", want, types)
+	}
+}
+
+func TestScrapeEmails(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<p>Sales: <a href="mailto:Sales@Example.com?subject=Hello">email us</a></p>
+		<p>Support: support@example.com. Press: press@example.org</p>
+		<p>Team: <a href="mailto:a@example.com,b@example.com">both</a></p>
+		<p>Not addresses: user@localhost, @example.com, name@domain.c</p>
+		<p>Spelled out: jobs [at] example [dot] com</p>
+		<script>var x = "hidden@example.com";</script>
+		<div>first@example.com</div><div>second@example.com</div>
+	</body></html>`)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		deobfuscate bool
+		want        []string
+	}{
+		{
+			name: "Plain addresses",
+			want: []string{"sales@example.com", "a@example.com", "b@example.com", "support@example.com", "press@example.org", "first@example.com", "second@example.com"},
+		},
+		{
+			name:        "Obfuscated addresses normalized",
+			deobfuscate: true,
+			want:        []string{"sales@example.com", "a@example.com", "b@example.com", "support@example.com", "press@example.org", "jobs@example.com", "first@example.com", "second@example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewService().Scrape(model.ScrapeRequest{
+				URL: server.URL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:           []string{"emails"},
+					DeobfuscateEmails: tt.deobfuscate,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if strings.Join(result.Emails, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected emails %v, got %v", tt.want, result.Emails)
+			}
+		})
+	}
+}
+
+func TestScrapeDOMStats(t *testing.T) {
+	// html > body > div > ul > li > a is the deepest path, six levels
+	server := newTestServer(`<html><head>
+		<title>Stats</title>
+		<link rel="stylesheet" href="/site.css">
+		<link rel="icon" href="/favicon.ico">
+		<style>p { color: red; }</style>
+		<script src="/app.js"></script>
+	</head><body>
+		<div><ul><li><a href="/">Home</a></li><li>About</li></ul></div>
+		<p>Text</p>
+		<script>console.log("hi")</script>
+	</body></html>`)
+	defer server.Close()
+
+	req := model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown"}}}
+	result, err := NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.DOMStats != nil {
+		t.Errorf("Expected no DOM stats unless requested, got %+v", result.Metadata.DOMStats)
+	}
+
+	req.IncludeDOMStats = true
+	result, err = NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	want := model.DOMStats{NodeCount: 15, MaxDepth: 6, ScriptCount: 2, StyleCount: 2}
+	if got := result.Metadata.DOMStats; got == nil || *got != want {
+		t.Errorf("Expected DOM stats %+v, got %+v", want, got)
+	}
+}
+
+func TestScrapeBlockAds(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<p>Article text</p>
+		<div class="ad">Buy now, limited offer</div>
+		<div id="google_ads_iframe_1">Sponsored link</div>
+		<iframe src="https://ad.doubleclick.net/ddm/adi/123"></iframe>
+		<p>More article text</p>
+	</body></html>`)
+	defer server.Close()
+
+	req := model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown", "html"}}}
+	result, err := NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Buy now") {
+		t.Errorf("Expected ads kept unless blockAds is set, got %q", result.Markdown)
+	}
+
+	req.BlockAds = true
+	result, err = NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	for _, ad := range []string{"Buy now", "Sponsored link"} {
+		if strings.Contains(result.Markdown, ad) {
+			t.Errorf("Expected %q removed from markdown, got %q", ad, result.Markdown)
+		}
+	}
+	if strings.Contains(result.HTML, "doubleclick") {
+		t.Errorf("Expected the ad iframe removed from html, got %q", result.HTML)
+	}
+	if !strings.Contains(result.Markdown, "Article text") || !strings.Contains(result.Markdown, "More article text") {
+		t.Errorf("Expected the article kept, got %q", result.Markdown)
+	}
+}
+
+func TestScrapeMobile(t *testing.T) {
+	// Serve the mobile layout to phone User-Agents
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if strings.Contains(r.UserAgent(), "Mobile") {
+			fmt.Fprint(w, `<html><body><p>Mobile layout</p></body></html>`)
+			return
+		}
+		fmt.Fprint(w, `<html><body><p>Desktop layout</p></body></html>`)
+	}))
+	defer server.Close()
+
+	req := model.ScrapeRequest{URL: server.URL}
+	result, err := NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Desktop layout") {
+		t.Errorf("Expected the desktop layout by default, got %q", result.Markdown)
+	}
+
+	req.Mobile = true
+	result, err = NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Mobile layout") {
+		t.Errorf("Expected the mobile layout with mobile set, got %q", result.Markdown)
+	}
+}
+
+func TestScrapeLocation(t *testing.T) {
+	// Serve German content to German speakers
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if strings.HasPrefix(r.Header.Get("Accept-Language"), "de") {
+			fmt.Fprint(w, `<html lang="de"><body><p>Willkommen</p></body></html>`)
+			return
+		}
+		fmt.Fprint(w, `<html lang="en"><body><p>Welcome</p></body></html>`)
+	}))
+	defer server.Close()
+
+	req := model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Location: &model.LocationOptions{Country: "DE", Languages: []string{"de"}},
+		},
+	}
+	result, err := NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Willkommen") {
+		t.Errorf("Expected German content for a German location, got %q", result.Markdown)
+	}
+
+	// An explicit header wins over the location
+	req.Headers = map[string]string{"accept-language": "en"}
+	result, err = NewService().Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Welcome") {
+		t.Errorf("Expected the request's Accept-Language header to win, got %q", result.Markdown)
+	}
+}
+
+func TestScrapeUnicodeNormalization(t *testing.T) {
+	// "Café" spelled with a combining acute accent, and an "fi" ligature
+	server := newTestServer("<html><body><p>Cafe\u0301 \ufb01le</p></body></html>")
+	defer server.Close()
+
+	tests := []struct {
+		form string
+		want string
+	}{
+		{form: "", want: "Cafe\u0301 \ufb01le"},
+		{form: "none", want: "Cafe\u0301 \ufb01le"},
+		{form: "nfc", want: "Caf\u00e9 \ufb01le"},
+		{form: "nfkc", want: "Caf\u00e9 file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.form, func(t *testing.T) {
+			result, err := NewService().Scrape(model.ScrapeRequest{
+				URL: server.URL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:              []string{"markdown", "text"},
+					UnicodeNormalization: tt.form,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if strings.TrimSpace(result.Markdown) != tt.want {
+				t.Errorf("Expected markdown %q, got %q", tt.want, result.Markdown)
+			}
+			if strings.TrimSpace(result.Text) != tt.want {
+				t.Errorf("Expected text %q, got %q", tt.want, result.Text)
+			}
+		})
+	}
+
+	if _, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{UnicodeNormalization: "nfd"}}); err == nil {
+		t.Error("Expected an error for an unknown normalization form")
+	}
+}
+
+func TestScrapeLinksTagFilters(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<nav><a href="/home">Home</a><a href="/about">About</a></nav>
+		<article><p>Read the <a href="/guide">guide</a>.</p></article>
+		<footer><a href="/privacy">Privacy</a></footer>
+	</body></html>`)
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		includeTags []string
+		excludeTags []string
+		want        []string
+	}{
+		{
+			name: "No filters",
+			want: []string{"/home", "/about", "/guide", "/privacy"},
+		},
+		{
+			name:        "Exclude nav",
+			excludeTags: []string{"nav"},
+			want:        []string{"/guide", "/privacy"},
+		},
+		{
+			name:        "Include article",
+			includeTags: []string{"article"},
+			want:        []string{"/guide"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := model.ScrapeRequest{
+				URL: server.URL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:     []string{"links", "markdown", "html"},
+					IncludeTags: tt.includeTags,
+					ExcludeTags: tt.excludeTags,
+					RawLinks:    true,
+				},
+			}
+			result, err := NewService().Scrape(req)
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if !reflect.DeepEqual(result.Links, tt.want) {
+				t.Errorf("Expected links %v, got %v", tt.want, result.Links)
+			}
+			if len(tt.excludeTags) > 0 && (strings.Contains(result.Markdown, "Home") || strings.Contains(result.HTML, "/home")) {
+				t.Errorf("Expected nav removed from markdown and html, got %q and %q", result.Markdown, result.HTML)
+			}
+
+			// Link details honor the same filters
+			req.LinkDetails = true
+			result, err = NewService().Scrape(req)
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			got := make([]string, 0, len(result.LinkDetails))
+			for _, link := range result.LinkDetails {
+				got = append(got, link.URL)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected link details for %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// newAuthProxy starts a proxy that requires the basic credentials
+// user:p@ss, forwarding plain requests and tunnelling CONNECT requests. It
+// records each request's method.
+func newAuthProxy(t *testing.T, methods *[]string, mu *sync.Mutex) *httptest.Server {
+	t.Helper()
+
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:p@ss"))
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*methods = append(*methods, r.Method)
+		mu.Unlock()
+
+		if r.Header.Get("Proxy-Authorization") != want {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxy"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method != http.MethodConnect {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><body><p>Via authenticated proxy</p></body></html>`)
+			return
+		}
+
+		// Tunnel to the target
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		go func() {
+			defer target.Close()
+			defer conn.Close()
+			go func() { _, _ = io.Copy(target, conn) }()
+			_, _ = io.Copy(conn, target)
+		}()
+	}))
+}
+
+func TestScrapeAuthenticatedProxy(t *testing.T) {
+	var mu sync.Mutex
+	methods := make([]string, 0)
+	proxy := newAuthProxy(t, &methods, &mu)
+	defer proxy.Close()
+
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><p>Tunnelled page</p></body></html>`)
+	}))
+	defer target.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	proxyURL.User = url.UserPassword("user", "p@ss")
+
+	// Plain requests carry the credentials
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: "http://example.invalid/page", ScrapeOptions: model.ScrapeOptions{Proxy: proxyURL.String()}})
+	if err != nil {
+		t.Fatalf("Failed to scrape through the proxy: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Via authenticated proxy") {
+		t.Errorf("Expected the proxied page, got %q", result.Markdown)
+	}
+
+	// HTTPS requests are tunnelled with an authenticated CONNECT
+	result, err = NewService().Scrape(model.ScrapeRequest{URL: target.URL, ScrapeOptions: model.ScrapeOptions{Proxy: proxyURL.String(), SkipTlsVerification: true}})
+	if err != nil {
+		t.Fatalf("Failed to scrape through the tunnel: %v", err)
+	}
+	if !strings.Contains(result.Markdown, "Tunnelled page") {
+		t.Errorf("Expected the tunnelled page, got %q", result.Markdown)
+	}
+	mu.Lock()
+	if len(methods) != 2 || methods[1] != http.MethodConnect {
+		t.Errorf("Expected a plain request then a CONNECT, got %v", methods)
+	}
+	mu.Unlock()
+
+	// Wrong credentials are refused by the proxy
+	proxyURL.User = url.UserPassword("user", "wrong")
+	if _, err := NewService().Scrape(model.ScrapeRequest{URL: target.URL, ScrapeOptions: model.ScrapeOptions{Proxy: proxyURL.String(), SkipTlsVerification: true}}); err == nil {
+		t.Error("Expected an error when the proxy refuses the credentials")
+	}
+}
+
+func TestScrapeLinksAbsolutized(t *testing.T) {
+	server := newTestServer(`<html><body>
+		<a href="/about">About</a>
+		<a href="team">Team</a>
+		<a href="//cdn.example.com/guide.pdf">Guide</a>
+		<a href="https://other.example.org/x">External</a>
+		<a href="#top">Top</a>
+		<a href="/about">About again</a>
+		<a href="mailto:team@example.com">Mail</a>
+		<a href="//cdn.example.com/guide.pdf">Guide again</a>
+	</body></html>`)
+	defer server.Close()
+
+	pageURL := server.URL + "/company/"
+	tests := []struct {
+		name     string
+		rawLinks bool
+		want     []string
+	}{
+		{
+			name: "Absolute and deduplicated",
+			want: []string{
+				server.URL + "/about",
+				server.URL + "/company/team",
+				"http://cdn.example.com/guide.pdf",
+				"https://other.example.org/x",
+				"mailto:team@example.com",
+			},
+		},
+		{
+			name:     "Raw hrefs",
+			rawLinks: true,
+			want: []string{
+				"/about",
+				"team",
+				"//cdn.example.com/guide.pdf",
+				"https://other.example.org/x",
+				"/about",
+				"mailto:team@example.com",
+				"//cdn.example.com/guide.pdf",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := NewService().Scrape(model.ScrapeRequest{
+				URL: pageURL,
+				ScrapeOptions: model.ScrapeOptions{
+					Formats:  []string{"links"},
+					RawLinks: tt.rawLinks,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if !reflect.DeepEqual(result.Links, tt.want) {
+				t.Errorf("Expected links %v, got %v", tt.want, result.Links)
+			}
+		})
+	}
+}
+
+func TestScrapeDetectPaywall(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		markers []string
+		want    bool
+	}{
+		{
+			name: "not accessible for free",
+			html: `<html><head><script type="application/ld+json">
+				{"@context": "https://schema.org", "@type": "NewsArticle", "headline": "Markets rally",
+				 "isAccessibleForFree": false,
+				 "hasPart": {"@type": "WebPageElement", "isAccessibleForFree": false, "cssSelector": ".locked"}}
+			</script></head><body><article><p>Markets rallied on Tuesday.</p><div class="locked"></div></article></body></html>`,
+			want: true,
+		},
+		{
+			name: "gated part as a string",
+			html: `<html><head><script type="application/ld+json">
+				{"@type": "Article", "hasPart": [{"@type": "WebPageElement", "isAccessibleForFree": "False"}]}
+			</script></head><body><article><p>Teaser</p></article></body></html>`,
+			want: true,
+		},
+		{
+			name: "paywall marker",
+			html: `<html><body><article><p>Teaser</p></article><div class="article-paywall-overlay">Join today</div></body></html>`,
+			want: true,
+		},
+		{
+			name: "truncated article with a subscribe prompt",
+			html: `<html><body><article><p>The first paragraph of the story.</p></article>
+				<aside><p>Subscribe to continue reading.</p></aside></body></html>`,
+			want: true,
+		},
+		{
+			name: "free article",
+			html: `<html><head><script type="application/ld+json">
+				{"@type": "Article", "isAccessibleForFree": true}
+			</script></head><body><article><p>The whole story.</p></article></body></html>`,
+			want: false,
+		},
+		{
+			name:    "configured markers replace the defaults",
+			html:    `<html><body><article><p>Teaser</p></article><div class="paywall"></div><div id="gate"></div></body></html>`,
+			markers: []string{"#gate"},
+			want:    true,
+		},
+		{
+			name:    "default markers unused when configured",
+			html:    `<html><body><article><p>Teaser</p></article><div class="paywall"></div></body></html>`,
+			markers: []string{"#gate", "[invalid"},
+			want:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(tt.html)
+			defer server.Close()
+
+			service := NewServiceWithOptions(ServiceOptions{PaywallMarkers: tt.markers})
+			req := model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown"}}}
+
+			// Detection only runs when requested
+			result, err := service.Scrape(req)
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if result.Metadata.Paywalled {
+				t.Error("Expected paywalled unset unless detectPaywall is requested")
+			}
+
+			req.DetectPaywall = true
+			result, err = service.Scrape(req)
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+			if result.Metadata.Paywalled != tt.want {
+				t.Errorf("Expected paywalled %v, got %v", tt.want, result.Metadata.Paywalled)
+			}
+		})
+	}
+}
+
+func TestScrapeMaxResponseBytes(t *testing.T) {
+	page := "<html><body><p>Opening paragraph</p><p>" + strings.Repeat("filler ", 2000) + "</p><p>Closing paragraph</p></body></html>"
+	server := newTestServer(page)
+	defer server.Close()
+
+	service := NewServiceWithOptions(ServiceOptions{MaxResponseBytes: 1 << 16})
+
+	// The server cap is larger than the page
+	req := model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown", "rawHtml"}}}
+	result, err := service.Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.RawHTML != page || result.Warning != "" {
+		t.Errorf("Expected the whole page without a warning, got %d bytes and warning %q", len(result.RawHTML), result.Warning)
+	}
+
+	// A smaller per-request cap truncates the body
+	req.MaxResponseBytes = 100
+	result, err = service.Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.RawHTML != page[:100] {
+		t.Errorf("Expected the first 100 bytes, got %d bytes", len(result.RawHTML))
+	}
+	if !strings.Contains(result.Markdown, "Opening paragraph") || strings.Contains(result.Markdown, "Closing paragraph") {
+		t.Errorf("Expected markdown from the truncated body, got %q", result.Markdown)
+	}
+	if !strings.Contains(result.Warning, "truncated to 100 bytes") {
+		t.Errorf("Expected a truncation warning, got %q", result.Warning)
+	}
+
+	// A cap above the server's is clamped to it
+	req.MaxResponseBytes = 1 << 20
+	result, err = service.Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.RawHTML != page {
+		t.Errorf("Expected the whole page within the server cap, got %d bytes", len(result.RawHTML))
+	}
+	if !strings.Contains(result.Warning, "exceeds the maximum of 65536 and was clamped") {
+		t.Errorf("Expected a clamp warning, got %q", result.Warning)
+	}
+}
+
+func TestScrapeIncludeByteCounts(t *testing.T) {
+	page := "<html><body><p>" + strings.Repeat("content ", 500) + "</p></body></html>"
+	server := newTestServer(page)
+	defer server.Close()
+
+	service := NewService()
+
+	result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown"}}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.BytesSent != 0 || result.Metadata.BytesReceived != 0 {
+		t.Errorf("Expected no byte counts unless requested, got %d sent and %d received", result.Metadata.BytesSent, result.Metadata.BytesReceived)
+	}
+
+	result, err = service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown"}, IncludeByteCounts: true}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Metadata.BytesSent <= 0 {
+		t.Errorf("Expected bytes sent to be counted, got %d", result.Metadata.BytesSent)
+	}
+	if result.Metadata.BytesReceived <= int64(len(page)) {
+		t.Errorf("Expected more than the %d byte body received, got %d", len(page), result.Metadata.BytesReceived)
+	}
+
+	// Job stats total the pages' counts
+	var stats model.TransferStats
+	stats.Add(result.Metadata)
+	stats.Add(result.Metadata)
+	if stats.TotalBytesReceived != 2*result.Metadata.BytesReceived || stats.TotalBytesSent != 2*result.Metadata.BytesSent {
+		t.Errorf("Expected totals of both pages, got %+v", stats)
+	}
+}
+
+func TestScrapeIncludeOriginalHTML(t *testing.T) {
+	page := `<html><body><nav>Site navigation</nav><main><p>Article body</p></main></body></html>`
+	server := newTestServer(page)
+	defer server.Close()
+
+	service := NewService()
+	req := model.ScrapeRequest{
+		URL: server.URL,
+		ScrapeOptions: model.ScrapeOptions{
+			Formats:         []string{"html"},
+			OnlyMainContent: true,
+		},
+	}
+
+	result, err := service.Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.OriginalHTML != "" {
+		t.Errorf("Expected no original HTML unless requested, got %q", result.OriginalHTML)
+	}
+
+	req.IncludeOriginalHTML = true
+	result, err = service.Scrape(req)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if strings.Contains(result.HTML, "Site navigation") {
+		t.Errorf("Expected the filtered HTML to drop the nav, got %q", result.HTML)
+	}
+	if !strings.Contains(result.OriginalHTML, "Site navigation") || !strings.Contains(result.OriginalHTML, "Article body") {
+		t.Errorf("Expected the original HTML to keep the whole page, got %q", result.OriginalHTML)
+	}
+	if result.OriginalHTML == result.HTML {
+		t.Error("Expected the original and filtered HTML to differ")
+	}
+	if result.OriginalHTML != page {
+		t.Errorf("Expected the body as served, got %q", result.OriginalHTML)
+	}
+}
+
+func TestOriginalHTMLLimit(t *testing.T) {
+	// A multi-byte character straddles the cap
+	body := []byte(strings.Repeat("a", maxOriginalHTMLBytes-1) + "é" + "tail")
+
+	got, truncated := originalHTML(body)
+	if !truncated {
+		t.Fatal("Expected a body over the cap to be truncated")
+	}
+	if len(got) != maxOriginalHTMLBytes-1 || !utf8.ValidString(got) {
+		t.Errorf("Expected a cut at the last whole character, got %d bytes", len(got))
+	}
+
+	if got, truncated := originalHTML([]byte("<p>short</p>")); truncated || got != "<p>short</p>" {
+		t.Errorf("Expected a short body unchanged, got %q (truncated %v)", got, truncated)
+	}
+}
+
+func TestProcessBatchJobURLStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body><p>Found</p></body></html>")
+	}))
+	defer server.Close()
+
+	var statuses []model.BatchURLStatus
+	urls := []string{server.URL + "/found", server.URL + "/missing"}
+	NewService().ProcessBatchJob("job-4", urls, model.BatchScrapeRequest{}, func(_ string, result model.ScrapeResult) error {
+		statuses = append(statuses, result.URLStatus())
+		return nil
+	})
+
+	if len(statuses) != 2 {
+		t.Fatalf("Expected a status for each URL, got %v", statuses)
+	}
+	if statuses[0].URL != urls[0] || !statuses[0].Success || statuses[0].StatusCode != http.StatusOK {
+		t.Errorf("Expected the first URL to succeed, got %+v", statuses[0])
+	}
+	if statuses[1].URL != urls[1] || statuses[1].Success || statuses[1].Error == "" {
+		t.Errorf("Expected the second URL to fail with its error, got %+v", statuses[1])
+	}
+}
+
+func TestProcessBatchJobFormats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body><p>No links here</p></body></html>")
+	}))
+	defer server.Close()
+
+	var results []model.ScrapeResult
+	req := model.BatchScrapeRequest{ScrapeOptions: model.ScrapeOptions{Formats: []string{"md", "links", "html"}}}
+	NewService().ProcessBatchJob("job-5", []string{server.URL}, req, func(_ string, result model.ScrapeResult) error {
+		results = append(results, result)
+		return nil
+	})
+
+	if len(results) != 1 {
+		t.Fatalf("Expected one result, got %d", len(results))
+	}
+	// links was requested but the page has none
+	want := []string{"markdown", "html"}
+	if !reflect.DeepEqual(results[0].Formats, want) {
+		t.Errorf("Expected formats %v, got %v", want, results[0].Formats)
+	}
+}
+
+func TestBatchScrapeDedupeURLs(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body><p>Page</p></body></html>")
+	}))
+	defer server.Close()
+
+	service := NewService()
+	req := model.BatchScrapeRequest{URLs: []string{
+		server.URL + "/a",
+		server.URL + "/b",
+		server.URL + "/a/",
+		server.URL + "/a#section",
+		server.URL + "/b",
+	}}
+	valid, _, duplicates, err := service.BatchScrape(req)
+	if err != nil {
+		t.Fatalf("BatchScrape() error = %v", err)
+	}
+	if want := []string{server.URL + "/a", server.URL + "/b"}; !reflect.DeepEqual(valid, want) {
+		t.Errorf("Expected valid URLs %v, got %v", want, valid)
+	}
+	if want := req.URLs[2:]; !reflect.DeepEqual(duplicates, want) {
+		t.Errorf("Expected duplicates %v, got %v", want, duplicates)
+	}
+
+	service.ProcessBatchJob("job-6", valid, req, nil)
+	for _, path := range []string{"/a", "/b"} {
+		if hits[path] != 1 {
+			t.Errorf("Expected %s to be scraped once, got %d", path, hits[path])
+		}
+	}
+
+	// Opting out keeps every URL
+	disabled := false
+	req.DedupeURLs = &disabled
+	valid, _, duplicates, _ = service.BatchScrape(req)
+	if len(valid) != len(req.URLs) || duplicates != nil {
+		t.Errorf("Expected every URL kept with dedupeUrls off, got %v and duplicates %v", valid, duplicates)
+	}
+}
@@ -0,0 +1,82 @@
+package scraper
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// Screenshot formats, rendered by the browser backend.
+const (
+	formatScreenshot         = "screenshot"
+	formatScreenshotFullPage = "screenshot@fullPage"
+)
+
+// DefaultMaxScreenshotBytes is the largest screenshot kept when no cap is
+// configured. Full-page captures of long pages can grow to many megabytes,
+// which adds up across a crawl's stored results.
+const DefaultMaxScreenshotBytes = 5 << 20
+
+// screenshotFormat reports whether a screenshot was requested, and whether
+// it should capture the full page.
+func screenshotFormat(formats []string) (requested, fullPage bool) {
+	for _, format := range formats {
+		switch format {
+		case formatScreenshotFullPage:
+			return true, true
+		case formatScreenshot:
+			requested = true
+		}
+	}
+	return requested, false
+}
+
+// captureScreenshot adds a base64-encoded PNG of the page to the result when
+// one was requested. It returns a warning instead of failing the scrape when
+// the browser is unavailable or the capture fails.
+func (s *Service) captureScreenshot(req model.ScrapeRequest, result *model.ScrapeResult) string {
+	requested, fullPage := screenshotFormat(req.Formats)
+	if !requested {
+		return ""
+	}
+
+	if s.browser == nil {
+		if s.browserErr != nil {
+			return "screenshot skipped: " + s.browserErr.Error()
+		}
+		return "screenshot skipped: no browser configured"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Timeout)*time.Millisecond)
+	defer cancel()
+
+	s.limiter.Wait()
+	image, err := s.browser.Screenshot(ctx, req.URL, ScreenshotOptions{
+		PageOptions: s.pageOptions(req),
+		FullPage:    fullPage,
+	})
+	if err != nil {
+		return "screenshot skipped: " + err.Error()
+	}
+	if s.maxScreenshotBytes > 0 && len(image) > s.maxScreenshotBytes {
+		return fmt.Sprintf("screenshot skipped: %d bytes exceeds the %d byte limit", len(image), s.maxScreenshotBytes)
+	}
+
+	result.Screenshot = base64.StdEncoding.EncodeToString(image)
+	return ""
+}
+
+// joinWarnings combines the non-empty warnings into one message.
+func joinWarnings(warnings ...string) string {
+	kept := make([]string, 0, len(warnings))
+	for _, warning := range warnings {
+		if warning != "" {
+			kept = append(kept, warning)
+		}
+	}
+	return strings.Join(kept, "; ")
+}
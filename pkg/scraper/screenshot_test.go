@@ -0,0 +1,106 @@
+package scraper
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// fakeBrowser returns a fixed image or page and records the last options.
+type fakeBrowser struct {
+	image      []byte
+	opts       ScreenshotOptions
+	html       string
+	renderOpts RenderOptions
+}
+
+func (b *fakeBrowser) Screenshot(_ context.Context, _ string, opts ScreenshotOptions) ([]byte, error) {
+	b.opts = opts
+	return b.image, nil
+}
+
+func (b *fakeBrowser) Render(_ context.Context, _ string, opts RenderOptions) (*RenderedPage, error) {
+	b.renderOpts = opts
+	page := &RenderedPage{HTML: b.html}
+	for _, action := range opts.Actions {
+		page.Actions = append(page.Actions, model.ActionResult{Type: action.Type, Selector: action.Selector, DurationMS: 5})
+	}
+	return page, nil
+}
+
+func TestScrapeScreenshot(t *testing.T) {
+	server := newTestServer(`<html><body><p>Hello</p></body></html>`)
+	defer server.Close()
+
+	browser := &fakeBrowser{image: []byte("\x89PNG fake")}
+	service := NewServiceWithOptions(ServiceOptions{Browser: browser})
+
+	result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown", "screenshot@fullPage"}}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Screenshot != base64.StdEncoding.EncodeToString(browser.image) {
+		t.Errorf("Expected the base64 screenshot, got %q", result.Screenshot)
+	}
+	if !browser.opts.FullPage {
+		t.Error("Expected a full-page capture for screenshot@fullPage")
+	}
+	if !strings.Contains(result.Markdown, "Hello") {
+		t.Errorf("Expected markdown alongside the screenshot, got %q", result.Markdown)
+	}
+
+	// Without the format no screenshot is taken
+	result, err = service.Scrape(model.ScrapeRequest{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Screenshot != "" {
+		t.Error("Expected no screenshot when the format isn't requested")
+	}
+}
+
+func TestScrapeScreenshotWithoutBrowser(t *testing.T) {
+	server := newTestServer(`<html><body><p>Hello</p></body></html>`)
+	defer server.Close()
+
+	service := NewServiceWithOptions(ServiceOptions{BrowserPath: "/nonexistent/chromium"})
+	if service.HasBrowser() {
+		t.Fatal("Expected no browser for a missing binary")
+	}
+
+	result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"markdown", "screenshot"}}})
+	if err != nil {
+		t.Fatalf("Expected the scrape to succeed without a browser, got %v", err)
+	}
+	if result.Screenshot != "" {
+		t.Error("Expected no screenshot without a browser")
+	}
+	if !strings.Contains(result.Warning, "screenshot skipped") {
+		t.Errorf("Expected a screenshot warning, got %q", result.Warning)
+	}
+	if !strings.Contains(result.Markdown, "Hello") {
+		t.Errorf("Expected the other formats to still be returned, got %q", result.Markdown)
+	}
+}
+
+func TestScrapeScreenshotSizeCap(t *testing.T) {
+	server := newTestServer(`<html><body><p>Hello</p></body></html>`)
+	defer server.Close()
+
+	browser := &fakeBrowser{image: []byte(strings.Repeat("x", 64))}
+	service := NewServiceWithOptions(ServiceOptions{Browser: browser, MaxScreenshotBytes: 32})
+
+	result, err := service.Scrape(model.ScrapeRequest{URL: server.URL, ScrapeOptions: model.ScrapeOptions{Formats: []string{"screenshot"}}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	if result.Screenshot != "" {
+		t.Error("Expected an oversized screenshot to be dropped")
+	}
+	if !strings.Contains(result.Warning, "exceeds") {
+		t.Errorf("Expected a size warning, got %q", result.Warning)
+	}
+}
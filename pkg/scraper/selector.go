@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/ncecere/rummage/pkg/model"
+	"golang.org/x/net/html"
+)
+
+// ValidateSelector reports whether the CSS selector parses.
+func ValidateSelector(selector string) error {
+	_, err := cascadia.Compile(selector)
+	return err
+}
+
+// selectorPollInterval is the pause between re-fetches while waiting for a
+// selector to appear.
+const selectorPollInterval = 500 * time.Millisecond
+
+// inertContentSelector matches elements whose content isn't rendered until
+// scripts run.
+const inertContentSelector = `template, noscript, script[type="text/template"], script[type="text/x-template"]`
+
+// waitForSelector re-fetches the page until the requested selector appears in
+// the static HTML or the selector timeout expires.
+func (s *Service) waitForSelector(sc *scraper, result *model.ScrapeResult) *model.ScrapeResult {
+	if sc.request.WaitForSelector == "" || sc.request.WaitForSelectorTimeout <= 0 {
+		return result
+	}
+
+	// The fixed wait only applies to the first fetch
+	sc.request.WaitFor = 0
+
+	deadline := time.Now().Add(time.Duration(sc.request.WaitForSelectorTimeout) * time.Millisecond)
+	for !selectorFound(result) && time.Now().Add(selectorPollInterval).Before(deadline) {
+		time.Sleep(selectorPollInterval)
+
+		s.limiter.Wait()
+		next, err := sc.scrape()
+		if err != nil {
+			break
+		}
+		result = next
+	}
+
+	return result
+}
+
+// selectorWarning explains a WaitForSelector that never appeared. The scrape
+// still returns whatever the page held.
+func selectorWarning(req model.ScrapeRequest, result *model.ScrapeResult) string {
+	if req.WaitForSelector == "" || selectorFound(result) {
+		return ""
+	}
+
+	warning := fmt.Sprintf("waitForSelector %q did not appear within %dms", req.WaitForSelector, req.WaitForSelectorTimeout)
+	if result.Metadata != nil && result.Metadata.RequiresBrowser {
+		warning += "; the page appears to render it with JavaScript"
+	}
+	return warning
+}
+
+// selectorFound reports whether the result recorded the selector as present.
+func selectorFound(result *model.ScrapeResult) bool {
+	return result.Metadata != nil && result.Metadata.SelectorFound != nil && *result.Metadata.SelectorFound
+}
+
+// selectorRendered reports whether the selector matches an element outside
+// any <template>, whose content the parser keeps but browsers don't render.
+func selectorRendered(doc *goquery.Document, selector string) bool {
+	return doc.Find(selector).FilterFunction(func(_ int, sel *goquery.Selection) bool {
+		return sel.Closest("template").Length() == 0
+	}).Length() > 0
+}
+
+// selectorInInertContent reports whether the selector matches markup that is
+// only present inside comments, templates or noscript blocks, which suggests
+// the page renders it with JavaScript.
+func selectorInInertContent(doc *goquery.Document, selector string) bool {
+	fragments := make([]string, 0)
+
+	doc.Find(inertContentSelector).Each(func(_ int, sel *goquery.Selection) {
+		if goquery.NodeName(sel) == "template" {
+			if inner, err := sel.Html(); err == nil {
+				fragments = append(fragments, inner)
+			}
+			return
+		}
+		fragments = append(fragments, sel.Text())
+	})
+
+	for _, root := range doc.Nodes {
+		collectComments(root, &fragments)
+	}
+
+	for _, fragment := range fragments {
+		fragmentDoc, err := goquery.NewDocumentFromReader(strings.NewReader(fragment))
+		if err != nil {
+			continue
+		}
+		if fragmentDoc.Find(selector).Length() > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collectComments appends the text of every comment under the node.
+func collectComments(n *html.Node, comments *[]string) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.CommentNode {
+			*comments = append(*comments, child.Data)
+			continue
+		}
+		collectComments(child, comments)
+	}
+}
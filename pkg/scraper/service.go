@@ -2,57 +2,398 @@
 package scraper
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/ncecere/rummage/pkg/llm"
 	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+	"github.com/ncecere/rummage/pkg/storage"
 	"github.com/ncecere/rummage/pkg/utils"
+	"github.com/ncecere/rummage/pkg/webhook"
 )
 
+// DefaultTimeoutMS is the scrape timeout used when a request doesn't set one.
+const DefaultTimeoutMS = 30000
+
+// DefaultUserAgent is the User-Agent sent when none is configured.
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/109.0.0.0 Safari/537.36"
+
+// MobileUserAgent is sent instead for mobile scrapes, so responsive sites
+// serve their mobile layout.
+const MobileUserAgent = "Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1"
+
 // Service provides web scraping functionality.
 type Service struct {
-	client *http.Client
+	client        *http.Client
+	maxTimeoutMS  int
+	userAgent     string
+	imageHandling string
+	soft404       *soft404Detector
+	paywall       *paywallDetector
+	limiter       *ratelimit.Limiter
+
+	// Media types the rawHtml format may return
+	rawContentTypes []string
+
+	// Largest response body read; requests may only lower it
+	maxResponseBytes int
+
+	// Headless browser for screenshots; browserErr explains why it's missing
+	browser    Browser
+	browserErr error
+
+	// Largest screenshot kept in a result, in bytes before encoding
+	maxScreenshotBytes int
+
+	// LLM client for the json format; nil disables it
+	llm *llm.Client
+
+	// Reports batch lifecycle events to the batch's webhook
+	webhookFn func(cfg *model.WebhookConfig, job, event string, payload model.WebhookEvent)
+
+	// Running batch jobs, shared with copies of the service
+	batches *batchJobs
+}
+
+// ServiceOptions contains options for creating a scraper service.
+type ServiceOptions struct {
+	// MaxRequestTimeout is the ceiling applied to every requested timeout.
+	// Zero means no ceiling.
+	MaxRequestTimeout time.Duration
+
+	// UserAgent is sent with every scrape. Defaults to DefaultUserAgent.
+	UserAgent string
+
+	// ImageHandling is the markdown image handling mode used when a request
+	// doesn't set one. Defaults to model.ImageHandlingKeep.
+	ImageHandling string
+
+	// Soft404Patterns are the phrases that mark a page as a soft 404.
+	// Defaults to DefaultSoft404Patterns.
+	Soft404Patterns []string
+
+	// RawContentTypes are the media types the rawHtml format may return,
+	// such as "text/*" or "application/json". Defaults to
+	// DefaultRawContentTypes.
+	RawContentTypes []string
+	// MaxResponseBytes caps the response body read for every scrape;
+	// requests may set a smaller cap. Defaults to DefaultMaxResponseBytes.
+	MaxResponseBytes int
+	// PaywallMarkers are the CSS selectors that mark a page as paywalled.
+	// Defaults to DefaultPaywallMarkers.
+	PaywallMarkers []string
+
+	// Limiter is the server-wide outbound rate limit shared with other
+	// services. Nil means unlimited.
+	Limiter *ratelimit.Limiter
+
+	// BrowserPath is the Chrome or Chromium binary used for screenshot
+	// formats. Empty disables them.
+	BrowserPath string
+
+	// Browser overrides the browser backend started from BrowserPath.
+	Browser Browser
+
+	// MaxScreenshotBytes caps the size of a captured screenshot; larger
+	// ones are dropped with a warning. Defaults to DefaultMaxScreenshotBytes.
+	MaxScreenshotBytes int
+
+	// LLM runs the extraction for the json format. Nil disables it.
+	LLM *llm.Client
+
+	// ProxyURL routes requests through an HTTP, HTTPS or SOCKS5 proxy
+	// unless a request sets its own. Empty connects directly.
+	ProxyURL string
+
+	// WebhookFn reports batch lifecycle events to the batch's webhook; it
+	// must not block. Defaults to an unsigned webhook.Notifier.
+	WebhookFn func(cfg *model.WebhookConfig, job, event string, payload model.WebhookEvent)
 }
 
 // NewService creates a new scraper service.
 func NewService() *Service {
+	return NewServiceWithOptions(ServiceOptions{})
+}
+
+// NewServiceWithOptions creates a new scraper service with custom options.
+func NewServiceWithOptions(opts ServiceOptions) *Service {
+	userAgent := opts.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	imageHandling := opts.ImageHandling
+	if !model.IsValidImageHandling(imageHandling) {
+		imageHandling = model.ImageHandlingKeep
+	}
+
+	// Screenshots need a browser; without one they're skipped with a warning
+	browser := opts.Browser
+	var browserErr error
+	if browser == nil && opts.BrowserPath != "" {
+		browser, browserErr = NewChromeBrowser(opts.BrowserPath)
+	}
+	maxScreenshotBytes := opts.MaxScreenshotBytes
+	if maxScreenshotBytes <= 0 {
+		maxScreenshotBytes = DefaultMaxScreenshotBytes
+	}
+	rawContentTypes := opts.RawContentTypes
+	if len(rawContentTypes) == 0 {
+		rawContentTypes = DefaultRawContentTypes
+	}
+	maxResponseBytes := opts.MaxResponseBytes
+	if maxResponseBytes <= 0 {
+		maxResponseBytes = DefaultMaxResponseBytes
+	}
+	webhookFn := opts.WebhookFn
+	if webhookFn == nil {
+		webhookFn = webhook.NewNotifier("").Notify
+	}
+
+	// Route every request through the default proxy, if one is configured
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+	if opts.ProxyURL != "" {
+		if proxy, err := utils.ParseProxy(opts.ProxyURL); err == nil {
+			client.Transport = configureTransport(nil, false, proxy)
+		}
+	}
+
+	return &Service{
+		client:        client,
+		maxTimeoutMS:  int(opts.MaxRequestTimeout / time.Millisecond),
+		userAgent:     userAgent,
+		imageHandling: imageHandling,
+		soft404:       newSoft404Detector(opts.Soft404Patterns, opts.Limiter),
+		paywall:       newPaywallDetector(opts.PaywallMarkers),
+		limiter:       opts.Limiter,
+		browser:       browser,
+		browserErr:    browserErr,
+		llm:           opts.LLM,
+		webhookFn:     webhookFn,
+		batches:       newBatchJobs(),
+
+		rawContentTypes:    rawContentTypes,
+		maxResponseBytes:   maxResponseBytes,
+		maxScreenshotBytes: maxScreenshotBytes,
+	}
+}
+
+// MaxTimeoutMS returns the timeout ceiling in milliseconds, or zero if unset.
+func (s *Service) MaxTimeoutMS() int {
+	return s.maxTimeoutMS
+}
+
+// WithTransport returns a copy of the service that sends requests through the
+// given transport instead of the shared default.
+func (s *Service) WithTransport(rt http.RoundTripper) *Service {
 	return &Service{
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   s.client.Timeout,
+			Transport: rt,
 		},
+		maxTimeoutMS:  s.maxTimeoutMS,
+		userAgent:     s.userAgent,
+		imageHandling: s.imageHandling,
+		soft404:       s.soft404,
+		paywall:       s.paywall,
+		limiter:       s.limiter,
+		browser:       s.browser,
+		browserErr:    s.browserErr,
+		llm:           s.llm,
+		webhookFn:     s.webhookFn,
+		batches:       s.batches,
+
+		rawContentTypes:    s.rawContentTypes,
+		maxResponseBytes:   s.maxResponseBytes,
+		maxScreenshotBytes: s.maxScreenshotBytes,
+	}
+}
+
+// ImageHandling returns the markdown image handling used when a request
+// doesn't set one.
+func (s *Service) ImageHandling() string {
+	return s.imageHandling
+}
+
+// UserAgent returns the User-Agent sent with scrapes.
+func (s *Service) UserAgent() string {
+	return s.userAgent
+}
+
+// requestUserAgent returns the User-Agent to send for the request: the mobile
+// one when the request asks for mobile, the configured one otherwise.
+func (s *Service) requestUserAgent(req model.ScrapeRequest) string {
+	if req.Mobile {
+		return MobileUserAgent
+	}
+	return s.userAgent
+}
+
+// pageOptions returns how the browser should present itself for the request.
+func (s *Service) pageOptions(req model.ScrapeRequest) PageOptions {
+	return PageOptions{
+		UserAgent: s.requestUserAgent(req),
+		Mobile:    req.Mobile,
+		Headers:   requestHeaders(req),
+		Location:  req.Location,
 	}
 }
 
 // Scrape scrapes a single URL and returns the result.
 func (s *Service) Scrape(req model.ScrapeRequest) (*model.ScrapeResult, error) {
+	return s.ScrapeContext(context.Background(), req)
+}
+
+// ScrapeContext scrapes a single URL, aborting the fetch if ctx is
+// cancelled.
+func (s *Service) ScrapeContext(ctx context.Context, req model.ScrapeRequest) (*model.ScrapeResult, error) {
+	return s.scrapeContext(ctx, req, nil)
+}
+
+// scrapeContext scrapes a single URL. When stream is set, the markdown is
+// passed to it block by block instead of being returned in the result.
+func (s *Service) scrapeContext(ctx context.Context, req model.ScrapeRequest, stream func(chunk string) error) (*model.ScrapeResult, error) {
 	// Validate request
 	if req.URL == "" {
 		return nil, errors.New("URL is required")
 	}
 
+	// The base URL override must be absolute to resolve against
+	if req.BaseURLOverride != "" && !utils.IsValidURL(req.BaseURLOverride) {
+		return nil, errors.New("baseURLOverride must be an absolute URL")
+	}
+
+	// Fall back to the configured image handling
+	if req.ImageHandling == "" {
+		req.ImageHandling = s.imageHandling
+	} else if !model.IsValidImageHandling(req.ImageHandling) {
+		return nil, errors.New("imageHandling must be one of keep, strip or alt")
+	}
+
+	// Reject unknown normalization forms
+	if req.UnicodeNormalization != "" && !model.IsValidUnicodeNormalization(req.UnicodeNormalization) {
+		return nil, errors.New("unicodeNormalization must be one of none, nfc or nfkc")
+	}
+
+	// The content selector must parse before anything is fetched
+	if req.ContentSelector != "" {
+		if err := ValidateSelector(req.ContentSelector); err != nil {
+			return nil, fmt.Errorf("invalid contentSelector: %w", err)
+		}
+	}
+
+	// The awaited selector must parse, or it could never be found
+	if req.WaitForSelector != "" {
+		if err := ValidateSelector(req.WaitForSelector); err != nil {
+			return nil, fmt.Errorf("invalid waitForSelector: %w", err)
+		}
+	}
+
+	// The proxy must be one the transport can use
+	if req.Proxy != "" {
+		if _, err := utils.ParseProxy(req.Proxy); err != nil {
+			return nil, err
+		}
+	}
+
+	// JSON extraction needs something to extract
+	if err := model.ValidateJSONFormat(req.Formats, req.JSONOptions); err != nil {
+		return nil, err
+	}
+
+	// Actions must be well formed before a browser is started
+	if err := model.ValidateActions(req.Actions); err != nil {
+		return nil, err
+	}
+
 	// Set default formats if none provided
 	if len(req.Formats) == 0 {
 		req.Formats = []string{"markdown"}
 	}
+	req.Formats = normalizeFormats(req.Formats)
+
+	// Set default timeout if not provided, capped at the configured ceiling
+	var warning string
+	req.Timeout, warning = utils.ResolveTimeout(req.Timeout, DefaultTimeoutMS, s.maxTimeoutMS)
+
+	// Selector polling is bounded by the same ceiling as the request timeout
+	if s.maxTimeoutMS > 0 && req.WaitForSelectorTimeout > s.maxTimeoutMS {
+		req.WaitForSelectorTimeout = s.maxTimeoutMS
+	}
 
-	// Set default timeout if not provided
-	if req.Timeout <= 0 {
-		req.Timeout = 30000 // 30 seconds
+	// JSON extraction reads the page markdown, even when it isn't returned
+	scrapeReq := req
+	markdownForExtract := hasFormat(req.Formats, formatJSON) && !hasFormat(req.Formats, "markdown")
+	if markdownForExtract {
+		scrapeReq.Formats = append(append([]string(nil), req.Formats...), "markdown")
 	}
 
 	// Create a scraper for this request
-	scraper := newScraper(s.client, req)
+	scraper := newScraper(s.client, scrapeReq)
+	scraper.userAgent = s.requestUserAgent(req)
+	scraper.soft404 = s.soft404
+	scraper.paywall = s.paywall
+	scraper.rawContentTypes = s.rawContentTypes
+	var limitWarning string
+	scraper.maxResponseBytes, limitWarning = resolveMaxResponseBytes(req.MaxResponseBytes, s.maxResponseBytes)
+	scraper.streamMarkdown = stream != nil
 
-	// Perform the scrape
-	return scraper.scrape()
+	// Wait for the global rate limit, then perform the scrape
+	s.limiter.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	scraper.ctx = ctx
+
+	// Pages with actions are loaded and driven in the browser first
+	if len(req.Actions) > 0 {
+		rendered, err := s.renderWithActions(req)
+		if err != nil {
+			return nil, err
+		}
+		scraper.rendered = rendered
+	}
+
+	result, err := scraper.scrape()
+	if err != nil {
+		return nil, err
+	}
+	result = s.waitForSelector(scraper, result)
+
+	// Skip pages in languages the caller doesn't want
+	languageWarning := languageMismatch(req, result)
+	if languageWarning != "" && req.ErrorOnLanguageMismatch {
+		return nil, errors.New(languageWarning)
+	}
+
+	if stream != nil {
+		if err := scraper.writeMarkdown(stream); err != nil {
+			return nil, err
+		}
+	}
+
+	markdown := result.Markdown
+	if markdownForExtract {
+		result.Markdown = ""
+	}
+	result.Warning = joinWarnings(warning, limitWarning, truncationWarning(scraper.truncated, scraper.maxResponseBytes), originalHTMLWarning(scraper.originalTruncated), languageWarning, selectorWarning(req, result), s.captureScreenshot(req, result), s.extractJSON(req, result, markdown))
+
+	return result, nil
 }
 
-// BatchScrape scrapes multiple URLs asynchronously.
-func (s *Service) BatchScrape(req model.BatchScrapeRequest) ([]string, []string, error) {
+// BatchScrape validates the URLs of a batch before it is scheduled, returning
+// the valid and invalid URLs and, when dedupeUrls is on, the duplicates left
+// out.
+func (s *Service) BatchScrape(req model.BatchScrapeRequest) ([]string, []string, []string, error) {
 	// Validate request
 	if len(req.URLs) == 0 {
-		return nil, nil, errors.New("at least one URL is required")
+		return nil, nil, nil, errors.New("at least one URL is required")
 	}
 
 	// Set default formats if none provided
@@ -60,16 +401,53 @@ func (s *Service) BatchScrape(req model.BatchScrapeRequest) ([]string, []string,
 		req.Formats = []string{"markdown"}
 	}
 
-	// Set default timeout if not provided
-	if req.Timeout <= 0 {
-		req.Timeout = 30000 // 30 seconds
+	// Reject unknown image handling modes up front
+	if req.ImageHandling != "" && !model.IsValidImageHandling(req.ImageHandling) {
+		return nil, nil, nil, errors.New("imageHandling must be one of keep, strip or alt")
+	}
+	if req.UnicodeNormalization != "" && !model.IsValidUnicodeNormalization(req.UnicodeNormalization) {
+		return nil, nil, nil, errors.New("unicodeNormalization must be one of none, nfc or nfkc")
+	}
+
+	// The content selector must parse before anything is fetched
+	if req.ContentSelector != "" {
+		if err := ValidateSelector(req.ContentSelector); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid contentSelector: %w", err)
+		}
+	}
+
+	// The proxy must be one the transport can use
+	if req.Proxy != "" {
+		if _, err := utils.ParseProxy(req.Proxy); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// JSON extraction needs something to extract
+	if err := model.ValidateJSONFormat(req.Formats, req.JSONOptions); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Actions must be well formed before a browser is started
+	if err := model.ValidateActions(req.Actions); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Set default timeout if not provided, capped at the configured ceiling
+	req.Timeout, _ = utils.ResolveTimeout(req.Timeout, DefaultTimeoutMS, s.maxTimeoutMS)
+
+	// Scrape each URL once, however it was written
+	urls := req.URLs
+	var duplicateURLs []string
+	if req.ShouldDedupeURLs() {
+		urls, duplicateURLs = dedupeURLs(urls)
 	}
 
 	// Validate URLs and separate valid from invalid
-	validURLs := make([]string, 0, len(req.URLs))
+	validURLs := make([]string, 0, len(urls))
 	invalidURLs := make([]string, 0)
 
-	for _, url := range req.URLs {
+	for _, url := range urls {
 		if utils.IsValidURL(url) {
 			validURLs = append(validURLs, url)
 		} else {
@@ -79,37 +457,74 @@ func (s *Service) BatchScrape(req model.BatchScrapeRequest) ([]string, []string,
 
 	// If ignoreInvalidURLs is false and there are invalid URLs, return an error
 	if !req.IgnoreInvalidURLs && len(invalidURLs) > 0 {
-		return validURLs, invalidURLs, errors.New("invalid URLs detected")
+		return validURLs, invalidURLs, duplicateURLs, errors.New("invalid URLs detected")
 	}
 
 	// If no valid URLs, return an error
 	if len(validURLs) == 0 {
-		return nil, invalidURLs, errors.New("no valid URLs provided")
+		return nil, invalidURLs, duplicateURLs, errors.New("no valid URLs provided")
 	}
 
-	return validURLs, invalidURLs, nil
+	return validURLs, invalidURLs, duplicateURLs, nil
+}
+
+// dedupeURLs keeps the first of each group of URLs that normalize alike,
+// such as ones differing only by a fragment or trailing slash, returning the
+// others as duplicates.
+func dedupeURLs(urls []string) ([]string, []string) {
+	unique := make([]string, 0, len(urls))
+	var duplicates []string
+	seen := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		key := utils.NormalizeURL(url)
+		if seen[key] {
+			duplicates = append(duplicates, url)
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, url)
+	}
+	return unique, duplicates
 }
 
 // ProcessBatchJob processes a batch job with the given URLs and options.
 func (s *Service) ProcessBatchJob(jobID string, urls []string, req model.BatchScrapeRequest,
 	resultCallback func(string, model.ScrapeResult) error) {
 
+	// Retry and buffer result writes so a storage outage doesn't lose pages
+	var results *storage.BufferedWriter
+	if resultCallback != nil {
+		results = storage.NewBufferedWriter(resultCallback, 0)
+		resultCallback = results.Write
+	}
+
+	// Cancelling the job stops it between URLs and aborts the fetch in flight
+	ctx, done := s.batches.start(jobID)
+	defer done()
+
+	// Webhooks are delivered in the background; failures don't affect the job
+	notify := func(event string, payload model.WebhookEvent) {
+		payload.ID = jobID
+		payload.Total = len(urls)
+		s.webhookFn(req.Webhook, model.WebhookJobBatch, event, payload)
+	}
+	notify(model.WebhookStarted, model.WebhookEvent{})
+
 	// Process each URL
+	completed := 0
 	for _, url := range urls {
-		// Create a scrape request for this URL
-		scrapeReq := model.ScrapeRequest{
-			URL:             url,
-			Formats:         req.Formats,
-			OnlyMainContent: req.OnlyMainContent,
-			IncludeTags:     req.IncludeTags,
-			ExcludeTags:     req.ExcludeTags,
-			Headers:         req.Headers,
-			WaitFor:         req.WaitFor,
-			Timeout:         req.Timeout,
+		if ctx.Err() != nil {
+			break
 		}
 
-		// Scrape the URL
-		result, err := s.Scrape(scrapeReq)
+		scrapeReq := req.ScrapeOptions.Request(url)
+
+		// Scrape the URL; a page cut short by cancellation isn't recorded
+		result, err := s.ScrapeContext(ctx, scrapeReq)
+		if ctx.Err() != nil {
+			break
+		}
+		page := model.WebhookEvent{}
 		if err != nil {
 			// Create an error result
 			result = &model.ScrapeResult{
@@ -117,12 +532,33 @@ func (s *Service) ProcessBatchJob(jobID string, urls []string, req model.BatchSc
 					SourceURL:  url,
 					StatusCode: http.StatusInternalServerError,
 				},
+				Error: err.Error(),
 			}
+			page.Error = err.Error()
+		} else {
+			result.Formats = populatedFormats(scrapeReq.Formats, result)
+			completed++
 		}
 
 		// Call the result callback
 		if resultCallback != nil {
 			_ = resultCallback(jobID, *result)
 		}
+
+		page.Completed = completed
+		page.Data = result
+		notify(model.WebhookPage, page)
+	}
+
+	// Store results buffered during a storage outage
+	if results != nil {
+		results.Flush()
+	}
+
+	// The batch completes even when every URL failed
+	if ctx.Err() != nil {
+		notify(model.WebhookFailed, model.WebhookEvent{Completed: completed, Error: "batch cancelled"})
+		return
 	}
+	notify(model.WebhookCompleted, model.WebhookEvent{Completed: completed})
 }
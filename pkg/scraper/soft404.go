@@ -0,0 +1,244 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/google/uuid"
+	"github.com/ncecere/rummage/pkg/ratelimit"
+)
+
+const (
+	// soft404ShortTextLength is the page text length below which a "not
+	// found" phrase anywhere in the body marks the page as a soft 404.
+	soft404ShortTextLength = 500
+	// soft404Similarity is the word overlap with the host's known 404 page
+	// above which a page is considered a soft 404.
+	soft404Similarity = 0.9
+	// soft404ProbeMaxBytes caps how much of the probe response is read.
+	soft404ProbeMaxBytes = 1 << 20
+	// soft404CacheTTL is how long a host's probe result is reused.
+	soft404CacheTTL = time.Hour
+	// soft404CacheSize caps the number of hosts whose probe is cached.
+	soft404CacheSize = 1024
+)
+
+// DefaultSoft404Patterns are the phrases that mark a page as a soft 404 when
+// no patterns are configured.
+var DefaultSoft404Patterns = []string{
+	"page not found",
+	"404 not found",
+	"error 404",
+	"page cannot be found",
+	"page could not be found",
+	"page does not exist",
+	"page doesn't exist",
+	"no longer available",
+	"nothing was found",
+}
+
+// soft404Detector flags pages that are served with a success status but are
+// really "not found" pages. It caches each host's 404 page for a while, and
+// concurrent checks on the same host share a single probe.
+type soft404Detector struct {
+	patterns []string
+	limiter  *ratelimit.Limiter
+	now      func() time.Time
+
+	mu    sync.Mutex
+	known map[string]*soft404Probe
+}
+
+// soft404Probe is the probe of one host, done once done is closed.
+type soft404Probe struct {
+	done    chan struct{}
+	words   map[string]bool
+	expires time.Time
+}
+
+// newSoft404Detector creates a detector matching the given phrases
+// case-insensitively. Probes wait on the limiter like any other request.
+func newSoft404Detector(patterns []string, limiter *ratelimit.Limiter) *soft404Detector {
+	if len(patterns) == 0 {
+		patterns = DefaultSoft404Patterns
+	}
+
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern = strings.ToLower(strings.TrimSpace(pattern)); pattern != "" {
+			lowered = append(lowered, pattern)
+		}
+	}
+
+	return &soft404Detector{
+		patterns: lowered,
+		limiter:  limiter,
+		now:      time.Now,
+		known:    make(map[string]*soft404Probe),
+	}
+}
+
+// isSoft404 reports whether the page looks like a "not found" page: its title
+// or main heading contains a pattern, its short body contains one, or its
+// text is nearly identical to the page the host serves for a missing URL.
+func (d *soft404Detector) isSoft404(client *http.Client, userAgent, pageURL string, doc *goquery.Document) bool {
+	heading := strings.ToLower(doc.Find("title").Text() + " " + doc.Find("h1").First().Text())
+	if d.matches(heading) {
+		return true
+	}
+
+	text := pageText(doc)
+	if len(text) < soft404ShortTextLength && d.matches(strings.ToLower(text)) {
+		return true
+	}
+
+	known := d.knownNotFound(client, userAgent, pageURL)
+	return len(known) > 0 && wordSimilarity(wordSet(strings.ToLower(text)), known) >= soft404Similarity
+}
+
+// matches reports whether text contains any of the patterns.
+func (d *soft404Detector) matches(text string) bool {
+	for _, pattern := range d.patterns {
+		if strings.Contains(text, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// knownNotFound returns the words of the page the host serves with a 200 for
+// a URL that can't exist, or nil if the host returns real 404s.
+func (d *soft404Detector) knownNotFound(client *http.Client, userAgent, pageURL string) map[string]bool {
+	u, err := url.Parse(pageURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	now := d.now()
+	if probe, ok := d.known[u.Host]; ok {
+		select {
+		case <-probe.done:
+			if now.Before(probe.expires) {
+				d.mu.Unlock()
+				return probe.words
+			}
+		default:
+			// Another check is probing this host; share its result
+			d.mu.Unlock()
+			<-probe.done
+			return probe.words
+		}
+	}
+
+	probe := &soft404Probe{done: make(chan struct{})}
+	d.evict(now)
+	d.known[u.Host] = probe
+	d.mu.Unlock()
+
+	d.limiter.Wait()
+	words, err := probeNotFound(client, userAgent, u)
+
+	d.mu.Lock()
+	probe.words = words
+	probe.expires = d.now().Add(soft404CacheTTL)
+	// Don't remember a failed probe, so the next check tries again
+	if err != nil && d.known[u.Host] == probe {
+		delete(d.known, u.Host)
+	}
+	close(probe.done)
+	d.mu.Unlock()
+
+	return words
+}
+
+// evict makes room for another host by dropping expired probes and, if the
+// cache is still full, an arbitrary finished one. The caller holds d.mu.
+func (d *soft404Detector) evict(now time.Time) {
+	if len(d.known) < soft404CacheSize {
+		return
+	}
+
+	for host, probe := range d.known {
+		select {
+		case <-probe.done:
+			if !now.Before(probe.expires) {
+				delete(d.known, host)
+			}
+		default:
+		}
+	}
+
+	for host, probe := range d.known {
+		if len(d.known) < soft404CacheSize {
+			return
+		}
+		select {
+		case <-probe.done:
+			delete(d.known, host)
+		default:
+		}
+	}
+}
+
+// probeNotFound requests a random path on the page's host and returns the
+// words of the response if it was served with a 200. It returns an error
+// only when the host couldn't be asked.
+func probeNotFound(client *http.Client, userAgent string, page *url.URL) (map[string]bool, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	probeURL := url.URL{Scheme: page.Scheme, Host: page.Host, Path: "/rummage-probe-" + uuid.New().String()}
+	req, err := http.NewRequest(http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, soft404ProbeMaxBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the probe response: %w", err)
+	}
+
+	return wordSet(strings.ToLower(pageText(doc))), nil
+}
+
+// pageText returns the visible text of the page body with whitespace collapsed.
+func pageText(doc *goquery.Document) string {
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript, template").Remove()
+	return strings.Join(strings.Fields(body.Text()), " ")
+}
+
+// wordSimilarity returns the Jaccard similarity of two word sets.
+func wordSimilarity(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -0,0 +1,150 @@
+package scraper
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// soft404Template is served with a 200 for every unknown path, like a CMS
+// that renders its own "missing" page.
+const soft404Template = `<html><head><title>Acme Store</title></head><body>
+	<nav>Home Products About Contact</nav>
+	<p>Sorry, we looked everywhere but could not locate what you asked for.</p>
+	<p>Try searching our catalogue or browse the categories above.</p>
+</body></html>`
+
+func TestScrapeDetectSoft404(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<html><head><title>Acme Store</title></head><body>
+				<nav>Home Products About Contact</nav>
+				<h1>Spring collection</h1>
+				<p>Browse our new range of jackets, boots and accessories for the season.</p>
+			</body></html>`)
+		case "/missing-title":
+			fmt.Fprint(w, `<html><head><title>Page Not Found | Acme</title></head><body><p>Go home.</p></body></html>`)
+		case "/missing-text":
+			fmt.Fprint(w, `<html><head><title>Acme</title></head><body><p>Error 404: this page does not exist.</p></body></html>`)
+		case "/custom":
+			fmt.Fprint(w, `<html><head><title>Acme</title></head><body><h1>Oops, gone fishing</h1></body></html>`)
+		default:
+			fmt.Fprint(w, soft404Template)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		detect   bool
+		patterns []string
+		want     bool
+	}{
+		{name: "Real page", path: "/", detect: true, want: false},
+		{name: "Pattern in title", path: "/missing-title", detect: true, want: true},
+		{name: "Pattern in short text", path: "/missing-text", detect: true, want: true},
+		{name: "Matches the host's 404 page", path: "/old-product", detect: true, want: true},
+		{name: "Detection off", path: "/missing-title", detect: false, want: false},
+		{name: "Custom pattern", path: "/custom", detect: true, patterns: []string{"Gone Fishing"}, want: true},
+		{name: "Custom patterns replace defaults", path: "/missing-text", detect: true, patterns: []string{"gone fishing"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewServiceWithOptions(ServiceOptions{Soft404Patterns: tt.patterns})
+			result, err := service.Scrape(model.ScrapeRequest{
+				URL: server.URL + tt.path,
+				ScrapeOptions: model.ScrapeOptions{
+					DetectSoft404: tt.detect,
+				},
+			})
+			if err != nil {
+				t.Fatalf("Failed to scrape: %v", err)
+			}
+
+			if result.Metadata.Soft404 != tt.want {
+				t.Errorf("Expected soft404 = %v, got %v", tt.want, result.Metadata.Soft404)
+			}
+		})
+	}
+}
+
+func TestScrapeDetectSoft404RealNotFound(t *testing.T) {
+	// A host that returns real 404s has no soft-404 fingerprint to compare against
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, soft404Template)
+	}))
+	defer server.Close()
+
+	result, err := NewService().Scrape(model.ScrapeRequest{URL: server.URL + "/", ScrapeOptions: model.ScrapeOptions{DetectSoft404: true}})
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+
+	if result.Metadata.Soft404 {
+		t.Error("Expected a page on a host with real 404s not to be flagged")
+	}
+}
+
+func TestSoft404ProbeCache(t *testing.T) {
+	// Drop the connection on the first probe, then serve the soft 404
+	var probes atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if probes.Add(1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, soft404Template)
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	detector := newSoft404Detector(nil, nil)
+	detector.now = func() time.Time { return now }
+	client := server.Client()
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	// A failed probe isn't remembered
+	if words := detector.knownNotFound(client, "test", server.URL+"/a"); words != nil {
+		t.Fatalf("Expected no words from a failed probe, got %v", words)
+	}
+
+	// Concurrent checks on the host share the next probe
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if words := detector.knownNotFound(client, "test", server.URL+"/b"); len(words) == 0 {
+				t.Error("Expected the host's 404 page words")
+			}
+		}()
+	}
+	wg.Wait()
+	if got := probes.Load(); got != 2 {
+		t.Errorf("Expected 2 probes, got %d", got)
+	}
+
+	// The result is reprobed once it expires
+	now = now.Add(soft404CacheTTL)
+	detector.knownNotFound(client, "test", server.URL+"/c")
+	if got := probes.Load(); got != 3 {
+		t.Errorf("Expected an expired result to be reprobed, got %d probes", got)
+	}
+}
@@ -0,0 +1,29 @@
+package scraper
+
+import "strings"
+
+// stopwords maps a base language code to its common stopwords.
+var stopwords = map[string]map[string]bool{
+	"en": wordSet("a an and are as at be but by for from has have he her his i in is it its of on or our she that the their them there they this to was we were what when where which who will with you your"),
+	"es": wordSet("a al como con de del el ella ellos en es esta este la las lo los mas no o para pero por que se si sin su sus un una y"),
+	"fr": wordSet("a au aux avec ce ces dans de des du elle en est et il ils la le les leur mais ne nous on ou par pas pour qui que sa se ses son sur un une vous"),
+	"de": wordSet("als am an auch auf aus bei das dass dem den der des die ein eine einem einen einer es für hat im in ist mit nicht noch oder sich sie sind und von war wie zu zum zur"),
+}
+
+// stopwordsFor returns the stopwords for a language tag such as "en-US",
+// falling back to English when the language is unknown.
+func stopwordsFor(language string) map[string]bool {
+	if words, ok := stopwords[baseLanguage(language)]; ok {
+		return words
+	}
+	return stopwords["en"]
+}
+
+// wordSet builds a lookup set from a space separated word list.
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
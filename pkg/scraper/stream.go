@@ -0,0 +1,53 @@
+package scraper
+
+import (
+	"context"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+	"golang.org/x/net/html"
+)
+
+// ScrapeStream scrapes a single URL and passes its markdown to write one
+// top-level block at a time, so a huge page's output can be sent while the
+// rest is still being converted. Only the markdown format is produced;
+// prependTitle and anchorHeadings need the whole document and don't apply.
+// The result holds the page metadata and any warning.
+func (s *Service) ScrapeStream(ctx context.Context, req model.ScrapeRequest, write func(chunk string) error) (*model.ScrapeResult, error) {
+	req.Formats = []string{"markdown"}
+	return s.scrapeContext(ctx, req, write)
+}
+
+// writeMarkdown converts the filtered page one top-level block of its body at
+// a time, passing each non-empty block's markdown to write followed by a
+// blank line.
+func (s *scraper) writeMarkdown(write func(chunk string) error) error {
+	if s.markdownDoc == nil {
+		return nil
+	}
+
+	converter := s.markdownConverter()
+	body := s.markdownDoc.Find("body").First()
+	if body.Length() == 0 {
+		body = s.markdownDoc.Selection
+	}
+
+	for _, node := range body.Contents().Nodes {
+		// Convert the block on its own, wrapped so the converter sees it as
+		// content rather than the root
+		wrapper := &html.Node{Type: html.ElementNode, Data: "div"}
+		node.Parent.RemoveChild(node)
+		wrapper.AppendChild(node)
+
+		markdown := strings.TrimSpace(converter.Convert(goquery.NewDocumentFromNode(wrapper).Selection))
+		markdown = normalizeUnicode(markdown, s.request.UnicodeNormalization)
+		if markdown == "" {
+			continue
+		}
+		if err := write(markdown + "\n\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
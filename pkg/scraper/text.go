@@ -0,0 +1,86 @@
+package scraper
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// blockElements are rendered on their own line when extracting plain text.
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// extractText extracts the filtered content as plain text, one block per line
+// with whitespace normalized.
+func (s *scraper) extractText(doc *goquery.Document) string {
+	docCopy := cloneDocument(doc)
+	s.applyContentFilters(docCopy)
+	docCopy.Find("script, style, noscript, template").Remove()
+
+	var sb strings.Builder
+	for _, node := range docCopy.Find("body").Nodes {
+		writeText(&sb, node)
+	}
+
+	lines := strings.Split(sb.String(), "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+
+	return strings.Join(kept, "\n")
+}
+
+// writeText writes the text content of n, breaking lines around block elements.
+func writeText(sb *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		sb.WriteString(n.Data)
+		return
+	case html.ElementNode:
+		if blockElements[n.Data] {
+			sb.WriteString("\n")
+			defer sb.WriteString("\n")
+		}
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		writeText(sb, child)
+	}
+}
+
+// extractIndexText canonicalizes the page text for full-text search indexing:
+// lowercased, punctuation replaced by spaces and, optionally, stopwords for
+// the page's language removed.
+func (s *scraper) extractIndexText(doc *goquery.Document, language string) string {
+	text := strings.Map(func(r rune) rune {
+		if unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return ' '
+		}
+		return unicode.ToLower(r)
+	}, s.extractText(doc))
+
+	words := strings.Fields(text)
+	if s.request.StripStopwords {
+		stopwords := stopwordsFor(language)
+		kept := words[:0]
+		for _, word := range words {
+			if !stopwords[word] {
+				kept = append(kept, word)
+			}
+		}
+		words = kept
+	}
+
+	return strings.Join(words, " ")
+}
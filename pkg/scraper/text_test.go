@@ -0,0 +1,64 @@
+package scraper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestExtractTextAndIndex(t *testing.T) {
+	page := `<html lang="en"><body>
+		<h1>The Quick   Brown Fox</h1>
+		<p>It jumps over the <b>lazy</b> dog, again &amp; again!</p>
+		<script>var ignored = true;</script>
+	</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		request   model.ScrapeRequest
+		wantText  string
+		wantIndex string
+	}{
+		{
+			name:      "Keep stopwords",
+			request:   model.ScrapeRequest{},
+			wantText:  "The Quick Brown Fox\nIt jumps over the lazy dog, again & again!",
+			wantIndex: "the quick brown fox it jumps over the lazy dog again again",
+		},
+		{
+			name:      "Strip stopwords",
+			request:   model.ScrapeRequest{ScrapeOptions: model.ScrapeOptions{StripStopwords: true}},
+			wantText:  "The Quick Brown Fox\nIt jumps over the lazy dog, again & again!",
+			wantIndex: "quick brown fox jumps over lazy dog again again",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScraper(nil, tt.request)
+
+			if got := s.extractText(doc); got != tt.wantText {
+				t.Errorf("extractText() = %q, want %q", got, tt.wantText)
+			}
+			if got := s.extractIndexText(doc, "en-US"); got != tt.wantIndex {
+				t.Errorf("extractIndexText() = %q, want %q", got, tt.wantIndex)
+			}
+		})
+	}
+}
+
+func TestStopwordsFor(t *testing.T) {
+	if !stopwordsFor("de-DE")["und"] {
+		t.Error("Expected German stopwords for 'de-DE'")
+	}
+	if !stopwordsFor("")["the"] {
+		t.Error("Expected English stopwords for an unknown language")
+	}
+}
@@ -0,0 +1,210 @@
+package scraper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"  // favicon formats
+	_ "image/jpeg" // favicon formats
+	_ "image/png"  // favicon formats
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// manifestMaxBytes caps the web app manifest read for its theme color.
+	manifestMaxBytes = 64 * 1024
+	// faviconMaxBytes caps the favicon read for its dominant color.
+	faviconMaxBytes = 512 * 1024
+	// faviconMaxSide caps the width and height of a favicon decoded, since a
+	// small compressed image can declare huge dimensions.
+	faviconMaxSide = 1024
+	// colorSamples is how many pixels along each side dominantColor samples.
+	colorSamples = 64
+)
+
+// themeColor returns the page's theme-color meta tag, preferring one that
+// applies regardless of the color scheme.
+func themeColor(doc *goquery.Document) string {
+	var fallback string
+	for _, node := range doc.Find(`meta[name="theme-color" i]`).EachIter() {
+		color := strings.TrimSpace(node.AttrOr("content", ""))
+		if color == "" {
+			continue
+		}
+		if _, scoped := node.Attr("media"); !scoped {
+			return color
+		}
+		if fallback == "" {
+			fallback = color
+		}
+	}
+	return fallback
+}
+
+// fetchThemeColor looks for a theme color outside the page: the theme_color
+// of its web app manifest, then the dominant color of its favicon. Each
+// costs a request; it returns "" when neither yields a color.
+func fetchThemeColor(client *http.Client, userAgent string, doc *goquery.Document, pageURL *url.URL) string {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if href := doc.Find(`link[rel~="manifest"]`).First().AttrOr("href", ""); href != "" {
+		if manifestURL, ok := resolveURL(pageURL, href); ok {
+			if color := manifestThemeColor(client, userAgent, manifestURL); color != "" {
+				return color
+			}
+		}
+	}
+
+	// Browsers fall back to /favicon.ico when the page names no icon
+	iconURL, ok := resolveURL(pageURL, doc.Find(`link[rel~="icon" i]`).First().AttrOr("href", "/favicon.ico"))
+	if !ok {
+		return ""
+	}
+	return faviconColor(client, userAgent, iconURL)
+}
+
+// manifestThemeColor returns the theme_color of the web app manifest.
+func manifestThemeColor(client *http.Client, userAgent, manifestURL string) string {
+	body, err := fetchAsset(client, userAgent, manifestURL, manifestMaxBytes)
+	if err != nil {
+		return ""
+	}
+
+	var manifest struct {
+		ThemeColor string `json:"theme_color"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(manifest.ThemeColor)
+}
+
+// faviconColor returns the most common opaque color of the favicon as
+// #rrggbb. PNG, GIF and JPEG icons are read, as are ICO files that embed
+// PNG images.
+func faviconColor(client *http.Client, userAgent, iconURL string) string {
+	body, err := fetchAsset(client, userAgent, iconURL, faviconMaxBytes)
+	if err != nil {
+		return ""
+	}
+
+	// Check the dimensions before decoding allocates the pixels
+	data := icoImage(body)
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width > faviconMaxSide || config.Height > faviconMaxSide {
+		return ""
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return ""
+	}
+	return dominantColor(img)
+}
+
+// icoImage returns the largest PNG image embedded in an ICO file, or data
+// unchanged when it isn't one.
+func icoImage(data []byte) []byte {
+	// ICONDIR: reserved 0, type 1, then the number of entries
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[0:]) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return data
+	}
+
+	var largest []byte
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	for i := 0; i < count; i++ {
+		// ICONDIRENTRY: 16 bytes, with the image size and offset at 8 and 12
+		entry := 6 + i*16
+		if entry+16 > len(data) {
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(data[entry+8:]))
+		offset := int(binary.LittleEndian.Uint32(data[entry+12:]))
+		if offset < 0 || size <= 0 || offset+size > len(data) {
+			continue
+		}
+		img := data[offset : offset+size]
+		if bytes.HasPrefix(img, []byte("\x89PNG")) && len(img) > len(largest) {
+			largest = img
+		}
+	}
+	if largest == nil {
+		return data
+	}
+	return largest
+}
+
+// dominantColor returns the average of the most common group of similar
+// opaque colors in img as #rrggbb, or "" for a fully transparent image.
+// Larger images are sampled on a grid of about colorSamples pixels a side.
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	var best *bucket
+
+	bounds := img.Bounds()
+	stepX := max(1, bounds.Dx()/colorSamples)
+	stepY := max(1, bounds.Dy()/colorSamples)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			// Undo premultiplied alpha and group by the top 4 bits of each channel
+			r8, g8, b8 := int(r*0xff/a), int(g*0xff/a), int(b*0xff/a)
+			key := r8>>4<<8 | g8>>4<<4 | b8>>4
+
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += r8
+			bk.g += g8
+			bk.b += b8
+			if best == nil || bk.count > best.count {
+				best = bk
+			}
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+	return fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+}
+
+// fetchAsset GETs a page asset, reading at most maxBytes of a successful
+// response.
+func fetchAsset(client *http.Client, userAgent, assetURL string, maxBytes int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, assetURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, assetURL)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxBytes))
+}
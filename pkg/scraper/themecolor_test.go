@@ -0,0 +1,136 @@
+package scraper
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestThemeColor(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{
+			name: "Meta tag",
+			head: `<meta name="theme-color" content="#4285f4">`,
+			want: "#4285f4",
+		},
+		{
+			name: "Unscoped tag preferred",
+			head: `<meta name="theme-color" media="(prefers-color-scheme: dark)" content="#000000">
+				<meta name="theme-color" content="#ffffff">`,
+			want: "#ffffff",
+		},
+		{
+			name: "Only scoped tags",
+			head: `<meta name="theme-color" media="(prefers-color-scheme: light)" content="#fafafa">`,
+			want: "#fafafa",
+		},
+		{
+			name: "No tag",
+			head: `<meta name="description" content="Example">`,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.head + "</head><body></body></html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			if got := themeColor(doc); got != tt.want {
+				t.Errorf("themeColor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchThemeColor(t *testing.T) {
+	// A mostly red icon with a transparent border
+	icon := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 1; y < 7; y++ {
+		for x := 1; x < 7; x++ {
+			icon.Set(x, y, color.NRGBA{R: 0xe0, G: 0x10, B: 0x10, A: 0xff})
+		}
+	}
+	icon.Set(1, 1, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+	var iconPNG bytes.Buffer
+	if err := png.Encode(&iconPNG, icon); err != nil {
+		t.Fatalf("Failed to encode icon: %v", err)
+	}
+
+	// An icon wider than any favicon needs, which isn't decoded
+	huge := image.NewNRGBA(image.Rect(0, 0, faviconMaxSide+1, 2))
+	for x := 0; x < faviconMaxSide+1; x++ {
+		huge.Set(x, 0, color.NRGBA{R: 0x10, G: 0xe0, B: 0x10, A: 0xff})
+	}
+	var hugePNG bytes.Buffer
+	if err := png.Encode(&hugePNG, huge); err != nil {
+		t.Fatalf("Failed to encode icon: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/manifest.json":
+			w.Write([]byte(`{"name": "Example", "theme_color": "#336699"}`))
+		case "/icon.png":
+			w.Write(iconPNG.Bytes())
+		case "/huge.png":
+			w.Write(hugePNG.Bytes())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	pageURL, _ := url.Parse(server.URL + "/page")
+
+	tests := []struct {
+		name string
+		head string
+		want string
+	}{
+		{
+			name: "Manifest",
+			head: `<link rel="manifest" href="/manifest.json"><link rel="icon" href="/icon.png">`,
+			want: "#336699",
+		},
+		{
+			name: "Favicon",
+			head: `<link rel="icon" href="/icon.png">`,
+			want: "#e01010",
+		},
+		{
+			name: "Oversized favicon",
+			head: `<link rel="icon" href="/huge.png">`,
+			want: "",
+		},
+		{
+			name: "Missing favicon",
+			head: ``,
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tt.head + "</head><body></body></html>"))
+			if err != nil {
+				t.Fatalf("Failed to parse HTML: %v", err)
+			}
+			if got := fetchThemeColor(server.Client(), DefaultUserAgent, doc, pageURL); got != tt.want {
+				t.Errorf("fetchThemeColor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
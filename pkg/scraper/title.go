@@ -0,0 +1,45 @@
+package scraper
+
+import "strings"
+
+// prependTitle starts markdown with title as a top-level heading, unless the
+// markdown already opens with one or there is no title. The converter renders
+// the head's <title> as the first line; that line gives way to the heading.
+func prependTitle(markdown, title string) string {
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return markdown
+	}
+
+	body := strings.TrimLeft(markdown, " \t\n")
+	if first, rest, _ := strings.Cut(body, "\n"); markdownText(first) == title {
+		body = strings.TrimLeft(rest, " \t\n")
+	}
+	if startsWithH1(body) {
+		return body
+	}
+	if body == "" {
+		return "# " + title
+	}
+	return "# " + title + "\n\n" + body
+}
+
+// startsWithH1 reports whether the first line of markdown is a top-level
+// heading, in either ATX ("# Title") or setext ("Title\n===") form.
+func startsWithH1(markdown string) bool {
+	lines := strings.SplitN(markdown, "\n", 3)
+	if match := headingPattern.FindStringSubmatch(lines[0]); match != nil {
+		return match[1] == "#"
+	}
+	if len(lines) > 1 {
+		underline := strings.TrimSpace(lines[1])
+		return underline != "" && strings.Trim(underline, "=") == ""
+	}
+	return false
+}
+
+// markdownText returns a line of markdown as plain text, without escapes and
+// with its whitespace collapsed.
+func markdownText(line string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(line, `\`, "")), " ")
+}
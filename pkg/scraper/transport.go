@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// requestClient returns a copy of the client whose transport applies the
+// request's certificate verification and proxy settings.
+func requestClient(client *http.Client, req model.ScrapeRequest) *http.Client {
+	var proxy *url.URL
+	if req.Proxy != "" {
+		proxy, _ = utils.ParseProxy(req.Proxy)
+	}
+
+	clone := &http.Client{}
+	if client != nil {
+		*clone = *client
+	}
+	clone.Transport = configureTransport(clone.Transport, req.SkipTlsVerification, proxy)
+	return clone
+}
+
+// configureTransport returns a transport like rt that skips certificate
+// verification and routes through proxy, as requested. A transport that
+// already skips verification is reused when no proxy is needed, so a crawl's
+// shared transport keeps pooling connections, and the transports derived for
+// other settings are cached so scrapes with the same settings share one
+// connection pool. Transports other than *http.Transport can't be
+// reconfigured and are returned unchanged.
+func configureTransport(rt http.RoundTripper, skipTLS bool, proxy *url.URL) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	insecure := transport.TLSClientConfig != nil && transport.TLSClientConfig.InsecureSkipVerify
+	if (!skipTLS || insecure) && proxy == nil {
+		return transport
+	}
+
+	key := transportKey{base: transport, skipTLS: skipTLS && !insecure}
+	if proxy != nil {
+		key.proxy = proxy.String()
+	}
+	return derivedTransports.get(key, func() *http.Transport {
+		derived := transport.Clone()
+		if key.skipTLS {
+			if derived.TLSClientConfig == nil {
+				derived.TLSClientConfig = &tls.Config{}
+			}
+			derived.TLSClientConfig.InsecureSkipVerify = true
+		}
+		if proxy != nil {
+			utils.UseProxy(derived, proxy)
+		}
+		return derived
+	})
+}
+
+// maxDerivedTransports caps the transports kept for request settings.
+const maxDerivedTransports = 32
+
+// derivedTransports caches the transports configureTransport derives.
+var derivedTransports = newTransportCache(maxDerivedTransports)
+
+// transportKey identifies a transport derived from base for request settings.
+type transportKey struct {
+	base    *http.Transport
+	skipTLS bool
+	proxy   string
+}
+
+// transportCache holds derived transports so their connection pools are
+// reused. Past its capacity the oldest transport is dropped and its idle
+// connections closed.
+type transportCache struct {
+	mu         sync.Mutex
+	max        int
+	transports map[transportKey]*http.Transport
+	order      []transportKey
+}
+
+// newTransportCache creates a cache holding up to max transports.
+func newTransportCache(max int) *transportCache {
+	return &transportCache{
+		max:        max,
+		transports: make(map[transportKey]*http.Transport),
+	}
+}
+
+// get returns the transport for key, creating it with create the first time.
+func (c *transportCache) get(key transportKey, create func() *http.Transport) *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if transport, ok := c.transports[key]; ok {
+		return transport
+	}
+
+	if len(c.order) >= c.max {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.transports[oldest].CloseIdleConnections()
+		delete(c.transports, oldest)
+	}
+
+	transport := create()
+	c.transports[key] = transport
+	c.order = append(c.order, key)
+	return transport
+}
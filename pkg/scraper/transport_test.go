@@ -0,0 +1,50 @@
+package scraper
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestConfigureTransportReuse(t *testing.T) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	proxyA, _ := url.Parse("http://proxy-a.internal:8080")
+	proxyB, _ := url.Parse("http://proxy-b.internal:8080")
+
+	if got := configureTransport(base, false, nil); got != base {
+		t.Error("Expected the base transport when nothing needs changing")
+	}
+
+	insecure := configureTransport(base, true, nil)
+	if insecure == http.RoundTripper(base) || configureTransport(base, true, nil) != insecure {
+		t.Error("Expected one derived transport for skipping verification, reused")
+	}
+
+	viaA := configureTransport(base, false, proxyA)
+	if configureTransport(base, false, proxyA) != viaA {
+		t.Error("Expected scrapes through the same proxy to share a transport")
+	}
+	if configureTransport(base, false, proxyB) == viaA {
+		t.Error("Expected a separate transport for another proxy")
+	}
+}
+
+func TestTransportCacheEvicts(t *testing.T) {
+	cache := newTransportCache(2)
+	created := 0
+	create := func() *http.Transport {
+		created++
+		return &http.Transport{}
+	}
+
+	first := cache.get(transportKey{proxy: "a"}, create)
+	cache.get(transportKey{proxy: "b"}, create)
+	cache.get(transportKey{proxy: "c"}, create)
+
+	if len(cache.transports) != 2 {
+		t.Errorf("Expected the cache to hold 2 transports, got %d", len(cache.transports))
+	}
+	if cache.get(transportKey{proxy: "a"}, create) == first || created != 4 {
+		t.Errorf("Expected the oldest transport to be dropped and recreated, created %d", created)
+	}
+}
@@ -0,0 +1,20 @@
+package scraper
+
+import (
+	"github.com/ncecere/rummage/pkg/model"
+	"golang.org/x/text/unicode/norm"
+)
+
+// normalizeUnicode applies the normalization form to text, so visually
+// identical characters encoded differently compare equal. An empty or "none"
+// form leaves the text unchanged.
+func normalizeUnicode(text, form string) string {
+	switch form {
+	case model.UnicodeNormalizationNFC:
+		return norm.NFC.String(text)
+	case model.UnicodeNormalizationNFKC:
+		return norm.NFKC.String(text)
+	default:
+		return text
+	}
+}
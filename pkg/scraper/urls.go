@@ -0,0 +1,75 @@
+package scraper
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// urlAttributes lists the elements and attributes that hold link and image URLs.
+var urlAttributes = []struct {
+	selector string
+	attr     string
+}{
+	{"a[href]", "href"},
+	{"img[src]", "src"},
+}
+
+// absolutizeURLs rewrites relative link and image URLs in the document so they
+// resolve against the given base URL.
+func absolutizeURLs(doc *goquery.Document, base *url.URL) {
+	for _, ua := range urlAttributes {
+		doc.Find(ua.selector).Each(func(_ int, sel *goquery.Selection) {
+			value, _ := sel.Attr(ua.attr)
+			if resolved, ok := resolveURL(base, value); ok {
+				sel.SetAttr(ua.attr, resolved)
+			}
+		})
+	}
+}
+
+// resolveURL resolves a possibly relative reference against the base URL.
+// Fragments, empty values and non-HTTP schemes are left untouched.
+func resolveURL(base *url.URL, ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") {
+		return "", false
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+
+	// Leave mailto:, javascript:, data: and friends alone
+	if refURL.Scheme != "" && refURL.Scheme != "http" && refURL.Scheme != "https" {
+		return "", false
+	}
+
+	return base.ResolveReference(refURL).String(), true
+}
+
+// baseHref returns the page's <base href> resolved against the page URL, or
+// nil when the page doesn't declare one or the request ignores it.
+func (s *scraper) baseHref(doc *goquery.Document) *url.URL {
+	if s.request.IgnoreBaseHref {
+		return nil
+	}
+
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return nil
+	}
+
+	pageURL, err := url.Parse(s.request.URL)
+	if err != nil {
+		return nil
+	}
+
+	base, err := pageURL.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return nil
+	}
+	return base
+}
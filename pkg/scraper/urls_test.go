@@ -0,0 +1,53 @@
+package scraper
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestAbsolutizeURLs(t *testing.T) {
+	html := `<html><body>
+		<a href="/docs/intro">Intro</a>
+		<a href="page2">Page 2</a>
+		<a href="https://other.example.org/x">External</a>
+		<a href="#top">Top</a>
+		<a href="mailto:team@example.com">Mail</a>
+		<img src="../img/logo.png">
+	</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+
+	// Resolve against an override rather than the scraped mirror URL
+	base, _ := url.Parse("https://canonical.example.com/blog/post/")
+	absolutizeURLs(doc, base)
+
+	wantLinks := []string{
+		"https://canonical.example.com/docs/intro",
+		"https://canonical.example.com/blog/post/page2",
+		"https://other.example.org/x",
+		"#top",
+		"mailto:team@example.com",
+	}
+
+	links := doc.Find("a").Map(func(_ int, sel *goquery.Selection) string {
+		return sel.AttrOr("href", "")
+	})
+	if len(links) != len(wantLinks) {
+		t.Fatalf("Expected %d links, got %d", len(wantLinks), len(links))
+	}
+	for i, want := range wantLinks {
+		if links[i] != want {
+			t.Errorf("Link mismatch at index %d: got %v, want %v", i, links[i], want)
+		}
+	}
+
+	if src := doc.Find("img").AttrOr("src", ""); src != "https://canonical.example.com/blog/img/logo.png" {
+		t.Errorf("Image mismatch: got %v", src)
+	}
+}
@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+const (
+	// bufferWriteAttempts is the number of tries for each result write.
+	bufferWriteAttempts = 3
+	// bufferInitialBackoff is the pause after the first failed write; it
+	// doubles after each further failure.
+	bufferInitialBackoff = 200 * time.Millisecond
+	// DefaultMaxBufferedResults caps the results held in memory while
+	// storage is unavailable.
+	DefaultMaxBufferedResults = 1000
+)
+
+// ResultWriteFunc stores a page result for a job.
+type ResultWriteFunc func(jobID string, result model.ScrapeResult) error
+
+// bufferedResult is a result waiting for storage to come back.
+type bufferedResult struct {
+	jobID  string
+	result model.ScrapeResult
+}
+
+// BufferedWriter retries result writes with backoff and, while storage stays
+// unavailable, holds results in memory up to a cap and writes them in order
+// once storage recovers.
+type BufferedWriter struct {
+	write      ResultWriteFunc
+	maxPending int
+	backoff    time.Duration
+
+	mu       sync.Mutex
+	pending  []bufferedResult
+	dropped  int
+	degraded bool
+}
+
+// NewBufferedWriter wraps write with retries and an in-memory buffer of at
+// most maxPending results. A non-positive maxPending uses
+// DefaultMaxBufferedResults.
+func NewBufferedWriter(write ResultWriteFunc, maxPending int) *BufferedWriter {
+	if maxPending <= 0 {
+		maxPending = DefaultMaxBufferedResults
+	}
+	return &BufferedWriter{
+		write:      write,
+		maxPending: maxPending,
+		backoff:    bufferInitialBackoff,
+	}
+}
+
+// Write stores the result, buffering it if storage is unavailable. It only
+// returns an error when the buffer is full and the result is dropped.
+func (w *BufferedWriter) Write(jobID string, result model.ScrapeResult) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Earlier results go first so pages stay in order
+	if len(w.pending) > 0 && !w.flushLocked(1) {
+		return w.bufferLocked(jobID, result)
+	}
+
+	if err := w.writeWithRetry(jobID, result, bufferWriteAttempts); err != nil {
+		if !w.degraded {
+			log.Printf("storage unavailable for job %s, buffering results: %v", jobID, err)
+		}
+		w.degraded = true
+		return w.bufferLocked(jobID, result)
+	}
+	return nil
+}
+
+// Flush writes the buffered results, retrying each with backoff, and returns
+// the number still buffered and the number dropped because the buffer was
+// full.
+func (w *BufferedWriter) Flush() (remaining, dropped int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.flushLocked(bufferWriteAttempts)
+	if len(w.pending) > 0 || w.dropped > 0 {
+		log.Printf("storage still unavailable: %d results not stored, %d dropped", len(w.pending), w.dropped)
+	}
+	return len(w.pending), w.dropped
+}
+
+// Degraded reports whether storage failed at any point, so results were
+// buffered or dropped.
+func (w *BufferedWriter) Degraded() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.degraded
+}
+
+// flushLocked writes buffered results in order until one fails. It reports
+// whether the buffer is empty.
+func (w *BufferedWriter) flushLocked(attempts int) bool {
+	for len(w.pending) > 0 {
+		next := w.pending[0]
+		if err := w.writeWithRetry(next.jobID, next.result, attempts); err != nil {
+			return false
+		}
+		w.pending = w.pending[1:]
+	}
+	return true
+}
+
+// bufferLocked holds the result until storage recovers, dropping it when the
+// buffer is full.
+func (w *BufferedWriter) bufferLocked(jobID string, result model.ScrapeResult) error {
+	if len(w.pending) >= w.maxPending {
+		w.dropped++
+		return fmt.Errorf("storage unavailable and result buffer full; dropped result for %s", sourceURL(result))
+	}
+	w.pending = append(w.pending, bufferedResult{jobID: jobID, result: result})
+	return nil
+}
+
+// writeWithRetry tries the write up to attempts times, doubling the pause
+// between tries.
+func (w *BufferedWriter) writeWithRetry(jobID string, result model.ScrapeResult, attempts int) error {
+	var err error
+	backoff := w.backoff
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = w.write(jobID, result); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// sourceURL returns the page URL recorded in the result's metadata.
+func sourceURL(result model.ScrapeResult) string {
+	if result.Metadata == nil {
+		return ""
+	}
+	return result.Metadata.SourceURL
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// flakyStore fails every write while down and records the stored URLs.
+type flakyStore struct {
+	down   bool
+	stored []string
+}
+
+func (f *flakyStore) write(_ string, result model.ScrapeResult) error {
+	if f.down {
+		return errors.New("connection refused")
+	}
+	f.stored = append(f.stored, result.Metadata.SourceURL)
+	return nil
+}
+
+func pageResult(i int) model.ScrapeResult {
+	return model.ScrapeResult{Metadata: &model.ScrapeMetadata{SourceURL: fmt.Sprintf("https://example.com/%d", i)}}
+}
+
+func TestBufferedWriterTransientOutage(t *testing.T) {
+	store := &flakyStore{}
+	writer := NewBufferedWriter(store.write, 3)
+	writer.backoff = 0
+
+	// Storage is up, then drops for three pages, then recovers
+	if err := writer.Write("job", pageResult(0)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	store.down = true
+	for i := 1; i <= 3; i++ {
+		if err := writer.Write("job", pageResult(i)); err != nil {
+			t.Fatalf("Expected result %d to be buffered, got %v", i, err)
+		}
+	}
+	if len(store.stored) != 1 {
+		t.Fatalf("Expected nothing stored during the outage, got %v", store.stored)
+	}
+	if !writer.Degraded() {
+		t.Error("Expected the writer to report degraded storage")
+	}
+
+	// The buffer is full, so another page is dropped
+	if err := writer.Write("job", pageResult(4)); err == nil {
+		t.Error("Expected an error when the buffer is full")
+	}
+
+	// Recovery flushes the buffer in order before the new result
+	store.down = false
+	if err := writer.Write("job", pageResult(5)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := []string{"https://example.com/0", "https://example.com/1", "https://example.com/2", "https://example.com/3", "https://example.com/5"}
+	if fmt.Sprint(store.stored) != fmt.Sprint(want) {
+		t.Errorf("Expected stored results %v, got %v", want, store.stored)
+	}
+
+	remaining, dropped := writer.Flush()
+	if remaining != 0 || dropped != 1 {
+		t.Errorf("Expected 0 remaining and 1 dropped, got %d and %d", remaining, dropped)
+	}
+}
+
+func TestBufferedWriterRetriesTransientFailure(t *testing.T) {
+	failures := 2
+	stored := 0
+	writer := NewBufferedWriter(func(string, model.ScrapeResult) error {
+		if failures > 0 {
+			failures--
+			return errors.New("timeout")
+		}
+		stored++
+		return nil
+	}, 0)
+	writer.backoff = 0
+
+	if err := writer.Write("job", pageResult(0)); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if stored != 1 {
+		t.Errorf("Expected the result stored after retrying, got %d writes", stored)
+	}
+	if writer.Degraded() {
+		t.Error("Expected a write that succeeded on retry not to degrade the job")
+	}
+}
@@ -13,10 +13,14 @@ import (
 const (
 	// Key prefix for crawl jobs
 	crawlJobKeyPrefix = "crawl:job:"
+	// Key prefix for crawl results, a list with one entry per page
+	crawlDataKeyPrefix = "crawl:data:"
 	// Key prefix for crawl errors
 	crawlErrorsKeyPrefix = "crawl:errors:"
 	// Key prefix for robots blocked URLs
 	robotsBlockedKeyPrefix = "crawl:robots:"
+	// Number of times a job update is retried when another write races it
+	maxJobUpdateAttempts = 10
 )
 
 // CreateCrawlJob creates a new crawl job and returns its ID.
@@ -44,9 +48,14 @@ func (s *RedisStorage) CreateCrawlJob(jobID string, req model.CrawlRequest) (str
 
 // GetCrawlJob retrieves a crawl job by ID.
 func (s *RedisStorage) GetCrawlJob(jobID string) (*model.CrawlStatus, error) {
+	return s.getCrawlJob(s.client, jobID)
+}
+
+// getCrawlJob reads a crawl job through c, which may be a watching transaction.
+func (s *RedisStorage) getCrawlJob(c redis.Cmdable, jobID string) (*model.CrawlStatus, error) {
 	key := crawlJobKeyPrefix + jobID
 
-	jobData, err := s.client.Get(s.ctx, key).Result()
+	jobData, err := c.Get(s.ctx, key).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
 			return nil, fmt.Errorf("job not found: %s", jobID)
@@ -64,63 +73,149 @@ func (s *RedisStorage) GetCrawlJob(jobID string) (*model.CrawlStatus, error) {
 
 // UpdateCrawlJob updates a crawl job with new results.
 func (s *RedisStorage) UpdateCrawlJob(jobID string, result model.ScrapeResult) error {
-	key := crawlJobKeyPrefix + jobID
-
-	// Get current job data
-	job, err := s.GetCrawlJob(jobID)
+	resultData, err := json.Marshal(result)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal result data: %w", err)
 	}
 
-	// Update job data
-	job.Completed++
-	job.Data = append(job.Data, result)
+	return s.updateCrawlJob(jobID, func(job *model.CrawlStatus, pipe redis.Pipeliner) bool {
+		// A cancelled job takes no more pages, even from another server
+		if job.Status == "cancelled" {
+			return false
+		}
+
+		// Append the page to the job's result list
+		dataKey := crawlDataKeyPrefix + jobID
+		pipe.RPush(s.ctx, dataKey, resultData)
+		pipe.Expire(s.ctx, dataKey, s.jobExpirationTime)
 
-	// Update status if completed
-	if job.Status == "pending" {
-		job.Status = "scraping"
-	}
+		// Update job data
+		job.Completed++
+		job.TransferStats.Add(result.Metadata)
 
-	// Save updated job data
-	jobData, err := json.Marshal(job)
+		// Update status if completed
+		if job.Status == "pending" {
+			job.Status = "scraping"
+		}
+		return true
+	})
+}
+
+// GetCrawlResults retrieves a page of a crawl job's results in the order they
+// were stored. A limit of zero or less returns every result after skip.
+func (s *RedisStorage) GetCrawlResults(jobID string, skip, limit int) ([]model.ScrapeResult, error) {
+	start, stop := resultsRange(skip, limit)
+	entries, err := s.client.LRange(s.ctx, crawlDataKeyPrefix+jobID, start, stop).Result()
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated job data: %w", err)
+		return nil, fmt.Errorf("failed to get results from Redis: %w", err)
 	}
 
-	if err := s.client.Set(s.ctx, key, jobData, s.jobExpirationTime).Err(); err != nil {
-		return fmt.Errorf("failed to update job in Redis: %w", err)
+	results := make([]model.ScrapeResult, 0, len(entries))
+	for _, entry := range entries {
+		var result model.ScrapeResult
+		if err := json.Unmarshal([]byte(entry), &result); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal result data: %w", err)
+		}
+		results = append(results, result)
 	}
 
-	return nil
+	return results, nil
+}
+
+// resultsRange converts skip and limit to the inclusive start and stop
+// indexes of a Redis list range.
+func resultsRange(skip, limit int) (int64, int64) {
+	if skip < 0 {
+		skip = 0
+	}
+	if limit <= 0 {
+		return int64(skip), -1
+	}
+	return int64(skip), int64(skip + limit - 1)
 }
 
 // UpdateCrawlJobStatus updates the status of a crawl job.
 func (s *RedisStorage) UpdateCrawlJobStatus(jobID string, status string, total int) error {
-	key := crawlJobKeyPrefix + jobID
+	return s.modifyCrawlJob(jobID, func(job *model.CrawlStatus) {
+		// A cancelled job stays cancelled
+		if job.Status != "cancelled" {
+			job.Status = status
+		}
+		if total > 0 {
+			job.Total = total
+		}
+	})
+}
 
-	// Get current job data
-	job, err := s.GetCrawlJob(jobID)
-	if err != nil {
-		return err
-	}
+// MarkCrawlDiscoveryCapped records that a crawl job hit its link discovery cap.
+func (s *RedisStorage) MarkCrawlDiscoveryCapped(jobID string) error {
+	return s.modifyCrawlJob(jobID, func(job *model.CrawlStatus) {
+		job.DiscoveryCapped = true
+	})
+}
 
-	// Update job data
-	job.Status = status
-	if total > 0 {
-		job.Total = total
-	}
+// MarkCrawlRetried records that a crawl job was retried with a fallback strategy.
+func (s *RedisStorage) MarkCrawlRetried(jobID string) error {
+	return s.modifyCrawlJob(jobID, func(job *model.CrawlStatus) {
+		job.Retried = true
+	})
+}
 
-	// Save updated job data
-	jobData, err := json.Marshal(job)
-	if err != nil {
-		return fmt.Errorf("failed to marshal updated job data: %w", err)
+// MarkCrawlDegraded records that storage failed during a crawl job.
+func (s *RedisStorage) MarkCrawlDegraded(jobID string) error {
+	return s.modifyCrawlJob(jobID, func(job *model.CrawlStatus) {
+		job.Degraded = true
+	})
+}
+
+// modifyCrawlJob applies fn to a stored crawl job and saves the result.
+func (s *RedisStorage) modifyCrawlJob(jobID string, fn func(*model.CrawlStatus)) error {
+	return s.updateCrawlJob(jobID, func(job *model.CrawlStatus, _ redis.Pipeliner) bool {
+		fn(job)
+		return true
+	})
+}
+
+// updateCrawlJob applies fn to a stored crawl job and saves the result in one
+// transaction with any writes fn queues on pipe. The job is watched, so a
+// concurrent update, such as a cancel racing a page write, makes this one
+// start over rather than overwrite it. fn returns false to save nothing.
+func (s *RedisStorage) updateCrawlJob(jobID string, fn func(*model.CrawlStatus, redis.Pipeliner) bool) error {
+	key := crawlJobKeyPrefix + jobID
+
+	update := func(tx *redis.Tx) error {
+		// Get current job data
+		job, err := s.getCrawlJob(tx, jobID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(s.ctx, func(pipe redis.Pipeliner) error {
+			if !fn(job, pipe) {
+				return nil
+			}
+
+			// Save updated job data
+			jobData, err := json.Marshal(job)
+			if err != nil {
+				return fmt.Errorf("failed to marshal updated job data: %w", err)
+			}
+			pipe.Set(s.ctx, key, jobData, s.jobExpirationTime)
+			return nil
+		})
+		if err != nil && !errors.Is(err, redis.TxFailedErr) {
+			return fmt.Errorf("failed to update job in Redis: %w", err)
+		}
+		return err
 	}
 
-	if err := s.client.Set(s.ctx, key, jobData, s.jobExpirationTime).Err(); err != nil {
-		return fmt.Errorf("failed to update job in Redis: %w", err)
+	for attempt := 0; attempt < maxJobUpdateAttempts; attempt++ {
+		if err := s.client.Watch(s.ctx, update, key); !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
 	}
 
-	return nil
+	return fmt.Errorf("failed to update job in Redis: too many concurrent updates")
 }
 
 // CompleteCrawlJob marks a crawl job as completed.
@@ -199,8 +294,9 @@ func (s *RedisStorage) StoreRobotsBlocked(jobID string, url string) error {
 	return nil
 }
 
-// GetCrawlErrors retrieves the errors for a crawl job.
-func (s *RedisStorage) GetCrawlErrors(jobID string) (*model.CrawlErrorsResponse, error) {
+// GetCrawlErrors retrieves a page of errors for a crawl job along with a
+// summary of all error messages. A limit of zero or less returns every error.
+func (s *RedisStorage) GetCrawlErrors(jobID string, skip, limit int) (*model.CrawlErrorsResponse, error) {
 	errorsKey := crawlErrorsKeyPrefix + jobID
 	robotsKey := robotsBlockedKeyPrefix + jobID
 
@@ -230,8 +326,12 @@ func (s *RedisStorage) GetCrawlErrors(jobID string) (*model.CrawlErrorsResponse,
 		}
 	}
 
+	page, summary := pageCrawlErrors(crawlErrors, skip, limit)
+
 	return &model.CrawlErrorsResponse{
-		Errors:        crawlErrors,
+		Errors:        page,
 		RobotsBlocked: robotsBlocked,
+		TotalErrors:   len(crawlErrors),
+		ErrorSummary:  summary,
 	}, nil
 }
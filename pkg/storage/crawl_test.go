@@ -99,6 +99,30 @@ func TestCrawlJobOperations(t *testing.T) {
 	}
 }
 
+func TestResultsRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		skip      int
+		limit     int
+		wantStart int64
+		wantStop  int64
+	}{
+		{name: "First page", skip: 0, limit: 100, wantStart: 0, wantStop: 99},
+		{name: "Later page", skip: 200, limit: 50, wantStart: 200, wantStop: 249},
+		{name: "No limit", skip: 10, limit: 0, wantStart: 10, wantStop: -1},
+		{name: "Negative skip", skip: -5, limit: 10, wantStart: 0, wantStop: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, stop := resultsRange(tt.skip, tt.limit)
+			if start != tt.wantStart || stop != tt.wantStop {
+				t.Errorf("Expected range [%d, %d], got [%d, %d]", tt.wantStart, tt.wantStop, start, stop)
+			}
+		})
+	}
+}
+
 func TestCrawlErrorOperations(t *testing.T) {
 	// Create a mock Redis storage
 	storage := NewMockRedisStorage()
@@ -119,7 +143,7 @@ func TestCrawlErrorOperations(t *testing.T) {
 	}
 
 	// Get crawl errors
-	errors, err := storage.GetCrawlErrors(jobID)
+	errors, err := storage.GetCrawlErrors(jobID, 0, 0)
 	if err != nil {
 		t.Fatalf("Failed to get crawl errors: %v", err)
 	}
@@ -154,7 +178,7 @@ func TestRobotsBlockedOperations(t *testing.T) {
 	}
 
 	// Get crawl errors
-	errors, err := storage.GetCrawlErrors(jobID)
+	errors, err := storage.GetCrawlErrors(jobID, 0, 0)
 	if err != nil {
 		t.Fatalf("Failed to get crawl errors: %v", err)
 	}
@@ -267,8 +291,8 @@ func (m *MockRedisStorage) StoreRobotsBlocked(jobID string, url string) error {
 	return nil
 }
 
-// GetCrawlErrors retrieves the errors for a crawl job.
-func (m *MockRedisStorage) GetCrawlErrors(jobID string) (*model.CrawlErrorsResponse, error) {
+// GetCrawlErrors retrieves a page of errors for a crawl job.
+func (m *MockRedisStorage) GetCrawlErrors(jobID string, skip, limit int) (*model.CrawlErrorsResponse, error) {
 	errors := m.crawlErrors[jobID]
 	if errors == nil {
 		errors = []model.CrawlError{}
@@ -279,8 +303,12 @@ func (m *MockRedisStorage) GetCrawlErrors(jobID string) (*model.CrawlErrorsRespo
 		blocked = []string{}
 	}
 
+	page, summary := pageCrawlErrors(errors, skip, limit)
+
 	return &model.CrawlErrorsResponse{
-		Errors:        errors,
+		Errors:        page,
 		RobotsBlocked: blocked,
+		TotalErrors:   len(errors),
+		ErrorSummary:  summary,
 	}, nil
 }
@@ -0,0 +1,30 @@
+package storage
+
+import "github.com/ncecere/rummage/pkg/model"
+
+// pageCrawlErrors returns the requested page of crawl errors along with a
+// summary counting how often each error message occurred across all errors.
+// A limit of zero or less returns every error after skip.
+func pageCrawlErrors(crawlErrors []model.CrawlError, skip, limit int) ([]model.CrawlError, map[string]int) {
+	summary := make(map[string]int)
+	for _, crawlError := range crawlErrors {
+		summary[crawlError.Error]++
+	}
+
+	if skip < 0 {
+		skip = 0
+	}
+	if skip > len(crawlErrors) {
+		skip = len(crawlErrors)
+	}
+
+	end := len(crawlErrors)
+	if limit > 0 && skip+limit < end {
+		end = skip + limit
+	}
+
+	page := make([]model.CrawlError, end-skip)
+	copy(page, crawlErrors[skip:end])
+
+	return page, summary
+}
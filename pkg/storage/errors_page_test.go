@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestPageCrawlErrors(t *testing.T) {
+	// 250 errors spread across three messages
+	crawlErrors := make([]model.CrawlError, 0, 250)
+	for i := 0; i < 250; i++ {
+		message := "timeout"
+		switch {
+		case i%5 == 0:
+			message = "404 Not Found"
+		case i%7 == 0:
+			message = "blocked"
+		}
+		crawlErrors = append(crawlErrors, model.CrawlError{
+			ID:    fmt.Sprintf("error-%d", i),
+			URL:   fmt.Sprintf("https://example.com/%d", i),
+			Error: message,
+		})
+	}
+
+	tests := []struct {
+		name      string
+		skip      int
+		limit     int
+		wantLen   int
+		wantFirst string
+	}{
+		{name: "First page", skip: 0, limit: 100, wantLen: 100, wantFirst: "error-0"},
+		{name: "Middle page", skip: 100, limit: 100, wantLen: 100, wantFirst: "error-100"},
+		{name: "Last partial page", skip: 200, limit: 100, wantLen: 50, wantFirst: "error-200"},
+		{name: "Past the end", skip: 300, limit: 100, wantLen: 0},
+		{name: "No limit", skip: 10, limit: 0, wantLen: 240, wantFirst: "error-10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, summary := pageCrawlErrors(crawlErrors, tt.skip, tt.limit)
+
+			if len(page) != tt.wantLen {
+				t.Fatalf("Expected %d errors, got %d", tt.wantLen, len(page))
+			}
+			if tt.wantLen > 0 && page[0].ID != tt.wantFirst {
+				t.Errorf("Expected first error '%s', got '%s'", tt.wantFirst, page[0].ID)
+			}
+
+			// The summary always covers every error, not just the page
+			if summary["404 Not Found"] != 50 {
+				t.Errorf("Expected 50 '404 Not Found' errors, got %d", summary["404 Not Found"])
+			}
+			if summary["blocked"] != 28 {
+				t.Errorf("Expected 28 'blocked' errors, got %d", summary["blocked"])
+			}
+			if summary["timeout"] != 172 {
+				t.Errorf("Expected 172 'timeout' errors, got %d", summary["timeout"])
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+// pruneScanCount is the number of keys requested per SCAN call.
+const pruneScanCount = 500
+
+// orphanKeyPrefixes are the per-job keys that shouldn't outlive the job they
+// belong to, with the prefixes of the job keys that may own them.
+var orphanKeyPrefixes = []struct {
+	prefix string
+	owners []string
+}{
+	{crawlDataKeyPrefix, []string{crawlJobKeyPrefix}},
+	{crawlErrorsKeyPrefix, []string{crawlJobKeyPrefix}},
+	{robotsBlockedKeyPrefix, []string{crawlJobKeyPrefix}},
+	// Webhook deliveries are logged for both crawl and batch jobs
+	{webhookDeliveriesKeyPrefix, []string{crawlJobKeyPrefix, batchJobKeyPrefix}},
+}
+
+// keyspace is the part of Redis used to find and delete orphaned keys.
+type keyspace interface {
+	scan(prefix string) ([]string, error)
+	exists(key string) (bool, error)
+	del(keys ...string) error
+}
+
+// PruneOrphanedKeys deletes crawl result, error and robots keys and webhook
+// delivery logs whose job no longer exists, such as when their TTLs drifted
+// past the job's.
+func (s *RedisStorage) PruneOrphanedKeys() (*model.PruneResponse, error) {
+	return pruneOrphanedKeys(redisKeyspace{client: s.client, ctx: s.ctx})
+}
+
+// pruneOrphanedKeys deletes every key under orphanKeyPrefixes that has no
+// matching job key.
+func pruneOrphanedKeys(ks keyspace) (*model.PruneResponse, error) {
+	resp := &model.PruneResponse{Pruned: make(map[string]int, len(orphanKeyPrefixes))}
+
+	for _, orphan := range orphanKeyPrefixes {
+		prefix := orphan.prefix
+		keys, err := ks.scan(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s keys: %w", prefix, err)
+		}
+
+		var orphans []string
+		for _, key := range keys {
+			jobID := strings.TrimPrefix(key, prefix)
+			owned, err := jobExists(ks, jobID, orphan.owners)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check job %s: %w", jobID, err)
+			}
+			if !owned {
+				orphans = append(orphans, key)
+			}
+		}
+
+		if len(orphans) > 0 {
+			if err := ks.del(orphans...); err != nil {
+				return nil, fmt.Errorf("failed to delete %s keys: %w", prefix, err)
+			}
+		}
+		resp.Pruned[prefix] = len(orphans)
+		resp.Total += len(orphans)
+	}
+
+	return resp, nil
+}
+
+// jobExists reports whether a job key exists for jobID under any of the
+// owner prefixes.
+func jobExists(ks keyspace, jobID string, owners []string) (bool, error) {
+	for _, owner := range owners {
+		exists, err := ks.exists(owner + jobID)
+		if err != nil || exists {
+			return exists, err
+		}
+	}
+	return false, nil
+}
+
+// redisKeyspace is the keyspace backed by a Redis client.
+type redisKeyspace struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+// scan returns every key starting with prefix, walking the keyspace with SCAN
+// so large databases aren't blocked.
+func (r redisKeyspace) scan(prefix string) ([]string, error) {
+	var keys []string
+	iter := r.client.Scan(r.ctx, 0, prefix+"*", pruneScanCount).Iterator()
+	for iter.Next(r.ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// exists reports whether key is set.
+func (r redisKeyspace) exists(key string) (bool, error) {
+	n, err := r.client.Exists(r.ctx, key).Result()
+	return n > 0, err
+}
+
+// del deletes keys.
+func (r redisKeyspace) del(keys ...string) error {
+	return r.client.Del(r.ctx, keys...).Err()
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+// mockKeyspace is an in-memory keyspace for testing
+type mockKeyspace struct {
+	keys map[string]bool
+}
+
+func (m *mockKeyspace) scan(prefix string) ([]string, error) {
+	var keys []string
+	for key := range m.keys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockKeyspace) exists(key string) (bool, error) {
+	return m.keys[key], nil
+}
+
+func (m *mockKeyspace) del(keys ...string) error {
+	for _, key := range keys {
+		delete(m.keys, key)
+	}
+	return nil
+}
+
+func TestPruneOrphanedKeys(t *testing.T) {
+	ks := &mockKeyspace{keys: map[string]bool{
+		"crawl:job:live":     true,
+		"crawl:errors:live":  true,
+		"crawl:robots:live":  true,
+		"crawl:errors:gone1": true,
+		"crawl:errors:gone2": true,
+		"crawl:robots:gone1": true,
+		"batch:job:other":    true,
+
+		"webhook:deliveries:live":  true,
+		"webhook:deliveries:other": true,
+		"webhook:deliveries:gone1": true,
+	}}
+
+	resp, err := pruneOrphanedKeys(ks)
+	if err != nil {
+		t.Fatalf("Failed to prune keys: %v", err)
+	}
+
+	if resp.Total != 4 {
+		t.Errorf("Expected 4 keys pruned, got %d", resp.Total)
+	}
+	if resp.Pruned[crawlErrorsKeyPrefix] != 2 {
+		t.Errorf("Expected 2 error keys pruned, got %d", resp.Pruned[crawlErrorsKeyPrefix])
+	}
+	if resp.Pruned[robotsBlockedKeyPrefix] != 1 {
+		t.Errorf("Expected 1 robots key pruned, got %d", resp.Pruned[robotsBlockedKeyPrefix])
+	}
+	if resp.Pruned[webhookDeliveriesKeyPrefix] != 1 {
+		t.Errorf("Expected 1 webhook delivery key pruned, got %d", resp.Pruned[webhookDeliveriesKeyPrefix])
+	}
+
+	for _, key := range []string{"crawl:errors:gone1", "crawl:errors:gone2", "crawl:robots:gone1", "webhook:deliveries:gone1"} {
+		if ks.keys[key] {
+			t.Errorf("Expected orphaned key %s to be deleted", key)
+		}
+	}
+	for _, key := range []string{"crawl:job:live", "crawl:errors:live", "crawl:robots:live", "batch:job:other", "webhook:deliveries:live", "webhook:deliveries:other"} {
+		if !ks.keys[key] {
+			t.Errorf("Expected key %s to be kept", key)
+		}
+	}
+}
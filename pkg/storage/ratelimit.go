@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Key prefix for the token buckets limiting incoming API requests
+	rateLimitKeyPrefix = "ratelimit:"
+)
+
+// takeTokenScript refills a token bucket stored as a hash for the time
+// elapsed, by the Redis clock so instances agree, then takes a token if one
+// is available. It returns 1 and 0 when a token was taken, or 0 and the
+// milliseconds until one is available. Idle buckets expire once they would be
+// full again.
+var takeTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local rate = capacity / 60000
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "last", now)
+redis.call("PEXPIRE", KEYS[1], 60000)
+return {allowed, wait}
+`)
+
+// TakeRateLimitToken takes a token from a token bucket shared by every
+// instance using this Redis, which holds perMinute tokens and refills at
+// perMinute tokens a minute. It satisfies ratelimit.TakeFunc.
+func (s *RedisStorage) TakeRateLimitToken(key string, perMinute int) (bool, time.Duration, error) {
+	if perMinute <= 0 {
+		return true, 0, nil
+	}
+
+	result, err := takeTokenScript.Run(s.ctx, s.client, []string{rateLimitKeyPrefix + key}, perMinute).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to take rate limit token from Redis: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
@@ -130,9 +130,12 @@ func (s *RedisStorage) UpdateBatchJob(jobID string, result model.ScrapeResult) e
 	// Update job data
 	job.Completed++
 	job.Data = append(job.Data, result)
+	job.Results = append(job.Results, result.URLStatus())
+	job.TransferStats.Add(result.Metadata)
+	job.CreditUsage.Add(result.Credits())
 
-	// Update status if completed
-	if job.Completed >= job.Total {
+	// Update status if completed; a cancelled job stays cancelled
+	if job.Completed >= job.Total && job.Status != "cancelled" {
 		job.Status = "completed"
 	}
 
@@ -149,6 +152,29 @@ func (s *RedisStorage) UpdateBatchJob(jobID string, result model.ScrapeResult) e
 	return nil
 }
 
+// CancelBatchJob marks a batch job as cancelled, keeping the results
+// collected so far.
+func (s *RedisStorage) CancelBatchJob(jobID string) error {
+	key := batchJobKeyPrefix + jobID
+
+	job, err := s.GetBatchJob(jobID)
+	if err != nil {
+		return err
+	}
+	job.Status = "cancelled"
+
+	jobData, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal updated job data: %w", err)
+	}
+
+	if err := s.client.Set(s.ctx, key, jobData, s.jobExpirationTime).Err(); err != nil {
+		return fmt.Errorf("failed to update job in Redis: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the Redis connection.
 func (s *RedisStorage) Close() error {
 	return s.client.Close()
@@ -57,6 +57,8 @@ func (m *MockRedisStorage) UpdateBatchJob(jobID string, result model.ScrapeResul
 
 	job.Completed++
 	job.Data = append(job.Data, result)
+	job.Results = append(job.Results, result.URLStatus())
+	job.CreditUsage.Add(result.Credits())
 
 	if job.Completed >= job.Total {
 		job.Status = "completed"
@@ -201,6 +203,9 @@ func TestMockRedisStorage_UpdateBatchJob(t *testing.T) {
 	if job.Status != "completed" {
 		t.Errorf("Expected status 'completed', got '%s'", job.Status)
 	}
+	if job.CreditsUsed != 2 {
+		t.Errorf("Expected 2 credits used, got %d", job.CreditsUsed)
+	}
 }
 
 func TestMockRedisStorage_Close(t *testing.T) {
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+const (
+	// Key prefix for schedules
+	scheduleKeyPrefix = "schedule:"
+	// Key of the set of schedule IDs
+	scheduleIndexKey = "schedules"
+	// Key prefix for schedule runs, a list with the newest run first
+	scheduleRunsKeyPrefix = "schedule:runs:"
+	// Number of runs kept per schedule
+	maxScheduleRuns = 100
+)
+
+// SaveSchedule stores a schedule. Schedules don't expire, so they survive
+// restarts until deleted.
+func (s *RedisStorage) SaveSchedule(schedule model.Schedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(s.ctx, scheduleKeyPrefix+schedule.ID, data, 0)
+	pipe.SAdd(s.ctx, scheduleIndexKey, schedule.ID)
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return fmt.Errorf("failed to store schedule in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// GetSchedule retrieves a schedule by ID.
+func (s *RedisStorage) GetSchedule(id string) (*model.Schedule, error) {
+	data, err := s.client.Get(s.ctx, scheduleKeyPrefix+id).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("schedule not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to get schedule from Redis: %w", err)
+	}
+
+	var schedule model.Schedule
+	if err := json.Unmarshal([]byte(data), &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// ListSchedules retrieves every stored schedule.
+func (s *RedisStorage) ListSchedules() ([]model.Schedule, error) {
+	ids, err := s.client.SMembers(s.ctx, scheduleIndexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules in Redis: %w", err)
+	}
+
+	schedules := make([]model.Schedule, 0, len(ids))
+	for _, id := range ids {
+		schedule, err := s.GetSchedule(id)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	return schedules, nil
+}
+
+// AddScheduleRun records a run of a schedule, keeping the most recent
+// maxScheduleRuns runs.
+func (s *RedisStorage) AddScheduleRun(id string, run model.ScheduleRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedule run: %w", err)
+	}
+
+	key := scheduleRunsKeyPrefix + id
+	pipe := s.client.TxPipeline()
+	pipe.LPush(s.ctx, key, data)
+	pipe.LTrim(s.ctx, key, 0, maxScheduleRuns-1)
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return fmt.Errorf("failed to store schedule run in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// GetScheduleRuns retrieves a page of a schedule's runs, newest first. A
+// limit of zero or less returns every run after skip.
+func (s *RedisStorage) GetScheduleRuns(id string, skip, limit int) ([]model.ScheduleRun, error) {
+	start, stop := resultsRange(skip, limit)
+	entries, err := s.client.LRange(s.ctx, scheduleRunsKeyPrefix+id, start, stop).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedule runs from Redis: %w", err)
+	}
+
+	runs := make([]model.ScheduleRun, 0, len(entries))
+	for _, entry := range entries {
+		var run model.ScheduleRun
+		if err := json.Unmarshal([]byte(entry), &run); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal schedule run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
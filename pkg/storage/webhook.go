@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+const (
+	// Key prefix for a job's webhook delivery log, a list with the oldest
+	// attempt first
+	webhookDeliveriesKeyPrefix = "webhook:deliveries:"
+	// Number of attempts kept per job
+	maxWebhookDeliveries = 1000
+)
+
+// RecordWebhookDelivery appends a webhook delivery attempt to a job's log,
+// keeping the most recent maxWebhookDeliveries attempts. The log expires
+// with the job.
+func (s *RedisStorage) RecordWebhookDelivery(jobID string, delivery model.WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook delivery: %w", err)
+	}
+
+	key := webhookDeliveriesKeyPrefix + jobID
+	pipe := s.client.TxPipeline()
+	pipe.RPush(s.ctx, key, data)
+	pipe.LTrim(s.ctx, key, -maxWebhookDeliveries, -1)
+	pipe.Expire(s.ctx, key, s.jobExpirationTime)
+	if _, err := pipe.Exec(s.ctx); err != nil {
+		return fmt.Errorf("failed to store webhook delivery in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// GetWebhookDeliveries retrieves a job's webhook delivery attempts, oldest
+// first.
+func (s *RedisStorage) GetWebhookDeliveries(jobID string) ([]model.WebhookDelivery, error) {
+	entries, err := s.client.LRange(s.ctx, webhookDeliveriesKeyPrefix+jobID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries from Redis: %w", err)
+	}
+
+	deliveries := make([]model.WebhookDelivery, 0, len(entries))
+	for _, entry := range entries {
+		var delivery model.WebhookDelivery
+		if err := json.Unmarshal([]byte(entry), &delivery); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
@@ -17,17 +17,18 @@ func Contains(slice []string, item string) bool {
 	return false
 }
 
-// GetMetaContent extracts meta content from HTML document
+// GetMetaContent extracts meta content from HTML document. It matches meta
+// tags whose name or property is name, or whose property is "og:"+name.
 func GetMetaContent(doc *goquery.Document, name string) string {
 	content := ""
 	doc.Find("meta").Each(func(_ int, s *goquery.Selection) {
-		if n, _ := s.Attr("name"); n == name {
-			content, _ = s.Attr("content")
-		} else if p, _ := s.Attr("property"); p == "og:"+name {
+		n, _ := s.Attr("name")
+		p, _ := s.Attr("property")
+		if strings.EqualFold(n, name) || p == name || p == "og:"+name {
 			content, _ = s.Attr("content")
 		}
 	})
-	return content
+	return strings.TrimSpace(content)
 }
 
 // ExtractMainContent finds the main content section of an HTML document
@@ -47,16 +48,29 @@ func ExtractMainContent(doc *goquery.Document) string {
 	return ""
 }
 
+// MarkdownCleanOptions controls CleanMarkdownWithOptions.
+type MarkdownCleanOptions struct {
+	// DisableTitleDedup keeps a leading title line even when the heading
+	// after it repeats it.
+	DisableTitleDedup bool
+}
+
 // CleanMarkdown improves markdown output by removing redundancies and formatting issues
 func CleanMarkdown(input string) string {
+	return CleanMarkdownWithOptions(input, MarkdownCleanOptions{})
+}
+
+// CleanMarkdownWithOptions cleans markdown like CleanMarkdown, with the
+// title de-duplication optionally turned off.
+func CleanMarkdownWithOptions(input string, opts MarkdownCleanOptions) string {
 	// Remove extra newlines
 	re := regexp.MustCompile(`\n{3,}`)
 	cleaned := re.ReplaceAllString(input, "\n\n")
 
 	// Remove title if it's duplicated in the content
-	lines := strings.Split(cleaned, "\n")
-	if len(lines) > 2 {
-		if strings.HasPrefix(lines[2], "# ") && strings.TrimSpace(lines[0]) == strings.TrimSpace(strings.TrimPrefix(lines[2], "# ")) {
+	if !opts.DisableTitleDedup {
+		lines := strings.Split(cleaned, "\n")
+		if len(lines) > 2 && isDuplicateTitle(lines[0], lines[1], lines[2]) {
 			lines = lines[2:]
 			cleaned = strings.Join(lines, "\n")
 		}
@@ -67,3 +81,31 @@ func CleanMarkdown(input string) string {
 
 	return cleaned
 }
+
+// maxTitleLength is the longest first line treated as a standalone title.
+const maxTitleLength = 120
+
+// isDuplicateTitle reports whether first is a standalone title line that the
+// heading two lines down repeats. Lines that read as body text, such as
+// sentences or markdown blocks, are never treated as titles.
+func isDuplicateTitle(first, blank, heading string) bool {
+	title := strings.TrimSpace(first)
+	if title == "" || len(title) > maxTitleLength || strings.TrimSpace(blank) != "" {
+		return false
+	}
+	if !strings.HasPrefix(heading, "# ") || title != strings.TrimSpace(strings.TrimPrefix(heading, "# ")) {
+		return false
+	}
+
+	// Sentences end with punctuation; titles don't
+	if strings.ContainsAny(title[len(title)-1:], ".!?:;,") {
+		return false
+	}
+	// Headings, lists, quotes, tables, code and links are content
+	for _, prefix := range []string{"#", "-", "*", "+", ">", "|", "`", "["} {
+		if strings.HasPrefix(title, prefix) {
+			return false
+		}
+	}
+	return !strings.Contains(title, "](")
+}
@@ -0,0 +1,47 @@
+package utils
+
+import "testing"
+
+func TestCleanMarkdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  MarkdownCleanOptions
+		want  string
+	}{
+		{
+			name:  "Duplicated title stripped",
+			input: "Release Notes\n\n# Release Notes\n\nVersion 2 is out.",
+			want:  "# Release Notes\n\nVersion 2 is out.",
+		},
+		{
+			name:  "Body sentence matching the heading kept",
+			input: "Pricing starts at five dollars.\n\n# Pricing starts at five dollars.\n\nSee the table below.",
+			want:  "Pricing starts at five dollars.\n\n# Pricing starts at five dollars.\n\nSee the table below.",
+		},
+		{
+			name:  "List item matching the heading kept",
+			input: "- Overview\n\n# - Overview\n\nText.",
+			want:  "- Overview\n\n# - Overview\n\nText.",
+		},
+		{
+			name:  "Duplicated title kept when dedup is disabled",
+			input: "Release Notes\n\n# Release Notes\n\nVersion 2 is out.",
+			opts:  MarkdownCleanOptions{DisableTitleDedup: true},
+			want:  "Release Notes\n\n# Release Notes\n\nVersion 2 is out.",
+		},
+		{
+			name:  "Extra newlines collapsed",
+			input: "First\n\n\n\nSecond",
+			want:  "First\n\nSecond",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CleanMarkdownWithOptions(tt.input, tt.opts); got != tt.want {
+				t.Errorf("CleanMarkdownWithOptions() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
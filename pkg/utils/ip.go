@@ -0,0 +1,29 @@
+package utils
+
+import "net/netip"
+
+// nonPublicPrefixes are ranges outside the public internet that IsPublicAddr
+// refuses besides loopback, link-local and private addresses: carrier-grade
+// NAT, the IETF protocol assignments and the benchmarking range.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// IsPublicAddr reports whether addr is reachable on the public internet.
+// Loopback, private, link-local (which holds cloud metadata services such as
+// 169.254.169.254), unspecified and multicast addresses are not.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
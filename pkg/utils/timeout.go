@@ -0,0 +1,23 @@
+package utils
+
+import "fmt"
+
+// ResolveTimeout picks the timeout in milliseconds for a request, falling back
+// to the default when none was requested and clamping to maxMS when it is set.
+// A non-empty warning is returned when the requested timeout was clamped.
+func ResolveTimeout(requestedMS, defaultMS, maxMS int) (int, string) {
+	timeout := requestedMS
+	if timeout <= 0 {
+		timeout = defaultMS
+	}
+
+	if maxMS <= 0 || timeout <= maxMS {
+		return timeout, ""
+	}
+
+	// Only warn when the caller asked for more than is allowed
+	if requestedMS > maxMS {
+		return maxMS, fmt.Sprintf("requested timeout of %dms exceeds the maximum of %dms and was clamped", requestedMS, maxMS)
+	}
+	return maxMS, ""
+}
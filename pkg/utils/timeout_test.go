@@ -0,0 +1,32 @@
+package utils
+
+import "testing"
+
+func TestResolveTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		requested   int
+		defaultMS   int
+		maxMS       int
+		want        int
+		wantWarning bool
+	}{
+		{name: "Default when not requested", requested: 0, defaultMS: 30000, maxMS: 60000, want: 30000},
+		{name: "Requested within ceiling", requested: 45000, defaultMS: 30000, maxMS: 60000, want: 45000},
+		{name: "Requested above ceiling", requested: 90000, defaultMS: 30000, maxMS: 60000, want: 60000, wantWarning: true},
+		{name: "Default above ceiling", requested: 0, defaultMS: 30000, maxMS: 10000, want: 10000},
+		{name: "No ceiling", requested: 900000, defaultMS: 30000, maxMS: 0, want: 900000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warning := ResolveTimeout(tt.requested, tt.defaultMS, tt.maxMS)
+			if got != tt.want {
+				t.Errorf("ResolveTimeout() = %v, want %v", got, tt.want)
+			}
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("ResolveTimeout() warning = %q, wantWarning %v", warning, tt.wantWarning)
+			}
+		})
+	}
+}
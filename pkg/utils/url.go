@@ -55,6 +55,26 @@ func ExtractDomain(rawURL string) string {
 	return u.Hostname()
 }
 
+// IsInternalHost reports whether host, as found in a URL, belongs to the same
+// site as baseHost: it is the same host, or its hostname is one of
+// internalHosts. Hostnames compare case-insensitively.
+func IsInternalHost(host, baseHost string, internalHosts []string) bool {
+	if strings.EqualFold(host, baseHost) {
+		return true
+	}
+
+	hostname := host
+	if u, err := url.Parse("//" + host); err == nil {
+		hostname = u.Hostname()
+	}
+	for _, internal := range internalHosts {
+		if strings.EqualFold(hostname, strings.TrimSpace(internal)) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsRelativeURL checks if a URL is relative.
 func IsRelativeURL(rawURL string) bool {
 	return !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://")
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"net/netip"
 	"testing"
 )
 
@@ -130,6 +131,52 @@ func TestExtractDomain(t *testing.T) {
 	}
 }
 
+func TestIsInternalHost(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		internalHosts []string
+		want          bool
+	}{
+		{
+			name: "Same host",
+			host: "example.com",
+			want: true,
+		},
+		{
+			name: "Other host",
+			host: "cdn.example.net",
+			want: false,
+		},
+		{
+			name:          "Configured host",
+			host:          "cdn.example.net",
+			internalHosts: []string{"cdn.example.net"},
+			want:          true,
+		},
+		{
+			name:          "Configured host with port and different case",
+			host:          "CDN.example.net:8443",
+			internalHosts: []string{"cdn.example.net"},
+			want:          true,
+		},
+		{
+			name:          "Unlisted host",
+			host:          "other.org",
+			internalHosts: []string{"cdn.example.net"},
+			want:          false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsInternalHost(tt.host, "example.com", tt.internalHosts); got != tt.want {
+				t.Errorf("IsInternalHost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestIsRelativeURL(t *testing.T) {
 	tests := []struct {
 		name string
@@ -228,3 +275,32 @@ func TestIsValidEmail(t *testing.T) {
 		})
 	}
 }
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "::1", want: false},
+		{addr: "10.1.2.3", want: false},
+		{addr: "172.16.0.1", want: false},
+		{addr: "192.168.1.1", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "fd00:ec2::254", want: false},
+		{addr: "fe80::1", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "0.0.0.0", want: false},
+		{addr: "::ffff:127.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
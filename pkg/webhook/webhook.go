@@ -0,0 +1,396 @@
+// Package webhook delivers job notifications to caller-supplied URLs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+	"github.com/ncecere/rummage/pkg/utils"
+)
+
+// deliveryTimeout bounds a single webhook delivery.
+const deliveryTimeout = 10 * time.Second
+
+// maxAttempts is how many times a delivery is tried before giving up.
+const maxAttempts = 3
+
+// SignatureHeader carries the HMAC-SHA256 of the payload, as
+// "sha256=<hex>", when a signing secret is configured.
+const SignatureHeader = "X-Rummage-Signature"
+
+// ErrPrivateDestination is returned for webhooks that resolve to a loopback,
+// private or link-local address, which would let callers probe the network
+// the server runs in.
+var ErrPrivateDestination = errors.New("webhook URL must not resolve to a loopback, private or link-local address")
+
+// allowPrivate lets deliveries reach private networks; see
+// AllowPrivateNetworks.
+var allowPrivate atomic.Bool
+
+// AllowPrivateNetworks lets webhooks be delivered to loopback, private and
+// link-local addresses, such as a receiver on the same host during local
+// development. They are refused by default.
+func AllowPrivateNetworks(allow bool) {
+	allowPrivate.Store(allow)
+}
+
+// client sends webhook deliveries. Its dialer checks every address it
+// connects to, redirects included, so a name that resolves differently on
+// delivery than when it was checked is still refused. Deliveries don't go
+// through an environment proxy, which would hide their destination.
+var client = &http.Client{
+	Timeout: deliveryTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: deliveryTimeout,
+			Control: guardDial,
+		}).DialContext,
+		ForceAttemptHTTP2:   true,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: deliveryTimeout,
+	},
+}
+
+// guardDial refuses connections to addresses off the public internet unless
+// private networks are allowed.
+func guardDial(network, address string, _ syscall.RawConn) error {
+	if allowPrivate.Load() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !utils.IsPublicAddr(addr) {
+		return ErrPrivateDestination
+	}
+	return nil
+}
+
+// CheckDestination resolves the webhook URL's host and reports
+// ErrPrivateDestination when any of its addresses is off the public
+// internet, so a webhook can be refused before anything is sent to it.
+func CheckDestination(ctx context.Context, rawURL string) error {
+	if allowPrivate.Load() {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %q", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !utils.IsPublicAddr(addr) {
+			return ErrPrivateDestination
+		}
+	}
+	return nil
+}
+
+// Recorder logs each delivery attempt for the job that reported the event.
+type Recorder func(jobID string, attempt model.WebhookDelivery)
+
+// retryDelay is the wait before the second attempt; it doubles after each
+// failed attempt.
+var retryDelay = time.Second
+
+// Deliver sends a lifecycle event for a job to its webhook, if it has one
+// and subscribes to the event. The payload's type is set to "<job>.<event>"
+// and the webhook's metadata is echoed in it. Each attempt is passed to
+// record, if set, under the payload's job ID.
+func Deliver(ctx context.Context, cfg *model.WebhookConfig, secret, job, event string, payload model.WebhookEvent, record Recorder) error {
+	if cfg == nil || cfg.URL == "" || !cfg.Wants(event) {
+		return nil
+	}
+
+	payload.Type = job + "." + event
+	payload.Metadata = cfg.Metadata
+	return send(ctx, *cfg, secret, payload, record)
+}
+
+// Send posts the event to the webhook as JSON. The webhook's configured
+// headers and any headers forwarded from the original request are sent with
+// it; forwarded headers are also echoed in the payload. The body is signed
+// with secret, if set, and non-2xx responses are retried.
+func Send(ctx context.Context, cfg model.WebhookConfig, secret string, event model.WebhookEvent) error {
+	return send(ctx, cfg, secret, event, nil)
+}
+
+// send posts the event like Send, passing each attempt to record, if set.
+func send(ctx context.Context, cfg model.WebhookConfig, secret string, event model.WebhookEvent, record Recorder) error {
+	if len(cfg.ForwardedHeaders) > 0 {
+		event.Headers = cfg.ForwardedHeaders
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	delay := retryDelay
+	for attempt := 1; ; attempt++ {
+		var status int
+		status, err = post(ctx, cfg, secret, body)
+		if record != nil {
+			delivery := model.WebhookDelivery{
+				Type:       event.Type,
+				Attempt:    attempt,
+				Timestamp:  time.Now().Format(time.RFC3339),
+				StatusCode: status,
+			}
+			if err != nil {
+				delivery.Error = err.Error()
+			}
+			record(event.ID, delivery)
+		}
+		if err == nil || attempt == maxAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// Test sends a sample event to the webhook once, without retrying, signed and
+// with headers as a real delivery would be, and reports how it went.
+func Test(ctx context.Context, cfg model.WebhookConfig, secret string) model.WebhookTestResponse {
+	event := model.WebhookEvent{
+		Type:     model.WebhookEventTest,
+		ID:       "test",
+		Metadata: cfg.Metadata,
+		Headers:  cfg.ForwardedHeaders,
+	}
+
+	var resp model.WebhookTestResponse
+	body, err := json.Marshal(event)
+	if err != nil {
+		resp.Error = fmt.Sprintf("failed to encode webhook payload: %v", err)
+		return resp
+	}
+
+	start := time.Now()
+	resp.StatusCode, err = post(ctx, cfg, secret, body)
+	resp.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.Delivered = true
+	return resp
+}
+
+// post makes a single delivery attempt, returning the response status when
+// the webhook answered.
+func post(ctx context.Context, cfg model.WebhookConfig, secret string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range cfg.ForwardedHeaders {
+		req.Header.Set(key, value)
+	}
+	if secret != "" {
+		req.Header.Set(SignatureHeader, Sign(secret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature header value for body: "sha256=" followed by
+// the hex HMAC-SHA256 of body keyed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queueSize is how many events a Notifier holds for one destination. Events
+// reported while it is full are dropped and recorded as failed deliveries.
+var queueSize = 256
+
+// ErrQueueFull is recorded for events dropped because their webhook's queue
+// was full.
+var ErrQueueFull = errors.New("webhook queue is full; event dropped")
+
+// ErrNotifierClosed is recorded for events reported after the notifier was
+// closed.
+var ErrNotifierClosed = errors.New("webhook notifier is closed; event dropped")
+
+// Notifier delivers lifecycle events in the background, so a slow webhook
+// doesn't stall the job reporting them. Each destination URL has its own
+// queue and worker, so events reach it in the order they were reported and a
+// slow endpoint only delays its own events. A worker exits once its queue is
+// empty, so an idle notifier holds no goroutines.
+type Notifier struct {
+	secret string
+	record Recorder
+
+	// ctx bounds deliveries; it is cancelled when Close gives up draining
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	queues  map[string]chan delivery
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// delivery is a queued lifecycle event.
+type delivery struct {
+	cfg     model.WebhookConfig
+	job     string
+	event   string
+	payload model.WebhookEvent
+}
+
+// NewNotifier creates a notifier that signs payloads with secret, if set.
+func NewNotifier(secret string) *Notifier {
+	return NewRecordingNotifier(secret, nil)
+}
+
+// NewRecordingNotifier creates a notifier like NewNotifier that also passes
+// each delivery attempt to record.
+func NewRecordingNotifier(secret string, record Recorder) *Notifier {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Notifier{
+		secret: secret,
+		record: record,
+		ctx:    ctx,
+		cancel: cancel,
+		queues: make(map[string]chan delivery),
+	}
+}
+
+// Notify queues a lifecycle event for a job's webhook and returns without
+// waiting for delivery. Events the webhook doesn't subscribe to are ignored;
+// events that can't be queued are dropped and recorded. Delivery failures
+// don't affect the job.
+func (n *Notifier) Notify(cfg *model.WebhookConfig, job, event string, payload model.WebhookEvent) {
+	if cfg == nil || cfg.URL == "" || !cfg.Wants(event) {
+		return
+	}
+	d := delivery{cfg: *cfg, job: job, event: event, payload: payload}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		n.drop(d, ErrNotifierClosed)
+		return
+	}
+
+	queue, ok := n.queues[cfg.URL]
+	if !ok {
+		queue = make(chan delivery, queueSize)
+		n.queues[cfg.URL] = queue
+		n.workers.Add(1)
+		go n.run(cfg.URL, queue)
+	}
+
+	select {
+	case queue <- d:
+	default:
+		n.drop(d, ErrQueueFull)
+	}
+}
+
+// Close stops accepting events and waits for those queued to be delivered.
+// When ctx is done first, deliveries still running are cancelled, the rest
+// are abandoned and ctx's error is returned.
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		n.workers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		return ctx.Err()
+	}
+}
+
+// run delivers a destination's queued events one at a time, exiting once the
+// queue is empty.
+func (n *Notifier) run(destination string, queue chan delivery) {
+	defer n.workers.Done()
+	for {
+		n.mu.Lock()
+		select {
+		case d := <-queue:
+			n.mu.Unlock()
+			n.deliver(d)
+		default:
+			// Nothing can be queued while the lock is held, so no event is
+			// left behind
+			delete(n.queues, destination)
+			n.mu.Unlock()
+			return
+		}
+	}
+}
+
+// deliver sends a single queued event.
+func (n *Notifier) deliver(d delivery) {
+	_ = Deliver(n.ctx, &d.cfg, n.secret, d.job, d.event, d.payload, n.record)
+}
+
+// drop records an event that won't be delivered.
+func (n *Notifier) drop(d delivery, reason error) {
+	log.Printf("Dropping %s.%s webhook for job %s: %v", d.job, d.event, d.payload.ID, reason)
+	if n.record != nil {
+		n.record(d.payload.ID, model.WebhookDelivery{
+			Type:      d.job + "." + d.event,
+			Timestamp: time.Now().Format(time.RFC3339),
+			Error:     reason.Error(),
+		})
+	}
+}
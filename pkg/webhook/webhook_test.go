@@ -0,0 +1,355 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ncecere/rummage/pkg/model"
+)
+
+func TestMain(m *testing.M) {
+	// The stub receivers listen on loopback
+	AllowPrivateNetworks(true)
+	os.Exit(m.Run())
+}
+
+func TestSendSignsPayload(t *testing.T) {
+	var signature string
+	var body []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(SignatureHeader)
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer hook.Close()
+
+	err := Send(context.Background(), model.WebhookConfig{URL: hook.URL}, "s3cret", model.WebhookEvent{ID: "job-1"})
+	if err != nil {
+		t.Fatalf("Failed to send webhook: %v", err)
+	}
+
+	if signature == "" || signature != Sign("s3cret", body) {
+		t.Errorf("Expected the payload to be signed, got %q", signature)
+	}
+	if Sign("other", body) == signature {
+		t.Error("Expected the signature to depend on the secret")
+	}
+}
+
+func TestSendRetriesNon2xx(t *testing.T) {
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = time.Second }()
+
+	var attempts int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < maxAttempts {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hook.Close()
+
+	if err := Send(context.Background(), model.WebhookConfig{URL: hook.URL}, "", model.WebhookEvent{}); err != nil {
+		t.Fatalf("Expected the delivery to succeed after retries: %v", err)
+	}
+	if attempts != maxAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxAttempts, attempts)
+	}
+}
+
+func TestSendGivesUp(t *testing.T) {
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = time.Second }()
+
+	var attempts int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusMovedPermanently)
+	}))
+	defer hook.Close()
+
+	if err := Send(context.Background(), model.WebhookConfig{URL: hook.URL}, "", model.WebhookEvent{}); err == nil {
+		t.Error("Expected an error when every attempt fails")
+	}
+	if attempts != maxAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxAttempts, attempts)
+	}
+}
+
+func TestDeliverFiltersEvents(t *testing.T) {
+	var types []string
+	var metadata map[string]interface{}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event model.WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook payload: %v", err)
+		}
+		types = append(types, event.Type)
+		metadata = event.Metadata
+	}))
+	defer hook.Close()
+
+	cfg := &model.WebhookConfig{
+		URL:      hook.URL,
+		Events:   []string{model.WebhookStarted, model.WebhookFailed},
+		Metadata: map[string]interface{}{"tenant": "acme"},
+	}
+	for _, event := range []string{model.WebhookStarted, model.WebhookPage, model.WebhookCompleted, model.WebhookFailed} {
+		if err := Deliver(context.Background(), cfg, "", model.WebhookJobCrawl, event, model.WebhookEvent{ID: "job-1"}, nil); err != nil {
+			t.Fatalf("Failed to deliver %s: %v", event, err)
+		}
+	}
+
+	if len(types) != 2 || types[0] != "crawl.started" || types[1] != "crawl.failed" {
+		t.Errorf("Expected only the subscribed events, got %v", types)
+	}
+	if metadata["tenant"] != "acme" {
+		t.Errorf("Expected the metadata to be echoed, got %v", metadata)
+	}
+
+	// Without events, only completed is delivered
+	types = nil
+	cfg.Events = nil
+	_ = Deliver(context.Background(), cfg, "", model.WebhookJobBatch, model.WebhookStarted, model.WebhookEvent{}, nil)
+	_ = Deliver(context.Background(), cfg, "", model.WebhookJobBatch, model.WebhookCompleted, model.WebhookEvent{}, nil)
+	if len(types) != 1 || types[0] != model.WebhookEventBatchCompleted {
+		t.Errorf("Expected only the completed event by default, got %v", types)
+	}
+}
+
+func TestNotifierDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	received := make(chan string, 3)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		var event model.WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode webhook payload: %v", err)
+		}
+		received <- event.Type
+	}))
+	defer hook.Close()
+	defer close(release)
+
+	cfg := &model.WebhookConfig{URL: hook.URL, Events: []string{model.WebhookStarted, model.WebhookCompleted}}
+	n := NewNotifier("")
+
+	// The webhook is stalled, yet reporting returns at once
+	start := time.Now()
+	n.Notify(cfg, model.WebhookJobCrawl, model.WebhookStarted, model.WebhookEvent{ID: "job-1"})
+	n.Notify(cfg, model.WebhookJobCrawl, model.WebhookPage, model.WebhookEvent{ID: "job-1"})
+	n.Notify(cfg, model.WebhookJobCrawl, model.WebhookCompleted, model.WebhookEvent{ID: "job-1"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected Notify not to wait for delivery, took %v", elapsed)
+	}
+
+	release <- struct{}{}
+	release <- struct{}{}
+	for _, want := range []string{"crawl.started", "crawl.completed"} {
+		select {
+		case got := <-received:
+			if got != want {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %s to be delivered", want)
+		}
+	}
+}
+
+func TestDeliverRecordsAttempts(t *testing.T) {
+	retryDelay = time.Millisecond
+	defer func() { retryDelay = time.Second }()
+
+	var calls int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer hook.Close()
+
+	var jobs []string
+	var attempts []model.WebhookDelivery
+	record := func(jobID string, attempt model.WebhookDelivery) {
+		jobs = append(jobs, jobID)
+		attempts = append(attempts, attempt)
+	}
+
+	cfg := &model.WebhookConfig{URL: hook.URL}
+	if err := Deliver(context.Background(), cfg, "", model.WebhookJobBatch, model.WebhookCompleted, model.WebhookEvent{ID: "job-1"}, record); err != nil {
+		t.Fatalf("Failed to deliver webhook: %v", err)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("Expected 2 attempts logged, got %d", len(attempts))
+	}
+	for _, job := range jobs {
+		if job != "job-1" {
+			t.Errorf("Expected attempts logged for job-1, got %q", job)
+		}
+	}
+
+	failed, delivered := attempts[0], attempts[1]
+	if failed.Attempt != 1 || failed.StatusCode != http.StatusBadGateway || failed.Error == "" {
+		t.Errorf("Expected the failed first attempt logged with its status and error, got %+v", failed)
+	}
+	if delivered.Attempt != 2 || delivered.StatusCode != http.StatusOK || delivered.Error != "" {
+		t.Errorf("Expected the successful second attempt logged, got %+v", delivered)
+	}
+	for _, attempt := range attempts {
+		if attempt.Type != model.WebhookJobBatch+"."+model.WebhookCompleted {
+			t.Errorf("Expected the event type logged, got %q", attempt.Type)
+		}
+		if _, err := time.Parse(time.RFC3339, attempt.Timestamp); err != nil {
+			t.Errorf("Expected an RFC 3339 timestamp, got %q", attempt.Timestamp)
+		}
+	}
+
+	// A webhook that never answers is logged without a status
+	attempts = nil
+	cfg.URL = "http://127.0.0.1:1"
+	_ = Deliver(context.Background(), cfg, "", model.WebhookJobBatch, model.WebhookCompleted, model.WebhookEvent{ID: "job-1"}, record)
+	if len(attempts) != maxAttempts {
+		t.Fatalf("Expected %d attempts logged, got %d", maxAttempts, len(attempts))
+	}
+	if attempts[0].StatusCode != 0 || attempts[0].Error == "" {
+		t.Errorf("Expected an unanswered attempt logged with its error, got %+v", attempts[0])
+	}
+}
+
+func TestSendRefusesPrivateDestination(t *testing.T) {
+	AllowPrivateNetworks(false)
+	defer AllowPrivateNetworks(true)
+
+	var received bool
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer hook.Close()
+
+	result := Test(context.Background(), model.WebhookConfig{URL: hook.URL}, "")
+	if result.Delivered || !strings.Contains(result.Error, ErrPrivateDestination.Error()) {
+		t.Errorf("Expected the loopback delivery to be refused, got %+v", result)
+	}
+	if received {
+		t.Error("Expected nothing to be sent to a loopback receiver")
+	}
+	if err := CheckDestination(context.Background(), "http://169.254.169.254/"); !errors.Is(err, ErrPrivateDestination) {
+		t.Errorf("Expected the metadata address to be refused, got %v", err)
+	}
+}
+
+func TestNotifierDestinationsIndependent(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	received := make(chan struct{}, 1)
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer fast.Close()
+
+	n := NewNotifier("")
+	n.Notify(&model.WebhookConfig{URL: slow.URL}, model.WebhookJobCrawl, model.WebhookCompleted, model.WebhookEvent{ID: "job-1"})
+	n.Notify(&model.WebhookConfig{URL: fast.URL}, model.WebhookJobCrawl, model.WebhookCompleted, model.WebhookEvent{ID: "job-2"})
+
+	// The stalled webhook doesn't hold up another job's
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the second webhook to be delivered while the first stalls")
+	}
+}
+
+func TestNotifierDropsWhenFull(t *testing.T) {
+	queueSize = 1
+	defer func() { queueSize = 256 }()
+
+	release := make(chan struct{})
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer hook.Close()
+
+	var mu sync.Mutex
+	var dropped []model.WebhookDelivery
+	n := NewRecordingNotifier("", func(jobID string, attempt model.WebhookDelivery) {
+		mu.Lock()
+		defer mu.Unlock()
+		if attempt.Error == ErrQueueFull.Error() {
+			dropped = append(dropped, attempt)
+		}
+	})
+	cfg := &model.WebhookConfig{URL: hook.URL, Events: []string{model.WebhookPage}}
+
+	// One event is being delivered and one queued; later ones are dropped
+	n.Notify(cfg, model.WebhookJobCrawl, model.WebhookPage, model.WebhookEvent{ID: "job-1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n.mu.Lock()
+		pending := len(n.queues[hook.URL])
+		n.mu.Unlock()
+		if pending == 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		n.Notify(cfg, model.WebhookJobCrawl, model.WebhookPage, model.WebhookEvent{ID: "job-1"})
+	}
+	close(release)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(dropped) != 2 {
+		t.Errorf("Expected 2 events dropped and recorded, got %d", len(dropped))
+	}
+}
+
+func TestNotifierCloseDrains(t *testing.T) {
+	var delivered atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		delivered.Add(1)
+	}))
+	defer hook.Close()
+
+	n := NewNotifier("")
+	cfg := &model.WebhookConfig{URL: hook.URL, Events: []string{model.WebhookPage}}
+	for i := 0; i < 5; i++ {
+		n.Notify(cfg, model.WebhookJobCrawl, model.WebhookPage, model.WebhookEvent{ID: "job-1"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := delivered.Load(); got != 5 {
+		t.Errorf("Expected every queued event delivered before Close returned, got %d", got)
+	}
+
+	// Events after Close are dropped
+	n.Notify(cfg, model.WebhookJobCrawl, model.WebhookPage, model.WebhookEvent{ID: "job-1"})
+	time.Sleep(20 * time.Millisecond)
+	if got := delivered.Load(); got != 5 {
+		t.Errorf("Expected no delivery after Close, got %d", got)
+	}
+}